@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// CameraMode is how the view frames the world (cycled with BindCamera).
+type CameraMode int
+
+const (
+	CameraFixed  CameraMode = iota // The whole track fitted to the window, north up (see fitView)
+	CameraFollow                   // Centered on the car, north up
+	CameraRotate                   // Behind the car with its heading pointing up, the track turning beneath it
+	cameraModeCount
+)
+
+var cameraModeNames = [...]string{"Fixed", "Follow", "Rotate"}
+
+func (m CameraMode) String() string { return cameraModeNames[m] }
+
+// Following cameras
+const (
+	CameraScale     = 4.0  // Screen pixels per world pixel, at zoom 1
+	CameraLookAhead = 0.25 // Rotate: how far below the window's center the car sits (fraction of its height), to see more of the road ahead
+
+	// Zoom (BindZoomIn/BindZoomOut or the mouse wheel), as a factor on CameraScale
+	CameraZoomStep = 1.25 // Per key press or wheel notch
+	CameraZoomMin  = 0.25
+	CameraZoomMax  = 8.0
+)
+
+// view is the world -> screen transform of the current camera, for a target of the given size.
+// HUD and labels are drawn in screen space afterwards, so they stay upright in every mode.
+func (g *Game) view(width, height int) ebiten.GeoM {
+	var v ebiten.GeoM
+	if g.Camera == CameraFixed || g.Car == nil {
+		v.Scale(float64(g.ViewScale), float64(g.ViewScale))
+		v.Translate(float64(g.ViewOffsetX), float64(g.ViewOffsetY))
+		return v
+	}
+
+	// Car to the origin, turned so its heading points up the screen (-Y), zoomed, then placed
+	v.Translate(-g.Car.Position.X, -g.Car.Position.Y)
+	lookAhead := 0.0
+	if g.Camera == CameraRotate {
+		v.Rotate(-math.Pi/2 - g.Car.Heading)
+		lookAhead = CameraLookAhead
+	}
+	scale := float64(g.viewScale())
+	v.Scale(scale, scale)
+	v.Translate(float64(width)/2, float64(height)*(0.5+lookAhead))
+	return v
+}
+
+// viewScale is how many screen pixels one world pixel spans in the current camera.
+func (g *Game) viewScale() float32 {
+	if g.Camera == CameraFixed || g.Car == nil {
+		return g.ViewScale
+	}
+	return float32(CameraScale * g.zoom())
+}
+
+// zoom is the following cameras' zoom factor (1 until it's been zoomed).
+func (g *Game) zoom() float64 {
+	if g.Zoom == 0 {
+		return 1
+	}
+	return g.Zoom
+}
+
+// zoomBy multiplies the zoom by factor, within CameraZoomMin..CameraZoomMax. The fixed
+// camera always fits the whole track, so zooming from it switches to following the car.
+func (g *Game) zoomBy(factor float64) {
+	if g.Camera == CameraFixed {
+		g.Camera = CameraFollow
+	}
+	g.Zoom = min(max(g.zoom()*factor, CameraZoomMin), CameraZoomMax)
+}
+
+// handleWheel zooms by a CameraZoomStep per notch the mouse wheel turned this frame.
+func (g *Game) handleWheel() {
+	if _, dy := ebiten.Wheel(); dy != 0 {
+		g.zoomBy(math.Pow(CameraZoomStep, dy))
+	}
+}
+
+// cycleCamera switches to the next camera mode.
+func (g *Game) cycleCamera() {
+	g.Camera = (g.Camera + 1) % cameraModeCount
+}
+
+// screenToWorld converts a screen pixel (e.g. the cursor) to world coordinates,
+// inverting the camera transform used by Draw.
+func (g *Game) screenToWorld(sx, sy int) common.Vec2 {
+	v := g.view(WindowWidth, WindowHeight)
+	v.Invert()
+	x, y := v.Apply(float64(sx), float64(sy))
+	return common.Vec2{X: x, Y: y}
+}
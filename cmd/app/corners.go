@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"racing-line-mapper/internal/physics"
+	"racing-line-mapper/internal/track"
+)
+
+// writeCornerGuide writes the mesh's corner guide (see track.CornerGuide) for the car
+// to path, as JSON if it ends in .json and as CSV otherwise.
+func writeCornerGuide(mesh *track.TrackMesh, car physics.CarParams, path string) error {
+	corners := mesh.CornerGuide(car.TurnSpeed, car.MaxSpeed, car.Deceleration())
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	write := track.WriteCornersCSV
+	if filepath.Ext(path) == ".json" {
+		write = track.WriteCornersJSON
+	}
+	if err := write(f, corners); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"racing-line-mapper/internal/agent"
+	"racing-line-mapper/internal/physics"
+)
+
+// Policy evaluation (E, or -eval N to evaluate the saved session and exit): the greedy
+// policy drives clean laps headlessly, without learning (see agent.Evaluate)
+const (
+	EvalLaps        = 20                 // Clean laps to average over
+	EvalResultsPath = "eval_results.csv" // Results are appended here, keyed by config hash ("" = don't save)
+)
+
+// evalConfig is everything besides the learned values that an evaluation's results
+// depend on; its hash keys the rows of the results file.
+type evalConfig struct {
+	Track        string
+	AgentKind    string
+	Rewards      agent.RewardConfig
+	Alpha, Gamma float64
+	Exploration  agent.Exploration
+	MaskActions  bool
+	Confidence   bool
+	CarModel     physics.PhysicsModel
+	CarParams    physics.CarParams
+}
+
+func (g *Game) evalConfig() evalConfig {
+	return evalConfig{
+		Track:       g.TrackPath,
+		AgentKind:   g.AgentKind,
+		Rewards:     g.AgentConfig.Rewards,
+		Alpha:       g.AgentConfig.Alpha,
+		Gamma:       g.AgentConfig.Gamma,
+		Exploration: g.AgentConfig.Exploration,
+		MaskActions: g.AgentConfig.MaskActions,
+		Confidence:  ConfidenceExploration,
+		CarModel:    g.CarModel,
+		CarParams:   g.CarParams,
+	}
+}
+
+// evaluate runs the agent's greedy policy for n clean laps, logs the statistics and,
+// if resultsPath is set, appends them there.
+func (g *Game) evaluate(n int, resultsPath string) {
+	opts := agent.DefaultEvalOptions(n)
+	opts.MaskActions = g.AgentConfig.MaskActions
+	opts.CarModel = g.CarModel
+	opts.CarParams = g.CarParams
+	opts.Stop = g.Interrupt.Received
+	res := agent.EvaluateWith(g.Agent, g.Grid, g.Mesh, n, opts)
+	log.Printf("Evaluation: %s", res)
+
+	if resultsPath == "" || res.Interrupted { // A partial run would skew the results file
+		return
+	}
+	hash := agent.ConfigHash(g.evalConfig())
+	if err := res.AppendCSV(resultsPath, hash); err != nil {
+		log.Printf("Saving evaluation results: %v", err)
+		return
+	}
+	log.Printf("Evaluation results appended to %s (config %s)", resultsPath, hash)
+}
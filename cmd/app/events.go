@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"racing-line-mapper/internal/physics"
+)
+
+// EventKind identifies a training event.
+type EventKind int
+
+const (
+	EventEpisodeStart EventKind = iota
+	EventEpisodeEnd
+	EventLap     // Lap completed
+	EventBestLap // Lap completed and it beat the best time (follows its EventLap)
+	EventCrash
+	EventEpsilon // Exploration rate dropped below the next of EpsilonMilestones
+)
+
+var eventKindNames = [...]string{"EpisodeStart", "EpisodeEnd", "Lap", "BestLap", "Crash", "Epsilon"}
+
+func (k EventKind) String() string {
+	if k < 0 || int(k) >= len(eventKindNames) {
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+	return eventKindNames[k]
+}
+
+// EpsilonMilestones are the exploration rates that trigger an EventEpsilon, in decreasing order.
+var EpsilonMilestones = []float64{0.5, 0.2, 0.1, 0.05, 0.01}
+
+// Event is one structured training event. Fields that don't apply to the kind are zero.
+type Event struct {
+	Kind    EventKind
+	Episode int
+	Ticks   int // Ticks into the episode
+
+	LapTime int                // EventLap, EventBestLap: lap time in ticks
+	Crash   *physics.CrashInfo // EventCrash: what was hit and where
+	Reason  string             // EventEpisodeEnd: "crash", "timeout" or "finish" (the end of a point-to-point track)
+	Epsilon float64            // EventEpsilon: the milestone crossed
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case EventLap, EventBestLap:
+		return fmt.Sprintf("[EPISODE %d] %s %d ticks", e.Episode, e.Kind, e.LapTime)
+	case EventCrash:
+		return fmt.Sprintf("[EPISODE %d] %s %s", e.Episode, e.Kind, e.Crash)
+	case EventEpisodeEnd:
+		return fmt.Sprintf("[EPISODE %d] %s after %d ticks (%s)", e.Episode, e.Kind, e.Ticks, e.Reason)
+	case EventEpsilon:
+		return fmt.Sprintf("[EPISODE %d] %s < %g", e.Episode, e.Kind, e.Epsilon)
+	default:
+		return fmt.Sprintf("[EPISODE %d] %s", e.Episode, e.Kind)
+	}
+}
+
+// ChanObserver adapts a channel to Game.OnEvent. Sends never block the simulation:
+// events are dropped while the channel is full.
+func ChanObserver(ch chan<- Event) func(Event) {
+	return func(e Event) {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// emit delivers an event to the subscriber, if any.
+// Callers building anything costly for an event should check g.OnEvent first.
+func (g *Game) emit(e Event) {
+	if g.OnEvent == nil {
+		return
+	}
+	e.Episode, e.Ticks = g.Episode, g.EpisodeTicks
+	g.OnEvent(e)
+}
+
+// checkEpsilon emits an EventEpsilon for each milestone the agent's exploration rate has dropped below.
+func (g *Game) checkEpsilon() {
+	eps := g.Agent.Epsilon()
+	for g.epsilonMilestone < len(EpsilonMilestones) && eps < EpsilonMilestones[g.epsilonMilestone] {
+		g.emit(Event{Kind: EventEpsilon, Epsilon: EpsilonMilestones[g.epsilonMilestone]})
+		g.epsilonMilestone++
+	}
+}
+
+// skipEpsilonMilestones marks the milestones the agent is already below as reported,
+// e.g. after a session restores a decayed exploration rate.
+func (g *Game) skipEpsilonMilestones() {
+	eps := g.Agent.Epsilon()
+	g.epsilonMilestone = 0
+	for g.epsilonMilestone < len(EpsilonMilestones) && eps < EpsilonMilestones[g.epsilonMilestone] {
+		g.epsilonMilestone++
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// captureImage copies an ebiten image's pixels back to the CPU.
+func captureImage(img *ebiten.Image) *image.RGBA {
+	b := img.Bounds()
+	rgba := image.NewRGBA(b)
+	img.ReadPixels(rgba.Pix)
+	return rgba
+}
+
+// writePNG encodes img to path.
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		return err
+	}
+	return f.Close()
+}
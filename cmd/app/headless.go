@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Headless training (-train-ticks, -train-laps): progress is logged every this many ticks
+const HeadlessLogEvery = 500000
+
+// trainHeadless runs the training loop without a window, as fast as it goes, until it
+// has run the given number of ticks or completed the given number of laps, whichever
+// comes first (0 = no limit; at least one must be set), or until interrupted.
+func (g *Game) trainHeadless(ticks, laps int) {
+	g.AIMode, g.Training = true, true
+	start, startLaps := time.Now(), g.NumLaps
+	for t := 1; ticks == 0 || t <= ticks; t++ {
+		if g.Interrupt.Received() {
+			log.Printf("Interrupted at tick %d", t)
+			g.logHeadlessProgress(t-1, ticks, time.Since(start))
+			return
+		}
+		g.updatePhysics()
+		done := t == ticks || (laps > 0 && g.NumLaps-startLaps >= laps)
+		if t%HeadlessLogEvery == 0 || done {
+			g.logHeadlessProgress(t, ticks, time.Since(start))
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// logHeadlessProgress logs where a headless run stands after t of its ticks (0 = no limit).
+func (g *Game) logHeadlessProgress(t, ticks int, elapsed time.Duration) {
+	of := ""
+	if ticks > 0 {
+		of = fmt.Sprintf("/%d", ticks)
+	}
+	table := ""
+	if qa, ok := g.Agent.(tableAgent); ok {
+		st := qa.Stats()
+		table = fmt.Sprintf(", %d states, %.1f%% covered", st.States, 100*st.Coverage())
+	}
+	log.Printf("Tick %d%s (%.0f ticks/s): episode %d, %d laps, best %s, epsilon %.4f%s",
+		t, of, float64(t)/elapsed.Seconds(), g.Episode, g.NumLaps,
+		g.HUD.TimeUnit.FormatTime(g.BestLapTime), g.Agent.Epsilon(), table)
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"racing-line-mapper/internal/agent"
+	"racing-line-mapper/internal/common"
+	"racing-line-mapper/internal/track"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// SpeedUnit selects how speeds are displayed.
+type SpeedUnit int
+
+const (
+	SpeedPxPerTick SpeedUnit = iota // Raw simulation units
+	SpeedMetersPerSec
+	SpeedKmh
+	speedUnitCount
+)
+
+// FormatSpeed renders a speed given in pixels per tick.
+func (u SpeedUnit) FormatSpeed(pxPerTick float64) string {
+	mps := pxPerTick * TicksPerSecond / common.PixelsPerMeter
+	switch u {
+	case SpeedMetersPerSec:
+		return fmt.Sprintf("%.1f m/s", mps)
+	case SpeedKmh:
+		return fmt.Sprintf("%.0f km/h", mps*3.6)
+	default:
+		return fmt.Sprintf("%.2f px/t", pxPerTick)
+	}
+}
+
+// TimeUnit selects how lap/sector times are displayed.
+type TimeUnit int
+
+const (
+	TimeSeconds TimeUnit = iota
+	TimeTicks
+	timeUnitCount
+)
+
+// FormatTime renders a duration given in ticks.
+func (u TimeUnit) FormatTime(ticks int) string {
+	if u == TimeTicks {
+		return fmt.Sprintf("%dt", ticks)
+	}
+	return fmt.Sprintf("%.2fs", float64(ticks)/TicksPerSecond)
+}
+
+// HUDSettings controls which HUD sections are shown and in which units.
+type HUDSettings struct {
+	SpeedUnit SpeedUnit
+	TimeUnit  TimeUnit
+
+	ShowStatus   bool // Mode, speed, lap times, last crash
+	ShowOffset   bool // Lateral offset gauge
+	ShowAgent    bool // Agent parameters and current state/action
+	ShowSectors  bool // Sector splits and the last lap's speed summary
+	ShowQValues  bool // Q-value bars for the current state
+	ShowControls bool // Key help
+}
+
+// DefaultHUDSettings shows everything, in seconds and km/h.
+func DefaultHUDSettings() HUDSettings {
+	return HUDSettings{
+		SpeedUnit:    SpeedKmh,
+		TimeUnit:     TimeSeconds,
+		ShowStatus:   true,
+		ShowOffset:   true,
+		ShowAgent:    true,
+		ShowSectors:  true,
+		ShowQValues:  true,
+		ShowControls: true,
+	}
+}
+
+// hudPanel is one boxed section of the HUD: a block of debug-font text,
+// optionally followed by an area of custom drawing (e.g. bars).
+type hudPanel struct {
+	Text   string
+	MinW   float32                                  // Minimum box width
+	ExtraH float32                                  // Height reserved below the text for Draw
+	Draw   func(screen *ebiten.Image, x, y float32) // Draws into the reserved area at (x, y)
+}
+
+// HUD layout constants (the debug font is 6x16 px per glyph)
+const (
+	hudGlyphW  = 6
+	hudLineH   = 16
+	hudPadding = 4
+	hudMargin  = 10
+	hudGap     = 6
+)
+
+var colorHUDBackground = color.RGBA{0, 0, 0, 180}
+
+func (p hudPanel) size() (float32, float32) {
+	lines := strings.Split(p.Text, "\n")
+	maxLen := 0
+	for _, l := range lines {
+		maxLen = max(maxLen, len(l))
+	}
+	w := max(float32(maxLen*hudGlyphW+2*hudPadding), p.MinW)
+	h := float32(len(lines)*hudLineH+2*hudPadding) + p.ExtraH
+	return w, h
+}
+
+// drawHUDColumn stacks panels from the top of the screen, aligned to the
+// left or right edge, in screen space (unaffected by the world view).
+func drawHUDColumn(screen *ebiten.Image, panels []hudPanel, alignRight bool) {
+	y := float32(0)
+	for _, p := range panels {
+		w, h := p.size()
+		x := float32(0)
+		if alignRight {
+			x = float32(WindowWidth) - w - hudMargin
+		}
+
+		vector.FillRect(screen, x, y, w, h, colorHUDBackground, true)
+		ebitenutil.DebugPrintAt(screen, p.Text, int(x)+hudPadding, int(y)+hudPadding)
+		if p.Draw != nil {
+			p.Draw(screen, x+hudPadding, y+h-p.ExtraH)
+		}
+
+		y += h + hudGap
+	}
+}
+
+// drawHUD builds the enabled sections and lays them out: status/sectors/controls on the left,
+// agent info and Q-values on the right.
+func (g *Game) drawHUD(screen *ebiten.Image) {
+	var left, right []hudPanel
+
+	if g.HUD.ShowStatus {
+		left = append(left, g.statusPanel())
+	}
+	if g.HUD.ShowOffset && len(g.Mesh.Waypoints) > 0 {
+		left = append(left, g.offsetPanel())
+	}
+	if g.HUD.ShowSectors {
+		left = append(left, g.sectorsPanel())
+	}
+	if g.HUD.ShowControls {
+		left = append(left, g.controlsPanel())
+	}
+	if g.AIMode && g.HUD.ShowAgent {
+		right = append(right, g.agentPanel())
+	}
+	if g.AIMode && g.HUD.ShowQValues {
+		right = append(right, g.qValuesPanel())
+	}
+
+	drawHUDColumn(screen, left, false)
+	drawHUDColumn(screen, right, true)
+}
+
+func (g *Game) statusPanel() hudPanel {
+	u := g.HUD
+	msg := "STATUS MONITOR\n"
+	msg += "----------------\n"
+	if g.AIMode {
+		msg += "Mode:   AI (Agent)\n"
+	} else {
+		msg += "Mode:   Manual\n"
+	}
+	msg += fmt.Sprintf("Speed:  %s\n", u.SpeedUnit.FormatSpeed(g.Car.Speed))
+	msg += fmt.Sprintf("Laps:   %d\n", g.NumLaps)
+
+	// Time Info
+	msg += fmt.Sprintf("Current: %s\n", u.TimeUnit.FormatTime(g.Car.CurrentLapTime))
+	msg += fmt.Sprintf("Last:    %s\n", u.TimeUnit.FormatTime(g.Car.LastLapTime))
+	msg += fmt.Sprintf("Best:    %s\n", u.TimeUnit.FormatTime(g.BestLapTime))
+	if g.BestLine != nil { // Distance from the best lap's line, RMS over the lap
+		msg += fmt.Sprintf("Line:    %.1f px (last %.1f)\n", g.LapAdherence.RMS(), g.LastLapAdherence.RMS())
+	}
+
+	// Crash Info
+	if g.LastCrash != nil {
+		msg += "Last crash:\n"
+		msg += fmt.Sprintf(" %s wall, wp %d\n", g.LastCrash.Side(), g.LastCrash.WaypointIdx)
+		msg += fmt.Sprintf(" d %.1f, %s corner\n", g.LastCrash.D, g.LastCrash.Corner)
+		msg += fmt.Sprintf(" v %s, hdg %+.0fdeg\n", u.SpeedUnit.FormatSpeed(g.LastCrash.Speed), g.LastCrash.RelHeading*180/math.Pi)
+	}
+
+	if g.Car.Crashed {
+		msg += "[CRASHED] "
+	}
+	if g.Recorder != nil {
+		msg += fmt.Sprintf("[REC %d] ", g.Recorder.Count)
+	}
+	if g.Training {
+		msg += "[High speed]"
+	} else {
+		msg += "[Real-time speed]"
+	}
+	return hudPanel{Text: msg}
+}
+
+// offsetPanel draws the car's Frenet d as a marker on a bar spanning the track width,
+// with the centerline marked. Off the tarmac the marker sticks to the edge, in red.
+// d and the width both come from the waypoint nearest the car's last checkpoint, so
+// the gauge doesn't jump to a parallel section of track.
+func (g *Game) offsetPanel() hudPanel {
+	const barW = 180.0
+
+	wp, _ := g.Mesh.GetClosestWaypointNear(g.Car.Position, g.Car.Checkpoint)
+	off := g.Car.Position.Sub(wp.Position)
+	d := off.X*wp.Normal.X + off.Y*wp.Normal.Y
+	half := wp.Width / 2
+	if wp.Degenerate() {
+		half = track.NominalTrackWidth / 2
+	}
+	frac := d / half
+
+	return hudPanel{
+		Text:   fmt.Sprintf("LATERAL OFFSET\nd %+.1f px (%+.0f%% of half width)", d, frac*100),
+		MinW:   barW + 2*hudPadding,
+		ExtraH: hudLineH + hudPadding,
+		Draw: func(screen *ebiten.Image, x, y float32) {
+			midY := y + hudLineH/2
+			vector.StrokeLine(screen, x, midY, x+barW, midY, 2, ColorOffsetBar, true)
+			for _, ex := range []float32{x, x + barW} { // Track edges
+				vector.StrokeLine(screen, ex, y+2, ex, y+hudLineH-2, 2, ColorOffsetBar, true)
+			}
+			vector.StrokeLine(screen, x+barW/2, y+4, x+barW/2, y+hudLineH-4, 1, ColorOffsetBar, true) // Centerline
+
+			col := ColorOffsetMark
+			if math.Abs(frac) > 1 {
+				col = ColorOffsetOff
+			}
+			mx := x + barW/2 + float32(math.Max(-1, math.Min(1, frac)))*barW/2
+			vector.FillRect(screen, mx-2, y+1, 4, hudLineH-2, col, true)
+		},
+	}
+}
+
+func (g *Game) sectorsPanel() hudPanel {
+	tu := g.HUD.TimeUnit
+	msg := "SECTORS\n"
+	msg += "----------------\n"
+	msg += "    Curr    Last    Best\n"
+	for i := 0; i < SectorCount; i++ {
+		curr := "-"
+		switch {
+		case i < g.CurrentSector:
+			curr = tu.FormatTime(g.SectorTimes[i])
+		case i == g.CurrentSector:
+			curr = tu.FormatTime(g.Car.CurrentLapTime - g.SectorStart)
+		}
+		last, best := "-", "-"
+		if g.LastSectorTimes[i] > 0 {
+			last = tu.FormatTime(g.LastSectorTimes[i])
+		}
+		if g.BestSectorTimes[i] > 0 {
+			best = tu.FormatTime(g.BestSectorTimes[i])
+		}
+		msg += fmt.Sprintf("S%d %-7s %-7s %-7s", i+1, curr, last, best)
+		if i < SectorCount-1 {
+			msg += "\n"
+		}
+	}
+
+	if lap := g.LastLapTelemetry; lap != nil {
+		su := g.HUD.SpeedUnit
+		msg += "\nLast lap speeds:\n"
+		msg += fmt.Sprintf(" Top %s @wp %d\n", su.FormatSpeed(lap.TopSpeed), lap.TopSpeedWP)
+		msg += fmt.Sprintf(" Min %s @wp %d\n", su.FormatSpeed(lap.MinSpeed), lap.MinSpeedWP)
+		msg += fmt.Sprintf(" Avg %s", su.FormatSpeed(lap.AvgSpeed()))
+	}
+	return hudPanel{Text: msg}
+}
+
+func (g *Game) controlsPanel() hudPanel {
+	return hudPanel{Text: g.controlsHelp()}
+}
+
+// agentPanel shows the agent's parameters plus what it is doing right now:
+// the discretized state and the chosen action.
+func (g *Game) agentPanel() hudPanel {
+	specs := "AGENT PARAMS\n"
+	specs += "------------\n"
+	specs += g.Agent.DebugInfoStr()
+	specs += "\n\nCURRENT STEP\n"
+	specs += "------------\n"
+	st := g.CurrentState
+	specs += fmt.Sprintf("State: s%d l%+d v%d h%+d k%+d\n", st.SegmentIdx, st.LaneIdx, st.SpeedLevel, st.HeadingRel, st.NextCurvature)
+	specs += fmt.Sprintf("Action: %s\n", agent.ActionNames[g.CurrentAction])
+	specs += fmt.Sprintf("Reward: %+.1f (%s)\n", g.CurrentReward.Total(), g.CurrentReward.Format(RewardHUDTerms))
+	specs += fmt.Sprintf("Confidence: %.0f%%", 100*agent.Confidence(g.Agent.QValuesFor(st), st.Masked))
+	return hudPanel{Text: specs, MinW: 200}
+}
+
+// qValuesPanel draws a Q-value bar per action at the current state,
+// scaled to the largest |Q| there.
+func (g *Game) qValuesPanel() hudPanel {
+	const barMaxW = 60.0 // Per side of the zero line
+
+	q := g.Agent.QValuesFor(g.CurrentState)
+	maxAbs := 0.0
+	for _, v := range q {
+		maxAbs = math.Max(maxAbs, math.Abs(v))
+	}
+
+	return hudPanel{
+		Text:   "Q-VALUES\n------------",
+		MinW:   200,
+		ExtraH: agent.ActionCount*hudLineH + hudPadding,
+		Draw: func(screen *ebiten.Image, x, y float32) {
+			zeroX := x + hudGlyphW*9 + barMaxW // After the 8-char label
+			for i, v := range q {
+				rowY := y + float32(i)*hudLineH
+				label := fmt.Sprintf("%-8s", agent.ActionNames[i])
+				if i == g.CurrentAction {
+					label = fmt.Sprintf(">%-7s", agent.ActionNames[i])
+				}
+				ebitenutil.DebugPrintAt(screen, label, int(x), int(rowY))
+
+				w := float32(0)
+				if maxAbs > 0 {
+					w = float32(v/maxAbs) * barMaxW
+				}
+				col := ColorQPositive
+				bx := zeroX
+				if w < 0 {
+					col = ColorQNegative
+					bx, w = zeroX+w, -w
+				}
+				vector.FillRect(screen, bx, rowY+4, w, hudLineH-8, col, true)
+				vector.StrokeLine(screen, zeroX, rowY+2, zeroX, rowY+hudLineH-2, 1, color.RGBA{200, 200, 200, 255}, true)
+			}
+		},
+	}
+}
+
+// sectorOf maps a waypoint index to its timing sector.
+func (g *Game) sectorOf(idx int) int {
+	n := len(g.Mesh.Waypoints)
+	if n == 0 || idx < 0 {
+		return 0
+	}
+	return min(idx*SectorCount/n, SectorCount-1)
+}
+
+// updateSectors closes the current sector once the car's checkpoint moves into a later one.
+func (g *Game) updateSectors() {
+	if g.Car.Checkpoint < 0 {
+		return
+	}
+	sector := g.sectorOf(g.Car.Checkpoint)
+	if sector <= g.CurrentSector {
+		return
+	}
+	g.SectorTimes[g.CurrentSector] = g.Car.CurrentLapTime - g.SectorStart
+	g.SectorStart = g.Car.CurrentLapTime
+	g.CurrentSector = sector
+}
+
+// finishSectors closes the last sector at lap completion and, if every sector
+// of the lap was timed, records the splits as the last lap's and updates the bests.
+func (g *Game) finishSectors() {
+	g.SectorTimes[g.CurrentSector] = g.Car.LastLapTime - g.SectorStart
+
+	complete := g.CurrentSector == SectorCount-1
+	for _, t := range g.SectorTimes {
+		complete = complete && t > 0
+	}
+	if complete {
+		g.LastSectorTimes = g.SectorTimes
+		for i, t := range g.SectorTimes {
+			if g.BestSectorTimes[i] == 0 || t < g.BestSectorTimes[i] {
+				g.BestSectorTimes[i] = t
+			}
+		}
+	}
+
+	g.SectorTimes = [SectorCount]int{}
+	g.CurrentSector = 0
+	g.SectorStart = 0
+}
+
+// resetSectors restarts sector timing for a fresh car (respawn/teleport),
+// starting in whichever sector the car is placed.
+func (g *Game) resetSectors() {
+	g.SectorTimes = [SectorCount]int{}
+	g.CurrentSector = g.sectorOf(g.Car.Checkpoint)
+	g.SectorStart = g.Car.CurrentLapTime
+}
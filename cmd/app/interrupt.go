@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Interrupts turns Ctrl+C (or SIGTERM) into a clean shutdown: the long-running loops
+// (headless training, evaluation, the game loop) poll Received and wind down, so the
+// Q-table, exported lines, lap trace and profiles still get written. Only the first
+// signal is caught; after it the default handling is back, so a second Ctrl+C ends the
+// process at once. The zero value (or nil) catches nothing until Listen.
+type Interrupts struct {
+	ch  chan os.Signal
+	sig os.Signal // The signal received, once one has been
+}
+
+// Listen starts catching the signals. Until then they end the process as usual, which
+// is what the setup (loading the track and the like) wants.
+func (in *Interrupts) Listen() {
+	in.ch = make(chan os.Signal, 1)
+	signal.Notify(in.ch, os.Interrupt, syscall.SIGTERM)
+}
+
+// Received reports whether a signal has arrived. It's meant for one goroutine at a time:
+// the game loop, or the headless run.
+func (in *Interrupts) Received() bool {
+	if in == nil || in.ch == nil {
+		return false
+	}
+	if in.sig == nil {
+		select {
+		case in.sig = <-in.ch:
+			signal.Stop(in.ch)
+			log.Printf("Received %v, shutting down (again to quit at once)", in.sig)
+		default:
+		}
+	}
+	return in.sig != nil
+}
+
+// Reraise stops catching the signals once the clean shutdown is done and, if one was
+// caught, exits the way it would have ended the process uncaught, so whoever sent it
+// (a shell, a job runner) sees the run as interrupted rather than finished.
+func (in *Interrupts) Reraise() {
+	if in == nil || in.ch == nil {
+		return
+	}
+	in.Received() // Also picks up one that came after the loops stopped polling
+	signal.Stop(in.ch)
+	if in.sig == nil {
+		return
+	}
+	if p, err := os.FindProcess(os.Getpid()); err == nil && p.Signal(in.sig) == nil {
+		time.Sleep(time.Second) // Delivery is asynchronous; this is normally never over
+	}
+	os.Exit(1) // Signals that can't be re-sent (on Windows) or are ignored
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// Key binding file: a JSON object of action name -> key name (ebiten's names, e.g.
+// "S", "F5", "ArrowUp"), overriding the defaults for the actions it lists.
+//
+//	{"toggle_training": "Space", "respawn": "Backspace"}
+const KeyBindingsPath = "keys.json"
+
+// Bindable actions (the names used in the key bindings file)
+const (
+	BindReloadTrack    = "reload_track"
+	BindToggleAI       = "toggle_ai"
+	BindRecordDemos    = "record_demos"
+	BindPretrain       = "pretrain"
+	BindEvaluate       = "evaluate"
+	BindExportLines    = "export_lines"
+	BindToggleApexes   = "toggle_apexes"
+	BindToggleBrakePts = "toggle_brake_points"
+	BindToggleSkids    = "toggle_skids"
+	BindToggleSmooth   = "toggle_smooth_track"
+	BindToggleRibs     = "toggle_ribs"
+	BindToggleEdges    = "toggle_boundaries"
+	BindToggleLine     = "toggle_racing_line"
+	BindRibDensity     = "rib_density"
+	BindCamera         = "camera"
+	BindZoomIn         = "zoom_in"
+	BindZoomOut        = "zoom_out"
+	BindSaveSession    = "save_session"
+	BindLoadSession    = "load_session"
+	BindRemesh         = "remesh"
+	BindToggleTraining = "toggle_training"
+	BindToggleGrid     = "toggle_frenet_grid"
+	BindToggleStatus   = "toggle_status"
+	BindToggleAgent    = "toggle_agent"
+	BindToggleSectors  = "toggle_sectors"
+	BindToggleQValues  = "toggle_qvalues"
+	BindToggleOffset   = "toggle_offset"
+	BindToggleHelp     = "toggle_help"
+	BindSpeedUnit      = "speed_unit"
+	BindTimeUnit       = "time_unit"
+	BindRespawn        = "respawn"
+	BindThrottle       = "throttle"
+	BindBrake          = "brake"
+	BindSteerLeft      = "steer_left"
+	BindSteerRight     = "steer_right"
+)
+
+// keyAction describes one bindable action.
+type keyAction struct {
+	Name   string
+	Key    ebiten.Key // Default binding
+	Help   string     // Controls panel text
+	Manual bool       // Only does anything while driving manually
+}
+
+// keyActions lists every bindable action, in the order of the controls panel.
+var keyActions = []keyAction{
+	{BindToggleTraining, ebiten.KeyS, "Toggle Slow Mode", false},
+	{BindToggleGrid, ebiten.KeyG, "Toggle Frenet Grid", false},
+	{BindToggleApexes, ebiten.KeyA, "Toggle Apexes", false},
+	{BindToggleBrakePts, ebiten.KeyB, "Toggle Brake Points", false},
+	{BindToggleSkids, ebiten.KeyK, "Toggle Skid Marks", false},
+	{BindToggleSmooth, ebiten.KeyV, "Toggle Smooth Track", false},
+	{BindToggleRibs, ebiten.KeyX, "Toggle Mesh Ribs", false},
+	{BindRibDensity, ebiten.KeyBracketRight, "Rib density", false},
+	{BindToggleEdges, ebiten.KeyO, "Toggle Track Edges", false},
+	{BindToggleLine, ebiten.KeyI, "Toggle Ideal Line", false},
+	{BindCamera, ebiten.KeyC, "Camera mode", false},
+	{BindZoomIn, ebiten.KeyEqual, "Zoom in (also the wheel)", false},
+	{BindZoomOut, ebiten.KeyMinus, "Zoom out", false},
+	{BindToggleAI, ebiten.KeyM, "Toggle AI/Manual", false},
+	{BindRemesh, ebiten.KeyN, "Re-mesh from car", false},
+	{BindReloadTrack, ebiten.KeyL, "Reload track", false},
+	{BindSaveSession, ebiten.KeyF5, "Save session", false},
+	{BindLoadSession, ebiten.KeyF9, "Load session", false},
+	{BindPretrain, ebiten.KeyP, "Pretrain from demos", false},
+	{BindEvaluate, ebiten.KeyE, "Evaluate policy", false},
+	{BindExportLines, ebiten.KeyF7, "Export best lap & line", false},
+	{BindThrottle, ebiten.KeyArrowUp, "Throttle", true},
+	{BindBrake, ebiten.KeyArrowDown, "Brake", true},
+	{BindSteerLeft, ebiten.KeyArrowLeft, "Steer left", true},
+	{BindSteerRight, ebiten.KeyArrowRight, "Steer right", true},
+	{BindRespawn, ebiten.KeyR, "Respawn", true},
+	{BindRecordDemos, ebiten.KeyD, "Record demos", true},
+	{BindToggleStatus, ebiten.KeyF1, "Status panel", false},
+	{BindToggleAgent, ebiten.KeyF2, "Agent panel", false},
+	{BindToggleSectors, ebiten.KeyF3, "Sectors panel", false},
+	{BindToggleQValues, ebiten.KeyF4, "Q-values panel", false},
+	{BindToggleOffset, ebiten.KeyF6, "Offset gauge", false},
+	{BindToggleHelp, ebiten.KeyH, "Help", false},
+	{BindSpeedUnit, ebiten.KeyU, "Speed unit", false},
+	{BindTimeUnit, ebiten.KeyT, "Time unit", false},
+}
+
+// KeyBindings maps action names (the Bind* constants) to the key that triggers them.
+type KeyBindings map[string]ebiten.Key
+
+// DefaultKeyBindings returns the built-in controls.
+func DefaultKeyBindings() KeyBindings {
+	kb := make(KeyBindings, len(keyActions))
+	for _, a := range keyActions {
+		kb[a.Name] = a.Key
+	}
+	return kb
+}
+
+// LoadKeyBindings reads the bindings file at path over the defaults. A missing file
+// just gives the defaults. Unknown action names and two actions sharing a key are errors.
+func LoadKeyBindings(path string) (KeyBindings, error) {
+	kb := DefaultKeyBindings()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return kb, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides map[string]ebiten.Key
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for name, key := range overrides {
+		if _, ok := kb[name]; !ok {
+			return nil, fmt.Errorf("%s: unknown action %q", path, name)
+		}
+		kb[name] = key
+	}
+
+	owner := make(map[ebiten.Key]string, len(kb))
+	for _, a := range keyActions {
+		key := kb[a.Name]
+		if other, taken := owner[key]; taken {
+			return nil, fmt.Errorf("%s: %s is bound to both %s and %s", path, key, other, a.Name)
+		}
+		owner[key] = a.Name
+	}
+	return kb, nil
+}
+
+// JustPressed reports whether the action's key went down this frame.
+func (kb KeyBindings) JustPressed(action string) bool {
+	return inpututil.IsKeyJustPressed(kb[action])
+}
+
+// Pressed reports whether the action's key is held.
+func (kb KeyBindings) Pressed(action string) bool {
+	return ebiten.IsKeyPressed(kb[action])
+}
+
+// keyHandler is what a press-to-trigger action does.
+type keyHandler struct {
+	Action string
+	Handle func()
+}
+
+// keyHandlers is the dispatch table for the press-to-trigger actions, in the order
+// they are checked each frame. Held actions (driving, respawn) are polled where used.
+func (g *Game) keyHandlers() []keyHandler {
+	toggle := func(b *bool) func() { return func() { *b = !*b } }
+	overlay := func(o Overlay) func() { return func() { g.Overlays.Toggle(o) } }
+	return []keyHandler{
+		// Reload the track (it's also reloaded when edited, see WatchTrackFile)
+		{BindReloadTrack, g.reloadTrack},
+
+		// Toggle AI / Manual driving (manual always runs in real time)
+		{BindToggleAI, func() {
+			g.AIMode = !g.AIMode
+			if !g.AIMode {
+				g.Training = false
+			} else {
+				g.stopRecording()
+			}
+		}},
+
+		// Record demonstrations / pretrain the agent from them
+		{BindRecordDemos, func() {
+			switch {
+			case g.AIMode:
+			case g.Recorder == nil:
+				g.startRecording()
+			default:
+				g.stopRecording()
+			}
+		}},
+		{BindPretrain, g.pretrainFromDemos},
+
+		// Evaluate the greedy policy (blocks until done)
+		{BindEvaluate, func() { g.evaluate(EvalLaps, EvalResultsPath) }},
+
+		// Write the best lap and the racing line to a file (see exportLines)
+		{BindExportLines, func() { g.exportLines(g.ExportPath) }},
+
+		// Overlays
+		{BindToggleApexes, overlay(OverlayApexes)},
+		{BindToggleBrakePts, overlay(OverlayBrakePoints)},
+		{BindToggleSkids, overlay(OverlaySkids)},
+		{BindToggleRibs, overlay(OverlayRibs)},
+		{BindRibDensity, g.cycleRibDensity},
+		{BindToggleEdges, overlay(OverlayBoundaries)},
+		{BindToggleLine, overlay(OverlayRacingLine)},
+		{BindToggleSmooth, toggle(&g.SmoothTrack)},
+		{BindCamera, g.cycleCamera},
+		{BindZoomIn, func() { g.zoomBy(CameraZoomStep) }},
+		{BindZoomOut, func() { g.zoomBy(1 / CameraZoomStep) }},
+
+		// Save / resume the training session
+		{BindSaveSession, g.saveSession},
+		{BindLoadSession, func() { g.loadSession() }},
+
+		// Re-seed the mesh from the car's current position and heading
+		// (recovery tool for when the automatic start detection picks a bad start)
+		{BindRemesh, g.regenerateMesh},
+
+		// Toggle Speed (S by default *slows down* from fast training)
+		{BindToggleTraining, toggle(&g.Training)},
+		{BindToggleGrid, overlay(OverlayFrenetGrid)},
+
+		// HUD sections and units
+		{BindToggleStatus, toggle(&g.HUD.ShowStatus)},
+		{BindToggleAgent, toggle(&g.HUD.ShowAgent)},
+		{BindToggleSectors, toggle(&g.HUD.ShowSectors)},
+		{BindToggleQValues, toggle(&g.HUD.ShowQValues)},
+		{BindToggleOffset, toggle(&g.HUD.ShowOffset)},
+		{BindToggleHelp, toggle(&g.HUD.ShowControls)},
+		{BindSpeedUnit, func() { g.HUD.SpeedUnit = (g.HUD.SpeedUnit + 1) % speedUnitCount }},
+		{BindTimeUnit, func() { g.HUD.TimeUnit = (g.HUD.TimeUnit + 1) % timeUnitCount }},
+	}
+}
+
+// handleKeys runs the handler of every action whose key was pressed this frame.
+func (g *Game) handleKeys() {
+	for _, h := range g.keyHandlers() {
+		if g.Keys.JustPressed(h.Action) {
+			h.Handle()
+		}
+	}
+}
+
+// manualInput reads the driving keys as driver inputs.
+func (g *Game) manualInput() (throttle, brake, steering float64) {
+	if g.Keys.Pressed(BindThrottle) {
+		throttle = 1.0
+	}
+	if g.Keys.Pressed(BindBrake) {
+		brake = 1.0
+	}
+	if g.Keys.Pressed(BindSteerLeft) {
+		steering -= 1.0
+	}
+	if g.Keys.Pressed(BindSteerRight) {
+		steering += 1.0
+	}
+	return throttle, brake, steering
+}
+
+// controlsHelp lists the bindings for the controls panel, leaving out the
+// manual-driving ones while the AI drives.
+func (g *Game) controlsHelp() string {
+	msg := "Controls:"
+	for _, a := range keyActions {
+		if a.Manual && g.AIMode {
+			continue
+		}
+		msg += fmt.Sprintf("\n%s = %s", g.Keys[a.Name], a.Help)
+	}
+	if !g.AIMode {
+		msg += "\nClick = Teleport"
+	}
+	return msg
+}
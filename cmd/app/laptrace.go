@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"racing-line-mapper/internal/common"
+)
+
+// TracedLap is one completed lap in a lap trace file (see LapTraceWriter).
+type TracedLap struct {
+	Episode     int           `json:"episode"`
+	Lap         int           `json:"lap"`          // Laps completed in the session, this one included
+	LapTime     int           `json:"lap_time"`     // Ticks
+	Best        bool          `json:"best"`         // A new best lap when it was driven
+	SampleEvery int           `json:"sample_every"` // Ticks between consecutive points
+	Points      []common.Vec2 `json:"points"`
+}
+
+// LapTraceWriter appends every completed lap to a file as NDJSON (one TracedLap per
+// line), so a whole session's progression can be animated afterwards. Lines are
+// buffered; Close flushes them.
+type LapTraceWriter struct {
+	f     *os.File
+	w     *bufio.Writer
+	enc   *json.Encoder
+	Count int // Laps written
+}
+
+// NewLapTraceWriter opens (or creates) the trace file at path for appending, so
+// successive sessions add to the same file.
+func NewLapTraceWriter(path string) (*LapTraceWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &LapTraceWriter{f: f, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// Write appends one lap (the encoder ends it with a newline).
+func (t *LapTraceWriter) Write(lap TracedLap) error {
+	if err := t.enc.Encode(lap); err != nil {
+		return err
+	}
+	t.Count++
+	return nil
+}
+
+// Close flushes the buffered laps and closes the file.
+func (t *LapTraceWriter) Close() error {
+	if err := t.w.Flush(); err != nil {
+		t.f.Close()
+		return err
+	}
+	return t.f.Close()
+}
+
+// closeLapTrace flushes and closes the lap trace, if one is being written.
+func (g *Game) closeLapTrace() {
+	if g.LapTrace == nil {
+		return
+	}
+	if err := g.LapTrace.Close(); err != nil {
+		log.Printf("Closing lap trace: %v", err)
+	}
+	log.Printf("Traced %d laps", g.LapTrace.Count)
+	g.LapTrace = nil
+}
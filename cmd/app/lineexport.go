@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"racing-line-mapper/internal/common"
+	"strconv"
+	"strings"
+)
+
+// Lines are exported here on F7, unless -export names another file (.geojson or .json
+// for GeoJSON, anything else CSV)
+const DefaultLineExportPath = "lines.csv"
+
+// exportedLine is one path written by exportLines, in track pixels in the -coords convention.
+type exportedLine struct {
+	Name    string // "best_lap" or "racing_line"
+	LapTime int    // Ticks; 0 for a line that wasn't driven
+	Points  []common.Vec2
+}
+
+// exportLines writes the best lap and the optimized racing line to path for analysis
+// outside the app (see writeLinesGeoJSON, writeLinesCSV), skipping whichever is empty.
+func (g *Game) exportLines(path string) {
+	var lines []exportedLine
+	if len(g.BestLapPath) > 1 {
+		lines = append(lines, exportedLine{Name: "best_lap", LapTime: g.BestLapTime, Points: g.BestLapPath})
+	}
+	if len(g.RacingLine) > 1 {
+		line := g.RacingLine
+		if g.Mesh.Looped {
+			line = append(line[:len(line):len(line)], line[0])
+		}
+		lines = append(lines, exportedLine{Name: "racing_line", Points: line})
+	}
+	if len(lines) == 0 {
+		log.Printf("No lines to export yet")
+		return
+	}
+	for i := range lines { // Copies: the game's own lines stay in image coordinates
+		pts := make([]common.Vec2, len(lines[i].Points))
+		for j, p := range lines[i].Points {
+			pts[j] = g.TrackCoords.Point(p, float64(g.Grid.Height))
+		}
+		lines[i].Points = pts
+	}
+
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".geojson", ".json":
+		err = writeFile(path, func(w io.Writer) error { return writeLinesGeoJSON(w, lines) })
+	default:
+		err = writeLinesCSV(path, lines)
+	}
+	if err != nil {
+		log.Printf("Exporting lines: %v", err)
+		return
+	}
+	log.Printf("Exported %d lines to %s", len(lines), path)
+}
+
+// writeLinesCSV writes each line as x,y rows under a header: the first to path, the
+// others next to it with their name appended (lines.csv, lines_racing_line.csv). A
+// comment line above the header gives the lap time.
+func writeLinesCSV(path string, lines []exportedLine) error {
+	ext := filepath.Ext(path)
+	for i, line := range lines {
+		p := path
+		if i > 0 {
+			p = strings.TrimSuffix(path, ext) + "_" + line.Name + ext
+		}
+		err := writeFile(p, func(w io.Writer) error {
+			comment := "# " + line.Name
+			if line.LapTime > 0 {
+				comment += fmt.Sprintf(", lap time %d ticks (%.3fs)", line.LapTime, float64(line.LapTime)/TicksPerSecond)
+			}
+			if _, err := fmt.Fprintln(w, comment); err != nil {
+				return err
+			}
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"x", "y"})
+			ftoa := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+			for _, pt := range line.Points {
+				cw.Write([]string{ftoa(pt.X), ftoa(pt.Y)})
+			}
+			cw.Flush()
+			return cw.Error()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// geoJSONFeature is a GeoJSON Feature holding a LineString.
+type geoJSONFeature struct {
+	Type       string         `json:"type"` // Always "Feature"
+	Properties map[string]any `json:"properties"`
+	Geometry   struct {
+		Type        string       `json:"type"` // Always "LineString"
+		Coordinates [][2]float64 `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+// writeLinesGeoJSON writes the lines as a FeatureCollection of LineStrings, with the
+// name and, for a driven lap, the lap time (ticks and seconds) as properties.
+func writeLinesGeoJSON(w io.Writer, lines []exportedLine) error {
+	features := make([]geoJSONFeature, len(lines))
+	for i, line := range lines {
+		f := &features[i]
+		f.Type = "Feature"
+		f.Properties = map[string]any{"name": line.Name}
+		if line.LapTime > 0 {
+			f.Properties["lap_time_ticks"] = line.LapTime
+			f.Properties["lap_time_seconds"] = float64(line.LapTime) / TicksPerSecond
+		}
+		f.Geometry.Type = "LineString"
+		f.Geometry.Coordinates = make([][2]float64, len(line.Points))
+		for j, pt := range line.Points {
+			f.Geometry.Coordinates[j] = [2]float64{pt.X, pt.Y}
+		}
+	}
+	return json.NewEncoder(w).Encode(struct {
+		Type     string           `json:"type"`
+		Features []geoJSONFeature `json:"features"`
+	}{"FeatureCollection", features})
+}
+
+// writeFile creates path and fills it with write, reporting the first error of either.
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"cmp"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"math"
+	"os"
 	"racing-line-mapper/internal/agent"
 	"racing-line-mapper/internal/common"
 	"racing-line-mapper/internal/physics"
 	"racing-line-mapper/internal/track"
+	"slices"
+	"strings"
+	"time"
 
 	"image/color"
 
@@ -21,8 +29,48 @@ import (
 // CONFIGURATION - Adjust these values to customize the simulation
 // ============================================================================
 
-// Input track file path
-const InputTrackPath = "processed_tracks/monza_10m.jpg"
+// Input track file path, unless -track names another; if it is missing the app falls
+// back to FallbackTrackPath (e.g. the oval from cmd/gen-track)
+const (
+	InputTrackPath    = "processed_tracks/monza_10m.jpg"
+	FallbackTrackPath = "assets/track.png"
+)
+
+// Learner to train unless -agent says otherwise: "qtable" (tabular Q-learning), "sarsa"
+// (tabular, on-policy), "doubleq" (tabular, double Q-learning), "linear" (linear function
+// approximation), "tiles" (linear over tile-coded features) or "tiles-steer" (the same,
+// choosing how hard to steer)
+const DefaultAgentKind = "qtable"
+
+// AgentKinds are the learners -agent accepts (see DefaultAgentKind).
+var AgentKinds = []string{"qtable", "sarsa", "doubleq", "linear", "tiles", "tiles-steer"}
+
+// Training session file (F5 saves, F9 loads; Q-table agents only)
+const SessionPath = "session.gob"
+
+// Q-table states visited fewer times than this are pruned before saving a session, to keep
+// the table and file small (0 = keep everything; see agent.AgentQTable.Prune)
+const SessionPruneMinVisits = 0
+
+// Best lap trace, rewritten on every new best (replayed with -render-video)
+const BestLapFile = "bestlap.json"
+
+// Demonstration dataset (D records while driving manually, overwriting it; P pretrains the agent from it)
+const DemoPath = "demos.gob"
+
+// Largest track grid dimension in cells; bigger scans are downsampled on load (0 = full resolution)
+const TrackMaxDim = 4000
+
+// Generated meshes are cached here, keyed on the classified track grid, so reloading an
+// unchanged track skips mesh generation (empty = no cache; see track.LoadOptions.MeshCache)
+const MeshCacheDir = "mesh_cache"
+
+// Track hot-reload: the track file is re-read when it changes on disk (or on L)
+const (
+	WatchTrackFile     = true // Poll the track file for changes
+	TrackWatchInterval = 60   // Frames between checks of the track file's modification time
+	ReloadKeepsAgent   = true // Keep the learned agent across reloads
+)
 
 // Render window dimensions
 const (
@@ -32,9 +80,28 @@ const (
 
 // Simulation settings
 const (
-	TrainingSpeedMultiplier = 3000 // Ticks per frame in training mode (1 = real-time)
-	CarSpawnWaypointIndex   = 5    // Which waypoint to spawn the car at (0 = start marker)
-	ViewScaleMargin         = 0.95 // Margin for fitting track in window (0.95 = 5% padding)
+	TrainingSpeedMultiplier = 3000  // Ticks per frame in training mode (1 = real-time)
+	CarSpawnWaypointIndex   = 5     // Which waypoint to spawn the car at (0 = start marker)
+	MaxEpisodeTicks         = 20000 // AI episodes longer than this end as a timeout and respawn (0 = no cap)
+	ConfidenceExploration   = false // Q-table agents explore more where they're unsure (see agent.AgentQTable.ExploreByConfidence)
+	MaxNudges               = 20    // Crash nudges per episode before the AI respawns anyway (see Game.NudgeOnCrash)
+	ViewScaleMargin         = 0.95  // Margin for fitting track in window (0.95 = 5% padding)
+	TicksPerSecond          = 60    // Simulation ticks per real-time second (for HUD units)
+	SectorCount             = 3     // Timing sectors per lap, split evenly by waypoint index
+	TraceSampleTicks        = 5     // Ticks between recorded lap trace points
+	DefaultTraceHistory     = 4     // Completed lap traces kept on screen (see Game.MaxTraceHistory)
+)
+
+// Reward breakdown readouts (see agent.RewardBreakdown)
+const (
+	RewardHUDTerms = 3 // Largest terms of the last step, in the agent panel
+	RewardLogTerms = 5 // Largest terms summed over an episode, in the episode log
+)
+
+// Frenet grid overlay settings (toggle with G)
+var (
+	FrenetGridOffsets   = []float64{-20, -10, 10, 20} // Lateral offsets (d) of the iso-offset curves, in pixels
+	FrenetGridMarkEvery = 10                          // Mark every Nth waypoint's s value along the centerline
 )
 
 // Track surface colors
@@ -50,52 +117,198 @@ var (
 var (
 	ColorFrenetFrame = color.RGBA{50, 155, 50, 40} // Bright Green (was: 100, 200, 255, 150 for Cyan)
 	// ColorFrenetFrame = color.RGBA{255, 255, 255, 50} // White
-	ColorCar         = color.RGBA{255, 0, 0, 255}    // Red
-	ColorCarHeading  = color.RGBA{255, 255, 0, 255}  // Yellow
-	ColorBestLap     = color.RGBA{50, 255, 50, 150}  // Light Green
-	ColorCurrentLap  = color.RGBA{255, 255, 0, 200}  // Yellow
-	ColorLapHistory1 = color.RGBA{255, 0, 255, 255}  // Magenta (most recent)
-	ColorLapHistory2 = color.RGBA{190, 0, 190, 150}  // Faded Magenta
-	ColorLapHistory3 = color.RGBA{130, 0, 130, 70}   // More Faded
-	ColorLapHistory4 = color.RGBA{70, 0, 70, 20}     // Most Faded
+	ColorCar         = color.RGBA{255, 0, 0, 255}   // Red
+	ColorCarHeading  = color.RGBA{255, 255, 0, 255} // Yellow
+	ColorBestLap     = color.RGBA{50, 255, 50, 150} // Light Green
+	ColorCurrentLap  = color.RGBA{255, 255, 0, 200} // Yellow
+	ColorTraceNewest = color.RGBA{255, 0, 255, 255} // Magenta (most recent lap; older ones fade, see traceColor)
+	ColorTraceOldest = color.RGBA{70, 0, 70, 20}    // Most Faded (the oldest kept)
+	ColorFrenetGrid  = color.RGBA{0, 200, 255, 90}  // Cyan (d isolines)
+	ColorFrenetMark  = color.RGBA{0, 200, 255, 200} // Cyan (s marks)
+	ColorApex        = color.RGBA{255, 140, 0, 255} // Orange
+	ColorBrakePoint  = color.RGBA{255, 30, 30, 255} // Red
+	ColorQPositive   = color.RGBA{50, 200, 50, 255} // Green (Q-value bars)
+	ColorQNegative   = color.RGBA{200, 50, 50, 255} // Red
+	ColorOffsetBar   = color.RGBA{0, 200, 255, 200} // Cyan (lateral offset gauge)
+	ColorOffsetMark  = color.RGBA{255, 255, 0, 255} // Yellow
+	ColorOffsetOff   = color.RGBA{255, 50, 50, 255} // Red (off the tarmac)
+	ColorSkidMark    = color.RGBA{0, 0, 0, 160}     // Black (fades with age)
+	ColorBoundary    = color.RGBA{0, 255, 200, 160} // Teal (track edges from the mesh)
+	ColorRacingLine  = color.RGBA{0, 120, 255, 220} // Blue (optimized line)
 )
 
+// Centerline colored by corner phase (drawn with the apex overlay; straights are left undrawn)
+var ColorPhases = map[track.Phase]color.RGBA{
+	track.PhaseBraking: {255, 50, 50, 200},  // Red
+	track.PhaseTurnIn:  {255, 200, 0, 200},  // Amber
+	track.PhaseApex:    {255, 140, 0, 200},  // Orange
+	track.PhaseExit:    {50, 200, 255, 200}, // Light Blue
+}
+
 // ============================================================================
 
 type Game struct {
+	TrackPath    string
+	TrackModTime time.Time // Of TrackPath when it was loaded (for hot-reload)
+
 	Grid       *track.Grid
 	Mesh       *track.TrackMesh
 	TrackImage *ebiten.Image
+	Surface    *TrackSurface // Smooth rendering of the grid (see SmoothTrack)
 	Car        *physics.Car
 	Agent      agent.Agent
 	AIMode     bool
 	Training   bool // Fast forward
 
+	// NudgeOnCrash puts a crashed AI car back on the track where it crashed instead of
+	// respawning it at the start, so it gets more attempts at the corner it failed.
+	NudgeOnCrash bool
+
+	// CarModel is the physics every car the game spawns drives with (see physics.PhysicsModel).
+	CarModel physics.PhysicsModel
+	// CarParams is the vehicle every car the game spawns is (see physics.CarParams).
+	CarParams physics.CarParams
+
+	// AgentKind is the learner new agents are (see AgentKinds), and AgentConfig their
+	// hyperparameters (exploration schedule included) and the rewards they're trained on.
+	AgentKind   string
+	AgentConfig agent.AgentConfig
+
+	// TrackCoords is the coordinate convention of the track's sidecar and of exported
+	// lines (see track.Coords).
+	TrackCoords track.Coords
+
+	// TrackSpacing places the mesh's waypoints by curvature if enabled (see track.Spacing).
+	TrackSpacing track.Spacing
+
+	// Demonstration recording (manual mode; nil when not recording)
+	Recorder *agent.DemoRecorder
+
+	// Every completed lap is appended here (nil unless -lap-trace is set)
+	LapTrace *LapTraceWriter
+
+	// ExportPath is where F7 writes the best lap and racing line (see exportLines)
+	ExportPath string
+
+	// Interrupt ends the run cleanly on Ctrl+C (Update returns ebiten.Termination, so
+	// files get flushed); nil never does
+	Interrupt *Interrupts
+
+	// Non-interactive lap video rendering (nil when running normally)
+	Replay *Replay
+
+	// Last step the agent took (for the HUD), and its reward by term, also summed
+	// over the episode for the episode log
+	CurrentState  agent.State
+	CurrentAction int
+	CurrentReward agent.RewardBreakdown
+	EpisodeReward agent.RewardBreakdown
+
+	// SmoothTrack draws the track from its outlines, with kerbs and a centerline,
+	// instead of the flat cells (and without the debug mesh ribs)
+	SmoothTrack bool
+
+	// Debug Overlays
+	Overlays     Overlays // Shown debug layers (see Overlay)
+	RibEvery     int      // Draw every Nth mesh rib (see RibDensities)
+	BrakePoints  []track.BrakePoint
+	TargetSpeeds []float64     // Corner speed limits, a speed per waypoint (see track.TargetSpeeds)
+	RacingLine   []common.Vec2 // Minimum-curvature line, a point per waypoint
+
+	// HUD units and visible sections
+	HUD HUDSettings
+
+	// Controls (see KeyBindingsPath)
+	Keys KeyBindings
+
 	// Analytics & Visuals
 	NumLaps        int
 	BestLapTime    int             // In ticks
 	BestLapPath    []common.Vec2   // Path of the best lap
+	bestLapUnsaved bool            // BestLapPath is newer than BestLapFile (see saveBestLap)
 	CurrentLapPath []common.Vec2   // Path of current lap
-	LapHistory     [][]common.Vec2 // Paths of last 4 laps
-	PreviousLaps   int             // To detect lap change
-
-	// Rendering Scale
+	LapHistory     [][]common.Vec2 // Paths of the last MaxTraceHistory laps, newest first
+	Skids          SkidMarks
+
+	// Completed lap traces kept in LapHistory (0 = none), drawn fading with age (see traceColor)
+	MaxTraceHistory int
+
+	// Sector timing (in ticks; zero = not set yet)
+	CurrentSector   int
+	SectorStart     int // Lap time at which the current sector began
+	SectorTimes     [SectorCount]int
+	LastSectorTimes [SectorCount]int
+	BestSectorTimes [SectorCount]int
+
+	// Speed statistics of the lap in progress and of the last completed one
+	LapTelemetry     LapTelemetry
+	LastLapTelemetry *LapTelemetry
+
+	// How closely the lap in progress and the last completed one follow the best lap's
+	// line (BestLine, nil until there is a best lap): deviation across the track at the
+	// same point along it, sampled every tick
+	BestLine         *track.ReferenceLine
+	LapAdherence     track.Adherence
+	LastLapAdherence track.Adherence
+
+	// Episode bookkeeping (an episode ends on crash/respawn)
+	Episode      int
+	EpisodeTicks int
+	Nudges       int                // Crash nudges so far this episode
+	LastCrash    *physics.CrashInfo // Most recent crash, kept across the respawn for the HUD
+
+	// Rendering Scale (of the fixed camera, see fitView)
 	ViewScale   float32
 	ViewOffsetX float32
 	ViewOffsetY float32
+	Camera      CameraMode
+	Zoom        float64 // Of the following cameras (0 = 1; see zoomBy)
+
+	// OnEvent, if set, receives training events (see Event) as they happen on the game loop.
+	// Wrap a channel with ChanObserver to consume them elsewhere.
+	OnEvent func(Event)
+
+	trackWatchFrames int
+	epsilonMilestone int // Next of EpsilonMilestones to report
+
+	// Last tick's next state, reused as this tick's current state (invalidated when the car is replaced)
+	nextState     agent.State
+	haveNextState bool
 }
 
 func (g *Game) Update() error {
+	if g.Interrupt.Received() {
+		return ebiten.Termination
+	}
 	if g.Car == nil {
 		return nil
 	}
+	if g.Replay != nil {
+		return g.updateReplay()
+	}
 
-	// Toggle AI (Removed Manual Toggle)
-	// g.AIMode is always true now
+	// Reload the track when it's edited (or on demand)
+	if WatchTrackFile {
+		g.watchTrack()
+	}
 
-	// Toggle Speed (S now *slows down* from fast training)
-	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
-		g.Training = !g.Training
+	// Keyboard controls (see KeyBindings), and the wheel zooms the camera
+	g.handleKeys()
+	g.handleWheel()
+
+	// Practice from anywhere: click the track to teleport the car there.
+	// Manual mode only, so teleports never leak into the agent's learning.
+	if !g.AIMode && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		mx, my := ebiten.CursorPosition()
+		if _, idx := g.Mesh.GetClosestWaypoint(g.screenToWorld(mx, my)); idx >= 0 {
+			g.Car = spawnCarAt(g.Mesh, idx, g.CarParams)
+			g.Car.Config.Model = g.CarModel
+			g.CurrentLapPath = []common.Vec2{}
+			g.resetSectors()
+			g.LapTelemetry = LapTelemetry{}
+			g.LapAdherence = track.Adherence{}
+			g.haveNextState = false
+		}
 	}
 
 	ticks := 1
@@ -117,120 +330,333 @@ func (g *Game) updatePhysics() {
 
 	// Update Timer
 	g.Car.CurrentLapTime++
+	g.EpisodeTicks++
 
-	// Record Trace (sample every 5 ticks to save memory/drawing)
-	if g.Car.CurrentLapTime%5 == 0 {
+	// Record Trace (sampled to save memory/drawing)
+	if g.Car.CurrentLapTime%TraceSampleTicks == 0 {
 		g.CurrentLapPath = append(g.CurrentLapPath, g.Car.Position)
 	}
 
-	currentState := agent.DiscretizeState(g.Car, g.Mesh)
+	// The car hasn't moved since last tick's next state was built, so reuse it
+	currentState := g.nextState
+	if !g.haveNextState {
+		currentState = g.observe(agent.Locate(g.Car, g.Mesh))
+	}
+	g.haveNextState = false
 	action := 0
 
-	if g.AIMode {
+	if g.AIMode && !g.Car.Crashed {
 		action = g.Agent.SelectAction(currentState)
-		switch action {
-		case agent.ActionThrottle:
-			throttle = 1.0
-		case agent.ActionBrake:
-			brake = 1.0
-		case agent.ActionLeft:
-			steering = -1.0
-		case agent.ActionRight:
-			steering = 1.0
-		}
+		g.CurrentState, g.CurrentAction = currentState, action
+		throttle, brake, steering = agent.Inputs(g.Agent, currentState, action)
 	}
 
-	// Reset if crashed
+	// Reset if crashed (the agent learned the crash on the tick it happened)
 	if g.Car.Crashed {
-		// cx, cy := int(g.Car.Position.X), int(g.Car.Position.Y)
-		// cell := g.Grid.Get(cx, cy)
-		// fmt.Printf("[CRASH] Pos: (%.1f, %.1f) Cell: %d\n", g.Car.Position.X, g.Car.Position.Y, cell.Type)
+		// Auto respawn (or nudge) for AI, Manual for Human
+		switch {
+		case g.AIMode && g.NudgeOnCrash && g.Nudges < MaxNudges && g.nudge():
+		case g.AIMode || g.Keys.Pressed(BindRespawn):
+			g.respawn("crash")
+		}
+	} else {
+		if !g.AIMode {
+			throttle, brake, steering = g.manualInput()
+			if g.Recorder != nil {
+				if err := g.Recorder.Record(currentState, agent.ActionFromInputs(throttle, brake, steering)); err != nil {
+					log.Printf("Recording demonstration: %v", err)
+					g.stopRecording()
+				}
+			}
+		}
+		env := g.env()
+		tr := env.Drive(throttle, brake, steering)
+		step, pos, progress := tr.Step, tr.Pos, tr.Progress // pos is shared by the telemetry, next state and reward below
+		terms, best := env.Score(tr, action)
+		g.updateSectors()
+		if !step.Crashed {
+			g.LapTelemetry.Add(g.Car.Speed, pos.Idx)
+			if g.BestLine != nil {
+				g.LapAdherence.Add(g.BestLine.Deviation(g.Mesh.WorldToFrenetNear(g.Car.Position, pos.Idx)))
+			}
+			g.Skids.Record(g.Car, step.Slip)
+		}
 
-		// Penalty for crashing is handled in Learn step usually, but here we just reset
-		// If AI, we need to record the crash state
-		if g.AIMode {
-			reward := agent.CalculateReward(g.Car, g.Grid, g.Mesh, g.BestLapTime)
-			// Next state is irrelevant if terminal, but let's pass current
-			g.Agent.Learn(currentState, action, reward, currentState)
-		}
-
-		// Auto respawn for AI, Manual for Human
-		if g.AIMode || ebiten.IsKeyPressed(ebiten.KeyR) {
-			// Respawn at closest waypoint to start
-			startX, startY := 400.0, 110.0
-			if len(g.Mesh.Waypoints) > 0 {
-				startX = g.Mesh.Waypoints[0].Position.X
-				startY = g.Mesh.Waypoints[0].Position.Y
+		if step.Crashed {
+			g.Car.Crash.Locate(g.Mesh, g.Car.Checkpoint)
+			crash := g.Car.Crash
+			g.LastCrash = &crash
+			g.emit(Event{Kind: EventCrash, Crash: g.LastCrash})
+
+			// Episode log (only in real-time mode; fast training would flood the console)
+			if !g.Training {
+				log.Printf("[EPISODE %d] %d ticks, %d laps | CRASH: %s", g.Episode, g.EpisodeTicks, g.Car.Laps, crash.String())
 			}
-			g.Car = physics.NewCar(startX, startY)
-			g.Car.Heading = 0     // Reset heading too
-			g.Car.Checkpoint = -1 // Reset checkpoint
-			g.Car.Laps = 0
-			// Reset Traces
-			g.CurrentLapPath = []common.Vec2{}
-			g.PreviousLaps = 0
 		}
-	} else {
-		g.Car.Update(g.Grid, throttle, brake, steering)
 
 		// Check for Lap Completion
-		if g.Car.Laps > g.PreviousLaps {
+		if progress.Lap {
 			// Completed a lap!
-			g.Car.LastLapTime = g.Car.CurrentLapTime
+			g.Car.LastLapTime = progress.LapTime
+			g.finishSectors()
+
+			lap := g.LapTelemetry
+			g.LastLapTelemetry = &lap
+			g.LapTelemetry = LapTelemetry{}
+			g.LastLapAdherence, g.LapAdherence = g.LapAdherence, track.Adherence{}
+			if !g.Training {
+				line := "no best line yet"
+				if g.LastLapAdherence.Count > 0 {
+					line = fmt.Sprintf("line to best: mean %.1f px, RMS %.1f px", g.LastLapAdherence.Mean(), g.LastLapAdherence.RMS())
+				}
+				log.Printf("[EPISODE %d] LAP %d in %s | %s | %s", g.Episode, g.NumLaps+1,
+					g.HUD.TimeUnit.FormatTime(g.Car.LastLapTime), lap.Format(g.HUD.SpeedUnit), line)
+			}
+			g.emit(Event{Kind: EventLap, LapTime: g.Car.LastLapTime})
 
 			// Update Best Time
-			if g.BestLapTime == 0 || g.Car.LastLapTime < g.BestLapTime {
-				g.BestLapTime = g.Car.LastLapTime
-				// Save Best Path (Copy slice)
-				g.BestLapPath = make([]common.Vec2, len(g.CurrentLapPath))
-				copy(g.BestLapPath, g.CurrentLapPath)
+			if best {
+				g.BestLapTime = env.BestLapTime
+				// Save Best Path, pulled back onto the tarmac where the trace ran wide
+				g.BestLapPath = g.Mesh.ClampToTrack(g.CurrentLapPath)
+				g.BestLine = track.NewReferenceLine(g.Mesh, g.BestLapPath)
+				g.bestLapUnsaved = true
+				g.emit(Event{Kind: EventBestLap, LapTime: g.BestLapTime})
 			}
 
 			// Save Trace
+			if g.LapTrace != nil {
+				lap := TracedLap{Episode: g.Episode, Lap: g.NumLaps + 1, LapTime: g.Car.LastLapTime, Best: best, SampleEvery: TraceSampleTicks, Points: g.CurrentLapPath}
+				if err := g.LapTrace.Write(lap); err != nil {
+					log.Printf("Writing lap trace: %v", err)
+				}
+			}
 			g.LapHistory = append([][]common.Vec2{g.CurrentLapPath}, g.LapHistory...)
-			if len(g.LapHistory) > 4 {
-				g.LapHistory = g.LapHistory[:4]
+			if len(g.LapHistory) > g.MaxTraceHistory {
+				g.LapHistory = g.LapHistory[:g.MaxTraceHistory]
 			}
 
 			// Reset Current Trace
 			g.CurrentLapPath = []common.Vec2{}
 			g.Car.CurrentLapTime = 0
-			g.PreviousLaps = g.Car.Laps
 			g.NumLaps++
 		}
 
+		// Episode cap: a policy that never crashes (e.g. crawling in circles) would otherwise run forever.
+		// The cut-off is a truncation, not a real terminal state, so the transition still bootstraps;
+		// it just carries a mild penalty.
+		timedOut := g.AIMode && MaxEpisodeTicks > 0 && g.EpisodeTicks >= MaxEpisodeTicks && !g.Car.Crashed
+
 		if g.AIMode {
-			nextState := agent.DiscretizeState(g.Car, g.Mesh)
-			reward := agent.CalculateReward(g.Car, g.Grid, g.Mesh, g.BestLapTime)
-			g.Agent.Learn(currentState, action, reward, nextState)
+			nextState := g.observe(pos)
+			if timedOut {
+				terms[agent.TermTimeout] = g.AgentConfig.Rewards.Timeout
+			}
+			g.recordReward(terms)
+			env.Learn(g.Agent, currentState, action, terms.Total(), tr, nextState) // Terminal on a crash or a point-to-point finish
+			g.nextState, g.haveNextState = nextState, true
+			if g.OnEvent != nil {
+				g.checkEpsilon()
+			}
+		}
+
+		switch {
+		case progress.Lap && !g.Mesh.Looped:
+			// A point-to-point track ends at its last waypoint: start the next run
+			g.respawn("finish")
+		case timedOut:
+			if !g.Training {
+				log.Printf("[EPISODE %d] %d ticks, %d laps | TIMEOUT", g.Episode, g.EpisodeTicks, g.Car.Laps)
+			}
+			g.respawn("timeout")
 		}
 	}
 }
 
+// env is the training environment over the game's current car, track and rewards.
+func (g *Game) env() *agent.Env {
+	return &agent.Env{
+		Grid:         g.Grid,
+		Mesh:         g.Mesh,
+		Car:          g.Car,
+		Rewards:      g.AgentConfig.Rewards,
+		MaskActions:  g.AgentConfig.MaskActions,
+		BestLapTime:  g.BestLapTime,
+		TargetSpeeds: g.TargetSpeeds,
+	}
+}
+
+// recordReward keeps the reward terms of the agent's step for the HUD and the episode log.
+func (g *Game) recordReward(terms agent.RewardBreakdown) {
+	g.CurrentReward = terms
+	g.EpisodeReward.Add(terms)
+}
+
+// observe builds the agent's view of the car at its located position,
+// with the pointless actions masked out if the config says so (see agent.AgentConfig).
+func (g *Game) observe(pos agent.TrackPos) agent.State {
+	return g.env().Observe(pos)
+}
+
+// nudge moves a crashed car to the nearest spot on the track where it fits, at rest and
+// keeping its heading, and lets the episode go on. The crash has already been learned
+// from; the move itself is not a transition, so the next tick observes afresh and the
+// only progress credited afterwards is the driving done from the new spot (the nudge is
+// across the track, so it gains no arc length). Reports false if there's no clear spot.
+func (g *Game) nudge() bool {
+	margin := math.Hypot(g.Car.Length, g.Car.Width)/2 + 1 // Keep the whole chassis off the walls
+	pos := g.Mesh.NearestOnTrack(g.Car.Position, margin, g.Car.Checkpoint)
+	if !g.Car.FitsAt(g.Grid, pos) {
+		return false
+	}
+
+	g.Car.Position = pos
+	g.Car.Velocity = common.Vec2{}
+	g.Car.Speed = 0
+	g.Car.Crashed = false
+	g.Nudges++
+	g.haveNextState = false
+	if !g.Training {
+		log.Printf("[EPISODE %d] Nudged back on track (%d/%d)", g.Episode, g.Nudges, MaxNudges)
+	}
+	return true
+}
+
+// respawn ends the current episode (for the given reason) and starts a new one
+// with a fresh car at the start of the track.
+func (g *Game) respawn(reason string) {
+	g.emit(Event{Kind: EventEpisodeEnd, Reason: reason})
+
+	// Respawn at the track's start, facing its start heading
+	g.Car = agent.StartCar(g.Mesh, g.CarParams)
+	g.Car.Config.Model = g.CarModel
+	g.Car.Checkpoint = -1 // Reset checkpoint
+	g.Car.Laps = 0
+	// Reset Traces
+	g.CurrentLapPath = []common.Vec2{}
+	g.resetSectors()
+	g.LapTelemetry = LapTelemetry{}
+	g.LapAdherence = track.Adherence{}
+
+	if g.AIMode && !g.Training {
+		log.Printf("[EPISODE %d] Reward %.0f: %s", g.Episode, g.EpisodeReward.Total(), g.EpisodeReward.Format(RewardLogTerms))
+	}
+	g.EpisodeReward = agent.RewardBreakdown{}
+
+	g.Episode++
+	g.EpisodeTicks = 0
+	g.Nudges = 0
+	g.haveNextState = false
+	g.emit(Event{Kind: EventEpisodeStart})
+}
+
+// traceColor is the color of the lap trace the given number of laps old (0 = the last
+// lap) out of count kept: fading from ColorTraceNewest to ColorTraceOldest, with the alpha
+// falling off quadratically so a long history of old laps doesn't drown out the new ones.
+func traceColor(age, count int) color.RGBA {
+	t := 0.0
+	if count > 1 {
+		t = min(float64(age)/float64(count-1), 1)
+	}
+	mix := func(from, to uint8, w float64) uint8 {
+		return uint8(math.Round(float64(from) + (float64(to)-float64(from))*w))
+	}
+	from, to := ColorTraceNewest, ColorTraceOldest
+	fade := 1 - (1-t)*(1-t) // Quadratic ease: the alpha drops fastest over the first few laps
+	return color.RGBA{mix(from.R, to.R, t), mix(from.G, to.G, t), mix(from.B, to.B, t), mix(from.A, to.A, fade)}
+}
+
 func (g *Game) Draw(screen *ebiten.Image) {
-	// Draw Track Image
-	if g.TrackImage != nil {
-		op := &ebiten.DrawImageOptions{}
-		op.GeoM.Scale(float64(g.ViewScale), float64(g.ViewScale))
-		op.GeoM.Translate(float64(g.ViewOffsetX), float64(g.ViewOffsetY))
-		screen.DrawImage(g.TrackImage, op)
+	if g.Replay != nil {
+		g.drawReplay(screen)
+		return
 	}
+	g.draw(screen)
+}
+
+// draw renders the track, overlays, traces, car and HUD.
+func (g *Game) draw(screen *ebiten.Image) {
+	// World -> screen (see CameraMode)
+	bounds := screen.Bounds()
+	view := g.view(bounds.Dx(), bounds.Dy())
 
 	// Helper to transform world coordinates to screen coordinates
 	toScreen := func(x, y float64) (float32, float32) {
-		return float32(x)*g.ViewScale + g.ViewOffsetX, float32(y)*g.ViewScale + g.ViewOffsetY
+		sx, sy := view.Apply(x, y)
+		return float32(sx), float32(sy)
+	}
+
+	// Draw Track Image
+	smooth := g.SmoothTrack && g.Surface != nil
+	if smooth {
+		g.Surface.Draw(screen, view)
+		if g.Mesh != nil {
+			drawTrackDetail(screen, g.Mesh, toScreen, g.viewScale())
+		}
+	} else if g.TrackImage != nil {
+		op := &ebiten.DrawImageOptions{GeoM: view}
+		if g.Camera == CameraRotate {
+			op.Filter = ebiten.FilterLinear // Cells turned off the pixel grid alias badly otherwise
+		}
+		screen.DrawImage(g.TrackImage, op)
 	}
 
 	// Draw Mesh (Debug)
 	if g.Mesh != nil {
-		for _, wp := range g.Mesh.Waypoints {
-			// Draw Rib (Normal) using ACTUAL track width
-			p1x, p1y := toScreen(wp.Position.X-wp.Normal.X*(wp.Width/2), wp.Position.Y-wp.Normal.Y*(wp.Width/2))
-			p2x, p2y := toScreen(wp.Position.X+wp.Normal.X*(wp.Width/2), wp.Position.Y+wp.Normal.Y*(wp.Width/2))
-			vector.StrokeLine(screen, p1x, p1y, p2x, p2y, 1, ColorFrenetFrame, true)
+		if g.Overlays.Has(OverlayRibs) && !smooth { // The clean view leaves out the ribs
+			drawRibs(screen, g.Mesh, toScreen, g.RibEvery)
+		}
+
+		if g.Overlays.Has(OverlayFrenetGrid) {
+			g.drawFrenetGrid(screen, toScreen)
+		}
+
+		if g.Overlays.Has(OverlayBoundaries) {
+			drawBoundaries(screen, g.Mesh, toScreen)
+		}
+
+		if g.Overlays.Has(OverlayRacingLine) {
+			drawRacingLine(screen, g.Mesh, g.RacingLine, toScreen)
+		}
+
+		if g.Overlays.Has(OverlayApexes) {
+			// Corner phases along the centerline (straights left undrawn)
+			for i, wp := range g.Mesh.Waypoints {
+				col, ok := ColorPhases[wp.Phase]
+				if !ok {
+					continue
+				}
+				next := g.Mesh.At(g.Mesh.Next(i))
+				p1x, p1y := toScreen(wp.Position.X, wp.Position.Y)
+				p2x, p2y := toScreen(next.Position.X, next.Position.Y)
+				vector.StrokeLine(screen, p1x, p1y, p2x, p2y, 3, col, true)
+			}
+
+			for _, idx := range g.Mesh.Apexes(track.ApexMinCurvature, track.ApexNMSWindow) {
+				wp := g.Mesh.Waypoints[idx]
+				x, y := toScreen(wp.Position.X, wp.Position.Y)
+				vector.FillCircle(screen, x, y, 4, ColorApex, true)
+			}
+		}
+
+		if g.Overlays.Has(OverlayBrakePoints) {
+			// A bar across the track where braking must begin, labelled with the apex speed to brake down to
+			for _, bp := range g.BrakePoints {
+				wp := g.Mesh.Waypoints[bp.WaypointIdx]
+				half := wp.Width / 2
+				p1x, p1y := toScreen(wp.Position.X-wp.Normal.X*half, wp.Position.Y-wp.Normal.Y*half)
+				p2x, p2y := toScreen(wp.Position.X+wp.Normal.X*half, wp.Position.Y+wp.Normal.Y*half)
+				vector.StrokeLine(screen, p1x, p1y, p2x, p2y, 3, ColorBrakePoint, true)
+				ebitenutil.DebugPrintAt(screen, g.HUD.SpeedUnit.FormatSpeed(bp.ApexSpeed), int(p2x)+4, int(p2y))
+			}
 		}
 	}
 
+	// Skid marks go under the lap traces
+	if g.Overlays.Has(OverlaySkids) {
+		g.Skids.Draw(screen, toScreen)
+	}
+
 	// Draw Best Lap Path (Light Green)
 	if len(g.BestLapPath) > 1 {
 		for j := 0; j < len(g.BestLapPath)-1; j++ {
@@ -241,15 +667,8 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	}
 
 	// Draw Tracelines (History)
-	traceColors := []color.RGBA{
-		ColorLapHistory1,
-		ColorLapHistory2,
-		ColorLapHistory3,
-		ColorLapHistory4,
-	}
-
 	for i, path := range g.LapHistory {
-		col := traceColors[i]
+		col := traceColor(i, g.MaxTraceHistory)
 		if len(path) > 1 {
 			for j := 0; j < len(path)-1; j++ {
 				p1x, p1y := toScreen(path[j].X, path[j].Y)
@@ -316,78 +735,372 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		vector.StrokeLine(screen, headX, headY, tipX, tipY, 2, ColorCarHeading, true)
 	}
 
-	// Draw HUD Background
-	// Panel size: 220x100 approx
-	// Let's Move the BOX to 0,0 to match DebugPrint.
-	vector.FillRect(screen, 0, 0, 140, 200, color.RGBA{0, 0, 0, 180}, true)
-	// vector.StrokeRect(screen, 0, 0, 250, 140, 2, color.RGBA{255, 255, 255, 100}, true)
+	g.drawHUD(screen)
+}
 
-	msg := "STATUS MONITOR\n"
-	msg += "----------------\n"
-	if g.AIMode {
-		msg += "Mode:   AI (Agent)\n"
-		msg += fmt.Sprintf("Speed:  %.2f\n", g.Car.Speed)
-		msg += fmt.Sprintf("Laps:   %d\n", g.NumLaps)
-	} else {
-		msg += "Mode:   Manual\n"
+// newAgent constructs the learner of the given kind (see AgentKinds) with the given
+// hyperparameters (the linear learners only take the exploration schedule and seed).
+func newAgent(kind string, cfg agent.AgentConfig) agent.Agent {
+	switch kind {
+	case "linear":
+		return agent.NewLinearAgent(cfg)
+	case "tiles":
+		return agent.NewTileCodedAgent(agent.DefaultTileCoder(), cfg)
+	case "tiles-steer":
+		return agent.NewSteeringTileCodedAgent(agent.DefaultTileCoder(), agent.TileSteerLevels, cfg)
+	case "sarsa":
+		a := agent.NewSARSAAgent(cfg)
+		a.ExploreByConfidence = ConfidenceExploration
+		return a
+	case "doubleq":
+		a := agent.NewDoubleQAgent(cfg)
+		a.ExploreByConfidence = ConfidenceExploration
+		return a
+	default:
+		a := agent.NewAgent(cfg)
+		a.ExploreByConfidence = ConfidenceExploration
+		return a
 	}
+}
 
-	// Time Info
-	bestTimeSec := float64(g.BestLapTime) / 60.0
-	lastTimeSec := float64(g.Car.LastLapTime) / 60.0
-	currTimeSec := float64(g.Car.CurrentLapTime) / 60.0
+// qtable is the agent's Q-table, for the tabular agents (Q-learning, SARSA and double Q,
+// whose first table it is); nil otherwise.
+func (g *Game) qtable() *agent.AgentQTable {
+	switch a := g.Agent.(type) {
+	case *agent.AgentQTable:
+		return a
+	case *agent.AgentSARSA:
+		return a.AgentQTable
+	case *agent.AgentDoubleQ:
+		return a.AgentQTable
+	}
+	return nil
+}
 
-	msg += fmt.Sprintf("Current: %.2fs\n", currTimeSec)
-	msg += fmt.Sprintf("Last:    %.2fs\n", lastTimeSec)
-	msg += fmt.Sprintf("Best:    %.2fs\n", bestTimeSec)
+// tableAgent is implemented by the tabular agents, for what has to cover all of their
+// tables (see qtable).
+type tableAgent interface {
+	Stats() agent.QTableStats
+	Prune(minVisits int) int
+}
 
-	// Draw Agent Specs Panel (Top Right)
-	if g.AIMode {
-		panelW := 140.0
-		panelH := 150.0
-		padding := 10.0
+// sessionAgent is implemented by agents that can persist their training session.
+type sessionAgent interface {
+	SaveSession(path string) error
+	LoadSession(path string) error
+}
 
-		targetX := float32(WindowWidth) - float32(panelW) - float32(padding)
-		targetY := float32(padding)
+func (g *Game) saveSession() {
+	sa, ok := g.Agent.(sessionAgent)
+	if !ok {
+		log.Printf("Agent does not support sessions")
+		return
+	}
+	if qa, ok := g.Agent.(tableAgent); ok && SessionPruneMinVisits > 0 {
+		log.Printf("Pruned %d Q-table states visited fewer than %d times", qa.Prune(SessionPruneMinVisits), SessionPruneMinVisits)
+	}
+	if err := sa.SaveSession(SessionPath); err != nil {
+		log.Printf("Saving session: %v", err)
+		return
+	}
+	log.Printf("Session saved to %s", SessionPath)
+}
 
-		vector.FillRect(screen, targetX, 0, float32(panelW), float32(panelH), color.RGBA{0, 0, 0, 180}, true)
+// loadSession resumes the session saved at SessionPath, reporting whether it could.
+func (g *Game) loadSession() bool {
+	sa, ok := g.Agent.(sessionAgent)
+	if !ok {
+		log.Printf("Agent does not support sessions")
+		return false
+	}
+	if err := sa.LoadSession(SessionPath); err != nil {
+		log.Printf("Loading session: %v", err)
+		return false
+	}
+	g.skipEpsilonMilestones()
+	log.Printf("Session loaded from %s", SessionPath)
+	return true
+}
 
-		specs := "AGENT PARAMS\n"
-		specs += "------------\n"
-		specs += g.Agent.DebugInfoStr()
+// qtableAgent is implemented by agents whose Q-table can be kept in a file from one run
+// to the next (see -qtable).
+type qtableAgent interface {
+	SaveToFile(path string) error
+	LoadFromFile(path string) error
+}
 
-		ebitenutil.DebugPrintAt(screen, specs, int(targetX)+10, int(targetY))
+// loadQTable continues training from the Q-table saved at path, if there is one yet,
+// reporting whether there was.
+func (g *Game) loadQTable(path string) bool {
+	qa, ok := g.Agent.(qtableAgent)
+	if !ok {
+		log.Printf("Agent does not support Q-table files")
+		return false
 	}
+	if err := qa.LoadFromFile(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Printf("No Q-table at %s yet; it will be saved there on exit", path)
+		} else {
+			log.Printf("Loading Q-table: %v", err)
+		}
+		return false
+	}
+	g.skipEpsilonMilestones()
+	log.Printf("Q-table loaded from %s", path)
+	return true
+}
 
-	if g.Car.Crashed {
-		msg += " [CRASHED]"
+// saveQTable writes the agent's Q-table to path for the next run to continue from.
+func (g *Game) saveQTable(path string) {
+	qa, ok := g.Agent.(qtableAgent)
+	if !ok {
+		return
 	}
-	if g.Training {
-		msg += " [High speed]"
+	if err := qa.SaveToFile(path); err != nil {
+		log.Printf("Saving Q-table: %v", err)
+		return
+	}
+	log.Printf("Q-table saved to %s", path)
+}
+
+// computeBrakePoints finds the ideal brake point for every apex, from the corner
+// speeds the car's turn rate allows on the widest line through each corner (see
+// track.TargetSpeeds) and its full-braking deceleration.
+func computeBrakePoints(mesh *track.TrackMesh, targets []float64, car physics.CarParams) []track.BrakePoint {
+	apexes := mesh.Apexes(track.ApexMinCurvature, track.ApexNMSWindow)
+	return mesh.BrakePoints(apexes, targets, car.Deceleration(), car.MaxSpeed)
+}
+
+// demoAgent is implemented by agents that can be warm-started from recorded demonstrations.
+type demoAgent interface {
+	PretrainFromDemos(path string) error
+}
+
+func (g *Game) startRecording() {
+	rec, err := agent.NewDemoRecorder(DemoPath)
+	if err != nil {
+		log.Printf("Starting demonstration recording: %v", err)
+		return
+	}
+	g.Recorder = rec
+	log.Printf("Recording demonstrations to %s", DemoPath)
+}
+
+func (g *Game) stopRecording() {
+	if g.Recorder == nil {
+		return
+	}
+	if err := g.Recorder.Close(); err != nil {
+		log.Printf("Closing demonstration file: %v", err)
+	}
+	log.Printf("Recorded %d demonstration steps to %s", g.Recorder.Count, DemoPath)
+	g.Recorder = nil
+}
+
+func (g *Game) pretrainFromDemos() {
+	da, ok := g.Agent.(demoAgent)
+	if !ok {
+		log.Printf("Agent does not support demonstration pretraining")
+		return
+	}
+	g.stopRecording() // Flush anything still being recorded into the dataset first
+	if err := da.PretrainFromDemos(DemoPath); err != nil {
+		log.Printf("Pretraining from demonstrations: %v", err)
+		return
+	}
+	log.Printf("Pretrained agent from %s", DemoPath)
+}
+
+// regenerateMesh rebuilds the mesh starting at the car's position and heading,
+// then resets everything that was expressed in the old mesh's indices/distances:
+// the car's progress, lap times and traces, and the agent (its states are keyed on segment indices).
+func (g *Game) regenerateMesh() {
+	mesh := track.GenerateMeshFrom(g.Grid, int(g.Car.Position.X), int(g.Car.Position.Y), g.Car.Heading)
+	mesh.Resample(g.TrackSpacing)
+	if len(mesh.Waypoints) == 0 {
+		log.Printf("Mesh regeneration from (%.0f, %.0f) produced no waypoints; keeping the old mesh", g.Car.Position.X, g.Car.Position.Y)
+		return
+	}
+	shape := "a loop"
+	switch {
+	case mesh.DeadEnd:
+		shape = "point to point"
+	case !mesh.Looped:
+		shape = "open: the walk didn't get back to the start"
+	}
+	log.Printf("Regenerated mesh from (%.0f, %.0f) heading %.0f deg: %d waypoints, %s",
+		g.Car.Position.X, g.Car.Position.Y, g.Car.Heading*180/math.Pi, len(mesh.Waypoints), shape)
+
+	g.setMesh(mesh, 0, false)
+}
+
+// ReloadTrack loads the track image at path and rebuilds everything derived from it:
+// the grid, its rendering, the view fit, and the mesh (see setMesh). With keepAgent the
+// learner survives the reload, which is only meaningful if the track didn't change much.
+func (g *Game) ReloadTrack(path string, keepAgent bool) error {
+	grid, mesh, err := track.LoadTrackFromImageWith(path, track.LoadOptions{MaxDim: TrackMaxDim, Coords: g.TrackCoords, Spacing: g.TrackSpacing, MeshCache: MeshCacheDir})
+	if err != nil {
+		return err
+	}
+	if len(mesh.Waypoints) < 2 {
+		return fmt.Errorf("no track found in %s: the mesh has %d waypoints (is the road light on a dark background?)", path, len(mesh.Waypoints))
+	}
+
+	g.TrackPath = path
+	if info, err := os.Stat(path); err == nil {
+		g.TrackModTime = info.ModTime()
+	}
+	g.Grid = grid
+	g.TrackImage = RenderGrid(grid)
+	g.Surface = NewTrackSurface(grid)
+	g.fitView()
+
+	spawnIdx := CarSpawnWaypointIndex
+	if spawnIdx >= len(mesh.Waypoints) {
+		spawnIdx = 0
+	}
+	g.setMesh(mesh, spawnIdx, keepAgent)
+	return nil
+}
+
+// watchTrack reloads the track when its file changes on disk. Called every frame;
+// only stats the file every TrackWatchInterval frames.
+func (g *Game) watchTrack() {
+	g.trackWatchFrames++
+	if g.TrackPath == "" || g.trackWatchFrames < TrackWatchInterval {
+		return
+	}
+	g.trackWatchFrames = 0
+
+	info, err := os.Stat(g.TrackPath)
+	if err != nil || info.ModTime().Equal(g.TrackModTime) {
+		return
+	}
+	g.TrackModTime = info.ModTime() // Don't retry a broken save until the next one
+	g.reloadTrack()
+}
+
+func (g *Game) reloadTrack() {
+	if err := g.ReloadTrack(g.TrackPath, ReloadKeepsAgent); err != nil {
+		log.Printf("Reloading %s: %v", g.TrackPath, err)
+		return
+	}
+	log.Printf("Reloaded %s: %d waypoints", g.TrackPath, len(g.Mesh.Waypoints))
+}
+
+// fitView scales and centers the grid in the window.
+func (g *Game) fitView() {
+	// 1. Calculate Scale to fit
+	winW, winH := float64(WindowWidth), float64(WindowHeight)
+	scaleW := winW / float64(g.Grid.Width)
+	scaleH := winH / float64(g.Grid.Height)
+
+	viewScale := float32(scaleW)
+	if scaleH < scaleW {
+		viewScale = float32(scaleH)
+	}
+	// Add some margin
+	viewScale *= ViewScaleMargin
+
+	// 2. Center the track
+	g.ViewScale = viewScale
+	g.ViewOffsetX = (float32(winW) - float32(g.Grid.Width)*viewScale) / 2
+	g.ViewOffsetY = (float32(winH) - float32(g.Grid.Height)*viewScale) / 2
+}
+
+// setMesh switches to a new mesh and resets everything that was expressed in the old
+// mesh's indices/distances: the car (respawned at waypoint spawnIdx), laps, times, traces
+// and, unless keepAgent, the agent (its states are keyed on segment indices).
+func (g *Game) setMesh(mesh *track.TrackMesh, spawnIdx int, keepAgent bool) {
+	g.stopRecording() // Recorded states index the old mesh
+	g.saveBestLap()   // Before the old mesh's best lap is cleared below
+
+	g.Mesh = mesh
+	g.TargetSpeeds = mesh.TargetSpeeds(g.CarParams.TurnSpeed, g.CarParams.MaxSpeed)
+	g.BrakePoints = computeBrakePoints(mesh, g.TargetSpeeds, g.CarParams)
+	g.RacingLine = track.OptimizeRacingLine(mesh)
+	if len(mesh.Waypoints) > 0 {
+		g.Car = spawnCarAt(mesh, spawnIdx, g.CarParams)
 	} else {
-		msg += " [Real-time speed]"
-	}
-	msg += "\nControls:\nS = Toggle Slow Mode"
-
-	// Position text with padding inside the box
-	// ebitenutil.DebugPrint draws at 0,0 by default.
-	// We'll wrap it in a Translate? No, DebugPrint is extremely simple.
-	// We'll use DebugPrintAt to position it. But we don't have that imported?
-	// DebugPrint supports newlines but fixed pos.
-	// Actually, DebugPrint always draws at 0,0.
-	// Let's rely on the box being at 0,0 approx (10,10).
-	// We need to move the TEXT to 15,15.
-	// `ebitenutil.DebugPrintAt` exists? Let's check imports.
-	// ebitenutil is imported.
-	// Let's assume DebugPrintAt is not available in standard ebitenutil?
-	// Wait, standard ebitenutil ONLY has DebugPrint.
-	// Creating a custom PrintAt using DebugPrint is impossible because it hardcodes position.
-	// I should use `text.Draw` if I want position.
-	// But I don't want to load fonts right now.
-	// Hack: Pad the string with spaces/newlines?
-	// Or just draw the box at 0,0.
-
-	ebitenutil.DebugPrint(screen, msg)
+		g.Car = physics.NewCar(400.0, 110.0, g.CarParams)
+	}
+	g.Car.Config.Model = g.CarModel
+	g.Car.Checkpoint = -1 // Not started
+
+	g.NumLaps = 0
+	g.BestLapTime = 0
+	g.BestLapPath = nil
+	g.CurrentLapPath = []common.Vec2{}
+	g.LapHistory = nil
+	g.Skids.Clear()
+	g.LastCrash = nil
+	g.resetSectors()
+	g.LapTelemetry = LapTelemetry{}
+	g.BestSectorTimes = [SectorCount]int{}
+	g.LastLapTelemetry = nil
+	g.BestLine = nil
+	g.LapAdherence, g.LastLapAdherence = track.Adherence{}, track.Adherence{}
+
+	if !keepAgent || g.Agent == nil {
+		g.Agent = newAgent(g.AgentKind, g.AgentConfig)
+		g.skipEpsilonMilestones()
+	}
+	if qa := g.qtable(); qa != nil {
+		qa.Track = g.Grid.Hash() // Sessions from other tracks won't load
+	}
+	g.CurrentState, g.CurrentAction = agent.State{}, 0
+	g.CurrentReward, g.EpisodeReward = agent.RewardBreakdown{}, agent.RewardBreakdown{}
+	g.haveNextState = false
+}
+
+// spawnCarAt places a fresh car on waypoint idx, heading along the track
+// (towards the next waypoint), with the checkpoint set so progress counts from there.
+func spawnCarAt(mesh *track.TrackMesh, idx int, params physics.CarParams) *physics.Car {
+	from, to := mesh.Waypoints[idx], mesh.At(mesh.Next(idx))
+	if mesh.Next(idx) == idx {
+		from = mesh.At(mesh.Prev(idx)) // End of an open track: head along the last segment
+	}
+
+	wp := mesh.Waypoints[idx]
+	car := physics.NewCar(wp.Position.X, wp.Position.Y, params)
+	car.Heading = math.Atan2(to.Position.Y-from.Position.Y, to.Position.X-from.Position.X)
+	car.Checkpoint = idx
+	return car
+}
+
+// drawFrenetGrid draws the d iso-offset curves (polylines parallel to the centerline,
+// built from each waypoint's normal) and marks every Nth s value along the centerline.
+func (g *Game) drawFrenetGrid(screen *ebiten.Image, toScreen func(x, y float64) (float32, float32)) {
+	wps := g.Mesh.Waypoints
+	n := len(wps)
+	if n < 2 {
+		return
+	}
+
+	// d isolines (on a looped track the last waypoint connects back to the first)
+	for _, d := range FrenetGridOffsets {
+		for i := 0; i < n; i++ {
+			a := wps[i]
+			b := g.Mesh.At(g.Mesh.Next(i))
+			p1x, p1y := toScreen(a.Position.X+a.Normal.X*d, a.Position.Y+a.Normal.Y*d)
+			p2x, p2y := toScreen(b.Position.X+b.Normal.X*d, b.Position.Y+b.Normal.Y*d)
+			vector.StrokeLine(screen, p1x, p1y, p2x, p2y, 1, ColorFrenetGrid, true)
+		}
+	}
+
+	// s marks: a short tick across the centerline plus the s value
+	if FrenetGridMarkEvery <= 0 {
+		return
+	}
+	for i := 0; i < n; i += FrenetGridMarkEvery {
+		wp := wps[i]
+		p1x, p1y := toScreen(wp.Position.X-wp.Normal.X*4, wp.Position.Y-wp.Normal.Y*4)
+		p2x, p2y := toScreen(wp.Position.X+wp.Normal.X*4, wp.Position.Y+wp.Normal.Y*4)
+		vector.StrokeLine(screen, p1x, p1y, p2x, p2y, 2, ColorFrenetMark, true)
+
+		lx, ly := toScreen(wp.Position.X, wp.Position.Y)
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%.0f", wp.Distance), int(lx)+4, int(ly)+4)
+	}
 }
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeight int) {
@@ -398,8 +1111,7 @@ func RenderGrid(g *track.Grid) *ebiten.Image {
 	img := ebiten.NewImage(g.Width, g.Height)
 	// We can map pixels directly
 	// For performance in Ebiten, it's better to use ReplacePixels or similar if we have the byte slice
-	// But since our Grid is a struct of Cells, we iterate.
-	// Optimization: Grid should probably hold a byte slice for the visual layer to avoid this loop every time we load - could make logic involving coords elsewhere harder to code.
+	// But since our Grid is a struct of Cells, we iterate (row by row, the order they're stored in).
 
 	pixels := make([]byte, g.Width*g.Height*4)
 	for y := 0; y < g.Height; y++ {
@@ -433,79 +1145,192 @@ func RenderGrid(g *track.Grid) *ebiten.Image {
 }
 
 func main() {
-	trackPath := InputTrackPath
-	grid, mesh, err := track.LoadTrackFromImage(trackPath)
+	interrupts := new(Interrupts)
+	if err := run(interrupts); err != nil {
+		log.Fatal(err)
+	}
+	interrupts.Reraise()
+}
+
+// run is the app: it parses the command line and runs what it asks for. Errors are
+// returned rather than fatal, so the deferred cleanup (the CPU profile above all,
+// which is truncated if it isn't stopped) runs however it ends. Once set up, it
+// catches interrupts for a clean shutdown (see Interrupts); main re-raises them after.
+func run(interrupts *Interrupts) error {
+	trackPath := flag.String("track", InputTrackPath, "Track image to load, e.g. any of processed_tracks/")
+	renderVideo := flag.String("render-video", "", "Render the saved lap to PNG frames in this directory, then exit")
+	fps := flag.Int("fps", 60, "Frame rate for -render-video")
+	lapPath := flag.String("lap", BestLapFile, "Saved lap to replay with -render-video")
+	nudge := flag.Bool("nudge", false, "Training: put a crashed car back on the track where it crashed instead of respawning it")
+	evalLaps := flag.Int("eval", 0, "Evaluate the saved session's (or with -train-ticks, the trained) greedy policy over this many clean laps, print the results, then exit")
+	evalCSV := flag.String("eval-csv", EvalResultsPath, "Results file -eval appends to (empty = don't save)")
+	trainTicks := flag.Int("train-ticks", 0, "Train headlessly (no window) for this many ticks, then exit")
+	trainLaps := flag.Int("train-laps", 0, "Train headlessly (no window) until the car has completed this many laps (or -train-ticks run out), then exit")
+	pprofAddr := flag.String("pprof", "", "Serve net/http/pprof on this address (e.g. :6060)")
+	cpuProfile := flag.String("cpuprofile", "", "Write a CPU profile of the run to this file")
+	memProfile := flag.String("memprofile", "", "Write a heap profile to this file on exit")
+	cornersPath := flag.String("corners", "", "Write the track's corner guide (apex, target speed, brake point per corner) to this file (.json, else CSV), then exit")
+	carPath := flag.String("car", "", "Vehicle (max_speed, acceleration, braking, friction, turn_speed, downforce, downforce_cap) from this JSON file, e.g. a nimble kart or a heavy GT car; anything it leaves out keeps the stock car's value")
+	drift := flag.Bool("drift", false, "Drive with the drift physics model (velocity separate from heading, tyres that can slide) instead of arcade grip")
+	agentKind := flag.String("agent", DefaultAgentKind, "Learner to train: "+strings.Join(AgentKinds, ", ")+" (sarsa learns on-policy, from the action it takes next; doubleq keeps two tables to curb overestimated values)")
+	configPath := flag.String("config", "", "Agent hyperparameters (alpha, gamma, exploration schedule, reward terms) from this JSON file; anything it leaves out keeps its default")
+	epsilon := flag.Float64("epsilon", agent.StartEpsilon, "Exploration rate new agents start decaying from (after the warmup); overrides -config")
+	seed := flag.Uint64("seed", 0, "Seed of the agent's random source, so runs with the same seed, track and config train identically (0 = random); overrides -config")
+	warmup := flag.Int("warmup", 0, "Learning steps of purely random actions before the exploration rate starts to decay; overrides -config")
+	coords := flag.String("coords", "image", "Coordinate convention of the track's sidecar and of exported lines (-export, F7): image (+Y down, headings clockwise) or y-up (+Y up, headings counter-clockwise)")
+	adaptiveSpacing := flag.Bool("adaptive-spacing", false, "Space the mesh's waypoints by curvature, 2px apart through hairpins to 10px on straights, instead of evenly")
+	traces := flag.Int("traces", DefaultTraceHistory, "Completed lap traces kept on screen, fading with age")
+	qtablePath := flag.String("qtable", "", "Load the Q-table from this file (JSON) on startup if it exists, and save it there on a clean exit, to train over many runs")
+	export := flag.String("export", "", "Write the best lap and the racing line to this file (.geojson, else CSV) at the end of the run; F7 writes them there (default "+DefaultLineExportPath+") any time")
+	lapTrace := flag.String("lap-trace", "", "Append every completed lap's path to this file (NDJSON, one lap per line with its time), e.g. to animate the session's progression afterwards")
+	flag.Parse()
+
+	prof, err := startProfiling(*pprofAddr, *cpuProfile, *memProfile)
 	if err != nil {
-		// Fallback to assets/track.png if not found
-		trackPath = "assets/track.png"
-		grid, mesh, err = track.LoadTrackFromImage(trackPath)
-		if err != nil {
-			log.Fatal(err)
-		}
+		return fmt.Errorf("starting profiling: %w", err)
 	}
+	defer prof.Stop()
 
-	trackImg := RenderGrid(grid)
+	keys, err := LoadKeyBindings(KeyBindingsPath)
+	if err != nil {
+		return fmt.Errorf("loading key bindings: %w", err)
+	}
 
 	ebiten.SetWindowSize(WindowWidth, WindowHeight)
 	ebiten.SetWindowTitle("Racing Line Mapper")
 
-	// 1. Calculate Scale to fit
-	winW, winH := float64(WindowWidth), float64(WindowHeight)
-	scaleW := winW / float64(grid.Width)
-	scaleH := winH / float64(grid.Height)
-
-	viewScale := float32(scaleW)
-	if scaleH < scaleW {
-		viewScale = float32(scaleH)
-	}
-	// Add some margin
-	viewScale *= ViewScaleMargin
+	game := &Game{
+		AIMode:   true,
+		Training: true,
+		HUD:      DefaultHUDSettings(),
+		Keys:     keys,
 
-	// 2. Center the track
-	viewOffsetX := (float32(winW) - float32(grid.Width)*viewScale) / 2
-	viewOffsetY := (float32(winH) - float32(grid.Height)*viewScale) / 2
+		Overlays: DefaultOverlays,
+		RibEvery: RibDensities[0],
 
-	// Spawn car at first waypoint
-	startX, startY := 400.0, 110.0
-	startHeading := 0.0
-	if len(mesh.Waypoints) > 0 {
-		// Start at configured waypoint index
-		startIdx := CarSpawnWaypointIndex
-		if startIdx >= len(mesh.Waypoints) {
-			startIdx = 0
+		NudgeOnCrash:    *nudge,
+		MaxTraceHistory: max(*traces, 0),
+		ExportPath:      cmp.Or(*export, DefaultLineExportPath),
+	}
+	if !slices.Contains(AgentKinds, *agentKind) {
+		return fmt.Errorf("unknown -agent %q (want one of %s)", *agentKind, strings.Join(AgentKinds, ", "))
+	}
+	game.AgentKind = *agentKind
+	game.AgentConfig = agent.DefaultAgentConfig()
+	if *configPath != "" {
+		if game.AgentConfig, err = agent.LoadAgentConfig(*configPath); err != nil {
+			return fmt.Errorf("loading agent config: %w", err)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) { // Explicit flags win over the config file
+		switch f.Name {
+		case "epsilon":
+			game.AgentConfig.Exploration.Start = *epsilon
+		case "warmup":
+			game.AgentConfig.Exploration.Warmup = *warmup
+		case "seed":
+			game.AgentConfig.Seed = *seed
+		}
+	})
+	if game.AgentConfig.Replay.Size > 0 && game.AgentKind != DefaultAgentKind {
+		return fmt.Errorf("agent config: replay is Q-learning only, -agent %s doesn't use it (set replay.size to 0)", game.AgentKind)
+	}
+	if *drift {
+		game.CarModel = physics.ModelDrift
+	}
+	game.CarParams = physics.DefaultCarParams()
+	if *carPath != "" {
+		if game.CarParams, err = physics.LoadCarParams(*carPath); err != nil {
+			return fmt.Errorf("loading car: %w", err)
 		}
+	}
+	if game.TrackCoords, err = track.ParseCoords(*coords); err != nil {
+		return err
+	}
+	if *adaptiveSpacing {
+		game.TrackSpacing = track.DefaultAdaptiveSpacing
+	}
 
-		wp := mesh.Waypoints[startIdx]
-		startX = wp.Position.X
-		startY = wp.Position.Y
+	if err := game.ReloadTrack(*trackPath, false); err != nil {
+		// Only the default track falls back; one asked for by name has to load
+		explicit := false
+		flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "track" })
+		if explicit || !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("loading track %s: %w", *trackPath, err)
+		}
+		log.Printf("No track at %s, using %s", *trackPath, FallbackTrackPath)
+		if err := game.ReloadTrack(FallbackTrackPath, false); err != nil {
+			return fmt.Errorf("loading track %s: %w", FallbackTrackPath, err)
+		}
+	}
 
-		// Align heading with track direction (Normal rotated 90 deg)
-		// Normal = (-dy, dx), so Direction = (dx, dy) = (Normal.Y, -Normal.X)
-		// Actually, let's just use the vector to the next waypoint
-		nextWP := mesh.Waypoints[(startIdx+1)%len(mesh.Waypoints)]
-		dx := nextWP.Position.X - wp.Position.X
-		dy := nextWP.Position.Y - wp.Position.Y
-		startHeading = math.Atan2(dy, dx)
+	if *cornersPath != "" {
+		if err := writeCornerGuide(game.Mesh, game.CarParams, *cornersPath); err != nil {
+			return err
+		}
+		log.Printf("Wrote the corner guide to %s", *cornersPath)
+		return nil
 	}
 
-	car := physics.NewCar(startX, startY)
-	car.Heading = startHeading
-	ag := agent.NewAgent()
+	loaded := false // A learned policy to evaluate without training first
+	if *qtablePath != "" {
+		loaded = game.loadQTable(*qtablePath)
+	}
+	if *lapTrace != "" {
+		if game.LapTrace, err = NewLapTraceWriter(*lapTrace); err != nil {
+			return fmt.Errorf("opening lap trace: %w", err)
+		}
+		defer game.closeLapTrace()
+	}
+	defer game.saveBestLap()
+	interrupts.Listen()
+	game.Interrupt = interrupts
+
+	// Headless runs: train, evaluate (the agent just trained, else the saved session), or both
+	if *trainTicks > 0 || *trainLaps > 0 || *evalLaps > 0 {
+		if *trainTicks > 0 || *trainLaps > 0 {
+			game.trainHeadless(*trainTicks, *trainLaps)
+			if *qtablePath != "" {
+				game.saveQTable(*qtablePath)
+			}
+		} else {
+			if *qtablePath == "" {
+				loaded = game.loadSession()
+			}
+			if !loaded { // A fresh agent's greedy policy would say nothing
+				return errors.New("-eval: no saved session or Q-table to evaluate; train one first (-train-ticks or -train-laps)")
+			}
+		}
+		if *evalLaps > 0 && !game.Interrupt.Received() {
+			game.evaluate(*evalLaps, *evalCSV)
+		}
+		if *export != "" {
+			game.exportLines(*export)
+		}
+		return nil
+	}
 
-	game := &Game{
-		Grid:        grid,
-		Mesh:        mesh,
-		TrackImage:  trackImg,
-		Car:         car,
-		Agent:       ag,
-		AIMode:      true,
-		Training:    true,
-		ViewScale:   viewScale,
-		ViewOffsetX: viewOffsetX,
-		ViewOffsetY: viewOffsetY,
+	if *renderVideo != "" {
+		replay, err := newReplay(*lapPath, *renderVideo, *fps)
+		if err != nil {
+			return err
+		}
+		game.Replay = replay
+		game.Car = replayCar(replay, game.CarParams)
+		game.AIMode, game.Training = false, false
+		game.BestLapPath = replay.Lap.Points
+		game.HUD = HUDSettings{SpeedUnit: game.HUD.SpeedUnit, TimeUnit: game.HUD.TimeUnit} // Clean frames: caption only
+		log.Printf("Rendering %d frames at %d fps to %s", replay.Frames(), *fps, *renderVideo)
 	}
 
 	if err := ebiten.RunGame(game); err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if *qtablePath != "" && game.Replay == nil {
+		game.saveQTable(*qtablePath)
 	}
+	if *export != "" && game.Replay == nil {
+		game.exportLines(*export)
+	}
+	return nil
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"racing-line-mapper/internal/common"
+	"racing-line-mapper/internal/track"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// Overlay is a debug layer drawn over the track that can be switched on and off.
+type Overlay int
+
+const (
+	OverlayRibs        Overlay = iota // Mesh ribs: each waypoint's normal across the track width
+	OverlayFrenetGrid                 // s/d isolines
+	OverlayApexes                     // Corner phases and curvature maxima
+	OverlayBrakePoints                // Ideal brake points before each corner
+	OverlaySkids                      // Skid marks where the car slid
+	OverlayBoundaries                 // Track edges taken from the mesh
+	OverlayRacingLine                 // Minimum-curvature line (see track.OptimizeRacingLine)
+)
+
+// Overlays is the set of overlays shown, a bit per Overlay.
+type Overlays uint
+
+// OverlaysOf returns the set of the given overlays.
+func OverlaysOf(overlays ...Overlay) Overlays {
+	var s Overlays
+	for _, o := range overlays {
+		s |= 1 << o
+	}
+	return s
+}
+
+// Has reports whether o is shown.
+func (s Overlays) Has(o Overlay) bool { return s&(1<<o) != 0 }
+
+// Toggle shows o if it's hidden and hides it if it's shown.
+func (s *Overlays) Toggle(o Overlay) { *s ^= 1 << o }
+
+// DefaultOverlays are shown at startup.
+var DefaultOverlays = OverlaysOf(OverlayRibs, OverlaySkids, OverlayRacingLine)
+
+// RibDensities are the choices the rib density key cycles through: draw every Nth rib.
+var RibDensities = []int{1, 2, 4, 8}
+
+// cycleRibDensity steps RibEvery to the next of RibDensities (back to the first after the last).
+func (g *Game) cycleRibDensity() {
+	next := RibDensities[0]
+	for i, n := range RibDensities {
+		if n == g.RibEvery && i+1 < len(RibDensities) {
+			next = RibDensities[i+1]
+		}
+	}
+	g.RibEvery = next
+}
+
+// drawBoundaries draws the mesh's left and right track edges (see track.TrackMesh.GetBoundaries).
+func drawBoundaries(screen *ebiten.Image, mesh *track.TrackMesh, toScreen func(x, y float64) (float32, float32)) {
+	left, right := mesh.GetBoundaries()
+	for _, edge := range [][]common.Vec2{left, right} {
+		for i := range edge {
+			j := mesh.Next(i)
+			if j == i {
+				continue // End of an open track
+			}
+			p1x, p1y := toScreen(edge[i].X, edge[i].Y)
+			p2x, p2y := toScreen(edge[j].X, edge[j].Y)
+			vector.StrokeLine(screen, p1x, p1y, p2x, p2y, 1.5, ColorBoundary, true)
+		}
+	}
+}
+
+// drawRacingLine draws the optimized line, a point per waypoint, closed on a looped track.
+func drawRacingLine(screen *ebiten.Image, mesh *track.TrackMesh, line []common.Vec2, toScreen func(x, y float64) (float32, float32)) {
+	for i := range line {
+		j := mesh.Next(i)
+		if j == i || j >= len(line) {
+			continue
+		}
+		p1x, p1y := toScreen(line[i].X, line[i].Y)
+		p2x, p2y := toScreen(line[j].X, line[j].Y)
+		vector.StrokeLine(screen, p1x, p1y, p2x, p2y, 2, ColorRacingLine, true)
+	}
+}
+
+// drawRibs draws every nth waypoint's normal across the full track width.
+func drawRibs(screen *ebiten.Image, mesh *track.TrackMesh, toScreen func(x, y float64) (float32, float32), every int) {
+	every = max(every, 1)
+	for i := 0; i < len(mesh.Waypoints); i += every {
+		wp := mesh.Waypoints[i]
+		half := wp.Width / 2
+		p1x, p1y := toScreen(wp.Position.X-wp.Normal.X*half, wp.Position.Y-wp.Normal.Y*half)
+		p2x, p2y := toScreen(wp.Position.X+wp.Normal.X*half, wp.Position.Y+wp.Normal.Y*half)
+		vector.StrokeLine(screen, p1x, p1y, p2x, p2y, 1, ColorFrenetFrame, true)
+	}
+}
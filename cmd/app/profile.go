@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	_ "net/http/pprof" // Registers the /debug/pprof handlers
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// profiler runs the profiling requested on the command line (see startProfiling).
+type profiler struct {
+	cpu     *os.File
+	memPath string
+}
+
+// startProfiling serves net/http/pprof on pprofAddr (e.g. ":6060") and starts a CPU
+// profile into cpuPath; each is skipped if empty. Stop ends the CPU profile and writes
+// a heap profile to memPath (if set).
+func startProfiling(pprofAddr, cpuPath, memPath string) (*profiler, error) {
+	p := &profiler{memPath: memPath}
+	if pprofAddr != "" {
+		go func() {
+			log.Printf("pprof listening on http://%s/debug/pprof/", pprofAddr)
+			if err := http.ListenAndServe(pprofAddr, nil); err != nil {
+				log.Printf("pprof server: %v", err)
+			}
+		}()
+	}
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		p.cpu = f
+	}
+	return p, nil
+}
+
+// Stop finishes the profiles, logging (rather than returning) any error so it can be
+// deferred on the way out.
+func (p *profiler) Stop() {
+	if p.cpu != nil {
+		pprof.StopCPUProfile()
+		if err := p.cpu.Close(); err != nil {
+			log.Printf("Writing CPU profile: %v", err)
+		}
+		p.cpu = nil
+	}
+	if p.memPath != "" {
+		f, err := os.Create(p.memPath)
+		if err != nil {
+			log.Printf("Writing heap profile: %v", err)
+			return
+		}
+		defer f.Close()
+		runtime.GC() // Up to date allocation statistics
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			log.Printf("Writing heap profile: %v", err)
+		}
+		p.memPath = ""
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"racing-line-mapper/internal/common"
+	"racing-line-mapper/internal/physics"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+// SavedLap is a recorded lap trace on disk.
+type SavedLap struct {
+	LapTime     int           `json:"lap_time"`     // Ticks
+	SampleEvery int           `json:"sample_every"` // Ticks between consecutive points
+	Points      []common.Vec2 `json:"points"`
+}
+
+func saveLap(path string, lap SavedLap) error {
+	data, err := json.Marshal(lap)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// saveBestLap writes the best lap to BestLapFile if it has improved since the last write.
+// It runs once when the app exits (interrupted or not) rather than on every new best,
+// which early in training comes every few laps.
+func (g *Game) saveBestLap() {
+	if !g.bestLapUnsaved {
+		return
+	}
+	if err := saveLap(BestLapFile, SavedLap{LapTime: g.BestLapTime, SampleEvery: TraceSampleTicks, Points: g.BestLapPath}); err != nil {
+		log.Printf("Saving best lap: %v", err)
+		return
+	}
+	g.bestLapUnsaved = false
+	log.Printf("Best lap saved to %s", BestLapFile)
+}
+
+func loadLap(path string) (SavedLap, error) {
+	var lap SavedLap
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return lap, err
+	}
+	if err := json.Unmarshal(data, &lap); err != nil {
+		return lap, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(lap.Points) < 2 || lap.SampleEvery <= 0 {
+		return lap, fmt.Errorf("%s: lap has no usable trace", path)
+	}
+	return lap, nil
+}
+
+// Replay animates a car along a saved lap at a fixed frame rate, writing every
+// frame to OutDir. Time advances per rendered frame, not per wall-clock tick,
+// so the output is identical on every run.
+type Replay struct {
+	Lap    SavedLap
+	OutDir string
+	FPS    int
+	Frame  int
+
+	canvas   *ebiten.Image
+	captured bool // Current frame already written
+}
+
+// Frames is the number of frames needed to cover the whole lap.
+func (r *Replay) Frames() int {
+	return int(math.Ceil(float64(r.Lap.LapTime) / TicksPerSecond * float64(r.FPS)))
+}
+
+// pose returns the car's position, heading and speed (pixels per tick) at the given lap time.
+func (r *Replay) pose(ticks float64) (common.Vec2, float64, float64) {
+	u := ticks / float64(r.Lap.SampleEvery)
+	pos := common.SamplePath(r.Lap.Points, u)
+	ahead := common.SamplePath(r.Lap.Points, u+0.05)
+	d := ahead.Sub(pos)
+	heading := math.Atan2(d.Y, d.X)
+	speed := d.Len() / (0.05 * float64(r.Lap.SampleEvery))
+	return pos, heading, speed
+}
+
+// updateReplay moves on to the next frame once the current one has been written,
+// and ends the program after the last frame.
+func (g *Game) updateReplay() error {
+	r := g.Replay
+	if r.captured {
+		r.Frame++
+		r.captured = false
+	}
+	if r.Frame >= r.Frames() {
+		return ebiten.Termination
+	}
+
+	ticks := float64(r.Frame) * TicksPerSecond / float64(r.FPS)
+	pos, heading, speed := r.pose(ticks)
+	g.Car.Position, g.Car.Heading, g.Car.Speed = pos, heading, speed
+	g.Car.CurrentLapTime = int(ticks)
+	return nil
+}
+
+// drawReplay renders the scene to an offscreen canvas, shows it, and writes it out as the current frame.
+func (g *Game) drawReplay(screen *ebiten.Image) {
+	r := g.Replay
+	if r.canvas == nil {
+		r.canvas = ebiten.NewImage(WindowWidth, WindowHeight)
+	}
+	r.canvas.Fill(color.Black)
+	g.draw(r.canvas)
+	ebitenutil.DebugPrintAt(r.canvas, fmt.Sprintf("Lap %s  %s", g.HUD.TimeUnit.FormatTime(g.Car.CurrentLapTime),
+		g.HUD.SpeedUnit.FormatSpeed(g.Car.Speed)), 10, 10)
+	screen.DrawImage(r.canvas, nil)
+
+	if r.captured || r.Frame >= r.Frames() {
+		return
+	}
+	path := filepath.Join(r.OutDir, fmt.Sprintf("frame_%05d.png", r.Frame))
+	if err := writePNG(path, captureImage(r.canvas)); err != nil {
+		fmt.Fprintf(os.Stderr, "writing %s: %v\n", path, err)
+	}
+	r.captured = true
+}
+
+// newReplay sets up video rendering of the lap saved at lapPath into outDir.
+func newReplay(lapPath, outDir string, fps int) (*Replay, error) {
+	if fps <= 0 {
+		return nil, fmt.Errorf("fps must be positive, got %d", fps)
+	}
+	lap, err := loadLap(lapPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Replay{Lap: lap, OutDir: outDir, FPS: fps}, nil
+}
+
+// replayCar is the car used to show the replay, placed at the start of the trace.
+func replayCar(r *Replay, params physics.CarParams) *physics.Car {
+	pos, heading, _ := r.pose(0)
+	car := physics.NewCar(pos.X, pos.Y, params)
+	car.Heading = heading
+	return car
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"racing-line-mapper/internal/agent"
+	"racing-line-mapper/internal/common"
+	"racing-line-mapper/internal/physics"
+	"racing-line-mapper/internal/track"
+	"testing"
+)
+
+// TestSetMeshSavesTheBestLap checks a best lap not yet written survives a re-mesh: it's
+// saved before setMesh clears it, and the exit save doesn't then overwrite it with nothing.
+func TestSetMeshSavesTheBestLap(t *testing.T) {
+	t.Chdir(t.TempDir())
+	var wps []track.Waypoint
+	for i := range 30 {
+		wps = append(wps, track.Waypoint{ID: i, Position: common.Vec2{X: float64(i) * 5, Y: 50}, Normal: common.Vec2{Y: 1}, Width: 50, Distance: float64(i) * 5})
+	}
+	mesh := &track.TrackMesh{Waypoints: wps, TotalLen: 150, Looped: true}
+	g := &Game{Grid: track.NewGrid(200, 100), CarParams: physics.DefaultCarParams(), AgentKind: DefaultAgentKind, AgentConfig: agent.DefaultAgentConfig()}
+	g.setMesh(mesh, 0, false)
+
+	path := []common.Vec2{{X: 10, Y: 50}, {X: 20, Y: 50}}
+	g.BestLapTime, g.BestLapPath, g.bestLapUnsaved = 300, path, true
+	g.setMesh(mesh, 0, true)
+	g.saveBestLap() // On exit
+
+	lap, err := loadLap(BestLapFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lap.LapTime != 300 || len(lap.Points) != len(path) {
+		t.Errorf("saved lap of %d ticks and %d points, want the best lap's 300 and %d", lap.LapTime, len(lap.Points), len(path))
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"racing-line-mapper/internal/common"
+	"racing-line-mapper/internal/physics"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// Skid marks (toggle with K): the rear tyres leave a trail wherever the car slides
+const (
+	SkidSlipThreshold = 0.4   // Slip (pixels/tick, see physics.Car.Slip) above which the tyres mark the track
+	SkidMarkLifetime  = 20000 // Ticks for a mark to fade out completely
+	MaxSkidMarks      = 6000  // Segments kept; the oldest are dropped beyond this
+)
+
+// skidSegment is one tick of one rear tyre's mark.
+type skidSegment struct {
+	A, B common.Vec2
+	Tick int // When it was laid down
+}
+
+// SkidMarks records where the car slid, aging the marks by simulation ticks.
+type SkidMarks struct {
+	segments []skidSegment // Oldest first
+	tick     int
+	rear     [2]common.Vec2 // Rear tyre positions at the previous tick, if it was sliding
+	sliding  bool
+}
+
+// Record advances the skid clock by one tick and, if the car slid more than
+// SkidSlipThreshold, extends its rear tyres' marks to where they are now.
+func (s *SkidMarks) Record(c *physics.Car, slip float64) {
+	s.tick++
+	s.expire()
+	if slip <= SkidSlipThreshold {
+		s.sliding = false
+		return
+	}
+
+	corners := c.Corners()
+	rear := [2]common.Vec2{corners[2], corners[3]} // Rear Right, Rear Left
+	if s.sliding {
+		for i := range rear {
+			s.segments = append(s.segments, skidSegment{A: s.rear[i], B: rear[i], Tick: s.tick})
+		}
+		if over := len(s.segments) - MaxSkidMarks; over > 0 {
+			s.segments = s.segments[over:]
+		}
+	}
+	s.rear, s.sliding = rear, true
+}
+
+// expire drops the marks that have faded out.
+func (s *SkidMarks) expire() {
+	i := 0
+	for i < len(s.segments) && s.tick-s.segments[i].Tick >= SkidMarkLifetime {
+		i++
+	}
+	s.segments = s.segments[i:]
+}
+
+// Clear removes all marks (e.g. when the track changes).
+func (s *SkidMarks) Clear() {
+	*s = SkidMarks{}
+}
+
+// Draw strokes the marks, older ones more transparent.
+func (s *SkidMarks) Draw(screen *ebiten.Image, toScreen func(x, y float64) (float32, float32)) {
+	for _, seg := range s.segments {
+		fade := 1 - float64(s.tick-seg.Tick)/SkidMarkLifetime
+		col := ColorSkidMark
+		col.A = uint8(float64(col.A) * fade)
+		p1x, p1y := toScreen(seg.A.X, seg.A.Y)
+		p2x, p2y := toScreen(seg.B.X, seg.B.Y)
+		vector.StrokeLine(screen, p1x, p1y, p2x, p2y, 1.5, col, true)
+	}
+}
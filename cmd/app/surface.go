@@ -0,0 +1,126 @@
+package main
+
+import (
+	"image/color"
+	"racing-line-mapper/internal/imgproc"
+	"racing-line-mapper/internal/track"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// Smooth track rendering (toggle with V): the surfaces are filled from their traced
+// outlines with anti-aliased edges instead of drawn as flat cells (RenderGrid).
+const (
+	SurfaceSimplify = 0.5 // Outline simplification tolerance, in pixels (see imgproc.SimplifyLoop)
+	KerbWidth       = 3.0 // Pixels, drawn inside the track edge
+	KerbStripe      = 2   // Waypoints per red/white kerb stripe
+)
+
+// Smooth track colors
+var (
+	ColorGrass      = color.RGBA{34, 70, 34, 255}    // Everything off the track
+	ColorSand       = color.RGBA{194, 170, 110, 255} // Gravel traps
+	ColorKerbRed    = color.RGBA{200, 30, 30, 255}
+	ColorKerbWhite  = color.RGBA{230, 230, 230, 255}
+	ColorCenterline = color.RGBA{255, 255, 255, 40} // Subtle
+)
+
+// surfaceLayer is one kind of surface, outlined in world coordinates.
+type surfaceLayer struct {
+	Outline *vector.Path // Closed contours, holes included (fill even-odd)
+	Color   color.RGBA
+}
+
+// TrackSurface is the smooth rendering of a grid, built once per track.
+type TrackSurface struct {
+	Layers []surfaceLayer // Bottom first
+}
+
+// NewTrackSurface traces the outline of every surface on the grid. The drivable layer
+// covers tarmac and the painted markings, which are then drawn over it.
+func NewTrackSurface(g *track.Grid) *TrackSurface {
+	drivable := func(t track.CellType) bool { return t != track.CellWall && t != track.CellGravel }
+	is := func(types ...track.CellType) func(track.CellType) bool {
+		return func(t track.CellType) bool {
+			for _, want := range types {
+				if t == want {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	s := &TrackSurface{}
+	for _, l := range []struct {
+		match func(track.CellType) bool
+		color color.RGBA
+	}{
+		{is(track.CellGravel), ColorSand},
+		{drivable, ColorTarmac},
+		{is(track.CellStart, track.CellFinish), ColorStart},
+		{is(track.CellDirection), ColorDir},
+	} {
+		mask := imgproc.NewMask(g.Width, g.Height)
+		for y := 0; y < g.Height; y++ {
+			for x := 0; x < g.Width; x++ {
+				mask.Set(x, y, l.match(g.Get(x, y).Type))
+			}
+		}
+		if mask.Count() == 0 {
+			continue
+		}
+
+		path := &vector.Path{}
+		for _, contour := range imgproc.Contours(mask) {
+			contour = imgproc.SimplifyLoop(contour, SurfaceSimplify)
+			path.MoveTo(float32(contour[0].X), float32(contour[0].Y))
+			for _, p := range contour[1:] {
+				path.LineTo(float32(p.X), float32(p.Y))
+			}
+			path.Close()
+		}
+		s.Layers = append(s.Layers, surfaceLayer{Outline: path, Color: l.color})
+	}
+	return s
+}
+
+// Draw fills the surfaces through the view transform (world -> screen).
+func (s *TrackSurface) Draw(screen *ebiten.Image, view ebiten.GeoM) {
+	screen.Fill(ColorGrass)
+	for _, l := range s.Layers {
+		var path vector.Path
+		path.AddPath(l.Outline, &vector.AddPathOptions{GeoM: view})
+		op := &vector.DrawPathOptions{AntiAlias: true}
+		op.ColorScale.ScaleWithColor(l.Color)
+		vector.FillPath(screen, &path, &vector.FillOptions{FillRule: vector.FillRuleEvenOdd}, op)
+	}
+}
+
+// drawTrackDetail draws the kerbs along both edges through every corner and a faint
+// centerline, over the smooth surface.
+func drawTrackDetail(screen *ebiten.Image, mesh *track.TrackMesh, toScreen func(x, y float64) (float32, float32), scale float32) {
+	for i, wp := range mesh.Waypoints {
+		next := mesh.At(mesh.Next(i))
+		p1x, p1y := toScreen(wp.Position.X, wp.Position.Y)
+		p2x, p2y := toScreen(next.Position.X, next.Position.Y)
+		vector.StrokeLine(screen, p1x, p1y, p2x, p2y, 1, ColorCenterline, true)
+
+		if wp.Phase == track.PhaseStraight {
+			continue
+		}
+		col := ColorKerbRed
+		if (i/KerbStripe)%2 == 1 {
+			col = ColorKerbWhite
+		}
+		for _, side := range []float64{-1, 1} {
+			// Kerb centerline, half a kerb inside the edge
+			d1 := side * (wp.Width/2 - KerbWidth/2)
+			d2 := side * (next.Width/2 - KerbWidth/2)
+			k1x, k1y := toScreen(wp.Position.X+wp.Normal.X*d1, wp.Position.Y+wp.Normal.Y*d1)
+			k2x, k2y := toScreen(next.Position.X+next.Normal.X*d2, next.Position.Y+next.Normal.Y*d2)
+			vector.StrokeLine(screen, k1x, k1y, k2x, k2y, KerbWidth*scale, col, true)
+		}
+	}
+}
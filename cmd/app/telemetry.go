@@ -0,0 +1,40 @@
+package main
+
+import "fmt"
+
+// LapTelemetry accumulates speed statistics over one lap, and where on track
+// (waypoint index) the extremes happened.
+type LapTelemetry struct {
+	Ticks    int
+	SpeedSum float64
+
+	TopSpeed   float64
+	TopSpeedWP int
+	MinSpeed   float64 // Roughly the slowest apex speed on a flying lap
+	MinSpeedWP int
+}
+
+// Add records one tick at the given speed (pixels per tick) and waypoint.
+func (t *LapTelemetry) Add(speed float64, wpIdx int) {
+	if t.Ticks == 0 || speed > t.TopSpeed {
+		t.TopSpeed, t.TopSpeedWP = speed, wpIdx
+	}
+	if t.Ticks == 0 || speed < t.MinSpeed {
+		t.MinSpeed, t.MinSpeedWP = speed, wpIdx
+	}
+	t.SpeedSum += speed
+	t.Ticks++
+}
+
+func (t LapTelemetry) AvgSpeed() float64 {
+	if t.Ticks == 0 {
+		return 0
+	}
+	return t.SpeedSum / float64(t.Ticks)
+}
+
+// Format summarizes the lap in the given units.
+func (t LapTelemetry) Format(u SpeedUnit) string {
+	return fmt.Sprintf("top %s @wp %d, min %s @wp %d, avg %s",
+		u.FormatSpeed(t.TopSpeed), t.TopSpeedWP, u.FormatSpeed(t.MinSpeed), t.MinSpeedWP, u.FormatSpeed(t.AvgSpeed()))
+}
@@ -0,0 +1,282 @@
+// Command compare overlays two racing lines on a track and reports where they differ.
+//
+//	go run ./cmd/compare -track processed_tracks/monza_10m.jpg -out compare.png a.csv b.csv
+//
+// Lines are CSV files of x,y world coordinates (one point per row, optional header),
+// in image coordinates unless -coords says otherwise as for the app's exports, or lap
+// files saved by the app (bestlap.json, always in image coordinates). Both lines are matched by arc length
+// along the track centerline, so the divergence is measured across the track rather
+// than between points that happen to share an index.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"racing-line-mapper/internal/common"
+	"racing-line-mapper/internal/track"
+)
+
+// Line colors in the output image
+var (
+	colorA = color.RGBA{255, 0, 255, 255} // First line (magenta)
+	colorB = color.RGBA{0, 160, 255, 255} // Second line (blue)
+	colorX = color.RGBA{255, 0, 0, 255}   // Point of maximum divergence
+)
+
+const (
+	resampleStep = 1.0 // Pixels between resampled line points
+	binSize      = 2.0 // Pixels of centerline arc length per comparison bin
+)
+
+func main() {
+	trackPath := flag.String("track", "", "Track image the lines were driven on")
+	out := flag.String("out", "compare.png", "Output image with both lines drawn over the track")
+	coordsName := flag.String("coords", "image", "Coordinate convention of the CSV lines and of the reported position: image (+Y down) or y-up (+Y up)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: compare -track TRACK [-out PNG] LINE_A LINE_B\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *trackPath == "" || flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	coords, err := track.ParseCoords(*coordsName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	grid, mesh, err := track.LoadTrackFromImage(*trackPath)
+	if err != nil {
+		log.Fatalf("Loading track: %v", err)
+	}
+	if len(mesh.Waypoints) < 2 {
+		log.Fatalf("%s: no usable mesh", *trackPath)
+	}
+
+	var lines [2][]common.Vec2
+	for i, path := range flag.Args() {
+		if lines[i], err = loadLine(path, coords, float64(grid.Height)); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s: %d points, %.1f px long\n", path, len(lines[i]), pathLength(lines[i]))
+	}
+
+	profA := lateralProfile(mesh, lines[0])
+	profB := lateralProfile(mesh, lines[1])
+	div, ok := maxDivergence(profA, profB)
+	if !ok {
+		log.Fatalf("The lines don't cover any common stretch of the track")
+	}
+	where := mesh.FrenetToWorld(div.S, (div.DA+div.DB)/2)
+	near := coords.Point(where, float64(grid.Height))
+	fmt.Printf("Compared %.0f%% of the lap\n", 100*div.Coverage)
+	fmt.Printf("Max divergence: %.1f px at s=%.1f (%.0f%% of the lap, near %.0f,%.0f): d=%.1f vs d=%.1f\n",
+		math.Abs(div.DA-div.DB), div.S, 100*div.S/mesh.TotalLen, near.X, near.Y, div.DA, div.DB)
+
+	img, err := loadImage(*trackPath)
+	if err != nil {
+		log.Fatalf("Loading track image: %v", err)
+	}
+	drawLine(img, lines[0], colorA)
+	drawLine(img, lines[1], colorB)
+	drawMarker(img, where, colorX)
+	if err := writePNG(*out, img); err != nil {
+		log.Fatalf("Writing %s: %v", *out, err)
+	}
+	fmt.Printf("Saved overlay to %s (%s: magenta, %s: blue)\n", *out, flag.Arg(0), flag.Arg(1))
+}
+
+// loadLine reads a racing line from a CSV of x,y rows in the given convention (on a track
+// height pixels tall) or a saved lap (.json), returning it in image coordinates.
+func loadLine(path string, coords track.Coords, height float64) ([]common.Vec2, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var points []common.Vec2
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var lap struct{ Points []common.Vec2 }
+		if err := json.NewDecoder(f).Decode(&lap); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		points = lap.Points
+	} else if points, err = readCSV(f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	} else {
+		for i := range points {
+			points[i] = coords.Point(points[i], height)
+		}
+	}
+	if len(points) < 2 {
+		return nil, fmt.Errorf("%s: need at least 2 points, got %d", path, len(points))
+	}
+	return points, nil
+}
+
+// readCSV reads x,y rows; extra columns are ignored and a non-numeric first row is taken as a header.
+func readCSV(r io.Reader) ([]common.Vec2, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var points []common.Vec2
+	for row := 1; ; row++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return points, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) < 2 {
+			return nil, fmt.Errorf("row %d: want x,y, got %d columns", row, len(rec))
+		}
+		x, errX := strconv.ParseFloat(rec[0], 64)
+		y, errY := strconv.ParseFloat(rec[1], 64)
+		if errX != nil || errY != nil {
+			if row == 1 {
+				continue // Header
+			}
+			return nil, fmt.Errorf("row %d: bad coordinates %q,%q", row, rec[0], rec[1])
+		}
+		points = append(points, common.Vec2{X: x, Y: y})
+	}
+}
+
+func pathLength(points []common.Vec2) float64 {
+	total := 0.0
+	for i := 1; i < len(points); i++ {
+		total += points[i].Sub(points[i-1]).Len()
+	}
+	return total
+}
+
+// resample returns points spaced step apart along the polyline.
+func resample(points []common.Vec2, step float64) []common.Vec2 {
+	out := []common.Vec2{points[0]}
+	carry := 0.0 // Distance already covered toward the next sample
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		seg := b.Sub(a).Len()
+		for t := step - carry; t <= seg; t += step {
+			out = append(out, a.Add(b.Sub(a).Scale(t/seg)))
+		}
+		carry = math.Mod(carry+seg, step)
+	}
+	return out
+}
+
+// lateralProfile is a line's mean lateral offset d per bin of centerline arc length
+// (NaN where the line has no points).
+func lateralProfile(mesh *track.TrackMesh, points []common.Vec2) []float64 {
+	bins := int(math.Ceil(mesh.TotalLen / binSize))
+	sum := make([]float64, bins)
+	count := make([]int, bins)
+	for _, p := range resample(points, resampleStep) {
+		s, d := mesh.WorldToFrenet(p)
+		b := int(s/binSize) % bins
+		sum[b] += d
+		count[b]++
+	}
+
+	prof := make([]float64, bins)
+	for b := range prof {
+		prof[b] = math.NaN()
+		if count[b] > 0 {
+			prof[b] = sum[b] / float64(count[b])
+		}
+	}
+	return prof
+}
+
+// divergence is where two lateral profiles are furthest apart.
+type divergence struct {
+	S        float64 // Centerline arc length
+	DA, DB   float64 // Lateral offsets of each line there
+	Coverage float64 // Fraction of bins both lines cover
+}
+
+func maxDivergence(a, b []float64) (divergence, bool) {
+	var best divergence
+	found, shared := false, 0
+	for i := range a {
+		if math.IsNaN(a[i]) || math.IsNaN(b[i]) {
+			continue
+		}
+		shared++
+		if !found || math.Abs(a[i]-b[i]) > math.Abs(best.DA-best.DB) {
+			best = divergence{S: (float64(i) + 0.5) * binSize, DA: a[i], DB: b[i]}
+			found = true
+		}
+	}
+	if found {
+		best.Coverage = float64(shared) / float64(len(a))
+	}
+	return best, found
+}
+
+func loadImage(path string) (*image.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(src.Bounds())
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+	return img, nil
+}
+
+// drawLine plots the polyline two pixels thick.
+func drawLine(img *image.RGBA, points []common.Vec2, c color.RGBA) {
+	for _, p := range resample(points, 0.5) {
+		x, y := int(p.X), int(p.Y)
+		for dy := 0; dy < 2; dy++ {
+			for dx := 0; dx < 2; dx++ {
+				img.SetRGBA(x+dx, y+dy, c)
+			}
+		}
+	}
+}
+
+// drawMarker draws a ring around p.
+func drawMarker(img *image.RGBA, p common.Vec2, c color.RGBA) {
+	const r = 8.0
+	for a := 0.0; a < 2*math.Pi; a += 0.5 / r {
+		img.SetRGBA(int(p.X+r*math.Cos(a)), int(p.Y+r*math.Sin(a)), c)
+	}
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -1,3 +1,9 @@
+//go:build opencv
+
+// The full preprocessing pipeline. Needs OpenCV (with contrib) installed:
+//
+//	go run -tags opencv ./cmd/debug-mesh
+
 package main
 
 import (
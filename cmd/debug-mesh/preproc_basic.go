@@ -0,0 +1,130 @@
+//go:build !opencv
+
+// Pure-Go fallback for builds without OpenCV. It runs marker detection,
+// thresholding, noise cleaning and skeletonization; gap closing, width
+// detection and rescaling to simulation scale still need the opencv build.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"racing-line-mapper/internal/imgproc"
+)
+
+// Marker color ranges (RGB) and cleaning parameters, matching the OpenCV pipeline
+var (
+	lowerGreen  = color.RGBA{0, 200, 0, 255}
+	upperGreen  = color.RGBA{100, 255, 100, 255}
+	lowerYellow = color.RGBA{200, 200, 0, 255}
+	upperYellow = color.RGBA{255, 255, 100, 255}
+)
+
+const (
+	trackThreshold = 104 // Pixels at or below this luma are track (the OpenCV pipeline inverts, then thresholds at 150)
+	padding        = 64
+	openKernel     = 3
+)
+
+func main() {
+	fmt.Println("running debug preproc script (pure Go; build with -tags opencv for the full pipeline)...")
+
+	inputDir := "./input_track_maps/"
+	files, err := filepath.Glob(inputDir + "*.jpg")
+	if err != nil {
+		fmt.Printf("Error reading input directory: %v\n", err)
+		return
+	}
+
+	re := regexp.MustCompile(`_([0-9.]+)[mM]\.`)
+	for _, inputPath := range files {
+		inputFilename := filepath.Base(inputPath)
+		if re.FindStringSubmatch(inputFilename) == nil {
+			continue // Skip files without width pattern
+		}
+		fmt.Printf("\n--- Processing %s ---\n", inputFilename)
+
+		img, err := loadImage(inputPath)
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", inputPath, err)
+			continue
+		}
+
+		// Markers, thresholded track, padding
+		green := imgproc.InRange(img, lowerGreen, upperGreen).Pad(padding)
+		yellow := imgproc.InRange(img, lowerYellow, upperYellow).Pad(padding)
+		thresh := imgproc.Threshold(img, trackThreshold, true).Pad(padding)
+
+		// Force Green and Yellow markers to be part of the track
+		thresh.Or(green)
+		thresh.Or(yellow)
+
+		clean := imgproc.Open(thresh, openKernel, 1)
+		clean.Or(green)
+		clean.Or(yellow)
+
+		// Output: White track on Black background, with the red start and yellow direction markers
+		out := image.NewRGBA(image.Rect(0, 0, clean.W, clean.H))
+		for y := 0; y < clean.H; y++ {
+			for x := 0; x < clean.W; x++ {
+				switch {
+				case green.At(x, y):
+					out.Set(x, y, color.RGBA{255, 0, 0, 255})
+				case yellow.At(x, y):
+					out.Set(x, y, color.RGBA{255, 255, 0, 255})
+				case clean.At(x, y):
+					out.Set(x, y, color.White)
+				default:
+					out.Set(x, y, color.Black)
+				}
+			}
+		}
+
+		base := "./processed_tracks/" + strings.TrimSuffix(inputFilename, filepath.Ext(inputFilename))
+		outputPath := base + "_basic.png"
+		if err := savePNG(outputPath, out); err != nil {
+			fmt.Printf("Error writing %s: %v\n", outputPath, err)
+			continue
+		}
+		fmt.Println("Output saved to " + outputPath + " (not rescaled)")
+
+		// Centerline skeleton of the cleaned track
+		skeleton := imgproc.Thin(clean)
+		skeletonPath := base + "_skeleton.png"
+		if err := savePNG(skeletonPath, skeleton.Gray()); err != nil {
+			fmt.Printf("Error writing %s: %v\n", skeletonPath, err)
+			continue
+		}
+		fmt.Println("Skeleton saved to " + skeletonPath)
+	}
+}
+
+func loadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+func savePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		return err
+	}
+	return f.Close()
+}
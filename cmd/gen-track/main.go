@@ -1,13 +1,58 @@
 package main
 
 import (
+	"flag"
 	"image"
 	"image/color"
 	"image/png"
+	"log"
 	"os"
+	"racing-line-mapper/internal/track"
 )
 
 func main() {
+	shape := flag.String("shape", "oval", "Track to generate: oval, esses or straight")
+	out := flag.String("out", "", "Output PNG (default assets/track.png for the oval, assets/esses.png for the esses, assets/straight.png for the straight)")
+	radius := flag.Float64("radius", 250, "esses: mean centerline radius (px)")
+	amplitude := flag.Float64("amplitude", 30, "esses: radial amplitude of the waves (px)")
+	wavelength := flag.Float64("wavelength", 260, "esses: length of one wave (px)")
+	width := flag.Float64("width", 40, "esses: track width (px)")
+	flag.Parse()
+
+	switch *shape {
+	case "oval":
+		writeImage(orDefault(*out, "assets/track.png"), oval())
+	case "esses":
+		e := track.Esses{Radius: *radius, Amplitude: *amplitude, Wavelength: *wavelength, Width: *width}
+		writeImage(orDefault(*out, "assets/esses.png"), e.Image())
+		log.Printf("Esses: %d waves, %dx%d px", e.Waves(), e.Size(), e.Size())
+	case "straight":
+		writeImage(orDefault(*out, "assets/straight.png"), straight())
+	default:
+		log.Fatalf("unknown shape %q (want oval, esses or straight)", *shape)
+	}
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func writeImage(path string, img image.Image) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// oval is the original test track: a simple elliptical ring.
+func oval() *image.RGBA {
 	width, height := 800, 600
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
 
@@ -59,7 +104,29 @@ func main() {
 		}
 	}
 
-	f, _ := os.Create("assets/track.png")
-	defer f.Close()
-	png.Encode(f, img)
+	return img
+}
+
+// straight is a point-to-point test track: a straight strip, closed at both ends, with
+// the start line near its left end.
+func straight() *image.RGBA {
+	width, height := 900, 200
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	white := color.RGBA{255, 255, 255, 255}
+	black := color.RGBA{0, 0, 0, 255}
+	red := color.RGBA{255, 0, 0, 255}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch {
+			case y < 75 || y >= 125 || x < 50 || x >= 850:
+				img.Set(x, y, black) // Wall
+			case x >= 80 && x < 90:
+				img.Set(x, y, red)
+			default:
+				img.Set(x, y, white) // Tarmac
+			}
+		}
+	}
+	return img
 }
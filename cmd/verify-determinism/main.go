@@ -0,0 +1,210 @@
+// Command verify-determinism trains the same seeded agent on the same track twice and
+// checks both runs came out bit for bit the same: the track's mesh, the car's trajectory
+// every tick, the lap times and the learned Q-table. Anything that isn't, e.g. iterating
+// a map where order matters, drawing from the global random source, or summing floats in
+// a different order, shows up as the first tick (or state) where the runs diverge.
+//
+//	go run ./cmd/verify-determinism -track processed_tracks/monza_10m.jpg -ticks 200000
+//
+// It exits with status 1 if the runs differ.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"slices"
+
+	"racing-line-mapper/internal/agent"
+	"racing-line-mapper/internal/physics"
+	"racing-line-mapper/internal/track"
+)
+
+// pose is the car's state after one tick.
+type pose struct {
+	X, Y, Heading, Speed float64
+	Crashed              bool
+}
+
+// lap is a lap completed during a run.
+type lap struct {
+	Tick, Time int // Tick it was completed on, and its time (ticks)
+}
+
+// run is everything a training run produced.
+type run struct {
+	Waypoints []track.Waypoint
+	Poses     []pose
+	Laps      []lap
+	QTable    agent.QTable
+	Visits    map[agent.State]int
+}
+
+func main() {
+	trackPath := flag.String("track", "processed_tracks/monza_10m.jpg", "Track image to train on")
+	ticks := flag.Int("ticks", 100000, "Training ticks per run")
+	seed := flag.Uint64("seed", 1, "Seed of the agent's random source")
+	maxEpisode := flag.Int("max-episode", 20000, "Respawn after this many ticks without a crash (0 = never)")
+	drift := flag.Bool("drift", false, "Drive with the drift physics model")
+	flag.Parse()
+
+	model := physics.ModelArcade
+	if *drift {
+		model = physics.ModelDrift
+	}
+	train := func() *run {
+		r, err := trainRun(*trackPath, *ticks, *seed, *maxEpisode, model)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return r
+	}
+	a, b := train(), train()
+
+	diffs := compare(a, b)
+	for _, d := range diffs {
+		fmt.Println("DIVERGED:", d)
+	}
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("Deterministic: %d ticks, %d laps, %d Q-table states identical across both runs\n",
+		len(a.Poses), len(a.Laps), len(a.QTable))
+}
+
+// trainRun loads the track and trains a fresh agent on it for the given number of ticks,
+// the way the app's training loop does: learn every tick, respawn on a crash or when an
+// episode runs too long.
+func trainRun(path string, ticks int, seed uint64, maxEpisode int, model physics.PhysicsModel) (*run, error) {
+	grid, mesh, err := track.LoadTrackFromImage(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(mesh.Waypoints) < 2 {
+		return nil, fmt.Errorf("%s: the mesh has %d waypoints", path, len(mesh.Waypoints))
+	}
+
+	a := agent.NewAgentWithSeed(seed)
+	a.Track = grid.Hash()
+	env := &agent.Env{Grid: grid, Mesh: mesh, Rewards: agent.DefaultRewardConfig(), MaskActions: true}
+	r := &run{Waypoints: slices.Clone(mesh.Waypoints), Poses: make([]pose, 0, ticks)}
+
+	var state agent.State
+	episodeTicks := 0
+	respawn := func() {
+		env.Car = agent.StartCar(mesh, physics.DefaultCarParams())
+		env.Car.Config.Model = model
+		state = env.Observe(agent.Locate(env.Car, mesh))
+		episodeTicks = 0
+	}
+	respawn()
+
+	for tick := 0; tick < ticks; tick++ {
+		env.Car.CurrentLapTime++
+		episodeTicks++
+		if env.Car.Crashed {
+			// As in the app: the crash was learned on the tick it happened, the next one respawns
+			respawn()
+			r.Poses = append(r.Poses, poseOf(env.Car))
+			continue
+		}
+
+		action := a.SelectAction(state)
+		tr := env.Drive(agent.Inputs(a, state, action))
+		terms, _ := env.Score(tr, action)
+		if tr.Progress.Lap {
+			r.Laps = append(r.Laps, lap{Tick: tick, Time: tr.Progress.LapTime})
+			env.Car.CurrentLapTime = 0
+		}
+
+		next := env.Observe(tr.Pos)
+		timedOut := maxEpisode > 0 && episodeTicks >= maxEpisode && !tr.Step.Crashed
+		if timedOut {
+			terms[agent.TermTimeout] = env.Rewards.Timeout
+		}
+		env.Learn(a, state, action, terms.Total(), tr, next)
+		state = next
+
+		r.Poses = append(r.Poses, poseOf(env.Car))
+		if timedOut || (tr.Progress.Lap && !mesh.Looped) { // A point-to-point track ends at its finish
+			respawn()
+		}
+	}
+
+	r.QTable, r.Visits = a.Snapshot(), a.Visits
+	return r, nil
+}
+
+func poseOf(c *physics.Car) pose {
+	return pose{X: c.Position.X, Y: c.Position.Y, Heading: c.Heading, Speed: c.Speed, Crashed: c.Crashed}
+}
+
+// compare describes every way the runs differ: the first differing waypoint, tick and
+// lap, and the Q-table states that differ. Floats are compared by their bits.
+func compare(a, b *run) []string {
+	var diffs []string
+	if i := firstDiff(a.Waypoints, b.Waypoints, sameWaypoint); i >= 0 {
+		diffs = append(diffs, fmt.Sprintf("mesh: %d vs %d waypoints, first different at %d", len(a.Waypoints), len(b.Waypoints), i))
+	}
+	if i := firstDiff(a.Poses, b.Poses, samePose); i >= 0 {
+		diffs = append(diffs, fmt.Sprintf("trajectory: tick %d: %s vs %s", i, at(a.Poses, i), at(b.Poses, i)))
+	}
+	if i := firstDiff(a.Laps, b.Laps, func(x, y lap) bool { return x == y }); i >= 0 {
+		diffs = append(diffs, fmt.Sprintf("laps: lap %d: %s vs %s", i+1, at(a.Laps, i), at(b.Laps, i)))
+	}
+
+	var states []string
+	for s, q := range a.QTable {
+		if q2, ok := b.QTable[s]; !ok || !sameFloats(q[:], q2[:]) || a.Visits[s] != b.Visits[s] {
+			states = append(states, fmt.Sprintf("%+v: %v (%d visits) vs %v (%d visits)", s, q, a.Visits[s], q2, b.Visits[s]))
+		}
+	}
+	for s := range b.QTable {
+		if _, ok := a.QTable[s]; !ok {
+			states = append(states, fmt.Sprintf("%+v: only in the second run", s))
+		}
+	}
+	if len(states) > 0 {
+		slices.Sort(states) // Map order would make the example differ from run to run
+		diffs = append(diffs, fmt.Sprintf("Q-table: %d states differ (of %d in the first run, %d in the second), e.g. %s", len(states), len(a.QTable), len(b.QTable), states[0]))
+	}
+	return diffs
+}
+
+// firstDiff is the index of the first element that differs between a and b, the end of
+// the shorter one if it is a prefix of the other, or -1 if they are the same.
+func firstDiff[T any](a, b []T, same func(x, y T) bool) int {
+	for i := range min(len(a), len(b)) {
+		if !same(a[i], b[i]) {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		return min(len(a), len(b))
+	}
+	return -1
+}
+
+// at formats s[i], or notes its absence.
+func at[T any](s []T, i int) string {
+	if i >= len(s) {
+		return "(none)"
+	}
+	return fmt.Sprintf("%+v", s[i])
+}
+
+func samePose(a, b pose) bool {
+	return a.Crashed == b.Crashed && sameFloats([]float64{a.X, a.Y, a.Heading, a.Speed}, []float64{b.X, b.Y, b.Heading, b.Speed})
+}
+
+func sameWaypoint(a, b track.Waypoint) bool {
+	return a.ID == b.ID && a.Phase == b.Phase &&
+		sameFloats([]float64{a.Position.X, a.Position.Y, a.Normal.X, a.Normal.Y, a.Width, a.Distance, a.Curvature},
+			[]float64{b.Position.X, b.Position.Y, b.Normal.X, b.Normal.Y, b.Width, b.Distance, b.Curvature})
+}
+
+func sameFloats(a, b []float64) bool {
+	return slices.EqualFunc(a, b, func(x, y float64) bool { return math.Float64bits(x) == math.Float64bits(y) })
+}
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"math"
+	"math/bits"
+)
+
+// ConfidenceTemperature is the softmax temperature of Confidence, in reward units:
+// Q-value gaps several times larger than this make the greedy action near certain.
+const ConfidenceTemperature = 1.0
+
+// ConfidenceExploreBoost is the share of the non-random choices that ExploreByConfidence
+// turns into exploration in a state where the agent has no preference at all.
+const ConfidenceExploreBoost = 0.5
+
+// Confidence is the softmax probability of the greedy action among the allowed ones.
+// It is 1/k (k allowed actions) when their Q-values are all equal, i.e. the agent is
+// guessing, and rises towards 1 as the best action pulls ahead of the rest.
+func Confidence(q [ActionCount]float64, masked ActionMask) float64 {
+	ok := allowed(masked)
+	best := math.Inf(-1)
+	for act, v := range q {
+		if ok.Has(act) {
+			best = math.Max(best, v)
+		}
+	}
+	sum := 0.0
+	for act, v := range q {
+		if ok.Has(act) {
+			sum += math.Exp((v - best) / ConfidenceTemperature)
+		}
+	}
+	return 1 / sum
+}
+
+// uncertainty rescales Confidence to [0, 1]: 1 when guessing, 0 when certain.
+func uncertainty(q [ActionCount]float64, masked ActionMask) float64 {
+	k := float64(bits.OnesCount8(uint8(allowed(masked))))
+	if k <= 1 {
+		return 0
+	}
+	return (1 - Confidence(q, masked)) / (1 - 1/k)
+}
+
+// ActionConfidence is the Confidence of the greedy action at the given state.
+func (a *AgentQTable) ActionConfidence(state State) float64 {
+	return Confidence(a.QValuesFor(state), state.Masked)
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConfidence(t *testing.T) {
+	var tie [ActionCount]float64
+	if c := Confidence(tie, 0); math.Abs(c-1.0/ActionCount) > 1e-12 {
+		t.Errorf("all-equal Q: confidence %v, want 1/%d", c, ActionCount)
+	}
+	if c := Confidence(tie, MaskOf(ActionThrottle, ActionBrake)); math.Abs(c-1.0/(ActionCount-2)) > 1e-12 {
+		t.Errorf("all-equal Q with 2 masked: confidence %v, want 1/%d", c, ActionCount-2)
+	}
+
+	dominant := tie
+	dominant[ActionLeft] = 20
+	if c := Confidence(dominant, 0); c < 0.99 {
+		t.Errorf("dominant action: confidence %v, want near 1", c)
+	}
+	// The dominant action being masked leaves the others tied again
+	if c := Confidence(dominant, MaskOf(ActionLeft)); math.Abs(c-1.0/(ActionCount-1)) > 1e-12 {
+		t.Errorf("dominant action masked: confidence %v, want 1/%d", c, ActionCount-1)
+	}
+}
+
+func TestExploreByConfidenceExploresUnsureStates(t *testing.T) {
+	sure, unsure := State{SegmentIdx: 1}, State{SegmentIdx: 2}
+	explored := func(byConfidence bool, s State) int {
+		a := NewAgentWithSeed(3)
+		a.ExploreByConfidence = byConfidence
+		a.Exploration.Start = MinEpsilon
+		q := [ActionCount]float64{ActionThrottle: 0.01} // Barely preferred
+		if s == sure {
+			q[ActionThrottle] = 50
+		}
+		a.QTable[s] = q
+
+		n := 0
+		for i := 0; i < 2000; i++ {
+			if a.SelectAction(s) != ActionThrottle {
+				n++
+			}
+		}
+		return n
+	}
+
+	if base, boosted := explored(false, unsure), explored(true, unsure); boosted < base+500 {
+		t.Errorf("unsure state: %d non-greedy picks with confidence exploration, %d without; want far more", boosted, base)
+	}
+	if base, boosted := explored(false, sure), explored(true, sure); boosted > base+20 {
+		t.Errorf("sure state: %d non-greedy picks with confidence exploration, %d without; want about the same", boosted, base)
+	}
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+)
+
+// AgentConfig is the set of hyperparameters a run trains with, so they can be tuned from
+// a file (see LoadAgentConfig) rather than by recompiling. Alpha and Gamma are those of
+// the tabular agents (AgentQTable, AgentSARSA); the linear ones keep their own (see
+// LinearAlpha, TileAlpha), since the tabular values make function approximation diverge.
+type AgentConfig struct {
+	Alpha       float64      `json:"alpha"` // Learning rate
+	Gamma       float64      `json:"gamma"` // Discount factor
+	Exploration Exploration  `json:"exploration"`
+	Rewards     RewardConfig `json:"rewards"`
+	Replay      ReplayConfig `json:"replay"` // Experience replay (Q-learning only); off by default
+
+	// MaskActions keeps the agent from choosing pointless actions, in training and in
+	// evaluation alike (see MaskFor). It is off by default: it changes what a state's
+	// best action can be, so a session trained without it should be evaluated without it.
+	MaskActions bool `json:"mask_actions"`
+
+	// Seed seeds the agent's random source (exploration, tie-breaking, which table double Q
+	// updates), so two runs with the same seed, track and config learn the same. 0 picks a
+	// random seed.
+	Seed uint64 `json:"seed"`
+}
+
+// DefaultAgentConfig returns the stock hyperparameters: Alpha, Gamma, DefaultExploration
+// and DefaultRewardConfig.
+func DefaultAgentConfig() AgentConfig {
+	return AgentConfig{Alpha: Alpha, Gamma: Gamma, Exploration: DefaultExploration(), Rewards: DefaultRewardConfig()}
+}
+
+// seed is the seed an agent built from the config starts its random source with.
+func (c AgentConfig) seed() uint64 {
+	if c.Seed != 0 {
+		return c.Seed
+	}
+	return rand.Uint64()
+}
+
+// LoadAgentConfig reads a JSON config from path, e.g.
+//
+//	{"alpha": 0.05, "exploration": {"decay": 0.99999}, "rewards": {"crash": -200}}
+//
+// Anything the file leaves out keeps its default (see DefaultAgentConfig).
+func LoadAgentConfig(path string) (AgentConfig, error) {
+	cfg := DefaultAgentConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate reports settings that can't train: a learning rate outside (0, 1], a
+// discount outside [0, 1], or an exploration schedule that isn't a rate that decays.
+func (c AgentConfig) Validate() error {
+	var errs []error
+	if c.Alpha <= 0 || c.Alpha > 1 {
+		errs = append(errs, fmt.Errorf("alpha %v is not in (0, 1]", c.Alpha))
+	}
+	if c.Gamma < 0 || c.Gamma > 1 {
+		errs = append(errs, fmt.Errorf("gamma %v is not in [0, 1]", c.Gamma))
+	}
+	e := c.Exploration
+	if e.Start < 0 || e.Start > 1 || e.Min < 0 || e.Min > 1 {
+		errs = append(errs, fmt.Errorf("exploration rates (start %v, min %v) are not in [0, 1]", e.Start, e.Min))
+	}
+	if e.Decay <= 0 || e.Decay > 1 {
+		errs = append(errs, fmt.Errorf("exploration decay %v is not in (0, 1]", e.Decay))
+	}
+	if e.Warmup < 0 {
+		errs = append(errs, fmt.Errorf("exploration warmup %d is negative", e.Warmup))
+	}
+	if c.Replay.Size < 0 || c.Replay.Count < 0 {
+		errs = append(errs, fmt.Errorf("replay size %d or count %d is negative", c.Replay.Size, c.Replay.Count))
+	}
+	return errors.Join(errs...)
+}
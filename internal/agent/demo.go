@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+)
+
+// Demonstration pretraining
+const (
+	DemoTarget float64 = 50.0 // Q-value demonstrated actions are pulled toward (others are pulled toward 0)
+	DemoEpochs int     = 5    // Passes over the dataset in PretrainFromDemos
+)
+
+// Demo is one recorded (state, action) pair from a human driving in manual mode.
+type Demo struct {
+	State  State
+	Action int
+}
+
+// DemoRecorder streams demonstrations to a file as they happen.
+type DemoRecorder struct {
+	f     *os.File
+	enc   *gob.Encoder
+	Count int
+}
+
+// NewDemoRecorder creates (or truncates) the dataset file at path.
+func NewDemoRecorder(path string) (*DemoRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &DemoRecorder{f: f, enc: gob.NewEncoder(f)}, nil
+}
+
+// Record appends one demonstration to the dataset.
+func (r *DemoRecorder) Record(state State, action int) error {
+	if err := r.enc.Encode(Demo{State: state, Action: action}); err != nil {
+		return err
+	}
+	r.Count++
+	return nil
+}
+
+func (r *DemoRecorder) Close() error {
+	return r.f.Close()
+}
+
+// LoadDemos reads every demonstration recorded at path.
+func LoadDemos(path string) ([]Demo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var demos []Demo
+	dec := gob.NewDecoder(f)
+	for {
+		var d Demo
+		if err := dec.Decode(&d); err != nil {
+			if errors.Is(err, io.EOF) {
+				return demos, nil
+			}
+			return nil, err
+		}
+		if d.Action < 0 || d.Action >= ActionCount {
+			continue
+		}
+		demos = append(demos, d)
+	}
+}
+
+// ActionFromInputs maps driver inputs to the closest discrete action.
+// Steering wins over pedals since the action set can't express both at once.
+func ActionFromInputs(throttle, brake, steering float64) int {
+	switch {
+	case steering < 0:
+		return ActionLeft
+	case steering > 0:
+		return ActionRight
+	case brake > 0:
+		return ActionBrake
+	case throttle > 0:
+		return ActionThrottle
+	default:
+		return ActionCoast
+	}
+}
+
+// PretrainFromDemos warm-starts the Q-table from a demonstration dataset with supervised
+// updates: at each demonstrated state the shown action is pulled toward DemoTarget
+// and the rest toward 0, so the greedy policy imitates the driver until RL takes over.
+func (a *AgentQTable) PretrainFromDemos(path string) error {
+	demos, err := LoadDemos(path)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pretrain(a.QTable, demos, true)
+	return nil
+}
+
+// pretrain runs PretrainFromDemos' updates on table, counting the visits if countVisits.
+// The caller holds the write lock.
+func (a *AgentQTable) pretrain(table QTable, demos []Demo, countVisits bool) {
+	for epoch := 0; epoch < DemoEpochs; epoch++ {
+		for _, d := range demos {
+			state := d.State.Discrete()
+			q := table[state]
+			for act := range q {
+				target := 0.0
+				if act == d.Action {
+					target = DemoTarget
+				}
+				q[act] += a.Alpha * (target - q[act])
+			}
+			table[state] = q
+			if countVisits && epoch == 0 {
+				a.Visits[state]++ // Once per demonstrated step, however many epochs
+			}
+		}
+	}
+}
+
+// PretrainFromDemos runs the same supervised warm-start as the Q-table version,
+// as gradient steps on the linear weights.
+func (a *AgentLinear) PretrainFromDemos(path string) error {
+	demos, err := LoadDemos(path)
+	if err != nil {
+		return err
+	}
+
+	for epoch := 0; epoch < DemoEpochs; epoch++ {
+		for _, d := range demos {
+			phi := basis(d.State.Features)
+			q := a.qValues(phi)
+			for act := range q {
+				target := 0.0
+				if act == d.Action {
+					target = DemoTarget
+				}
+				errQ := clamp(target-q[act], -LinearTDClip, LinearTDClip)
+				for i, x := range phi {
+					a.W[act][i] += LinearAlpha * errQ * x
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestPretrainFromDemosImitatesDriver records a small demonstration dataset and checks
+// that after pretraining the Q-table ranks the demonstrated action first at each state.
+func TestPretrainFromDemosImitatesDriver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demos.gob")
+
+	want := map[State]int{
+		{SegmentIdx: 0, SpeedLevel: 1}:              ActionThrottle,
+		{SegmentIdx: 1, SpeedLevel: 3}:              ActionBrake,
+		{SegmentIdx: 2, SpeedLevel: 2, LaneIdx: -2}: ActionRight,
+	}
+
+	rec, err := NewDemoRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		for s, a := range want {
+			s.Features = Features{S: float64(i) / 10} // Continuous part must not split the table entry
+			if err := rec.Record(s, a); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	demos, err := LoadDemos(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(demos) != rec.Count {
+		t.Fatalf("loaded %d demos, recorded %d", len(demos), rec.Count)
+	}
+
+	ag := NewAgentWithSeed(1)
+	if err := ag.PretrainFromDemos(path); err != nil {
+		t.Fatal(err)
+	}
+	for s, a := range want {
+		q := ag.QValuesFor(s)
+		for other := range q {
+			if other != a && q[other] >= q[a] {
+				t.Errorf("state %+v: Q[%s]=%.2f not above Q[%s]=%.2f",
+					s, ActionNames[a], q[a], ActionNames[other], q[other])
+			}
+		}
+	}
+}
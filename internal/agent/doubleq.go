@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"fmt"
+	"maps"
+)
+
+// AgentDoubleQ is a tabular agent that learns by double Q-learning. Plain Q-learning
+// bootstraps from the highest Q-value of the next state, and with noisy rewards the
+// highest of several noisy estimates is biased upward, so values get overestimated.
+// Double Q keeps two tables and updates one at random each step, picking the next
+// state's best action with it but valuing that action with the other, whose noise is
+// independent.
+//
+// The first table, visits, exploration and sessions are AgentQTable's; QTableB is the
+// second table. Actions are chosen epsilon-greedily over the sum of the two.
+type AgentDoubleQ struct {
+	*AgentQTable
+
+	QTableB QTable
+}
+
+// NewDoubleQAgent creates a double Q agent with the hyperparameters and seed of cfg (see NewAgent).
+// cfg.Replay is ignored: replay only runs through AgentQTable's single-table update.
+func NewDoubleQAgent(cfg AgentConfig) *AgentDoubleQ {
+	cfg.Replay = ReplayConfig{}
+	return &AgentDoubleQ{AgentQTable: NewAgent(cfg), QTableB: make(QTable)}
+}
+
+// NewDoubleQAgentWithSeed creates a double Q agent whose random choices, including which
+// table each step updates, come from its own seeded generator (see NewAgentWithSeed).
+func NewDoubleQAgentWithSeed(seed uint64) *AgentDoubleQ {
+	return &AgentDoubleQ{AgentQTable: NewAgentWithSeed(seed), QTableB: make(QTable)}
+}
+
+// SelectAction chooses epsilon-greedily by the sum of the two tables' Q-values.
+func (a *AgentDoubleQ) SelectAction(state State) int {
+	qValues, exists := a.sum(state.Discrete())
+	return a.chooseAction(qValues, exists, state.Masked)
+}
+
+// Learn updates one of the tables, chosen at random, towards
+// reward + Gamma * Q_other(s', argmax_a Q_this(s', a)) over the actions allowed in s'.
+func (a *AgentDoubleQ) Learn(state State, action int, reward float64, nextState State) {
+	a.learn(state, action, reward, nextState, false)
+}
+
+// LearnTerminal updates one of the tables, chosen at random, towards the reward alone,
+// for a transition that ended the episode.
+func (a *AgentDoubleQ) LearnTerminal(state State, action int, reward float64) {
+	a.learn(state, action, reward, state, true)
+}
+
+// learn is Learn, or LearnTerminal if terminal.
+func (a *AgentDoubleQ) learn(state State, action int, reward float64, nextState State, terminal bool) {
+	nextMasked := nextState.Masked
+	state, nextState = state.Discrete(), nextState.Discrete()
+
+	this, other := a.QTable, a.QTableB
+	if a.rng.IntN(2) == 1 {
+		this, other = other, this
+	}
+
+	nextQ := 0.0
+	if nextValues, exists := this[nextState]; exists && !terminal {
+		nextQ = other[nextState][orderedGreedyAction(nil, nextValues, nextMasked)]
+	}
+
+	qValues := this[state]
+	qValues[action] += a.Alpha * (reward + a.Gamma*nextQ - qValues[action])
+
+	a.mu.Lock()
+	this[state] = qValues
+	a.Visits[state]++
+	a.steps++
+	a.mu.Unlock()
+}
+
+// sum is the two tables' Q-values at a discrete state added up, and whether either has
+// learned anything there. The caller is the training goroutine or holds the lock.
+func (a *AgentDoubleQ) sum(state State) (q [ActionCount]float64, exists bool) {
+	qa, inA := a.QTable[state]
+	qb, inB := a.QTableB[state]
+	for act := range q {
+		q[act] = qa[act] + qb[act]
+	}
+	return q, inA || inB
+}
+
+// QValuesFor returns the mean of the two tables' Q-values at the given state (zeros if
+// unseen): the agent's value estimate, which ranks the actions as SelectAction does.
+func (a *AgentDoubleQ) QValuesFor(state State) [ActionCount]float64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	q, _ := a.sum(state.Discrete())
+	for act := range q {
+		q[act] /= 2
+	}
+	return q
+}
+
+// ActionConfidence is the Confidence of the greedy action at the given state.
+func (a *AgentDoubleQ) ActionConfidence(state State) float64 {
+	return Confidence(a.QValuesFor(state), state.Masked)
+}
+
+// Snapshot returns the mean of the two tables (see QValuesFor) over every state either
+// has learned. Like AgentQTable.Snapshot it is safe to call during training.
+func (a *AgentDoubleQ) Snapshot() QTable {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	mean := make(QTable, len(a.QTable))
+	for _, table := range []QTable{a.QTable, a.QTableB} {
+		for s := range table {
+			q, _ := a.sum(s)
+			for act := range q {
+				q[act] /= 2
+			}
+			mean[s] = q
+		}
+	}
+	return mean
+}
+
+// Stats summarizes the agent, counting every state either table has learned.
+func (a *AgentDoubleQ) Stats() QTableStats {
+	st := a.AgentQTable.Stats()
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for s := range a.QTableB {
+		if _, ok := a.QTable[s]; !ok {
+			st.States++
+		}
+	}
+	return st
+}
+
+// Prune drops the states visited fewer than minVisits times from both tables (see
+// AgentQTable.Prune), returning how many it dropped.
+func (a *AgentDoubleQ) Prune(minVisits int) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	pruned := 0
+	for state, n := range a.Visits {
+		if n < minVisits {
+			delete(a.QTable, state)
+			delete(a.QTableB, state)
+			delete(a.Visits, state)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// Reset forgets everything learned, in both tables.
+func (a *AgentDoubleQ) Reset() {
+	a.AgentQTable.Reset()
+	a.mu.Lock()
+	clear(a.QTableB)
+	a.mu.Unlock()
+}
+
+// SaveSession writes the session as AgentQTable does, with the second table.
+func (a *AgentDoubleQ) SaveSession(path string) error {
+	return a.saveSession(path, a.QTableB)
+}
+
+// LoadSession loads a session as AgentQTable does. One saved by a single-table agent
+// starts both tables from its table.
+func (a *AgentDoubleQ) LoadSession(path string) error {
+	second, err := a.loadSession(path)
+	if err != nil {
+		return err
+	}
+	a.setSecond(second)
+	return nil
+}
+
+// SaveToFile writes the Q-tables to path as AgentQTable does, the second one under "second".
+func (a *AgentDoubleQ) SaveToFile(path string) error {
+	return a.saveToFile(path, a.QTableB)
+}
+
+// LoadFromFile loads the Q-tables saved at path as AgentQTable does. A file saved by a
+// single-table agent starts both tables from its table.
+func (a *AgentDoubleQ) LoadFromFile(path string) error {
+	second, err := a.loadFromFile(path)
+	if err != nil {
+		return err
+	}
+	a.setSecond(second)
+	return nil
+}
+
+// setSecond installs a loaded second table, or a copy of the first if there was none.
+func (a *AgentDoubleQ) setSecond(second QTable) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if second == nil {
+		second = maps.Clone(a.QTable)
+	}
+	a.QTableB = second
+}
+
+// PretrainFromDemos runs AgentQTable's supervised warm-start on both tables.
+func (a *AgentDoubleQ) PretrainFromDemos(path string) error {
+	demos, err := LoadDemos(path)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pretrain(a.QTable, demos, true)
+	a.pretrain(a.QTableB, demos, false)
+	return nil
+}
+
+func (a *AgentDoubleQ) DebugInfoStr() string {
+	st := a.AgentQTable.Stats()
+	a.mu.RLock()
+	sizeB := len(a.QTableB)
+	a.mu.RUnlock()
+	return fmt.Sprintf("Type: Double Q\nQ-Size:  %d A, %d B\nVisits:  %d states, %.1f avg, %d once\nCovered: %.1f%% >%d visits\nAlpha:   %.8f\nGamma:   %.8f\nEpsilon: %.8f\nDecay:   %.8f",
+		st.States, sizeB, st.Visited, st.MeanVisits, st.VisitedOnce, 100*st.Coverage(), CoverageMinVisits, a.Alpha, a.Gamma, st.Epsilon, a.Exploration.Decay)
+}
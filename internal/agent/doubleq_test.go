@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestDoubleQUpdatesOneTable checks each update goes to one table, bootstrapping from
+// the other table's value of the action the updated table rates best next.
+func TestDoubleQUpdatesOneTable(t *testing.T) {
+	s, next := State{SegmentIdx: 1}, State{SegmentIdx: 2}
+	seen := map[string]bool{}
+	for seed := uint64(0); seed < 20; seed++ {
+		a := NewDoubleQAgentWithSeed(seed)
+		a.QTable[next] = [ActionCount]float64{ActionThrottle: 10, ActionBrake: 0}
+		a.QTableB[next] = [ActionCount]float64{ActionThrottle: 1, ActionBrake: 20}
+		a.Learn(s, ActionCoast, 1, next)
+
+		_, inA := a.QTable[s]
+		_, inB := a.QTableB[s]
+		switch {
+		case inA && !inB: // A picks throttle, B values it at 1
+			seen["A"] = true
+			if got, want := a.QTable[s][ActionCoast], Alpha*(1+Gamma*1); math.Abs(got-want) > 1e-12 {
+				t.Errorf("seed %d: A's Q(s, coast) = %v, want %v", seed, got, want)
+			}
+		case inB && !inA: // B picks brake, A values it at 0
+			seen["B"] = true
+			if got, want := a.QTableB[s][ActionCoast], Alpha*1; math.Abs(got-want) > 1e-12 {
+				t.Errorf("seed %d: B's Q(s, coast) = %v, want %v", seed, got, want)
+			}
+		default:
+			t.Fatalf("seed %d: updated A %v, B %v; want exactly one", seed, inA, inB)
+		}
+		if a.Visits[s] != 1 || a.steps != 1 {
+			t.Errorf("seed %d: after one update: %d visits, %d steps", seed, a.Visits[s], a.steps)
+		}
+	}
+	if !seen["A"] || !seen["B"] {
+		t.Errorf("over 20 seeds the updates went to %v, want both tables", seen)
+	}
+}
+
+// TestDoubleQReducesMaximizationBias learns the value of a step into a state where every
+// action pays pure noise: worth 0, which Q-learning overestimates by bootstrapping from
+// the luckiest of the noisy estimates, and double Q much less.
+func TestDoubleQReducesMaximizationBias(t *testing.T) {
+	s, noisy, done := State{SegmentIdx: 1}, State{SegmentIdx: 2}, State{SegmentIdx: 3}
+	estimate := func(a Agent) float64 {
+		rng := NewRand(3)
+		for i := 0; i < 20000; i++ {
+			a.Learn(s, ActionCoast, 0, noisy)
+			a.Learn(noisy, i%ActionCount, rng.NormFloat64(), done)
+		}
+		return a.QValuesFor(s)[ActionCoast]
+	}
+
+	single := NewAgentWithSeed(1)
+	single.Gamma = 1
+	double := NewDoubleQAgentWithSeed(1)
+	double.Gamma = 1
+	q, dq := estimate(single), estimate(double)
+	if q < 0.1 {
+		t.Fatalf("Q-learning valued the noise at %.3f; the test needs it to overestimate", q)
+	}
+	if math.Abs(dq) > q/2 {
+		t.Errorf("noise valued at %.3f by Q-learning and %.3f by double Q; want double Q much nearer 0", q, dq)
+	}
+}
+
+// TestDoubleQLearnsTheChain trains on the chain environment: throttle should come out
+// ahead of brake everywhere, in the combined values.
+func TestDoubleQLearnsTheChain(t *testing.T) {
+	a := NewDoubleQAgentWithSeed(42)
+	env := &chainEnv{}
+	for i := 0; i < 5000; i++ {
+		s := env.state()
+		action := a.SelectAction(s)
+		a.Learn(s, action, env.step(action), env.state())
+	}
+	for seg := 0; seg < chainLen; seg++ {
+		q := a.QValuesFor(State{SegmentIdx: seg})
+		if q[ActionThrottle] <= q[ActionBrake] {
+			t.Errorf("segment %d: throttle %.2f not above brake %.2f", seg, q[ActionThrottle], q[ActionBrake])
+		}
+	}
+}
+
+// TestDoubleQSessionKeepsBothTables checks sessions and Q-table files carry the second
+// table, and that a single-table session starts both tables from its one.
+func TestDoubleQSessionKeepsBothTables(t *testing.T) {
+	a := NewDoubleQAgentWithSeed(5)
+	env := &chainEnv{}
+	for i := 0; i < 2000; i++ {
+		s := env.state()
+		action := a.SelectAction(s)
+		a.Learn(s, action, env.step(action), env.state())
+	}
+	dir := t.TempDir()
+
+	for _, format := range []struct {
+		name       string
+		save, load func(a *AgentDoubleQ, path string) error
+	}{
+		{"session", (*AgentDoubleQ).SaveSession, (*AgentDoubleQ).LoadSession},
+		{"file", (*AgentDoubleQ).SaveToFile, (*AgentDoubleQ).LoadFromFile},
+	} {
+		path := filepath.Join(dir, format.name)
+		if err := format.save(a, path); err != nil {
+			t.Fatal(err)
+		}
+		b := NewDoubleQAgentWithSeed(6)
+		if err := format.load(b, path); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(a.QTable, b.QTable) || !reflect.DeepEqual(a.QTableB, b.QTableB) {
+			t.Errorf("%s: the tables changed in a save and load", format.name)
+		}
+	}
+
+	single := NewAgentWithSeed(7)
+	train(single, &chainEnv{}, 2000)
+	path := filepath.Join(dir, "single.gob")
+	if err := single.SaveSession(path); err != nil {
+		t.Fatal(err)
+	}
+	b := NewDoubleQAgentWithSeed(8)
+	if err := b.LoadSession(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(b.QTable, single.QTable) || !reflect.DeepEqual(b.QTableB, single.QTable) {
+		t.Error("a single-table session didn't start both tables from its table")
+	}
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"math"
+	"racing-line-mapper/internal/physics"
+	"racing-line-mapper/internal/track"
+)
+
+// Env is the core of the training loop with no window or input attached: a car on a
+// track, what the agent sees of it, and what each move earns. The app builds one over
+// its own state every tick; tests and tools can drive one directly.
+type Env struct {
+	Grid        *track.Grid
+	Mesh        *track.TrackMesh
+	Car         *physics.Car
+	Rewards     RewardConfig
+	MaskActions bool // Mask pointless actions in observed states (see MaskFor)
+	BestLapTime int  // Ticks, 0 if none yet (see Reward)
+
+	// TargetSpeeds is the fastest speed for each waypoint (see track.TargetSpeeds), for
+	// the RewardConfig.TargetSpeed term; without it the term is left out.
+	TargetSpeeds []float64
+}
+
+// Transition is what one Drive did to the car.
+type Transition struct {
+	Step     physics.StepInfo
+	Pos      TrackPos // Where the car is now
+	Progress ProgressEvent
+}
+
+// Observe is the agent's view of the car at its located position.
+func (e *Env) Observe(pos TrackPos) State {
+	state := DiscretizeStateAt(e.Car, e.Mesh, pos)
+	if e.MaskActions {
+		state.Masked = MaskFor(e.Car)
+	}
+	return state
+}
+
+// Drive advances the car one tick with the given inputs, then locates it and updates
+// its progress along the track.
+func (e *Env) Drive(throttle, brake, steering float64) Transition {
+	step := e.Car.Update(e.Grid, throttle, brake, steering)
+	pos := Locate(e.Car, e.Mesh)
+	return Transition{Step: step, Pos: pos, Progress: UpdateProgress(e.Car, e.Mesh, pos)}
+}
+
+// Ends reports whether tr ended the episode: the car crashed, or finished a point-to-point
+// track. Nothing follows either, so there is no next state to bootstrap from.
+func (e *Env) Ends(tr Transition) bool {
+	return tr.Step.Crashed || (tr.Progress.Lap && !e.Mesh.Looped)
+}
+
+// Learn teaches a the move from state that took action, earned reward and led to tr:
+// a transition that Ends the episode is learned as terminal, anything else from next.
+func (e *Env) Learn(a Agent, state State, action int, reward float64, tr Transition, next State) {
+	if e.Ends(tr) {
+		a.LearnTerminal(state, action, reward)
+		return
+	}
+	a.Learn(state, action, reward, next)
+}
+
+// Score is the reward for the move that took action and led to tr (see RewardTerms),
+// paid against the best lap so far, after which it records the lap tr finished, if any:
+// BestLapTime becomes its time if it beat the old one, and best reports whether it did.
+// Scoring first is what pays a new best lap TermPersonalBest.
+func (e *Env) Score(tr Transition, action int) (terms RewardBreakdown, best bool) {
+	terms = e.RewardTerms(tr.Pos, tr.Progress, action)
+	if tr.Progress.Lap && (e.BestLapTime == 0 || tr.Progress.LapTime < e.BestLapTime) {
+		e.BestLapTime = tr.Progress.LapTime
+		best = true
+	}
+	return terms, best
+}
+
+// Reward is the reward for the move that took action and made the progress at pos
+// (see the package-level Reward). A car that was already crashed only gets the crash
+// term, so pass it the zero TrackPos and ProgressEvent.
+func (e *Env) Reward(pos TrackPos, progress ProgressEvent, action int) float64 {
+	return e.RewardTerms(pos, progress, action).Total()
+}
+
+// RewardTerms is Reward split into its terms (see RewardBreakdown). On top of the
+// package-level RewardTerms, it charges for speed over the target at pos, which needs
+// the per-waypoint TargetSpeeds.
+func (e *Env) RewardTerms(pos TrackPos, progress ProgressEvent, action int) RewardBreakdown {
+	b := RewardTerms(e.Car, e.Grid, pos, progress, e.BestLapTime, action, e.Rewards)
+	if !e.Car.Crashed && e.Rewards.TargetSpeed != 0 && pos.Idx >= 0 && pos.Idx < len(e.TargetSpeeds) {
+		b[TermTargetSpeed] = -e.Rewards.TargetSpeed * math.Max(0, e.Car.Speed-e.TargetSpeeds[pos.Idx])
+	}
+	return b
+}
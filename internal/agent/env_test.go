@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"math"
+	"racing-line-mapper/internal/physics"
+	"testing"
+)
+
+// learnLog is a Q-learning agent that counts its updates and checks each terminal one
+// moved Q(s, a) towards the reward alone.
+type learnLog struct {
+	*AgentQTable
+	t                 *testing.T
+	learns, terminals int
+}
+
+func (l *learnLog) Learn(state State, action int, reward float64, next State) {
+	l.learns++
+	l.AgentQTable.Learn(state, action, reward, next)
+}
+
+func (l *learnLog) LearnTerminal(state State, action int, reward float64) {
+	l.terminals++
+	before := l.QValuesFor(state)[action]
+	l.AgentQTable.LearnTerminal(state, action, reward)
+	if got, want := l.QValuesFor(state)[action], before+l.Alpha*(reward-before); math.Abs(got-want) > 1e-12 {
+		l.t.Errorf("terminal update took Q from %v to %v, want %v", before, got, want)
+	}
+}
+
+// TestCrashLearnsOnce drives flat out into the corridor's wall and checks the crash is
+// learned once, on the tick it happens, without bootstrapping from the state after it.
+func TestCrashLearnsOnce(t *testing.T) {
+	grid, mesh := corridor()
+	a := &learnLog{AgentQTable: NewAgentWithSeed(1), t: t}
+	env := &Env{Grid: grid, Mesh: mesh, Car: StartCar(mesh, physics.DefaultCarParams()), Rewards: DefaultRewardConfig()}
+	env.Car.Position.X = 30 // Clear of the corridor's back wall
+	state := env.Observe(Locate(env.Car, mesh))
+	for tick := 0; !env.Car.Crashed; tick++ {
+		if tick == 1000 {
+			t.Fatal("no crash in 1000 ticks")
+		}
+		env.Car.CurrentLapTime++
+		tr := env.Drive(ActionInputs(ActionThrottle))
+		next := env.Observe(tr.Pos)
+		terms := env.RewardTerms(tr.Pos, tr.Progress, ActionThrottle)
+		if tr.Step.Crashed && terms[TermCrash] != env.Rewards.Crash {
+			t.Errorf("crash tick charged %v for the crash, want %v", terms[TermCrash], env.Rewards.Crash)
+		}
+		env.Learn(a, state, ActionThrottle, terms.Total(), tr, next)
+		state = next
+	}
+	if a.terminals != 1 || a.learns == 0 {
+		t.Errorf("got %d terminal and %d bootstrapped updates, want 1 terminal one after the drive", a.terminals, a.learns)
+	}
+}
+
+// TestPersonalBestBonus checks a lap is paid for beating the best lap it's up against,
+// and only then.
+func TestPersonalBestBonus(t *testing.T) {
+	grid, mesh := corridor()
+	env := &Env{Grid: grid, Mesh: mesh, Car: StartCar(mesh, physics.DefaultCarParams()), Rewards: DefaultRewardConfig(), BestLapTime: 300}
+	pos := Locate(env.Car, mesh)
+
+	terms := env.RewardTerms(pos, ProgressEvent{Lap: true, LapTime: 280}, ActionThrottle)
+	if terms[TermPersonalBest] != 500 || terms[TermImprovement] != 20*5 {
+		t.Errorf("lap 20 ticks under the best: personal best %v, improvement %v; want 500 and 100", terms[TermPersonalBest], terms[TermImprovement])
+	}
+	for _, lapTime := range []int{300, 320} {
+		terms := env.RewardTerms(pos, ProgressEvent{Lap: true, LapTime: lapTime}, ActionThrottle)
+		if terms[TermPersonalBest] != 0 || terms[TermImprovement] != 0 {
+			t.Errorf("lap of %d ticks against a best of 300: personal best %v, improvement %v; want neither", lapTime, terms[TermPersonalBest], terms[TermImprovement])
+		}
+	}
+}
+
+// TestScorePaysBeforeRecording runs laps through Score, as the app and the tools do: a
+// faster lap is paid for beating the best before it becomes the best.
+func TestScorePaysBeforeRecording(t *testing.T) {
+	grid, mesh := corridor()
+	env := &Env{Grid: grid, Mesh: mesh, Car: StartCar(mesh, physics.DefaultCarParams()), Rewards: DefaultRewardConfig()}
+	pos := Locate(env.Car, mesh)
+
+	for _, tc := range []struct {
+		lapTime  int
+		best     bool
+		bonus    float64
+		bestTime int
+	}{
+		{300, true, 0, 300}, // The first lap is the best, with nothing to beat
+		{280, true, 500, 280},
+		{290, false, 0, 280},
+	} {
+		terms, best := env.Score(Transition{Pos: pos, Progress: ProgressEvent{Lap: true, LapTime: tc.lapTime}}, ActionThrottle)
+		if best != tc.best || terms[TermPersonalBest] != tc.bonus || env.BestLapTime != tc.bestTime {
+			t.Errorf("lap of %d ticks: best %v, personal best bonus %v, best lap %d; want %v, %v, %d",
+				tc.lapTime, best, terms[TermPersonalBest], env.BestLapTime, tc.best, tc.bonus, tc.bestTime)
+		}
+	}
+}
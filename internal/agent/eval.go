@@ -0,0 +1,262 @@
+package agent
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"math"
+	"os"
+	"racing-line-mapper/internal/physics"
+	"racing-line-mapper/internal/track"
+	"slices"
+	"strconv"
+)
+
+// Evaluation defaults (see EvalOptions)
+const (
+	EvalMaxLapTicks    = 20000 // A lap taking longer than this is abandoned as a timeout
+	EvalAttemptsPerLap = 3     // Give up after this many attempts per clean lap asked for
+)
+
+// EvalOptions tunes an evaluation run.
+type EvalOptions struct {
+	MaskActions bool   // Mask pointless actions as during training (see MaskFor)
+	MaxLapTicks int    // Lap attempts longer than this count as timeouts
+	MaxAttempts int    // Stop after this many lap attempts even if short of clean laps
+	TieOrder    []int  // Priority between equally valued actions (nil = random, see Seed)
+	Seed        uint64 // Of the random tie-breaking between equally valued actions
+
+	CarModel  physics.PhysicsModel // Physics the evaluation car drives with
+	CarParams physics.CarParams    // Vehicle the evaluation car is
+
+	// Stop, if set, is polled every tick; once it reports true the evaluation ends
+	// early, e.g. on Ctrl+C, and the result is marked Interrupted.
+	Stop func() bool
+}
+
+// DefaultEvalOptions returns the options Evaluate uses for n clean laps.
+func DefaultEvalOptions(n int) EvalOptions {
+	return EvalOptions{
+		MaxLapTicks: EvalMaxLapTicks,
+		MaxAttempts: n * EvalAttemptsPerLap,
+		TieOrder:    DefaultTieOrder,
+		CarParams:   physics.DefaultCarParams(),
+	}
+}
+
+// EvalResult summarizes an evaluation run. Lap times are in ticks.
+type EvalResult struct {
+	Attempts  int   // Laps started
+	LapTimes  []int // Of the clean laps, in the order they were driven
+	DirtyLaps int   // Completed, but with a wheel on the gravel at some point
+	Crashes   int
+	Timeouts  int
+
+	// Interrupted is set if Stop ended the evaluation before it was done, so the
+	// statistics cover fewer laps than asked for.
+	Interrupted bool
+
+	// Over the clean laps (zero if there were none)
+	Mean, Median, P95 float64
+	Best              int
+}
+
+// CleanLaps is the number of laps completed without crashing or leaving the tarmac.
+func (r EvalResult) CleanLaps() int { return len(r.LapTimes) }
+
+// CrashRate is the fraction of lap attempts that ended in a crash.
+func (r EvalResult) CrashRate() float64 {
+	if r.Attempts == 0 {
+		return 0
+	}
+	return float64(r.Crashes) / float64(r.Attempts)
+}
+
+func (r EvalResult) String() string {
+	s := fmt.Sprintf("%d/%d clean laps (%d dirty, %d crashes, %d timeouts; crash rate %.0f%%) | mean %.0f, median %.0f, p95 %.0f, best %d ticks",
+		r.CleanLaps(), r.Attempts, r.DirtyLaps, r.Crashes, r.Timeouts, 100*r.CrashRate(), r.Mean, r.Median, r.P95, r.Best)
+	if r.Interrupted {
+		s += " (interrupted)"
+	}
+	return s
+}
+
+// Evaluate drives the agent's greedy policy until it has n clean laps (or runs out of
+// attempts, see DefaultEvalOptions) and reports the lap time statistics.
+func Evaluate(a Agent, grid *track.Grid, mesh *track.TrackMesh, n int) EvalResult {
+	return EvaluateWith(a, grid, mesh, n, DefaultEvalOptions(n))
+}
+
+// EvaluateWith is Evaluate with explicit options. Nothing is learned and nothing is
+// explored: every action is the best one by the agent's current Q-values, so the agent
+// itself is left untouched. Each attempt after a crash or timeout starts a fresh car on the
+// first waypoint; after a completed lap the car carries on into the next one, as in training,
+// except on a point-to-point track, where every run starts afresh.
+func EvaluateWith(a Agent, grid *track.Grid, mesh *track.TrackMesh, n int, opts EvalOptions) EvalResult {
+	var r EvalResult
+	if len(mesh.Waypoints) < 2 {
+		return r
+	}
+	rng := NewRand(opts.Seed)
+
+attempts:
+	for r.CleanLaps() < n && r.Attempts < opts.MaxAttempts {
+		car := StartCar(mesh, opts.CarParams)
+		car.Config.Model = opts.CarModel
+		env := &Env{Grid: grid, Mesh: mesh, Car: car, MaskActions: opts.MaskActions}
+		pos := Locate(car, mesh)
+		offTrack := false
+		r.Attempts++
+
+		for r.CleanLaps() < n {
+			if opts.Stop != nil && opts.Stop() {
+				r.Interrupted = true
+				break attempts
+			}
+			car.CurrentLapTime++
+			state := env.Observe(pos)
+			action := chooseGreedy(rng, opts.TieOrder, a.QValuesFor(state), state.Masked)
+			throttle, brake, steering := Inputs(a, state, action)
+
+			tr := env.Drive(throttle, brake, steering)
+			if tr.Step.Crashed {
+				r.Crashes++
+				break
+			}
+			offTrack = offTrack || tr.Step.Surface == track.CellGravel
+			pos = tr.Pos
+
+			if progress := tr.Progress; progress.Lap {
+				if offTrack {
+					r.DirtyLaps++
+				} else {
+					r.LapTimes = append(r.LapTimes, progress.LapTime)
+				}
+				if r.CleanLaps() == n || r.Attempts == opts.MaxAttempts || !mesh.Looped {
+					break
+				}
+				car.CurrentLapTime = 0
+				offTrack = false
+				r.Attempts++
+				continue
+			}
+			if opts.MaxLapTicks > 0 && car.CurrentLapTime >= opts.MaxLapTicks {
+				r.Timeouts++
+				break
+			}
+		}
+	}
+
+	r.summarize()
+	return r
+}
+
+// StartCar is a car with the given params at rest at the mesh's start, facing its start
+// heading (see track.TrackMesh.StartPose), with progress counted from the first waypoint.
+func StartCar(mesh *track.TrackMesh, params physics.CarParams) *physics.Car {
+	pos, heading := mesh.StartPose()
+	car := physics.NewCar(pos.X, pos.Y, params)
+	car.Heading = heading
+	car.Checkpoint = 0
+	return car
+}
+
+// summarize fills in the lap time statistics from LapTimes.
+func (r *EvalResult) summarize() {
+	if len(r.LapTimes) == 0 {
+		return
+	}
+	sorted := slices.Sorted(slices.Values(r.LapTimes))
+	sum := 0
+	for _, t := range sorted {
+		sum += t
+	}
+	r.Mean = float64(sum) / float64(len(sorted))
+	r.Median = percentile(sorted, 50)
+	r.P95 = percentile(sorted, 95)
+	r.Best = sorted[0]
+}
+
+// percentile interpolates linearly between the closest ranks of sorted values.
+func percentile(sorted []int, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := min(lo+1, len(sorted)-1)
+	frac := rank - float64(lo)
+	return float64(sorted[lo])*(1-frac) + float64(sorted[hi])*frac
+}
+
+// SteeringAgent is implemented by agents that pick how hard to steer instead of always
+// steering at full lock (see AgentTileCoded.SteerLevels).
+type SteeringAgent interface {
+	// Steering is the steering input, in [-1, 1], for taking action at state.
+	Steering(state State, action int) float64
+}
+
+// Inputs is ActionInputs for an action the agent chose at state, steering by the agent's
+// own amount if it picks one (see SteeringAgent).
+func Inputs(a Agent, state State, action int) (throttle, brake, steering float64) {
+	throttle, brake, steering = ActionInputs(action)
+	if sa, ok := a.(SteeringAgent); ok && steering != 0 {
+		steering = sa.Steering(state, action)
+	}
+	return throttle, brake, steering
+}
+
+// ActionInputs maps a discrete action to the driver inputs it stands for.
+func ActionInputs(action int) (throttle, brake, steering float64) {
+	switch action {
+	case ActionThrottle:
+		throttle = 1.0
+	case ActionBrake:
+		brake = 1.0
+	case ActionLeft:
+		steering = -1.0
+	case ActionRight:
+		steering = 1.0
+	}
+	return throttle, brake, steering
+}
+
+// ConfigHash is a short stable digest of a configuration value (its %#v form), for
+// telling apart results produced under different settings.
+func ConfigHash(config any) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%#v", config)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// evalCSVHeader is the first row of a results file (see AppendCSV).
+var evalCSVHeader = []string{"config", "attempts", "clean_laps", "dirty_laps", "crashes", "timeouts", "crash_rate", "mean", "median", "p95", "best"}
+
+// AppendCSV adds the result as a row keyed by configHash to the CSV file at path,
+// creating it with a header row if it doesn't exist yet.
+func (r EvalResult) AppendCSV(path, configHash string) error {
+	_, err := os.Stat(path)
+	isNew := errors.Is(err, fs.ErrNotExist)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if isNew {
+		w.Write(evalCSVHeader)
+	}
+	ftoa := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	w.Write([]string{
+		configHash,
+		strconv.Itoa(r.Attempts), strconv.Itoa(r.CleanLaps()), strconv.Itoa(r.DirtyLaps),
+		strconv.Itoa(r.Crashes), strconv.Itoa(r.Timeouts), ftoa(r.CrashRate()),
+		ftoa(r.Mean), ftoa(r.Median), ftoa(r.P95), strconv.Itoa(r.Best),
+	})
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
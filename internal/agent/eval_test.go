@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"encoding/csv"
+	"math"
+	"os"
+	"path/filepath"
+	"racing-line-mapper/internal/common"
+	"racing-line-mapper/internal/physics"
+	"racing-line-mapper/internal/track"
+	"testing"
+)
+
+// throttleAgent always floors it, whatever the state.
+type throttleAgent struct{ AgentQTable }
+
+func (*throttleAgent) QValuesFor(State) [ActionCount]float64 {
+	var q [ActionCount]float64
+	q[ActionThrottle] = 1
+	return q
+}
+
+// corridor is a short drivable straight along straightMesh(30), moved to y=50, with
+// the wall right after its last waypoint: flat out along it ends in the wall.
+func corridor() (*track.Grid, *track.TrackMesh) {
+	grid := track.NewGrid(200, 100)
+	for x := 0; x < 150; x++ {
+		for y := 20; y < 80; y++ {
+			grid.Set(x, y, track.Cell{Type: track.CellTarmac, Friction: 1})
+		}
+	}
+	mesh := straightMesh(30)
+	for i := range mesh.Waypoints {
+		mesh.Waypoints[i].Position.Y = 50
+	}
+	return grid, mesh
+}
+
+func TestEvaluateCountsCrashes(t *testing.T) {
+	grid, mesh := corridor()
+	res := Evaluate(&throttleAgent{}, grid, mesh, 4)
+	if res.Attempts != 4*EvalAttemptsPerLap || res.Crashes != res.Attempts {
+		t.Errorf("got %d crashes in %d attempts, want every one of %d attempts to crash", res.Crashes, res.Attempts, 4*EvalAttemptsPerLap)
+	}
+	if res.CleanLaps() != 0 || res.CrashRate() != 1 {
+		t.Errorf("got %d clean laps, crash rate %.2f; want 0 and 1", res.CleanLaps(), res.CrashRate())
+	}
+}
+
+func TestEvaluateLeavesAgentUntouched(t *testing.T) {
+	grid, mesh := corridor()
+	a := NewAgentWithSeed(1)
+	Evaluate(a, grid, mesh, 2)
+	if a.Epsilon() != StartEpsilon || len(a.QTable) != 0 {
+		t.Errorf("evaluation changed the agent: epsilon %v, %d Q-table entries", a.Epsilon(), len(a.QTable))
+	}
+}
+
+// TestEvaluateStops checks Stop ends an evaluation early and marks it interrupted.
+func TestEvaluateStops(t *testing.T) {
+	grid := track.NewGrid(200, 100) // All wall: every attempt crashes on its first tick
+	opts := DefaultEvalOptions(5)
+	polls := 0
+	opts.Stop = func() bool { polls++; return polls > 3 }
+
+	res := EvaluateWith(&throttleAgent{}, grid, straightMesh(30), 5, opts)
+	if !res.Interrupted || polls != 4 || res.Crashes != 3 {
+		t.Errorf("stopped after %d polls: %v; want interrupted on the 4th poll, after 3 crashes", polls, res)
+	}
+	if res := Evaluate(&throttleAgent{}, grid, straightMesh(30), 1); res.Interrupted {
+		t.Error("evaluation without a Stop came out interrupted")
+	}
+}
+
+func TestEvalResultStatistics(t *testing.T) {
+	r := EvalResult{LapTimes: []int{130, 100, 110, 120, 200}}
+	r.summarize()
+	if r.Mean != 132 || r.Median != 120 || r.Best != 100 {
+		t.Errorf("mean %v, median %v, best %d; want 132, 120, 100", r.Mean, r.Median, r.Best)
+	}
+	if r.P95 != 186 { // Rank 3.8 of 0..4: 80% of the way from 130 to 200
+		t.Errorf("p95 = %v, want 186", r.P95)
+	}
+}
+
+func TestAppendCSVWritesHeaderOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	r := EvalResult{Attempts: 3, LapTimes: []int{100}}
+	r.summarize()
+	for _, hash := range []string{ConfigHash(DefaultRewardConfig()), ConfigHash(RewardConfig{})} {
+		if err := r.AppendCSV(path, hash); err != nil {
+			t.Fatalf("AppendCSV: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("reading back: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "config" {
+		t.Fatalf("got rows %v, want a header and two results", rows)
+	}
+	if rows[1][0] == rows[2][0] {
+		t.Errorf("different configs got the same hash %s", rows[1][0])
+	}
+}
+
+// TestStartCarUsesMeshStartPose checks the car every episode starts in (the app's
+// respawns included) takes the mesh's start pose, not East from the first waypoint.
+func TestStartCarUsesMeshStartPose(t *testing.T) {
+	mesh := straightMesh(30)
+	mesh.StartPosition, mesh.StartHeading = common.Vec2{X: 40, Y: 3}, math.Pi/2
+	car := StartCar(mesh, physics.DefaultCarParams())
+	if car.Position != mesh.StartPosition || car.Heading != mesh.StartHeading || car.Checkpoint != 0 {
+		t.Errorf("car at %v heading %.2f (checkpoint %d), want %v heading %.2f (checkpoint 0)",
+			car.Position, car.Heading, car.Checkpoint, mesh.StartPosition, mesh.StartHeading)
+	}
+
+	// A mesh built in code has no start: the first waypoint, facing the second
+	mesh = straightMesh(30)
+	mesh.Waypoints[1].Position.Y = 5
+	car = StartCar(mesh, physics.DefaultCarParams())
+	if car.Position != mesh.Waypoints[0].Position || math.Abs(car.Heading-math.Pi/4) > 1e-12 {
+		t.Errorf("car at %v heading %.2f, want %v heading %.2f", car.Position, car.Heading, mesh.Waypoints[0].Position, math.Pi/4)
+	}
+}
@@ -0,0 +1,35 @@
+package agent
+
+import "math"
+
+// Exploration is an agent's epsilon-greedy schedule. The exploration rate only moves
+// with learning steps (Learn calls), never with action selection, so choosing actions
+// without learning (evaluation, a paused run) doesn't use up the exploration budget.
+type Exploration struct {
+	Start  float64 `json:"start"`  // Rate when the decay begins
+	Warmup int     `json:"warmup"` // Learning steps of purely random actions before the decay begins (to fill the table)
+	Decay  float64 `json:"decay"`  // Multiplies the rate per learning step after the warmup
+	Min    float64 `json:"min"`    // The rate never decays below this
+}
+
+// DefaultExploration starts fully random with no warmup and decays by Decay down to MinEpsilon.
+func DefaultExploration() Exploration {
+	return Exploration{Start: StartEpsilon, Decay: Decay, Min: MinEpsilon}
+}
+
+// Rate is the exploration rate after the given number of learning steps.
+func (e Exploration) Rate(steps int) float64 {
+	if steps < e.Warmup {
+		return 1
+	}
+	return math.Max(e.Start*math.Pow(e.Decay, float64(steps-e.Warmup)), e.Min)
+}
+
+// stepsTo is roughly how many learning steps the rate takes to decay to rate (for
+// sessions saved before the steps were, which only kept the rate).
+func (e Exploration) stepsTo(rate float64) int {
+	if rate >= e.Start || e.Decay <= 0 || e.Decay >= 1 || rate <= 0 {
+		return e.Warmup
+	}
+	return e.Warmup + int(math.Round(math.Log(rate/e.Start)/math.Log(e.Decay)))
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExplorationSchedule(t *testing.T) {
+	e := Exploration{Start: 0.5, Warmup: 10, Decay: 0.9, Min: 0.1}
+	for _, tc := range []struct {
+		steps int
+		want  float64
+	}{{0, 1}, {9, 1}, {10, 0.5}, {11, 0.45}, {12, 0.405}, {1000, 0.1}} {
+		if got := e.Rate(tc.steps); math.Abs(got-tc.want) > 1e-12 {
+			t.Errorf("after %d steps: rate %v, want %v", tc.steps, got, tc.want)
+		}
+	}
+	for _, steps := range []int{0, 10, 15, 25} {
+		if got := e.stepsTo(e.Rate(steps)); got != max(steps, e.Warmup) {
+			t.Errorf("stepsTo(Rate(%d)) = %d", steps, got)
+		}
+	}
+}
+
+// TestExplorationFollowsLearning checks that only learning moves the exploration rate:
+// selecting actions alone (as evaluation does) leaves it where it was.
+func TestExplorationFollowsLearning(t *testing.T) {
+	s, next := State{SegmentIdx: 1}, State{SegmentIdx: 2}
+	for name, ag := range map[string]Agent{
+		"qtable": NewAgentWithSeed(1),
+		"linear": NewLinearAgent(DefaultAgentConfig()),
+		"tiles":  NewTileCodedAgent(DefaultTileCoder(), DefaultAgentConfig()),
+	} {
+		for i := 0; i < 1000; i++ {
+			ag.SelectAction(s)
+		}
+		if got := ag.Epsilon(); got != StartEpsilon {
+			t.Errorf("%s: epsilon %v after selecting actions, want it still at %v", name, got, StartEpsilon)
+		}
+		for i := 0; i < 1000; i++ {
+			ag.Learn(s, ag.SelectAction(s), 0, next)
+		}
+		if got, want := ag.Epsilon(), DefaultExploration().Rate(1000); got != want {
+			t.Errorf("%s: epsilon %v after 1000 learning steps, want %v", name, got, want)
+		}
+	}
+
+	// Warmup: every action random until it's over, then the configured start
+	a := NewAgentWithSeed(1)
+	a.Exploration = Exploration{Start: 0.2, Warmup: 100, Decay: 1, Min: 0}
+	a.QTable[s] = [ActionCount]float64{ActionThrottle: 10}
+	throttle := 0
+	for i := 0; i < 100; i++ {
+		if a.Epsilon() != 1 {
+			t.Fatalf("step %d of the warmup: epsilon %v, want 1", i, a.Epsilon())
+		}
+		if a.SelectAction(s) == ActionThrottle {
+			throttle++
+		}
+		a.Learn(next, ActionCoast, 0, next)
+	}
+	if throttle > 50 {
+		t.Errorf("warmup chose the greedy action %d/100 times, want about 1 in %d", throttle, ActionCount)
+	}
+	if got := a.Epsilon(); got != 0.2 {
+		t.Errorf("after the warmup: epsilon %v, want 0.2", got)
+	}
+}
+
+// TestSetEpsilon checks an override moves only that agent along its schedule, and that
+// learning decays on from the rate it was set to.
+func TestSetEpsilon(t *testing.T) {
+	a, b := NewAgentWithSeed(1), NewAgentWithSeed(1)
+	a.Exploration = Exploration{Start: 1, Decay: 0.99, Min: 0.01}
+	b.Exploration = a.Exploration
+
+	a.SetEpsilon(0.5)
+	if got := a.Epsilon(); math.Abs(got-0.5) > 0.005 {
+		t.Errorf("epsilon %v after setting it to 0.5", got)
+	}
+	if got := b.Epsilon(); got != 1 {
+		t.Errorf("the other agent's epsilon moved to %v", got)
+	}
+	before := a.Epsilon()
+	a.Learn(State{SegmentIdx: 1}, ActionCoast, 0, State{SegmentIdx: 2})
+	if got, want := a.Epsilon(), before*0.99; math.Abs(got-want) > 1e-12 {
+		t.Errorf("epsilon %v after a learning step from %v, want %v", got, before, want)
+	}
+
+	for _, tc := range []struct{ set, want float64 }{{2, 1}, {0.001, 0.01}, {0, 0.01}} {
+		a.SetEpsilon(tc.set)
+		if got := a.Epsilon(); math.Abs(got-tc.want) > 0.001 {
+			t.Errorf("SetEpsilon(%v): epsilon %v, want it clamped to %v", tc.set, got, tc.want)
+		}
+	}
+	a.Exploration.Min = 0
+	if a.SetEpsilon(0); a.Epsilon() > 1e-6 {
+		t.Errorf("SetEpsilon(0) with no floor: epsilon %v, want about 0", a.Epsilon())
+	}
+}
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"math"
+	"racing-line-mapper/internal/physics"
+	"racing-line-mapper/internal/track"
+)
+
+// CurvatureLookahead is how many waypoints ahead the curvature feature looks.
+const CurvatureLookahead = 10
+
+// Curvature buckets of State.NextCurvature (see curvatureBucket)
+const (
+	CurvatureBucketBend = track.StraightCurvature    // |curvature| (rad/pixel) from which the track ahead bends
+	CurvatureBucketHard = 2 * track.ApexMinCurvature // ... and from which it bends hard (radius under 100px)
+)
+
+// Features is the continuous (un-bucketed) observation of the car.
+// It is comparable so it can live inside State, but tabular agents ignore it.
+type Features struct {
+	S              float64 // Progress along track, normalized to 0..1
+	D              float64 // Lateral offset from centerline (pixels, positive = right)
+	Speed          float64 // Scalar speed (pixels per tick)
+	HeadingRel     float64 // Car heading minus track heading (radians, -Pi..Pi)
+	CurvatureAhead float64 // Signed heading change per pixel over the lookahead window
+	TopSpeed       float64 // The car's top speed (pixels per tick), which Speed is relative to
+}
+
+// SpeedFrac is Speed as a fraction of the car's top speed, or of the stock car's
+// (see physics.DefaultCarParams) where TopSpeed is unset.
+func (f Features) SpeedFrac() float64 {
+	top := f.TopSpeed
+	if top <= 0 {
+		top = physics.DefaultCarParams().MaxSpeed
+	}
+	return f.Speed / top
+}
+
+// curvatureAhead estimates the signed curvature of the track between waypoint idx
+// and the waypoint CurvatureLookahead steps ahead (change in tangent angle / arc length).
+func curvatureAhead(mesh *track.TrackMesh, idx int) float64 {
+	n := len(mesh.Waypoints)
+	if n < 2 || idx < 0 {
+		return 0
+	}
+	a := mesh.Waypoints[idx]
+	b := mesh.At(idx + CurvatureLookahead)
+
+	// Tangent is Normal rotated -90 deg
+	h1 := math.Atan2(-a.Normal.X, a.Normal.Y)
+	h2 := math.Atan2(-b.Normal.X, b.Normal.Y)
+
+	dh := h2 - h1
+	for dh > math.Pi {
+		dh -= 2 * math.Pi
+	}
+	for dh < -math.Pi {
+		dh += 2 * math.Pi
+	}
+
+	arc := b.Distance - a.Distance
+	if arc <= 0 {
+		arc += mesh.TotalLen
+	}
+	if arc <= 0 {
+		return 0
+	}
+	return dh / arc
+}
+
+// curvatureBucket discretizes a curvature ahead (see curvatureAhead) into -2 (hard
+// left), -1 (left), 0 (straight), 1 (right) or 2 (hard right).
+func curvatureBucket(k float64) int {
+	bucket := 0
+	switch a := math.Abs(k); {
+	case a >= CurvatureBucketHard:
+		bucket = 2
+	case a >= CurvatureBucketBend:
+		bucket = 1
+	}
+	if k < 0 {
+		bucket = -bucket
+	}
+	return bucket
+}
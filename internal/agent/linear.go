@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+)
+
+// Linear approximator hyperparameters.
+// The tabular Gamma is too close to 1 for function approximation (values grow
+// to ~1/(1-Gamma) times the per-tick reward and the weights diverge), so the
+// linear agent uses a shorter horizon.
+const (
+	LinearAlpha   float64 = 0.001 // Learning Rate (per weight)
+	LinearGamma   float64 = 0.99  // Discount Factor
+	LinearTDClip  float64 = 100.0 // Clamp on the TD error to keep lap bonuses from blowing up the weights
+	LinearDClamp  float64 = 30.0  // |d| (pixels) that maps to a normalized offset of 1
+	LinearCurvMax float64 = 0.05  // |curvature| (rad/pixel) that maps to a normalized curvature of 1
+)
+
+// NumBasis is the length of the feature vector fed to the linear approximator.
+const NumBasis = 10
+
+// AgentLinear approximates Q(s, a) = W[a] . phi(s) over the continuous Features,
+// so it generalizes between nearby states instead of storing each one.
+type AgentLinear struct {
+	W       [ActionCount][NumBasis]float64
+	Updates int
+
+	// Exploration is the epsilon-greedy schedule, over the learning steps (Updates).
+	Exploration Exploration
+
+	seed uint64 // Of rng, for Reset
+	rng  *Rand
+}
+
+// NewLinearAgent creates a linear agent with the exploration schedule and seed of cfg
+// (it keeps its own learning rate and discount; see LinearAlpha).
+func NewLinearAgent(cfg AgentConfig) *AgentLinear {
+	seed := cfg.seed()
+	return &AgentLinear{
+		Exploration: cfg.Exploration,
+		seed:        seed,
+		rng:         NewRand(seed),
+	}
+}
+
+// Reset zeroes the weights and restarts exploration.
+func (a *AgentLinear) Reset() {
+	a.W = [ActionCount][NumBasis]float64{}
+	a.Updates = 0
+	a.rng = NewRand(a.seed)
+}
+
+// basis maps the raw continuous features to a normalized vector phi(s).
+// A few squared/product terms are included so a linear model can still
+// express "slow down when far off-center" and "slow down before curves".
+func basis(f Features) [NumBasis]float64 {
+	d := clamp(f.D/LinearDClamp, -1, 1)
+	v := clamp(f.SpeedFrac(), -1, 1) // 1 at the car's top speed
+	k := clamp(f.CurvatureAhead/LinearCurvMax, -1, 1)
+	sinH := math.Sin(f.HeadingRel)
+	cosH := math.Cos(f.HeadingRel)
+
+	return [NumBasis]float64{
+		1.0, // Bias
+		f.S,
+		d,
+		d * d,
+		v,
+		v * v,
+		sinH,
+		cosH,
+		k,
+		v * math.Abs(k),
+	}
+}
+
+func clamp(x, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, x))
+}
+
+// qValues evaluates W[a] . phi for every action.
+func (a *AgentLinear) qValues(phi [NumBasis]float64) [ActionCount]float64 {
+	var q [ActionCount]float64
+	for act := 0; act < ActionCount; act++ {
+		for i, x := range phi {
+			q[act] += a.W[act][i] * x
+		}
+	}
+	return q
+}
+
+func (a *AgentLinear) Epsilon() float64 { return a.Exploration.Rate(a.Updates) }
+
+// SelectAction chooses an action using Epsilon-Greedy policy over the approximated Q-values.
+// Masked actions are never chosen.
+func (a *AgentLinear) SelectAction(state State) int {
+	if a.rng.Float64() < a.Epsilon() {
+		return randomAction(a.rng, state.Masked)
+	}
+	return greedyAction(a.rng, a.qValues(basis(state.Features)), state.Masked)
+}
+
+// Learn performs a semi-gradient TD(0) update of the chosen action's weights.
+// W[a] += Alpha * (R + Gamma * maxQ(s',a') - Q(s,a)) * phi(s)
+func (a *AgentLinear) Learn(state State, action int, reward float64, nextState State) {
+	a.learn(state, action, reward, maxAllowedQ(a.qValues(basis(nextState.Features)), nextState.Masked))
+}
+
+// LearnTerminal is Learn for a transition that ended the episode: the target is the reward alone.
+func (a *AgentLinear) LearnTerminal(state State, action int, reward float64) {
+	a.learn(state, action, reward, 0)
+}
+
+// learn performs the update towards reward + Gamma * maxNextQ.
+func (a *AgentLinear) learn(state State, action int, reward, maxNextQ float64) {
+	phi := basis(state.Features)
+	currentQ := a.qValues(phi)[action]
+
+	tdError := clamp(reward+LinearGamma*maxNextQ-currentQ, -LinearTDClip, LinearTDClip)
+	for i, x := range phi {
+		a.W[action][i] += LinearAlpha * tdError * x
+	}
+	a.Updates++
+}
+
+// QValuesFor returns the approximated Q-values of every action at the given state.
+func (a *AgentLinear) QValuesFor(state State) [ActionCount]float64 {
+	return a.qValues(basis(state.Features))
+}
+
+func (a *AgentLinear) DebugInfoStr() string {
+	norm := 0.0
+	for act := range a.W {
+		for _, w := range a.W[act] {
+			norm += w * w
+		}
+	}
+	return fmt.Sprintf("Type: Linear\nUpdates: %d\n|W|:     %.4f\nAlpha:   %.8f\nGamma:   %.8f\nEpsilon: %.8f\nDecay:   %.8f",
+		a.Updates, math.Sqrt(norm), LinearAlpha, LinearGamma, a.Epsilon(), a.Exploration.Decay)
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"math"
+	"testing"
+)
+
+// TestLinearAgentLearnsTheReward checks repeated terminal updates bring Q(s, a) to the
+// reward they pay, and leave the other actions' weights alone.
+func TestLinearAgentLearnsTheReward(t *testing.T) {
+	a := NewLinearAgent(DefaultAgentConfig())
+	s := State{Features: Features{S: 0.3, D: 6, Speed: 4, HeadingRel: 0.2, CurvatureAhead: 0.01}}
+
+	for i := 0; i < 20000; i++ {
+		a.LearnTerminal(s, ActionThrottle, 5)
+	}
+	if q := a.QValuesFor(s)[ActionThrottle]; math.Abs(q-5) > 0.01 {
+		t.Errorf("Q(s, throttle) = %.4f after 20000 updates towards 5", q)
+	}
+	if a.W[ActionBrake] != ([NumBasis]float64{}) {
+		t.Errorf("brake weights %v, want untouched", a.W[ActionBrake])
+	}
+	if a.Updates != 20000 {
+		t.Errorf("%d updates counted, want 20000", a.Updates)
+	}
+}
+
+// TestLinearLearnTerminalDoesNotBootstrap checks the terminal target is the reward
+// alone, where Learn adds the discounted best value of the next state.
+func TestLinearLearnTerminalDoesNotBootstrap(t *testing.T) {
+	s, next := State{Features: Features{S: 0.3}}, State{Features: Features{S: 0.6}}
+	step := func(terminal bool) float64 {
+		a := NewLinearAgent(DefaultAgentConfig())
+		a.W[ActionCoast][0] = 50 // Coasting is worth 50 everywhere (the bias term is 1)
+		if terminal {
+			a.LearnTerminal(s, ActionThrottle, 1)
+		} else {
+			a.Learn(s, ActionThrottle, 1, next)
+		}
+		return a.W[ActionThrottle][0] // Moved by Alpha * TD error
+	}
+
+	if got, want := step(true), LinearAlpha*1; math.Abs(got-want) > 1e-12 {
+		t.Errorf("terminal update moved the bias weight by %v, want %v", got, want)
+	}
+	if got, want := step(false), LinearAlpha*(1+LinearGamma*50); math.Abs(got-want) > 1e-12 {
+		t.Errorf("bootstrapped update moved the bias weight by %v, want %v", got, want)
+	}
+}
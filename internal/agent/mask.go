@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"math"
+	"racing-line-mapper/internal/physics"
+)
+
+// ActionMask is a set of actions, one bit per action (bit i = action i).
+// State.Masked holds the actions that are forbidden in a state; agents never pick
+// them and don't bootstrap through them. The zero mask allows everything.
+type ActionMask uint8
+
+// MaskOf returns the mask containing the given actions.
+func MaskOf(actions ...int) ActionMask {
+	var m ActionMask
+	for _, a := range actions {
+		m |= 1 << a
+	}
+	return m
+}
+
+// Has reports whether the action is in the mask.
+func (m ActionMask) Has(action int) bool {
+	return m&(1<<action) != 0
+}
+
+// MaskFor returns the actions that are pointless for the car right now:
+// throttle at top speed, and braking once stopped (it would start reversing).
+func MaskFor(c *physics.Car) ActionMask {
+	var m ActionMask
+	if c.Speed >= c.Params.MaxSpeed {
+		m |= MaskOf(ActionThrottle)
+	}
+	if c.Speed <= 0 {
+		m |= MaskOf(ActionBrake)
+	}
+	return m
+}
+
+// allowed returns the mask of usable actions, ignoring a mask that would forbid all of them.
+func allowed(masked ActionMask) ActionMask {
+	all := ActionMask(1<<ActionCount - 1)
+	if masked&all == all {
+		return all
+	}
+	return all &^ masked
+}
+
+// randomAction picks uniformly among the actions not masked.
+// With nothing masked it draws exactly like rng.IntN(ActionCount).
+func randomAction(rng *Rand, masked ActionMask) int {
+	ok := allowed(masked)
+	n := 0
+	for act := 0; act < ActionCount; act++ {
+		if ok.Has(act) {
+			n++
+		}
+	}
+	k := rng.IntN(n)
+	for act := 0; act < ActionCount; act++ {
+		if ok.Has(act) {
+			if k == 0 {
+				return act
+			}
+			k--
+		}
+	}
+	return 0
+}
+
+// greedyAction returns the unmasked action with the highest Q-value,
+// breaking ties by starting the scan at a random action.
+func greedyAction(rng *Rand, q [ActionCount]float64, masked ActionMask) int {
+	ok := allowed(masked)
+	bestAction := 0
+	maxQ := math.Inf(-1)
+
+	// Random tie-breaking
+	start := rng.IntN(ActionCount)
+	for i := 0; i < ActionCount; i++ {
+		idx := (start + i) % ActionCount
+		if ok.Has(idx) && q[idx] > maxQ {
+			maxQ = q[idx]
+			bestAction = idx
+		}
+	}
+	return bestAction
+}
+
+// DefaultTieOrder is the priority between equally valued actions for deterministic
+// greedy choices (see AgentQTable.TieOrder): keep going fast, then steer, brake last.
+var DefaultTieOrder = []int{ActionThrottle, ActionCoast, ActionLeft, ActionRight, ActionBrake}
+
+// orderedGreedyAction is greedyAction with ties going to the action that comes first in
+// order instead of a random one. Actions missing from order rank after it, by index.
+func orderedGreedyAction(order []int, q [ActionCount]float64, masked ActionMask) int {
+	ok := allowed(masked)
+	bestAction := -1
+	maxQ := math.Inf(-1)
+
+	consider := func(act int) {
+		if act >= 0 && act < ActionCount && ok.Has(act) && q[act] > maxQ {
+			maxQ = q[act]
+			bestAction = act
+		}
+	}
+	for _, act := range order {
+		consider(act)
+	}
+	for act := 0; act < ActionCount; act++ {
+		consider(act)
+	}
+	return max(bestAction, 0)
+}
+
+// chooseGreedy picks the best action, breaking ties by order if given, else randomly.
+func chooseGreedy(rng *Rand, order []int, q [ActionCount]float64, masked ActionMask) int {
+	if order != nil {
+		return orderedGreedyAction(order, q, masked)
+	}
+	return greedyAction(rng, q, masked)
+}
+
+// maxAllowedQ is the highest Q-value among the unmasked actions (the bootstrap target).
+func maxAllowedQ(q [ActionCount]float64, masked ActionMask) float64 {
+	ok := allowed(masked)
+	best := math.Inf(-1)
+	for act, v := range q {
+		if ok.Has(act) && v > best {
+			best = v
+		}
+	}
+	return best
+}
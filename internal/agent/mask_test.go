@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"racing-line-mapper/internal/physics"
+	"testing"
+)
+
+// TestMaskedActionNeverChosen checks every agent, exploring and greedy, with the masked
+// action rigged to have the best Q-value.
+func TestMaskedActionNeverChosen(t *testing.T) {
+	state := State{SegmentIdx: 3, SpeedLevel: 3, Features: Features{S: 0.4, Speed: physics.DefaultCarParams().MaxSpeed}}
+	state.Masked = MaskOf(ActionThrottle, ActionLeft)
+
+	qtable := NewAgentWithSeed(7)
+	qtable.QTable[state.Discrete()] = [ActionCount]float64{ActionThrottle: 100, ActionLeft: 90, ActionBrake: 1}
+	linear := NewLinearAgent(DefaultAgentConfig())
+	linear.W[ActionThrottle][0] = 100 // Bias weight
+	tiles := NewTileCodedAgent(DefaultTileCoder(), DefaultAgentConfig())
+	for _, i := range tiles.Coder.Active(state.Features, nil) {
+		tiles.W[ActionThrottle][i] = 100
+	}
+
+	for name, ag := range map[string]Agent{"qtable": qtable, "linear": linear, "tiles": tiles} {
+		seen := map[int]int{}
+		for i := 0; i < 2000; i++ {
+			if i == 1000 { // Second half greedy
+				switch a := ag.(type) {
+				case *AgentQTable:
+					a.Exploration = Exploration{}
+				case *AgentLinear:
+					a.Exploration = Exploration{}
+				case *AgentTileCoded:
+					a.Exploration = Exploration{}
+				}
+			}
+			act := ag.SelectAction(state)
+			if state.Masked.Has(act) {
+				t.Fatalf("%s: chose masked action %s", name, ActionNames[act])
+			}
+			seen[act]++
+		}
+		if len(seen) != ActionCount-2 {
+			t.Errorf("%s: chose %v, want every unmasked action while exploring", name, seen)
+		}
+	}
+}
+
+// TestLearnSkipsMaskedBootstrap checks that a masked action's value in the next state
+// doesn't leak into the update.
+func TestLearnSkipsMaskedBootstrap(t *testing.T) {
+	ag := NewAgentWithSeed(1)
+	s := State{SegmentIdx: 1}
+	next := State{SegmentIdx: 2, Masked: MaskOf(ActionThrottle)}
+	ag.QTable[next.Discrete()] = [ActionCount]float64{ActionThrottle: 1000, ActionCoast: 10}
+
+	ag.Learn(s, ActionCoast, 0, next)
+	if got, want := ag.QTable[s][ActionCoast], Alpha*Gamma*10; got != want {
+		t.Errorf("Q = %v, want %v (bootstrapped from the best allowed action)", got, want)
+	}
+}
+
+func TestMaskFor(t *testing.T) {
+	c := physics.NewCar(0, 0, physics.DefaultCarParams())
+	if m := MaskFor(c); m != MaskOf(ActionBrake) {
+		t.Errorf("stopped car: mask %b, want brake only", m)
+	}
+	c.Speed = c.Params.MaxSpeed
+	if m := MaskFor(c); m != MaskOf(ActionThrottle) {
+		t.Errorf("car at top speed: mask %b, want throttle only", m)
+	}
+	c.Speed = 3
+	if m := MaskFor(c); m != 0 {
+		t.Errorf("cruising car: mask %b, want none", m)
+	}
+}
+
+// TestTieOrderMakesGreedyDeterministic checks that with a tie order, tied greedy choices
+// always go to the highest-priority allowed action, whatever the RNG.
+func TestTieOrderMakesGreedyDeterministic(t *testing.T) {
+	q := [ActionCount]float64{ActionThrottle: 1, ActionLeft: 1, ActionBrake: 1}
+	for seed := uint64(0); seed < 50; seed++ {
+		rng := NewRand(seed)
+		if act := chooseGreedy(rng, DefaultTieOrder, q, 0); act != ActionThrottle {
+			t.Fatalf("seed %d: chose %s, want Throttle", seed, ActionNames[act])
+		}
+		if act := chooseGreedy(rng, DefaultTieOrder, q, MaskOf(ActionThrottle)); act != ActionLeft {
+			t.Fatalf("seed %d: with Throttle masked chose %s, want Left", seed, ActionNames[act])
+		}
+	}
+
+	// Actions left out of the order rank after it, lowest index first
+	q = [ActionCount]float64{ActionCoast: 1, ActionLeft: 1, ActionRight: 1}
+	if act := orderedGreedyAction([]int{ActionRight}, q, 0); act != ActionRight {
+		t.Errorf("chose %s, want Right (first in order)", ActionNames[act])
+	}
+	if act := orderedGreedyAction([]int{ActionBrake}, q, 0); act != ActionCoast {
+		t.Errorf("chose %s, want Coast (lowest index outside the order)", ActionNames[act])
+	}
+
+	// An agent with a TieOrder treats unseen states (all zeros) as ties too, so
+	// it only strays from the first allowed action when it explores
+	ag := NewAgentWithSeed(1)
+	ag.Exploration = Exploration{}
+	ag.TieOrder = DefaultTieOrder
+	unseen := State{SegmentIdx: 2, Masked: MaskOf(ActionThrottle)}
+	coast := 0
+	for i := 0; i < 1000; i++ {
+		if ag.SelectAction(unseen) == ActionCoast {
+			coast++
+		}
+	}
+	if coast < 980 {
+		t.Errorf("unseen state chose Coast %d/1000 times, want all but the exploration (MinEpsilon)", coast)
+	}
+}
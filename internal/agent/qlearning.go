@@ -2,10 +2,11 @@ package agent
 
 import (
 	"fmt"
+	"maps"
 	"math"
-	"math/rand"
 	"racing-line-mapper/internal/physics"
 	"racing-line-mapper/internal/track"
+	"sync"
 )
 
 // Actions
@@ -18,29 +19,84 @@ const (
 	ActionCount
 )
 
+// ActionNames are display names indexed by action.
+var ActionNames = [ActionCount]string{"Coast", "Throttle", "Brake", "Left", "Right"}
+
 // Hyperparameters
 const (
-	Alpha float64     = 0.1   // Learning Rate
-	Gamma float64      = 0.999987 // Discount Factor
-	MinEpsilon float64 = 0.005
-	Decay      float64 = 0.9999875 // Decay Rate
+	StartEpsilon float64 = 1.0
+	Alpha        float64 = 0.1      // Learning Rate
+	Gamma        float64 = 0.999987 // Discount Factor
+	MinEpsilon   float64 = 0.005
+	Decay        float64 = 0.9999875 // Decay Rate
 )
 
-var Epsilon = 1.0
-
 // Rewards
 const (
 	RwCrash                     = -100.0
 	RwSpeedAlongTrackMultiplier = 1.0
 	RwGravel                    = -5.0
+	RwTimeout                   = -50.0 // Episode hit the tick cap without crashing
+	RwCornerLine                = 2.0   // Most the corner line term pays (or costs) per tick, see RewardConfig.CornerLine
 )
 
+// RewardConfig holds the tunable reward terms.
+type RewardConfig struct {
+	Crash                     float64 `json:"crash"`
+	SpeedAlongTrackMultiplier float64 `json:"speed_along_track_multiplier"`
+	Gravel                    float64 `json:"gravel"`
+	Timeout                   float64 `json:"timeout"`
+
+	// ActionCost is subtracted from every transition that took the action, e.g. to make
+	// heavy braking and steering cost a little so the agent doesn't spam them.
+	ActionCost [ActionCount]float64 `json:"action_cost"`
+
+	// CornerLine rewards driving an outside-apex-outside line through the corners instead
+	// of penalizing the edges there (see TermCornerLine); off, the track is one centering
+	// band end to end.
+	CornerLine bool `json:"corner_line"`
+
+	// TargetSpeed is what every pixel per tick over the waypoint's target speed costs per
+	// tick (see TermTargetSpeed and Env.TargetSpeeds). The targets allow for the widest
+	// line through each corner, so it pays to brake for the corner and use its width.
+	// 0, the default, leaves the term out.
+	TargetSpeed float64 `json:"target_speed"`
+}
+
+// DefaultRewardConfig returns the stock reward terms, with no action costs.
+func DefaultRewardConfig() RewardConfig {
+	return RewardConfig{
+		Crash:                     RwCrash,
+		SpeedAlongTrackMultiplier: RwSpeedAlongTrackMultiplier,
+		Gravel:                    RwGravel,
+		Timeout:                   RwTimeout,
+	}
+}
+
 // State represents the discretized state of the car.
+// Features carries the continuous observation the discrete buckets were derived from,
+// for agents that don't use the table (see AgentLinear). Masked lists the actions
+// that may not be taken from this state (see ActionMask).
 type State struct {
 	SegmentIdx int // Progress along track (0..N)
 	LaneIdx    int // Lateral offset (-3..3)
 	SpeedLevel int // 0: Stopped, 1: Slow, 2: Medium, 3: Fast
 	HeadingRel int // Relative heading to track direction (-2..2)
+
+	// NextCurvature is the bend of the track ahead (see curvatureAhead), from -2 (hard
+	// left) to 2 (hard right), so the agent sees a corner coming before it is in it.
+	NextCurvature int
+
+	Features Features
+	Masked   ActionMask
+}
+
+// Discrete returns the state with its continuous features and mask cleared.
+// This is the key tabular agents index on, so nearby continuous values share an entry.
+func (s State) Discrete() State {
+	s.Features = Features{}
+	s.Masked = 0
+	return s
 }
 
 // QTable stores the Q-values for state-action pairs.
@@ -49,23 +105,128 @@ type QTable map[State][ActionCount]float64
 type Agent interface {
 	SelectAction(state State) int
 	Learn(state State, action int, reward float64, nextState State)
+	// LearnTerminal learns from a transition that ended the episode (a crash, or the
+	// finish of a point-to-point track): there is no next state, so nothing to bootstrap.
+	LearnTerminal(state State, action int, reward float64)
+	QValuesFor(state State) [ActionCount]float64
+	Epsilon() float64 // Current exploration rate
 	DebugInfoStr() string
+
+	// Reset forgets everything learned and restores the agent to how it was constructed:
+	// starting exploration rate and the random sequence of its original seed.
+	Reset()
 }
 
+// AgentQTable is a tabular Q-learning agent. One goroutine trains it (SelectAction,
+// Learn, Prune, LoadSession...); others may read it at the same time through Stats,
+// Snapshot, QValuesFor and Epsilon, which is what a metrics reader should use rather
+// than the QTable and Visits fields.
 type AgentQTable struct {
 	QTable QTable
+
+	// Visits counts the updates each state (by its Discrete key) has had, for finding
+	// the rarely visited entries Prune drops.
+	Visits map[State]int
+
+	// ExploreByConfidence explores more where the greedy action is barely preferred
+	// (low Confidence), on top of epsilon; see ConfidenceExploreBoost.
+	ExploreByConfidence bool
+
+	// TieOrder, if set, makes greedy choices deterministic: of the actions sharing the
+	// highest Q-value, the one earliest in TieOrder wins (see DefaultTieOrder) instead of
+	// a random one. Exploration stays random; this is meant for evaluation.
+	TieOrder []int
+
+	// Learning rate and discount factor of the updates (see AgentConfig)
+	Alpha, Gamma float64
+
+	// Exploration is the epsilon-greedy schedule, over the learning steps so far.
+	Exploration Exploration
+
+	// Replay, if set, keeps the latest transitions, and each Learn replays ReplayCount of
+	// them at random through the same update, so experience is learned from more than
+	// once. Replays don't count as visits or learning steps. Sessions don't keep the
+	// buffer, so a resumed run replays differently than an uninterrupted one would.
+	Replay      *ReplayBuffer
+	ReplayCount int
+
+	// Track identifies the track the agent learns on (see track.Grid.Hash). Sessions
+	// record it, and LoadSession refuses one trained on another track.
+	Track string
+
+	steps int    // Learn calls so far (see Exploration)
+	seed  uint64 // Of rng, for Reset
+	rng   *Rand
+
+	// mu guards QTable, Visits and steps against the concurrent readers. The training
+	// goroutine is their only writer: it takes the write lock around its changes, and
+	// its own reads don't need the lock.
+	mu sync.RWMutex
+}
+
+// NewAgent creates a Q-table agent with the hyperparameters and seed of cfg (its rewards
+// are the environment's; see Env).
+func NewAgent(cfg AgentConfig) *AgentQTable {
+	a := NewAgentWithSeed(cfg.seed())
+	a.Alpha, a.Gamma, a.Exploration = cfg.Alpha, cfg.Gamma, cfg.Exploration
+	if cfg.Replay.Size > 0 {
+		a.Replay, a.ReplayCount = NewReplayBuffer(cfg.Replay.Size), cfg.Replay.Count
+	}
+	return a
 }
 
-func NewAgent() Agent {
+// NewAgentWithSeed creates a Q-table agent with the default hyperparameters whose random
+// choices come from its own seeded generator, so two agents with the same seed make the
+// same decisions.
+func NewAgentWithSeed(seed uint64) *AgentQTable {
 	return &AgentQTable{
-		QTable: make(QTable),
+		QTable:      make(QTable),
+		Visits:      make(map[State]int),
+		Alpha:       Alpha,
+		Gamma:       Gamma,
+		Exploration: DefaultExploration(),
+		seed:        seed,
+		rng:         NewRand(seed),
 	}
 }
 
+// Reset clears the Q-table, visit counts and replay buffer (keeping their storage) and
+// restarts exploration.
+func (a *AgentQTable) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	clear(a.QTable)
+	clear(a.Visits)
+	if a.Replay != nil {
+		a.Replay.Reset()
+	}
+	a.steps = 0
+	a.rng = NewRand(a.seed)
+}
+
+// TrackPos is the car's position located on the mesh (its closest waypoint).
+// Locating is the expensive part of building a state or a reward, so callers that
+// need both for the same position should Locate once and use the ...At variants.
+type TrackPos struct {
+	WP  track.Waypoint
+	Idx int
+}
+
+// Locate finds the car's closest waypoint, searching near its last checkpoint.
+func Locate(c *physics.Car, mesh *track.TrackMesh) TrackPos {
+	wp, idx := mesh.GetClosestWaypointNear(c.Position, c.Checkpoint)
+	return TrackPos{WP: wp, Idx: idx}
+}
+
 // DiscretizeState converts continuous car physics to a discrete State.
 func DiscretizeState(c *physics.Car, mesh *track.TrackMesh) State {
+	return DiscretizeStateAt(c, mesh, Locate(c, mesh))
+}
+
+// DiscretizeStateAt is DiscretizeState for an already located car.
+func DiscretizeStateAt(c *physics.Car, mesh *track.TrackMesh, pos TrackPos) State {
 	// 1. Get Frenet Coordinates
-	wp, wpIdx := mesh.GetClosestWaypoint(c.Position)
+	wp, wpIdx := pos.WP, pos.Idx
 
 	// Calculate Lateral Offset (d)
 	// Vector from Waypoint to Car
@@ -78,6 +239,7 @@ func DiscretizeState(c *physics.Car, mesh *track.TrackMesh) State {
 	// Discretize Lane (Track Width approx 50)
 	// Center = 0. Width/2 = 25.
 	// Lanes: -20..-10, -10..0, 0..10, 10..20
+	// Fixed pixel boundaries, so a waypoint whose width is unknown still gets a lane
 	lane := 0
 	if d < -15 {
 		lane = -2
@@ -91,13 +253,14 @@ func DiscretizeState(c *physics.Car, mesh *track.TrackMesh) State {
 		lane = 2
 	}
 
-	// 2. Speed
+	// 2. Speed, relative to the car's top speed (8, 4 and 0.5 px/tick for the stock car)
 	speedLevel := 0
-	if c.Speed > 8 {
+	top := c.Params.MaxSpeed
+	if c.Speed > 0.8*top {
 		speedLevel = 3
-	} else if c.Speed > 4 {
+	} else if c.Speed > 0.4*top {
 		speedLevel = 2
-	} else if c.Speed > 0.5 {
+	} else if c.Speed > 0.05*top {
 		speedLevel = 1
 	}
 
@@ -126,47 +289,116 @@ func DiscretizeState(c *physics.Car, mesh *track.TrackMesh) State {
 		h = 1
 	}
 
+	progress := 0.0
+	if mesh.TotalLen > 0 {
+		progress = wp.Distance / mesh.TotalLen
+	}
+
+	// 4. Track ahead. A segment mostly sees one bucket, so this adds few states
+	k := curvatureAhead(mesh, wpIdx)
+
 	return State{
-		SegmentIdx: wpIdx / 5, // Downsample segments (reduce state space)
-		LaneIdx:    lane,
-		SpeedLevel: speedLevel,
-		HeadingRel: h,
+		SegmentIdx:    wpIdx / 5, // Downsample segments (reduce state space)
+		LaneIdx:       lane,
+		SpeedLevel:    speedLevel,
+		HeadingRel:    h,
+		NextCurvature: curvatureBucket(k),
+		Features: Features{
+			S:              progress,
+			D:              d,
+			Speed:          c.Speed,
+			HeadingRel:     relHeading,
+			CurvatureAhead: k,
+			TopSpeed:       top,
+		},
 	}
 }
 
+// halfWidth is the waypoint's half width for the edge and corner line rewards. Degenerate
+// waypoints have no usable width and fall back to the nominal track width.
+func halfWidth(wp track.Waypoint) float64 {
+	if wp.Degenerate() {
+		return track.NominalTrackWidth / 2
+	}
+	return wp.Width / 2
+}
+
+// Epsilon is the agent's current exploration rate, from its schedule and the learning
+// steps so far (see Exploration); every agent has its own.
+func (a *AgentQTable) Epsilon() float64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.Exploration.Rate(a.steps)
+}
+
+// SetEpsilon moves the agent along its exploration schedule to where the rate is
+// (about) epsilon, so the decay carries on from there. The rate stays within what the
+// schedule reaches: between Exploration.Min and Start, and with no decay, just Start.
+// Change Exploration itself for a different schedule.
+func (a *AgentQTable) SetEpsilon(epsilon float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.steps = a.Exploration.stepsTo(max(epsilon, a.Exploration.Min, math.SmallestNonzeroFloat64)) // A rate of 0 is only approached
+}
+
 // SelectAction chooses an action using Epsilon-Greedy policy.
+// Masked actions are never chosen.
 func (a *AgentQTable) SelectAction(state State) int {
+	qValues, exists := a.QTable[state.Discrete()]
+	return a.chooseAction(qValues, exists, state.Masked)
+}
 
-	Epsilon = math.Max(Epsilon*Decay, MinEpsilon)
-
-	if rand.Float64() < Epsilon {
-		return rand.Intn(ActionCount)
+// chooseAction is the epsilon-greedy choice over the given Q-values of a state, which
+// exists if the agent has learned anything there yet.
+func (a *AgentQTable) chooseAction(qValues [ActionCount]float64, exists bool, masked ActionMask) int {
+	epsilon := a.Exploration.Rate(a.steps)
+	explore := epsilon
+	if a.ExploreByConfidence && exists {
+		explore += (1 - epsilon) * ConfidenceExploreBoost * uncertainty(qValues, masked)
+	}
+	if a.rng.Float64() < explore {
+		return randomAction(a.rng, masked)
 	}
 
 	// Greedy: Find max Q
-	qValues, exists := a.QTable[state]
-	if !exists {
-		return rand.Intn(ActionCount) // Unknown state, explore
+	if !exists && a.TieOrder == nil {
+		return randomAction(a.rng, masked) // Unknown state, explore (with a TieOrder all its zeros tie)
 	}
+	return chooseGreedy(a.rng, a.TieOrder, qValues, masked)
+}
 
-	bestAction := 0
-	maxQ := -math.MaxFloat64
+// Learn updates the Q-Table based on the transition, then replays past ones if the
+// agent has a Replay buffer.
+// The bootstrap only considers the actions allowed in the next state.
+func (a *AgentQTable) Learn(state State, action int, reward float64, nextState State) {
+	a.learn(Experience{State: state, Action: action, Reward: reward, Next: nextState})
+}
 
-	// Random tie-breaking
-	start := rand.Intn(ActionCount)
-	for i := 0; i < ActionCount; i++ {
-		idx := (start + i) % ActionCount
-		if qValues[idx] > maxQ {
-			maxQ = qValues[idx]
-			bestAction = idx
-		}
-	}
+// LearnTerminal updates Q(s,a) towards the reward alone, for a transition that ended
+// the episode, then replays as Learn does.
+func (a *AgentQTable) LearnTerminal(state State, action int, reward float64) {
+	a.learn(Experience{State: state, Action: action, Reward: reward, Next: state, Terminal: true})
+}
 
-	return bestAction
+// learn applies t, stores it in the replay buffer and replays ReplayCount transitions
+// from there.
+func (a *AgentQTable) learn(t Experience) {
+	a.update(t, true)
+	if a.Replay == nil {
+		return
+	}
+	a.Replay.Add(t)
+	for i := 0; i < a.ReplayCount; i++ {
+		a.update(a.Replay.Sample(a.rng), false)
+	}
 }
 
-// Learn updates the Q-Table based on the transition.
-func (a *AgentQTable) Learn(state State, action int, reward float64, nextState State) {
+// update applies the Bellman update for t, counting it as a visit and a learning step if
+// it is new experience rather than a replay. A terminal transition doesn't bootstrap.
+func (a *AgentQTable) update(t Experience, experience bool) {
+	nextMasked := t.Next.Masked
+	state, nextState, action, reward := t.State.Discrete(), t.Next.Discrete(), t.Action, t.Reward
+
 	// Get current Q
 	qValues := a.QTable[state]
 	currentQ := qValues[action]
@@ -174,129 +406,167 @@ func (a *AgentQTable) Learn(state State, action int, reward float64, nextState S
 	// Get max Q for next state
 	nextQValues, exists := a.QTable[nextState]
 	maxNextQ := 0.0
-	if exists {
-		maxNextQ = -math.MaxFloat64
-		for _, q := range nextQValues {
-			if q > maxNextQ {
-				maxNextQ = q
-			}
-		}
+	if exists && !t.Terminal {
+		maxNextQ = maxAllowedQ(nextQValues, nextMasked)
 	}
 
 	// Bellman Equation
 	// Q(s,a) = Q(s,a) + Alpha * (R + Gamma * maxQ(s',a') - Q(s,a))
-	newQ := currentQ + Alpha*(reward+Gamma*maxNextQ-currentQ)
+	newQ := currentQ + a.Alpha*(reward+a.Gamma*maxNextQ-currentQ)
 
 	qValues[action] = newQ
+	a.mu.Lock()
 	a.QTable[state] = qValues
+	if experience {
+		a.Visits[state]++
+		a.steps++
+	}
+	a.mu.Unlock()
 }
 
-func (a *AgentQTable) DebugInfoStr() string {
-	return fmt.Sprintf("Type: Q-Table\nQ-Size:  %d\nAlpha:   %.8f\nGamma:   %.8f\nEpsilon: %.8f\nDecay:   %.8f",
-		len(a.QTable), Alpha, Gamma, Epsilon, Decay)
+// Prune drops the states visited fewer than minVisits times from the Q-table, returning
+// how many it dropped. States without a visit count (from a session saved before visits
+// were tracked) are kept, since there's no telling how often they were visited.
+func (a *AgentQTable) Prune(minVisits int) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	pruned := 0
+	for state, n := range a.Visits {
+		if n < minVisits {
+			delete(a.QTable, state)
+			delete(a.Visits, state)
+			pruned++
+		}
+	}
+	return pruned
 }
 
-// CalculateReward determines the reward for the current state.
-func CalculateReward(c *physics.Car, grid *track.Grid, mesh *track.TrackMesh, bestLapTime int) float64 {
-	if c.Crashed {
-		return RwCrash
+// CoverageMinVisits is how many updates a state needs beyond which Coverage counts it
+// as explored: a state seen only a handful of times has Q-values still mostly guesswork.
+const CoverageMinVisits = 10
+
+// visitStats summarizes Visits: the mean visits per state, how many states were visited
+// only once, and how many more than CoverageMinVisits times.
+func (a *AgentQTable) visitStats() (mean float64, once, explored int) {
+	total := 0
+	for _, n := range a.Visits {
+		total += n
+		if n == 1 {
+			once++
+		}
+		if n > CoverageMinVisits {
+			explored++
+		}
 	}
+	if len(a.Visits) > 0 {
+		mean = float64(total) / float64(len(a.Visits))
+	}
+	return mean, once, explored
+}
 
-	// 1. Progress Reward
-	// We want to maximize speed along the track direction (s-velocity)
-	wp, wpIdx := mesh.GetClosestWaypoint(c.Position)
-
-	// Tangent vector
-	tangentX := wp.Normal.Y
-	tangentY := -wp.Normal.X
-
-	// Dot product of Velocity and Tangent = Speed along track
-	speedAlongTrack := c.Velocity.X*tangentX + c.Velocity.Y*tangentY
-
-	reward := speedAlongTrack * RwSpeedAlongTrackMultiplier // Multiplier to encourage speed
+// Coverage is the fraction of the visited states that have been updated more than
+// CoverageMinVisits times (0 before any), for telling when training has saturated:
+// once it stops rising, the agent is mostly revisiting states it already knows. It's
+// safe to call while another goroutine trains the agent.
+func (a *AgentQTable) Coverage() float64 {
+	return a.Stats().Coverage()
+}
 
-	// TODO: see if rewards can be issued for being at the right places in corners / turns - close to the outside edge of the road during corner entry and inside while hitting the apex, then close to the outside again when meeting the next section of the road (roughly).
-	// also see if rewards can be provided for optimum brake / throttle / accel levels during corner entry and exit.
+// QValuesFor returns the Q-values of every action at the given state (zeros if unseen).
+func (a *AgentQTable) QValuesFor(state State) [ActionCount]float64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.QTable[state.Discrete()]
+}
 
-	// 2. Centering Reward (Stay in middle lanes)
-	// Calculate Lateral Offset (d)
-	dx := c.Position.X - wp.Position.X
-	dy := c.Position.Y - wp.Position.Y
-	d := dx*wp.Normal.X + dy*wp.Normal.Y
+// QTableStats is a consistent summary of an AgentQTable at one moment (see Stats).
+type QTableStats struct {
+	States      int     // Entries in the Q-table
+	Visited     int     // States updated at least once
+	MeanVisits  float64 // Updates per visited state
+	VisitedOnce int     // States updated only once
+	Explored    int     // States updated more than CoverageMinVisits times
+	Epsilon     float64 // Exploration rate
+}
 
-	if math.Abs(d) > 20 {
-		reward -= 2.0 // Penalty for being near edge
+// Coverage is Explored as a fraction of Visited (see AgentQTable.Coverage).
+func (st QTableStats) Coverage() float64 {
+	if st.Visited == 0 {
+		return 0
 	}
+	return float64(st.Explored) / float64(st.Visited)
+}
 
-	// 3. Gravel Penalty
-	cellX := int(c.Position.X)
-	cellY := int(c.Position.Y)
-	cell := grid.Get(cellX, cellY)
+// Stats summarizes the agent. It's safe to call while another goroutine trains it.
+func (a *AgentQTable) Stats() QTableStats {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	mean, once, explored := a.visitStats()
+	return QTableStats{States: len(a.QTable), Visited: len(a.Visits), MeanVisits: mean, VisitedOnce: once, Explored: explored, Epsilon: a.Exploration.Rate(a.steps)}
+}
 
-	if cell.Type == track.CellGravel {
-		reward -= RwGravel
-	}
+// Snapshot returns a copy of the Q-table. It's safe to call while another goroutine
+// trains the agent, and the copy stays valid however the agent changes afterwards.
+func (a *AgentQTable) Snapshot() QTable {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return maps.Clone(a.QTable)
+}
 
-	// 4. Time/Stationary Penalty
-	// Penalize just existing to encourage finishing fast
-	// Extra penalty if actually stopped
-	reward -= 1.0
+func (a *AgentQTable) DebugInfoStr() string {
+	st := a.Stats()
+	return fmt.Sprintf("Type: Q-Table\nQ-Size:  %d\nVisits:  %d states, %.1f avg, %d once\nCovered: %.1f%% >%d visits\nAlpha:   %.8f\nGamma:   %.8f\nEpsilon: %.8f\nDecay:   %.8f",
+		st.States, st.Visited, st.MeanVisits, st.VisitedOnce, 100*st.Coverage(), CoverageMinVisits, a.Alpha, a.Gamma, st.Epsilon, a.Exploration.Decay)
+}
 
-	if c.Speed < 0.1 {
-		reward -= 10.0 // Heavy penalty for stopping
-	}
+// ProgressEvent reports how a tick moved the car along the track (see UpdateProgress).
+type ProgressEvent struct {
+	Checkpoint bool // Reached the next waypoint in sequence (or the first one after a reset)
+	Lap        bool // Crossed the finish line, completing a lap
+	LapTime    int  // Lap time in ticks at the crossing (valid with Lap)
+}
 
-	// 5. Backwards Penalty
-	// If speedAlongTrack is negative, we are going wrong way
-	if speedAlongTrack < -0.1 {
-		reward -= 20.0 // Very heavy penalty for wrong way
+// UpdateProgress advances the car's checkpoint and lap count from its located position and
+// reports what happened. Progress must be strictly sequential: small skips (e.g. 1->3) are
+// allowed, big jumps (cutting across the track) and going backwards are not. A lap is
+// counted when the car's last move (from Car.PrevPosition) crossed the start line forwards
+// after it came round the last stretch of the track. On a point-to-point track (not
+// Looped) there is no line to come back to: the run is complete, and counts as the lap,
+// when the car reaches the last waypoint, after which it has to be respawned.
+func UpdateProgress(c *physics.Car, mesh *track.TrackMesh, pos TrackPos) ProgressEvent {
+	var ev ProgressEvent
+	if c.Crashed || pos.Idx < 0 {
+		return ev
 	}
 
-	// 6. Checkpoint & Lap Reward
-
-	// Check strictly sequential progress
-	// Allow small skips (e.g. 1->3 is ok, 1->10 is cheating/cutting)
-	// Also handle lap wrap-around (End -> 0)
-
-	validProgress := false
+	wpIdx := pos.Idx
 	diff := wpIdx - c.Checkpoint
 
-	// Normal process: moved forward by 1-5 waypoints
-	if diff > 0 && diff < 10 {
-		validProgress = true
-	}
-
-	// Lap wrap-around: Last few checkpoints -> First few
-	// e.g. MeshLen=100. Current=98. Next=1.
-	if c.Checkpoint > len(mesh.Waypoints)-10 && wpIdx < 10 {
-		validProgress = true
+	// Normal process: moved forward by 1-9 waypoints
+	ev.Checkpoint = diff > 0 && diff < 10
+
+	// Lap: across the line from the last few checkpoints. The checkpoint only wraps back to
+	// the start here, however close the car already is to the first waypoint.
+	// Point to point: onto the last waypoint from the few before it.
+	if last := len(mesh.Waypoints) - 1; !mesh.Looped {
+		if ev.Checkpoint && wpIdx == last {
+			ev.Lap = true
+			ev.LapTime = c.CurrentLapTime
+			c.Laps++
+		}
+	} else if line, ok := mesh.StartLine(); ok && c.Checkpoint > len(mesh.Waypoints)-10 && line.Crossed(c.PrevPosition, c.Position) {
+		ev.Checkpoint = true
+		ev.Lap = true
+		ev.LapTime = c.CurrentLapTime
 		c.Laps++
-
-		// Major Lap Reward base
-		reward += 1000.0
-
-		// Personal Best Bonus
-		// If we beat the best time (or if no best time exists/0), give bonus
-		// bestLapTime comes from Game, in ticks.
-		// c.CurrentLapTime is what we just finished.
-
-		// Note: c.CurrentLapTime is handled in main loop tick update, let's assume it's accurate at moment of crossing.
-		if bestLapTime > 0 && c.CurrentLapTime < bestLapTime {
-			// Improvement Bonus
-			improvement := float64(bestLapTime - c.CurrentLapTime)
-			// e.g. Improved by 100 ticks (1.6s) -> 100 * 5 = 500 extra reward
-			reward += improvement * 5.0
-
-			// Just for beating PB
-			reward += 500.0
+		if wpIdx >= 10 {
+			wpIdx = 0 // Just over the line but still nearest a waypoint behind it
 		}
 	}
 
-	if validProgress || c.Checkpoint == -1 {
+	if ev.Checkpoint || c.Checkpoint == -1 {
+		ev.Checkpoint = true
 		c.Checkpoint = wpIdx
-		// Small bonus for verifying checkpoint (milestone)
-		reward += 10.0
 	}
-
-	return reward
+	return ev
 }
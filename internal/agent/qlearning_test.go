@@ -0,0 +1,509 @@
+package agent
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+	"racing-line-mapper/internal/physics"
+	"racing-line-mapper/internal/track"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// straightMesh is n waypoints 5px apart heading +X, 50px wide;
+// normals point +Y (right of travel in screen coordinates).
+func straightMesh(n int) *track.TrackMesh {
+	var wps []track.Waypoint
+	for i := 0; i < n; i++ {
+		wps = append(wps, track.Waypoint{
+			ID:       i,
+			Position: common.Vec2{X: float64(i) * 5},
+			Normal:   common.Vec2{Y: 1},
+			Width:    50,
+			Distance: float64(i) * 5,
+		})
+	}
+	return &track.TrackMesh{Waypoints: wps, TotalLen: float64(n) * 5, Looped: true}
+}
+
+// TestZeroWidthWaypoint checks that a waypoint whose width raycasts failed still
+// yields a sensible lane and a finite reward instead of garbage.
+func TestZeroWidthWaypoint(t *testing.T) {
+	mesh := straightMesh(20)
+	mesh.Waypoints[10].Width = 0
+	grid := &track.Grid{}
+
+	for _, tc := range []struct {
+		d    float64
+		lane int
+	}{{0, 0}, {10, 1}, {-10, -1}, {20, 2}, {-20, -2}} {
+		c := physics.NewCar(50, tc.d, physics.DefaultCarParams()) // On waypoint 10
+		c.Speed = 2
+		c.Velocity = common.Vec2{X: 2}
+		c.Checkpoint = 9
+
+		s := DiscretizeState(c, mesh)
+		if s.LaneIdx != tc.lane {
+			t.Errorf("d=%.0f: lane %d, want %d", tc.d, s.LaneIdx, tc.lane)
+		}
+		if math.IsNaN(s.Features.D) || math.IsInf(s.Features.D, 0) {
+			t.Errorf("d=%.0f: non-finite feature D %v", tc.d, s.Features.D)
+		}
+
+		pos := Locate(c, mesh)
+		r := Reward(c, grid, pos, UpdateProgress(c, mesh, pos), 0, ActionCoast, DefaultRewardConfig())
+		if math.IsNaN(r) || math.IsInf(r, 0) {
+			t.Errorf("d=%.0f: non-finite reward %v", tc.d, r)
+		}
+	}
+}
+
+// TestSpeedScalesWithTopSpeed checks the speed bucket and the normalized speed feature
+// are relative to the car's top speed: a car twice as fast at twice the speed looks the same.
+func TestSpeedScalesWithTopSpeed(t *testing.T) {
+	mesh := straightMesh(20)
+	stock := physics.DefaultCarParams()
+	fast := stock
+	fast.MaxSpeed *= 2
+
+	for _, frac := range []float64{0, 0.3, 0.5, 0.9} {
+		var levels [2]int
+		var speeds [2]float64
+		for k, params := range []physics.CarParams{stock, fast} {
+			c := physics.NewCar(50, 0, params)
+			c.Speed = frac * params.MaxSpeed
+			c.Checkpoint = 9
+			s := DiscretizeState(c, mesh)
+			levels[k], speeds[k] = s.SpeedLevel, s.Features.SpeedFrac()
+		}
+		if levels[0] != levels[1] || speeds[0] != speeds[1] {
+			t.Errorf("at %.0f%% of top speed: stock car level %d (%.2f), fast car level %d (%.2f); want the same",
+				100*frac, levels[0], speeds[0], levels[1], speeds[1])
+		}
+	}
+}
+
+// TestNextCurvatureSeesTheBendAhead checks the lookahead bucket: nothing on a straight,
+// and the direction and severity of a bend CurvatureLookahead waypoints ahead.
+func TestNextCurvatureSeesTheBendAhead(t *testing.T) {
+	for _, tc := range []struct {
+		k    float64
+		want int
+	}{{0, 0}, {0.001, 0}, {-0.003, -1}, {0.005, 1}, {0.02, 2}, {-0.05, -2}} {
+		if got := curvatureBucket(tc.k); got != tc.want {
+			t.Errorf("curvature %v: bucket %d, want %d", tc.k, got, tc.want)
+		}
+	}
+
+	mesh := straightMesh(40)
+	c := physics.NewCar(50, 0, physics.DefaultCarParams()) // On waypoint 10
+	c.Checkpoint = 9
+	if s := DiscretizeState(c, mesh); s.NextCurvature != 0 {
+		t.Errorf("straight: next curvature %d, want 0", s.NextCurvature)
+	}
+
+	// Past waypoint 10 the heading turns right (towards the normal) by 0.05 rad per 5px
+	for i := 11; i < len(mesh.Waypoints); i++ {
+		h := 0.05 * float64(i-10)
+		mesh.Waypoints[i].Normal = common.Vec2{X: -math.Sin(h), Y: math.Cos(h)}
+	}
+	if s := DiscretizeState(c, mesh); s.NextCurvature != 2 {
+		t.Errorf("hard right ahead: next curvature %d, want 2", s.NextCurvature)
+	}
+}
+
+func TestActionCostLowersReward(t *testing.T) {
+	mesh := straightMesh(20)
+	grid := &track.Grid{}
+	cfg := DefaultRewardConfig()
+	cfg.ActionCost[ActionBrake] = 0.5
+
+	c := physics.NewCar(50, 0, physics.DefaultCarParams())
+	c.Speed = 2
+	c.Velocity = common.Vec2{X: 2}
+	c.Checkpoint = 9
+	pos := Locate(c, mesh)
+	progress := UpdateProgress(c, mesh, pos)
+	reward := func(action int) float64 {
+		return Reward(c, grid, pos, progress, 0, action, cfg)
+	}
+
+	coast, brake := reward(ActionCoast), reward(ActionBrake)
+	if got := coast - brake; math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("coast reward %.3f, brake reward %.3f: brake should be lower by its 0.5 cost", coast, brake)
+	}
+}
+
+// TestRewardIsPure checks that the reward leaves the car alone (the same call gives the
+// same answer) while UpdateProgress advances checkpoints and counts the lap at the finish.
+func TestRewardIsPure(t *testing.T) {
+	mesh := straightMesh(20)
+	grid := &track.Grid{}
+	cfg := DefaultRewardConfig()
+
+	c := physics.NewCar(95, 0, physics.DefaultCarParams()) // On the last waypoint
+	c.Speed = 2
+	c.Velocity = common.Vec2{X: 2}
+	c.Checkpoint = 18
+	c.CurrentLapTime = 300
+
+	pos := Locate(c, mesh)
+	progress := UpdateProgress(c, mesh, pos)
+	if !progress.Checkpoint || progress.Lap || c.Checkpoint != 19 {
+		t.Fatalf("to waypoint 19: %+v, checkpoint %d", progress, c.Checkpoint)
+	}
+
+	before := *c
+	first := Reward(c, grid, pos, progress, 0, ActionThrottle, cfg)
+	second := Reward(c, grid, pos, progress, 0, ActionThrottle, cfg)
+	if first != second || !reflect.DeepEqual(*c, before) {
+		t.Errorf("Reward changed something: %.3f then %.3f, car %+v -> %+v", first, second, before, *c)
+	}
+
+	// Across the finish line (the straight mesh loops back to x=0)
+	c.PrevPosition, c.Position = common.Vec2{X: -1}, common.Vec2{X: 0}
+	pos = Locate(c, mesh)
+	progress = UpdateProgress(c, mesh, pos)
+	if !progress.Lap || progress.LapTime != 300 || c.Laps != 1 || c.Checkpoint != 0 {
+		t.Fatalf("across the line: %+v, laps %d, checkpoint %d", progress, c.Laps, c.Checkpoint)
+	}
+	lap := Reward(c, grid, pos, progress, 400, ActionThrottle, cfg)
+	plain := Reward(c, grid, pos, ProgressEvent{}, 400, ActionThrottle, cfg)
+	// Lap, 100 ticks under the best, new best, checkpoint
+	if want := 1000 + 100*5.0 + 500 + 10; math.Abs(lap-plain-want) > 1e-9 {
+		t.Errorf("lap bonus %.1f, want %.1f", lap-plain, want)
+	}
+}
+
+// BenchmarkStateAndReward compares one learning step's lookups done separately
+// (current state, next state and reward each finding the closest waypoint) with
+// the shared path that locates the car once per position.
+func BenchmarkStateAndReward(b *testing.B) {
+	grid, mesh, err := track.LoadTrackFromImage("../../processed_tracks/monza_10m.jpg")
+	if err != nil {
+		b.Skipf("loading track: %v", err)
+	}
+	i := len(mesh.Waypoints) / 3
+	wp, next := mesh.Waypoints[i], mesh.Waypoints[i+1]
+	c := physics.NewCar(wp.Position.X, wp.Position.Y, physics.DefaultCarParams())
+	c.Speed = 3
+	c.Velocity = next.Position.Sub(wp.Position).Normalize().Scale(3)
+	c.Checkpoint = i
+
+	b.Run("separate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			DiscretizeState(c, mesh)
+			DiscretizeState(c, mesh)
+			Reward(c, grid, Locate(c, mesh), ProgressEvent{}, 0, ActionThrottle, DefaultRewardConfig())
+		}
+	})
+	b.Run("shared", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pos := Locate(c, mesh)
+			DiscretizeStateAt(c, mesh, pos)
+			Reward(c, grid, pos, ProgressEvent{}, 0, ActionThrottle, DefaultRewardConfig())
+		}
+	})
+}
+
+// TestPointToPointFinish checks a point-to-point track is completed on reaching its last
+// waypoint, once, and that its start line doesn't count.
+func TestPointToPointFinish(t *testing.T) {
+	mesh := straightMesh(20)
+	mesh.Looped = false
+
+	c := physics.NewCar(95, 0, physics.DefaultCarParams()) // On the last waypoint
+	c.Checkpoint = 18
+	c.CurrentLapTime = 300
+	progress := UpdateProgress(c, mesh, Locate(c, mesh))
+	if !progress.Lap || progress.LapTime != 300 || c.Laps != 1 || c.Checkpoint != 19 {
+		t.Fatalf("onto the last waypoint: %+v, laps %d, checkpoint %d", progress, c.Laps, c.Checkpoint)
+	}
+	if progress = UpdateProgress(c, mesh, Locate(c, mesh)); progress.Lap || c.Laps != 1 {
+		t.Errorf("still on the last waypoint: %+v, laps %d; want the finish counted once", progress, c.Laps)
+	}
+
+	// Past the end there is no line to cross back to the start
+	c.PrevPosition, c.Position = common.Vec2{X: -1}, common.Vec2{X: 0}
+	if progress = UpdateProgress(c, mesh, Locate(c, mesh)); progress.Lap {
+		t.Errorf("across the start line of an open track: %+v, want no lap", progress)
+	}
+}
+
+func TestRewardTermsSumToReward(t *testing.T) {
+	mesh := straightMesh(20)
+	grid := &track.Grid{}
+	c := physics.NewCar(50, 0, physics.DefaultCarParams())
+	c.Speed = 2
+	c.Velocity = common.Vec2{X: 2}
+	pos := Locate(c, mesh)
+	cfg := DefaultRewardConfig()
+	cfg.ActionCost[ActionBrake] = 0.5
+	progress := ProgressEvent{Checkpoint: true, Lap: true, LapTime: 350}
+
+	terms := RewardTerms(c, grid, pos, progress, 400, ActionBrake, cfg)
+	if got, want := terms.Total(), Reward(c, grid, pos, progress, 400, ActionBrake, cfg); got != want {
+		t.Errorf("terms sum to %v, Reward is %v", got, want)
+	}
+	if top := terms.Top(2); len(top) != 2 || top[0] != TermLap || top[1] != TermPersonalBest {
+		t.Errorf("top terms %v of %v, want lap then personal best", top, terms)
+	}
+	if terms[TermActionCost] != -0.5 || terms[TermTime] != -1 || terms[TermCrash] != 0 {
+		t.Errorf("action cost %v, time %v, crash %v; want -0.5, -1, 0", terms[TermActionCost], terms[TermTime], terms[TermCrash])
+	}
+
+	c.Crashed = true
+	terms = RewardTerms(c, grid, TrackPos{}, ProgressEvent{}, 400, ActionBrake, cfg)
+	if terms.Top(1)[0] != TermCrash || terms.Total() != cfg.Crash-0.5 {
+		t.Errorf("crashed: %v (total %v), want only the crash and action terms", terms, terms.Total())
+	}
+}
+
+// TestCornerLineReward drives a right-hander: the outside (left) edge pays at turn-in and
+// exit, the inside (right) one at the apex, and with the setting off the edges are only
+// penalized.
+func TestCornerLineReward(t *testing.T) {
+	grid := &track.Grid{}
+	cfg := DefaultRewardConfig()
+	cfg.CornerLine = true
+	// Heading +X, so the normal (+Y) is on the right; positive curvature turns towards it
+	wp := track.Waypoint{Normal: common.Vec2{Y: 1}, Width: 20, Curvature: 0.02}
+	at := func(phase track.Phase, d float64, cfg RewardConfig) RewardBreakdown {
+		wp.Phase = phase
+		c := physics.NewCar(0, d, physics.DefaultCarParams())
+		c.Speed = 2
+		c.Velocity = common.Vec2{X: 2}
+		return RewardTerms(c, grid, TrackPos{WP: wp}, ProgressEvent{}, 0, ActionThrottle, cfg)
+	}
+
+	for _, tc := range []struct {
+		phase track.Phase
+		d     float64
+		want  float64
+	}{
+		{track.PhaseTurnIn, -9, 0.9 * RwCornerLine},
+		{track.PhaseTurnIn, 9, -0.9 * RwCornerLine},
+		{track.PhaseApex, 9, 0.9 * RwCornerLine},
+		{track.PhaseApex, -20, -RwCornerLine}, // Clamped at the edge
+		{track.PhaseExit, -5, 0.5 * RwCornerLine},
+		{track.PhaseStraight, -9, 0},
+	} {
+		terms := at(tc.phase, tc.d, cfg)
+		if got := terms[TermCornerLine]; math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s at d=%v: corner line %v, want %v", track.PhaseNames[tc.phase], tc.d, got, tc.want)
+		}
+		if tc.phase != track.PhaseStraight && terms[TermCentering] != 0 {
+			t.Errorf("%s at d=%v: centering %v, want none in a corner", track.PhaseNames[tc.phase], tc.d, terms[TermCentering])
+		}
+	}
+	if terms := at(track.PhaseStraight, -9, cfg); terms[TermCentering] == 0 {
+		t.Errorf("straight near the edge: no centering penalty")
+	}
+
+	// A left-hander mirrors it
+	wp.Curvature = -0.02
+	if got := at(track.PhaseApex, -9, cfg)[TermCornerLine]; math.Abs(got-0.9*RwCornerLine) > 1e-9 {
+		t.Errorf("left-hander apex on the left: corner line %v, want %v", got, 0.9*RwCornerLine)
+	}
+
+	terms := at(track.PhaseApex, -9, DefaultRewardConfig())
+	if terms[TermCornerLine] != 0 || terms[TermCentering] == 0 {
+		t.Errorf("corner line off: corner line %v, centering %v; want only the centering penalty", terms[TermCornerLine], terms[TermCentering])
+	}
+}
+
+// TestTargetSpeedReward checks the overspeed term charges only for the speed over the
+// waypoint's target, and only when set up.
+func TestTargetSpeedReward(t *testing.T) {
+	cfg := DefaultRewardConfig()
+	cfg.TargetSpeed = 3
+	env := &Env{Grid: &track.Grid{}, Rewards: cfg, TargetSpeeds: []float64{8, 2, 8}}
+	pos := TrackPos{WP: track.Waypoint{Normal: common.Vec2{Y: 1}, Width: 20}, Idx: 1}
+	at := func(speed float64) RewardBreakdown {
+		env.Car = physics.NewCar(0, 0, physics.DefaultCarParams())
+		env.Car.Speed = speed
+		env.Car.Velocity = common.Vec2{X: speed}
+		return env.RewardTerms(pos, ProgressEvent{}, ActionThrottle)
+	}
+
+	for _, tc := range []struct{ speed, want float64 }{
+		{1.5, 0},
+		{2, 0},
+		{3.5, -4.5}, // 1.5 over, at 3 a pixel per tick
+	} {
+		if got := at(tc.speed)[TermTargetSpeed]; math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("speed %v against a target of 2: overspeed %v, want %v", tc.speed, got, tc.want)
+		}
+	}
+	if got, want := at(3.5).Total(), RewardTerms(env.Car, env.Grid, pos, ProgressEvent{}, 0, ActionThrottle, cfg).Total()-4.5; math.Abs(got-want) > 1e-9 {
+		t.Errorf("total %v, want the package-level reward less the overspeed, %v", got, want)
+	}
+
+	env.Rewards.TargetSpeed = 0
+	if got := at(3.5)[TermTargetSpeed]; got != 0 {
+		t.Errorf("with the term off: overspeed %v, want none", got)
+	}
+	env.Rewards.TargetSpeed, env.TargetSpeeds = 3, nil
+	if got := at(3.5)[TermTargetSpeed]; got != 0 {
+		t.Errorf("without target speeds: overspeed %v, want none", got)
+	}
+}
+
+// TestLearnBellmanUpdate checks the Q-learning update against the formula worked by hand:
+// Q(s,a) += Alpha * (r + Gamma * max Q(s',.) - Q(s,a)), with max Q(s',.) = 0 for a next
+// state that has never been seen.
+func TestLearnBellmanUpdate(t *testing.T) {
+	a := NewAgentWithSeed(1)
+	s := State{SegmentIdx: 1, SpeedLevel: 2}
+	next := State{SegmentIdx: 2, SpeedLevel: 2}
+
+	// Unseen next state: nothing to bootstrap from
+	a.Learn(s, ActionThrottle, 10, next)
+	want := 0 + Alpha*(10+Gamma*0-0)
+	if got := a.QTable[s][ActionThrottle]; got != want {
+		t.Errorf("unseen next state: Q = %v, want %v", got, want)
+	}
+	if _, ok := a.QTable[next]; ok {
+		t.Errorf("learning created an entry for the next state")
+	}
+
+	// Seen next state: bootstrap from its best action
+	a.QTable[next] = [ActionCount]float64{ActionCoast: 3, ActionThrottle: 7, ActionBrake: -2}
+	q := a.QTable[s][ActionThrottle]
+	a.Learn(s, ActionThrottle, -1, next)
+	want = q + Alpha*(-1+Gamma*7-q)
+	if got := a.QTable[s][ActionThrottle]; got != want {
+		t.Errorf("seen next state: Q = %v, want %v", got, want)
+	}
+
+	// A crash is terminal: it learns towards the penalty alone, where learning it as a
+	// transition back to its own state would add that state's best value to the target
+	crashed := a.QTable[next]
+	a.Learn(next, ActionBrake, RwCrash, next)
+	want = -2 + Alpha*(RwCrash+Gamma*7-(-2))
+	if got := a.QTable[next][ActionBrake]; got != want {
+		t.Errorf("crash as a self-transition: Q = %v, want %v", got, want)
+	}
+	a.QTable[next] = crashed
+	a.LearnTerminal(next, ActionBrake, RwCrash)
+	want = -2 + Alpha*(RwCrash-(-2))
+	if got := a.QTable[next][ActionBrake]; got != want {
+		t.Errorf("terminal crash: Q = %v, want %v (no bootstrap)", got, want)
+	}
+	a.QTable[next] = crashed
+
+	// The other actions and the features of the state are left alone
+	if got := a.QTable[s]; got[ActionCoast] != 0 || got[ActionBrake] != 0 {
+		t.Errorf("other actions changed: %v", got)
+	}
+	withFeatures := s
+	withFeatures.Features.Speed = 4.2
+	a.Learn(withFeatures, ActionCoast, 1, next)
+	if got := a.QTable[s][ActionCoast]; got != Alpha*(1+Gamma*7) || a.Visits[s] != 3 {
+		t.Errorf("same discrete state with features: Q = %v, visits %d; want %v, 3", got, a.Visits[s], Alpha*(1+Gamma*7))
+	}
+}
+
+// BenchmarkSelectAndLearn is the Q-table's share of a training tick: choose an action,
+// then learn from the transition, over a table of a realistic size.
+func BenchmarkSelectAndLearn(b *testing.B) {
+	a := NewAgentWithSeed(1)
+	states := make([]State, 4096)
+	for i := range states {
+		states[i] = State{SegmentIdx: i / 16, LaneIdx: i%5 - 2, SpeedLevel: i % 16 / 5}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s, next := states[i%len(states)], states[(i+1)%len(states)]
+		a.Learn(s, a.SelectAction(s), 1, next)
+	}
+}
+
+// TestConcurrentReaders reads the agent from other goroutines while it trains, as a
+// metrics reader would; run with -race to check the locking.
+func TestConcurrentReaders(t *testing.T) {
+	a := NewAgentWithSeed(1)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 2; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				st := a.Stats()
+				if snap := a.Snapshot(); len(snap) < st.States {
+					t.Errorf("snapshot of %d states after stats counted %d", len(snap), st.States)
+					return
+				}
+				a.QValuesFor(State{SegmentIdx: 3})
+				_ = a.DebugInfoStr()
+			}
+		}()
+	}
+
+	for i := 0; i < 20000; i++ {
+		s, next := State{SegmentIdx: i % 100}, State{SegmentIdx: (i + 1) % 100}
+		a.Learn(s, a.SelectAction(s), 1, next)
+		if i == 10000 {
+			a.Prune(2)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if st := a.Stats(); st.States != 100 || st.MeanVisits == 0 || st.Epsilon >= StartEpsilon {
+		t.Errorf("after training: %+v, want 100 states with visits and a decayed epsilon", st)
+	}
+}
+
+// TestCoverage checks Coverage counts the visited states updated more than
+// CoverageMinVisits times, and that Prune's dropped states stop counting.
+func TestCoverage(t *testing.T) {
+	a := NewAgentWithSeed(1)
+	if got := a.Coverage(); got != 0 {
+		t.Errorf("coverage %v before any learning, want 0", got)
+	}
+
+	for seg, n := range []int{1, CoverageMinVisits, CoverageMinVisits + 1, 3 * CoverageMinVisits} {
+		s := State{SegmentIdx: seg}
+		for i := 0; i < n; i++ {
+			a.Learn(s, ActionCoast, 0, s)
+		}
+	}
+	st := a.Stats()
+	if st.Visited != 4 || st.VisitedOnce != 1 || st.Explored != 2 {
+		t.Errorf("stats %+v, want 4 states visited, 1 once and 2 explored", st)
+	}
+	if got := a.Coverage(); got != 0.5 {
+		t.Errorf("coverage %v, want 0.5", got)
+	}
+
+	a.Prune(CoverageMinVisits + 1)
+	if got := a.Coverage(); got != 1 {
+		t.Errorf("coverage %v after pruning the rarely visited states, want 1", got)
+	}
+}
+
+// TestGravelRewardIsAPenalty checks gravel costs what RewardConfig.Gravel says, signed as
+// given like the crash and timeout terms, so leaving the tarmac lowers the reward.
+func TestGravelRewardIsAPenalty(t *testing.T) {
+	grid := track.NewGrid(10, 10)
+	grid.Set(5, 5, track.Cell{Type: track.CellGravel, Friction: 0.4})
+	cfg := DefaultRewardConfig()
+	pos := TrackPos{WP: track.Waypoint{Normal: common.Vec2{Y: 1}, Width: 20}}
+	at := func(x float64) RewardBreakdown {
+		return RewardTerms(physics.NewCar(x, 5, physics.DefaultCarParams()), grid, pos, ProgressEvent{}, 0, ActionCoast, cfg)
+	}
+
+	if got := at(5)[TermGravel]; got != cfg.Gravel || got >= 0 {
+		t.Errorf("gravel term %v, want the configured penalty %v", got, cfg.Gravel)
+	}
+	if got := at(2)[TermGravel]; got != 0 {
+		t.Errorf("gravel term %v off the gravel, want none", got)
+	}
+}
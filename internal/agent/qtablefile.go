@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// qtableFile is the JSON form of a Q-table (see SaveToFile). JSON objects can only be
+// keyed by strings, so the map is stored as a list of entries, sorted by state so the
+// same table always writes the same file.
+type qtableFile struct {
+	Track   string        `json:"track,omitempty"` // The agent's Track
+	Steps   int           `json:"steps"`           // Learning steps (see Exploration)
+	Entries []qtableEntry `json:"states"`
+	Second  []qtableEntry `json:"second,omitempty"` // AgentDoubleQ's second table
+}
+
+type qtableEntry struct {
+	State  State                `json:"state"`
+	Q      [ActionCount]float64 `json:"q"` // Indexed by action (see ActionNames)
+	Visits int                  `json:"visits,omitempty"`
+}
+
+// SaveToFile writes the Q-table (with its visit counts and the exploration progress) to
+// path as JSON, readable by other tools. Unlike SaveSession it doesn't keep the random
+// state, so a run continued from it explores differently than an uninterrupted one would.
+func (a *AgentQTable) SaveToFile(path string) error {
+	return a.saveToFile(path, nil)
+}
+
+// saveToFile is SaveToFile, with a second table for AgentDoubleQ.
+func (a *AgentQTable) saveToFile(path string, second QTable) error {
+	a.mu.RLock()
+	file := qtableFile{Track: a.Track, Steps: a.steps, Entries: a.fileEntries(a.QTable, true)}
+	if second != nil {
+		file.Second = a.fileEntries(second, false)
+	}
+	a.mu.RUnlock()
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// fileEntries lists table sorted by state, with the visit counts if withVisits.
+func (a *AgentQTable) fileEntries(table QTable, withVisits bool) []qtableEntry {
+	entries := make([]qtableEntry, 0, len(table))
+	for s, q := range table {
+		e := qtableEntry{State: s, Q: q}
+		if withVisits {
+			e.Visits = a.Visits[s]
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(x, y qtableEntry) int { return compareStates(x.State, y.State) })
+	return entries
+}
+
+// LoadFromFile replaces the agent's Q-table, visit counts and exploration progress with
+// the ones saved at path by SaveToFile. As with LoadSession, a table trained on another
+// track is refused with an error wrapping ErrTrackMismatch, leaving the agent unchanged.
+func (a *AgentQTable) LoadFromFile(path string) error {
+	_, err := a.loadFromFile(path)
+	return err
+}
+
+// loadFromFile is LoadFromFile, also returning the file's second table if it has one
+// (see AgentDoubleQ).
+func (a *AgentQTable) loadFromFile(path string) (second QTable, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file qtableFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if file.Track != "" && a.Track != "" && file.Track != a.Track {
+		return nil, fmt.Errorf("%s: %w (track %s, this is %s)", path, ErrTrackMismatch, file.Track, a.Track)
+	}
+
+	table := make(QTable, len(file.Entries))
+	visits := make(map[State]int, len(file.Entries))
+	for _, e := range file.Entries {
+		table[e.State] = e.Q
+		if e.Visits > 0 {
+			visits[e.State] = e.Visits
+		}
+	}
+	if file.Second != nil {
+		second = make(QTable, len(file.Second))
+		for _, e := range file.Second {
+			second[e.State] = e.Q
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.QTable, a.Visits, a.steps = table, visits, file.Steps
+	return second, nil
+}
+
+// compareStates orders states by their discrete fields, then their features and mask.
+func compareStates(x, y State) int {
+	return cmp.Or(
+		cmp.Compare(x.SegmentIdx, y.SegmentIdx),
+		cmp.Compare(x.LaneIdx, y.LaneIdx),
+		cmp.Compare(x.SpeedLevel, y.SpeedLevel),
+		cmp.Compare(x.HeadingRel, y.HeadingRel),
+		cmp.Compare(x.NextCurvature, y.NextCurvature),
+		cmp.Compare(x.Features.S, y.Features.S),
+		cmp.Compare(x.Features.D, y.Features.D),
+		cmp.Compare(x.Features.Speed, y.Features.Speed),
+		cmp.Compare(x.Features.HeadingRel, y.Features.HeadingRel),
+		cmp.Compare(x.Features.CurvatureAhead, y.Features.CurvatureAhead),
+		cmp.Compare(x.Masked, y.Masked),
+	)
+}
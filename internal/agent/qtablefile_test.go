@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestQTableFileRoundTrip saves a trained table as JSON and loads it into a fresh agent:
+// the values must come back exactly (JSON floats round-trip), and saving the same table
+// again must write the same bytes despite the map's random iteration order.
+func TestQTableFileRoundTrip(t *testing.T) {
+	a := NewAgentWithSeed(3)
+	a.Track = "abc"
+	train(a, &chainEnv{}, 3000)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "qtable.json")
+	if err := a.SaveToFile(path); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+
+	b := NewAgentWithSeed(4)
+	b.Track = a.Track
+	if err := b.LoadFromFile(path); err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	if !reflect.DeepEqual(a.QTable, b.QTable) {
+		t.Errorf("loaded Q-table differs:\nsaved:  %v\nloaded: %v", a.QTable, b.QTable)
+	}
+	if !reflect.DeepEqual(a.Visits, b.Visits) {
+		t.Errorf("loaded visit counts differ:\nsaved:  %v\nloaded: %v", a.Visits, b.Visits)
+	}
+	if a.Epsilon() != b.Epsilon() {
+		t.Errorf("loaded epsilon = %v, want %v", b.Epsilon(), a.Epsilon())
+	}
+
+	again := filepath.Join(dir, "again.json")
+	if err := b.SaveToFile(again); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+	first, _ := os.ReadFile(path)
+	second, _ := os.ReadFile(again)
+	if !bytes.Equal(first, second) {
+		t.Error("saving the same table twice wrote different files")
+	}
+
+	other := NewAgentWithSeed(5)
+	other.Track = "def"
+	if err := other.LoadFromFile(path); !errors.Is(err, ErrTrackMismatch) {
+		t.Errorf("loading another track's table: got %v, want ErrTrackMismatch", err)
+	}
+	if len(other.QTable) != 0 {
+		t.Error("a refused table was loaded anyway")
+	}
+}
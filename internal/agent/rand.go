@@ -0,0 +1,26 @@
+package agent
+
+import "math/rand/v2"
+
+// Rand is a seeded random source whose full state can be saved and restored,
+// so a resumed session continues the exact random sequence of the original run.
+type Rand struct {
+	*rand.Rand
+	src *rand.PCG
+}
+
+// NewRand creates a generator from a single seed.
+func NewRand(seed uint64) *Rand {
+	src := rand.NewPCG(seed, seed^0x9e3779b97f4a7c15)
+	return &Rand{Rand: rand.New(src), src: src}
+}
+
+// MarshalBinary returns the generator state.
+func (r *Rand) MarshalBinary() ([]byte, error) {
+	return r.src.MarshalBinary()
+}
+
+// UnmarshalBinary restores a state returned by MarshalBinary.
+func (r *Rand) UnmarshalBinary(data []byte) error {
+	return r.src.UnmarshalBinary(data)
+}
@@ -0,0 +1,67 @@
+package agent
+
+// Experience is one transition the agent learned from: it took Action in State, was
+// paid Reward and ended up in Next. Terminal marks a transition that ended the episode,
+// which has nothing to bootstrap from.
+type Experience struct {
+	State    State
+	Action   int
+	Reward   float64
+	Next     State
+	Terminal bool
+}
+
+// ReplayConfig sets up experience replay for the Q-learning agent (see AgentQTable.Replay).
+// A Size of 0 turns it off.
+type ReplayConfig struct {
+	Size  int `json:"size"`  // Transitions kept; the oldest is overwritten once full
+	Count int `json:"count"` // Past transitions replayed after each Learn
+}
+
+// ReplayBuffer is a fixed-capacity ring of the latest transitions.
+type ReplayBuffer struct {
+	items []Experience
+	next  int // Where the next transition goes once full (the oldest one)
+}
+
+// NewReplayBuffer creates an empty buffer holding up to capacity transitions.
+func NewReplayBuffer(capacity int) *ReplayBuffer {
+	return &ReplayBuffer{items: make([]Experience, 0, capacity)}
+}
+
+// Add stores t, overwriting the oldest transition if the buffer is full.
+func (b *ReplayBuffer) Add(t Experience) {
+	if cap(b.items) == 0 {
+		return
+	}
+	if len(b.items) < cap(b.items) {
+		b.items = append(b.items, t)
+	} else {
+		b.items[b.next] = t
+	}
+	b.next = (b.next + 1) % cap(b.items)
+}
+
+// Len is the number of transitions stored.
+func (b *ReplayBuffer) Len() int {
+	return len(b.items)
+}
+
+// At is the i-th oldest transition stored (0 <= i < Len).
+func (b *ReplayBuffer) At(i int) Experience {
+	if len(b.items) < cap(b.items) {
+		return b.items[i]
+	}
+	return b.items[(b.next+i)%len(b.items)]
+}
+
+// Sample draws a stored transition uniformly at random. The buffer must not be empty.
+func (b *ReplayBuffer) Sample(rng *Rand) Experience {
+	return b.items[rng.IntN(len(b.items))]
+}
+
+// Reset empties the buffer, keeping its capacity.
+func (b *ReplayBuffer) Reset() {
+	b.items = b.items[:0]
+	b.next = 0
+}
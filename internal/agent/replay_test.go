@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"math"
+	"testing"
+)
+
+// TestReplayBufferWraps checks the buffer fills up to its capacity and then overwrites
+// its oldest transitions, keeping them in order.
+func TestReplayBufferWraps(t *testing.T) {
+	b := NewReplayBuffer(3)
+	add := func(i int) { b.Add(Experience{Action: i}) }
+	actions := func() []int {
+		var got []int
+		for i := 0; i < b.Len(); i++ {
+			got = append(got, b.At(i).Action)
+		}
+		return got
+	}
+
+	add(0)
+	add(1)
+	if got := actions(); b.Len() != 2 || got[0] != 0 || got[1] != 1 {
+		t.Fatalf("part full: %v, want [0 1]", got)
+	}
+	add(2)
+	add(3)
+	add(4)
+	if got := actions(); b.Len() != 3 || got[0] != 2 || got[1] != 3 || got[2] != 4 {
+		t.Errorf("after 5 into 3: %v, want [2 3 4]", got)
+	}
+	for i := 5; i < 9; i++ { // Round the ring once more
+		add(i)
+	}
+	if got := actions(); got[0] != 6 || got[1] != 7 || got[2] != 8 {
+		t.Errorf("after 9 into 3: %v, want [6 7 8]", got)
+	}
+
+	rng := NewRand(1)
+	for i := 0; i < 50; i++ {
+		if a := b.Sample(rng).Action; a < 6 || a > 8 {
+			t.Fatalf("sampled %d, which was overwritten", a)
+		}
+	}
+
+	b.Reset()
+	if b.Len() != 0 {
+		t.Errorf("%d transitions after Reset", b.Len())
+	}
+	add(9)
+	if got := actions(); len(got) != 1 || got[0] != 9 {
+		t.Errorf("after Reset and one add: %v, want [9]", got)
+	}
+}
+
+// TestLearnReplays checks each Learn also replays ReplayCount stored transitions through
+// the same update, without counting them as visits or learning steps.
+func TestLearnReplays(t *testing.T) {
+	cfg := DefaultAgentConfig()
+	cfg.Replay = ReplayConfig{Size: 10, Count: 5}
+	a := NewAgent(cfg)
+	s, next := State{SegmentIdx: 1}, State{SegmentIdx: 2}
+	a.Learn(s, ActionThrottle, 1, next)
+
+	// The one transition stored, learned once and replayed 5 times: Q = 1 - (1-Alpha)^6
+	if got, want := a.QTable[s][ActionThrottle], 1-math.Pow(1-cfg.Alpha, 6); math.Abs(got-want) > 1e-12 {
+		t.Errorf("Q(s, throttle) = %v, want %v", got, want)
+	}
+	if a.Visits[s] != 1 || a.steps != 1 || a.Replay.Len() != 1 {
+		t.Errorf("after one Learn: %d visits, %d steps, %d stored", a.Visits[s], a.steps, a.Replay.Len())
+	}
+
+	a.Reset()
+	if a.Replay.Len() != 0 {
+		t.Errorf("%d transitions kept through Reset", a.Replay.Len())
+	}
+	if NewAgent(DefaultAgentConfig()).Replay != nil {
+		t.Error("replay is on by default")
+	}
+	if NewSARSAAgent(cfg).Replay != nil || NewDoubleQAgent(cfg).Replay != nil {
+		t.Error("SARSA or double Q keeps a replay buffer it never replays")
+	}
+}
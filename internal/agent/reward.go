@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"racing-line-mapper/internal/physics"
+	"racing-line-mapper/internal/track"
+	"slices"
+	"strings"
+)
+
+// RewardTerm names one component of the reward (see RewardBreakdown).
+type RewardTerm int
+
+const (
+	TermProgress     RewardTerm = iota // Speed along the track, times SpeedAlongTrackMultiplier
+	TermActionCost                     // RewardConfig.ActionCost of the action taken
+	TermCentering                      // Near the track edge
+	TermCornerLine                     // Outside at turn-in and exit, inside at the apex (with RewardConfig.CornerLine)
+	TermTargetSpeed                    // Over the waypoint's target speed (added by Env, see RewardConfig.TargetSpeed)
+	TermGravel                         // On the gravel
+	TermTime                           // Every tick costs a little
+	TermStopped                        // Standing still
+	TermBackwards                      // Going the wrong way
+	TermLap                            // Completed a lap
+	TermImprovement                    // Per tick a lap beat the best lap by
+	TermPersonalBest                   // Beat the best lap
+	TermCheckpoint                     // Reached the next waypoint
+	TermCrash                          // Hit a wall
+	TermTimeout                        // Episode cut off at the tick cap (added by the caller, see RewardConfig.Timeout)
+	RewardTermCount
+)
+
+// RewardTermNames are display names indexed by RewardTerm.
+var RewardTermNames = [RewardTermCount]string{
+	"progress", "action", "centering", "corner line", "overspeed", "gravel", "time",
+	"stopped", "backwards", "lap", "improvement", "best", "checkpoint", "crash", "timeout",
+}
+
+// RewardBreakdown is a reward split into the contributions of its terms, which sum to it.
+type RewardBreakdown [RewardTermCount]float64
+
+// Total is the reward: the sum of the terms.
+func (b RewardBreakdown) Total() float64 {
+	total := 0.0
+	for _, v := range b {
+		total += v
+	}
+	return total
+}
+
+// Add accumulates another breakdown term by term, e.g. over an episode.
+func (b *RewardBreakdown) Add(o RewardBreakdown) {
+	for i, v := range o {
+		b[i] += v
+	}
+}
+
+// Top returns the n (or fewer) terms that contributed, largest magnitude first.
+func (b RewardBreakdown) Top(n int) []RewardTerm {
+	var terms []RewardTerm
+	for t, v := range b {
+		if v != 0 {
+			terms = append(terms, RewardTerm(t))
+		}
+	}
+	slices.SortStableFunc(terms, func(x, y RewardTerm) int {
+		return cmp.Compare(math.Abs(b[y]), math.Abs(b[x]))
+	})
+	return terms[:min(n, len(terms))]
+}
+
+// Format lists the n largest contributions, e.g. "progress +8.2, time -1.0".
+func (b RewardBreakdown) Format(n int) string {
+	parts := make([]string, 0, n)
+	for _, t := range b.Top(n) {
+		parts = append(parts, fmt.Sprintf("%s %+.1f", RewardTermNames[t], b[t]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Reward determines the reward for the transition that took action and led to the car's
+// current state, given the progress it made (from UpdateProgress). It doesn't modify anything.
+func Reward(c *physics.Car, grid *track.Grid, pos TrackPos, progress ProgressEvent, bestLapTime int, action int, cfg RewardConfig) float64 {
+	return RewardTerms(c, grid, pos, progress, bestLapTime, action, cfg).Total()
+}
+
+// RewardTerms is Reward split into its terms, to see which of them dominate.
+func RewardTerms(c *physics.Car, grid *track.Grid, pos TrackPos, progress ProgressEvent, bestLapTime int, action int, cfg RewardConfig) RewardBreakdown {
+	var b RewardBreakdown
+	b[TermActionCost] = -cfg.ActionCost[action]
+	if c.Crashed {
+		b[TermCrash] = cfg.Crash
+		return b
+	}
+
+	// 1. Progress Reward
+	// We want to maximize speed along the track direction (s-velocity)
+	wp := pos.WP
+
+	// Tangent vector
+	tangentX := wp.Normal.Y
+	tangentY := -wp.Normal.X
+
+	// Dot product of Velocity and Tangent = Speed along track
+	speedAlongTrack := c.Velocity.X*tangentX + c.Velocity.Y*tangentY
+
+	b[TermProgress] = speedAlongTrack * cfg.SpeedAlongTrackMultiplier // Multiplier to encourage speed
+
+	// TODO: see if rewards can be provided for optimum brake / throttle / accel levels during corner entry and exit.
+
+	// 2. Centering Reward (Stay in middle lanes)
+	// Calculate Lateral Offset (d)
+	dx := c.Position.X - wp.Position.X
+	dy := c.Position.Y - wp.Position.Y
+	d := dx*wp.Normal.X + dy*wp.Normal.Y
+
+	// Skipped where the width is unknown: there is no edge to be near.
+	// With the corner line on, corners reward the edges instead (see cornerLine).
+	if line, ok := cornerLine(wp, d); cfg.CornerLine && ok {
+		b[TermCornerLine] = line * RwCornerLine
+	} else if !wp.Degenerate() && math.Abs(d) > 0.8*halfWidth(wp) {
+		b[TermCentering] = -2.0 // Penalty for being near edge
+	}
+
+	// 3. Gravel Penalty
+	if grid.SurfaceAt(c.Position) == track.CellGravel {
+		b[TermGravel] = cfg.Gravel
+	}
+
+	// 4. Time/Stationary Penalty
+	// Penalize just existing to encourage finishing fast
+	// Extra penalty if actually stopped
+	b[TermTime] = -1.0
+
+	if c.Speed < 0.1 {
+		b[TermStopped] = -10.0 // Heavy penalty for stopping
+	}
+
+	// 5. Backwards Penalty
+	// If speedAlongTrack is negative, we are going wrong way
+	if speedAlongTrack < -0.1 {
+		b[TermBackwards] = -20.0 // Very heavy penalty for wrong way
+	}
+
+	// 6. Checkpoint & Lap Reward
+	if progress.Lap {
+		// Major Lap Reward base
+		b[TermLap] = 1000.0
+
+		// Personal Best Bonus
+		// If we beat the best time (or if no best time exists/0), give bonus
+		// bestLapTime comes from Game, in ticks.
+		if bestLapTime > 0 && progress.LapTime < bestLapTime {
+			// Improvement Bonus
+			improvement := float64(bestLapTime - progress.LapTime)
+			// e.g. Improved by 100 ticks (1.6s) -> 100 * 5 = 500 extra reward
+			b[TermImprovement] = improvement * 5.0
+
+			// Just for beating PB
+			b[TermPersonalBest] = 500.0
+		}
+	}
+
+	if progress.Checkpoint {
+		// Small bonus for verifying checkpoint (milestone)
+		b[TermCheckpoint] = 10.0
+	}
+
+	return b
+}
+
+// cornerLine scores lateral offset d at wp against the classic line through a corner: from
+// -1 on the wrong edge to 1 on the right one, which is the outside during turn-in and exit
+// and the inside at the apex. The inside is the side the curvature turns towards. ok is
+// false away from corners (see track.ComputePhases) and where the width is unknown.
+func cornerLine(wp track.Waypoint, d float64) (score float64, ok bool) {
+	if wp.Degenerate() || wp.Curvature == 0 {
+		return 0, false
+	}
+	inside := math.Max(-1, math.Min(1, d/halfWidth(wp)))
+	if wp.Curvature < 0 {
+		inside = -inside
+	}
+	switch wp.Phase {
+	case track.PhaseTurnIn, track.PhaseExit:
+		return -inside, true
+	case track.PhaseApex:
+		return inside, true
+	}
+	return 0, false
+}
@@ -0,0 +1,86 @@
+package agent
+
+import "fmt"
+
+// AgentSARSA is a tabular agent that learns on-policy (SARSA): each update bootstraps
+// from the value of the action the agent will actually take next, exploration included,
+// where AgentQTable bootstraps from the best one. Near a wall that makes it value the
+// risk its own exploration runs, so it tends to learn a safer line while it explores.
+//
+// It shares AgentQTable's table, exploration and sessions. Since Learn is given only the
+// next state, it draws the next action there itself and hands that same action to the
+// SelectAction call that follows for that state.
+type AgentSARSA struct {
+	*AgentQTable
+
+	next       State // The next state of the last Learn, with the action drawn for it
+	nextAction int
+	haveNext   bool
+}
+
+// NewSARSAAgent creates a SARSA agent with the hyperparameters and seed of cfg (see NewAgent).
+// cfg.Replay is ignored: a replayed transition has no next action drawn by the current policy.
+func NewSARSAAgent(cfg AgentConfig) *AgentSARSA {
+	cfg.Replay = ReplayConfig{}
+	return &AgentSARSA{AgentQTable: NewAgent(cfg)}
+}
+
+// NewSARSAAgentWithSeed creates a SARSA agent whose random choices come from its own
+// seeded generator (see NewAgentWithSeed).
+func NewSARSAAgentWithSeed(seed uint64) *AgentSARSA {
+	return &AgentSARSA{AgentQTable: NewAgentWithSeed(seed)}
+}
+
+// SelectAction takes the action the last Learn drew if state is that transition's next
+// state, and otherwise (e.g. after a respawn) chooses epsilon-greedily as AgentQTable does.
+func (a *AgentSARSA) SelectAction(state State) int {
+	if a.haveNext && state == a.next {
+		a.haveNext = false
+		return a.nextAction
+	}
+	a.haveNext = false
+	return a.AgentQTable.SelectAction(state)
+}
+
+// Learn draws the action to take in nextState from the current policy and updates
+// towards its value (see LearnSARSA). The next SelectAction for nextState returns it.
+func (a *AgentSARSA) Learn(state State, action int, reward float64, nextState State) {
+	nextAction := a.AgentQTable.SelectAction(nextState)
+	a.LearnSARSA(state, action, reward, nextState, nextAction)
+	a.next, a.nextAction, a.haveNext = nextState, nextAction, true
+}
+
+// LearnTerminal updates Q(s,a) towards the reward alone, for a transition that ended the
+// episode; there is no next action to draw.
+func (a *AgentSARSA) LearnTerminal(state State, action int, reward float64) {
+	a.haveNext = false
+	a.update(Experience{State: state, Action: action, Reward: reward, Next: state, Terminal: true}, true)
+}
+
+// LearnSARSA updates Q(s,a) towards reward + Gamma * Q(s',a'), for the action nextAction
+// taken in nextState (a state not seen yet is worth 0).
+func (a *AgentSARSA) LearnSARSA(state State, action int, reward float64, nextState State, nextAction int) {
+	state, nextState = state.Discrete(), nextState.Discrete()
+
+	qValues := a.QTable[state]
+	nextQ := a.QTable[nextState][nextAction]
+	qValues[action] += a.Alpha * (reward + a.Gamma*nextQ - qValues[action])
+
+	a.mu.Lock()
+	a.QTable[state] = qValues
+	a.Visits[state]++
+	a.steps++
+	a.mu.Unlock()
+}
+
+// Reset forgets everything learned, including the action drawn for the next state.
+func (a *AgentSARSA) Reset() {
+	a.AgentQTable.Reset()
+	a.haveNext = false
+}
+
+func (a *AgentSARSA) DebugInfoStr() string {
+	st := a.Stats()
+	return fmt.Sprintf("Type: SARSA\nQ-Size:  %d\nVisits:  %d states, %.1f avg, %d once\nCovered: %.1f%% >%d visits\nAlpha:   %.8f\nGamma:   %.8f\nEpsilon: %.8f\nDecay:   %.8f",
+		st.States, st.Visited, st.MeanVisits, st.VisitedOnce, 100*st.Coverage(), CoverageMinVisits, a.Alpha, a.Gamma, st.Epsilon, a.Exploration.Decay)
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"math"
+	"testing"
+)
+
+// TestSARSABootstrapsTheNextAction checks the update uses the value of the action taken
+// next, not the best one as Q-learning would.
+func TestSARSABootstrapsTheNextAction(t *testing.T) {
+	s, next := State{SegmentIdx: 1}, State{SegmentIdx: 2}
+	a := NewSARSAAgentWithSeed(1)
+	a.QTable[next.Discrete()] = [ActionCount]float64{ActionThrottle: 10, ActionBrake: -10}
+
+	a.LearnSARSA(s, ActionCoast, 1, next, ActionBrake)
+	if got, want := a.QTable[s][ActionCoast], Alpha*(1+Gamma*-10); math.Abs(got-want) > 1e-12 {
+		t.Errorf("Q(s, coast) = %v, want %v (bootstrapped from the brake taken next)", got, want)
+	}
+	if a.Visits[s] != 1 || a.steps != 1 {
+		t.Errorf("after one update: %d visits, %d steps", a.Visits[s], a.steps)
+	}
+}
+
+// TestSARSATakesTheActionItLearnedFrom checks the action Learn draws for the next state
+// is the one SelectAction then takes there, while another state gets a fresh choice.
+func TestSARSATakesTheActionItLearnedFrom(t *testing.T) {
+	a := NewSARSAAgentWithSeed(7)
+	s, next := State{SegmentIdx: 1}, State{SegmentIdx: 2, Masked: 1 << ActionBrake}
+	for i := 0; i < 200; i++ {
+		a.Learn(s, a.SelectAction(s), 0, next)
+		drawn := a.nextAction
+		if drawn == ActionBrake {
+			t.Fatalf("drew the masked action for the next state")
+		}
+		if got := a.SelectAction(next); got != drawn {
+			t.Fatalf("step %d: took %d in the next state, but learned from %d", i, got, drawn)
+		}
+	}
+
+	a.Learn(s, ActionCoast, 0, next)
+	a.SelectAction(State{SegmentIdx: 5}) // Respawned elsewhere: the drawn action is dropped
+	if a.haveNext {
+		t.Error("the drawn action outlived a SelectAction for another state")
+	}
+}
+
+// TestSARSALearnsTheChain trains on the chain environment: driving forward earns reward,
+// so throttle should come out ahead of brake everywhere.
+func TestSARSALearnsTheChain(t *testing.T) {
+	a := NewSARSAAgentWithSeed(42)
+	env := &chainEnv{}
+	for i := 0; i < 5000; i++ {
+		s := env.state()
+		action := a.SelectAction(s)
+		a.Learn(s, action, env.step(action), env.state())
+	}
+	for seg := 0; seg < chainLen; seg++ {
+		q := a.QValuesFor(State{SegmentIdx: seg})
+		if q[ActionThrottle] <= q[ActionBrake] {
+			t.Errorf("segment %d: throttle %.2f not above brake %.2f", seg, q[ActionThrottle], q[ActionBrake])
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// session is the on-disk form of a training session: everything needed for a
+// resumed run to continue exactly where the saved one left off.
+type session struct {
+	QTable  QTable
+	Visits  map[State]int // Missing from sessions saved before visits were tracked
+	Epsilon float64
+	Steps   int    // Learning steps (see Exploration); missing from sessions saved before they were counted
+	RNG     []byte // Serialized generator state (see Rand)
+	Track   string // The agent's Track; empty if it had none, or the session predates it
+	Second  QTable // AgentDoubleQ's second table; nil for the single-table agents
+}
+
+// ErrTrackMismatch is returned (wrapped) by LoadSession for a session trained on another track.
+var ErrTrackMismatch = errors.New("session was trained on a different track")
+
+// SaveSession writes the Q-table, the visit counts, the exploration progress, and the RNG state to path.
+func (a *AgentQTable) SaveSession(path string) error {
+	return a.saveSession(path, nil)
+}
+
+// saveSession is SaveSession, with a second table for AgentDoubleQ.
+func (a *AgentQTable) saveSession(path string, second QTable) error {
+	rng, err := a.rng.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := gob.NewEncoder(f).Encode(session{QTable: a.QTable, Visits: a.Visits, Epsilon: a.Exploration.Rate(a.steps), Steps: a.steps, RNG: rng, Track: a.Track, Second: second}); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// LoadSession replaces the agent's Q-table, visit counts, exploration progress, and RNG state with the ones saved at path.
+// The agent keeps its own Exploration schedule. If both the session and the agent know
+// their track and they differ, the agent is left unchanged and the error wraps ErrTrackMismatch.
+func (a *AgentQTable) LoadSession(path string) error {
+	_, err := a.loadSession(path)
+	return err
+}
+
+// loadSession is LoadSession, also returning the session's second table if it has one
+// (see AgentDoubleQ).
+func (a *AgentQTable) loadSession(path string) (second QTable, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var s session
+	if err := gob.NewDecoder(f).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Track != "" && a.Track != "" && s.Track != a.Track {
+		return nil, fmt.Errorf("%s: %w (track %s, this is %s)", path, ErrTrackMismatch, s.Track, a.Track)
+	}
+	if err := a.rng.UnmarshalBinary(s.RNG); err != nil {
+		return nil, err
+	}
+
+	if s.QTable == nil {
+		s.QTable = make(QTable)
+	}
+	if s.Visits == nil {
+		s.Visits = make(map[State]int)
+	}
+	if s.Steps == 0 && s.Epsilon < a.Exploration.Rate(0) {
+		s.Steps = a.Exploration.stepsTo(s.Epsilon) // Older session: only the rate was saved
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.QTable, a.Visits, a.steps = s.QTable, s.Visits, s.Steps
+	return s.Second, nil
+}
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// chainEnv is a tiny deterministic environment: a ring of segments where
+// throttle moves forward (+1 reward), brake moves back (-1) and anything else stays put.
+type chainEnv struct {
+	seg int
+}
+
+const chainLen = 10
+
+func (e *chainEnv) state() State {
+	return State{SegmentIdx: e.seg}
+}
+
+func (e *chainEnv) step(action int) float64 {
+	switch action {
+	case ActionThrottle:
+		e.seg = (e.seg + 1) % chainLen
+		return 1
+	case ActionBrake:
+		e.seg = (e.seg - 1 + chainLen) % chainLen
+		return -1
+	}
+	return 0
+}
+
+func train(a *AgentQTable, env *chainEnv, steps int) {
+	for i := 0; i < steps; i++ {
+		s := env.state()
+		action := a.SelectAction(s)
+		r := env.step(action)
+		a.Learn(s, action, r, env.state())
+	}
+}
+
+func TestSessionResumeMatchesUninterruptedRun(t *testing.T) {
+	const steps = 4000
+	const seed = 42
+
+	// Uninterrupted run
+	full := NewAgentWithSeed(seed)
+	train(full, &chainEnv{}, steps)
+
+	// Same run, saved halfway and resumed into a differently-seeded agent
+	first := NewAgentWithSeed(seed)
+	env := &chainEnv{}
+	train(first, env, steps/2)
+
+	path := filepath.Join(t.TempDir(), "session.gob")
+	if err := first.SaveSession(path); err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+
+	resumed := NewAgentWithSeed(seed + 1)
+	if err := resumed.LoadSession(path); err != nil {
+		t.Fatalf("LoadSession: %v", err)
+	}
+	train(resumed, env, steps-steps/2)
+
+	if !reflect.DeepEqual(full.QTable, resumed.QTable) {
+		t.Errorf("resumed Q-table differs from uninterrupted run:\nfull:    %v\nresumed: %v", full.QTable, resumed.QTable)
+	}
+	if !reflect.DeepEqual(full.Visits, resumed.Visits) {
+		t.Errorf("resumed visit counts differ from uninterrupted run")
+	}
+	if full.Epsilon() != resumed.Epsilon() {
+		t.Errorf("resumed epsilon = %v, want %v", resumed.Epsilon(), full.Epsilon())
+	}
+}
+
+func TestResetMatchesFreshAgent(t *testing.T) {
+	const steps = 2000
+
+	fresh := NewAgentWithSeed(7)
+	train(fresh, &chainEnv{}, steps)
+
+	reused := NewAgentWithSeed(7)
+	train(reused, &chainEnv{}, steps)
+	reused.Reset()
+	if len(reused.QTable) != 0 || reused.Epsilon() != StartEpsilon {
+		t.Fatalf("after Reset: %d Q-table entries, epsilon %v; want 0 and %v", len(reused.QTable), reused.Epsilon(), StartEpsilon)
+	}
+	train(reused, &chainEnv{}, steps)
+
+	if !reflect.DeepEqual(fresh.QTable, reused.QTable) {
+		t.Errorf("training after Reset differs from training a fresh agent with the same seed")
+	}
+}
+
+func TestPruneDropsRarelyVisitedStates(t *testing.T) {
+	ag := NewAgentWithSeed(1)
+	often, rare, unknown := State{SegmentIdx: 1}, State{SegmentIdx: 2}, State{SegmentIdx: 3}
+	for i := 0; i < 5; i++ {
+		ag.Learn(often, ActionThrottle, 1, rare)
+	}
+	ag.Learn(rare, ActionThrottle, 1, often)
+	ag.Learn(rare, ActionCoast, 1, often)
+	ag.QTable[unknown] = [ActionCount]float64{ActionBrake: 1} // No visit count, as from an old session
+
+	if n := ag.Prune(3); n != 1 {
+		t.Errorf("pruned %d states, want 1", n)
+	}
+	if _, ok := ag.QTable[rare]; ok {
+		t.Error("state visited twice survived pruning at 3 visits")
+	}
+	if _, ok := ag.Visits[rare]; ok {
+		t.Error("pruned state kept its visit count")
+	}
+	if ag.QTable[often][ActionThrottle] == 0 || ag.Visits[often] != 5 {
+		t.Errorf("frequently visited state lost: Q %v, visits %d", ag.QTable[often], ag.Visits[often])
+	}
+	if _, ok := ag.QTable[unknown]; !ok {
+		t.Error("state without a visit count was pruned")
+	}
+}
+
+func TestLoadSessionRejectsOtherTrack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.gob")
+	saved := NewAgentWithSeed(1)
+	saved.Track = "monza"
+	train(saved, &chainEnv{}, 100)
+	if err := saved.SaveSession(path); err != nil {
+		t.Fatal(err)
+	}
+
+	other := NewAgentWithSeed(2)
+	other.Track = "spa"
+	if err := other.LoadSession(path); !errors.Is(err, ErrTrackMismatch) {
+		t.Errorf("loading a monza session on spa: %v, want ErrTrackMismatch", err)
+	}
+	if len(other.QTable) != 0 {
+		t.Error("a rejected session was loaded anyway")
+	}
+
+	// The same track, or an agent that doesn't know its track, loads it
+	for _, track := range []string{"monza", ""} {
+		a := NewAgentWithSeed(2)
+		a.Track = track
+		if err := a.LoadSession(path); err != nil || !reflect.DeepEqual(a.QTable, saved.QTable) {
+			t.Errorf("track %q: %v, Q-table loaded %v", track, err, reflect.DeepEqual(a.QTable, saved.QTable))
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"racing-line-mapper/internal/physics"
+	"racing-line-mapper/internal/track"
+	"testing"
+)
+
+// TestTrainingSmoke runs the whole pipeline end to end: render a small track image,
+// load it into a grid and mesh, and train a Q-table agent on it for a few hundred ticks,
+// respawning after crashes as the app does.
+func TestTrainingSmoke(t *testing.T) {
+	e := track.Esses{Radius: 150, Amplitude: 15, Wavelength: 240, Width: 40}
+	path := filepath.Join(t.TempDir(), "smoke.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, e.Image()); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	grid, mesh, err := track.LoadTrackFromImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// About one waypoint per walker step (6px) around the loop
+	if n, want := len(mesh.Waypoints), int(mesh.TotalLen/6); !mesh.Looped || n < want/2 || n > 2*want {
+		t.Fatalf("mesh of %d waypoints over %.0f px (looped %v), want a loop of about %d", n, mesh.TotalLen, mesh.Looped, want)
+	}
+
+	a := NewAgentWithSeed(1)
+	env := &Env{Grid: grid, Mesh: mesh, Car: StartCar(mesh, physics.DefaultCarParams()), Rewards: DefaultRewardConfig(), MaskActions: true}
+	start := env.Car.Position
+	moved, crashes := 0.0, 0
+	state := env.Observe(Locate(env.Car, mesh))
+	for tick := 0; tick < 500; tick++ {
+		env.Car.CurrentLapTime++
+		action := a.SelectAction(state)
+		tr := env.Drive(ActionInputs(action))
+		next := env.Observe(tr.Pos)
+		terms, _ := env.Score(tr, action)
+		env.Learn(a, state, action, terms.Total(), tr, next)
+		moved = max(moved, env.Car.Position.Sub(start).Len())
+
+		state = next
+		if tr.Step.Crashed {
+			crashes++
+			env.Car = StartCar(mesh, physics.DefaultCarParams())
+			state = env.Observe(Locate(env.Car, mesh))
+		}
+	}
+
+	if moved < 10 {
+		t.Errorf("car got at most %.1f px from the start in 500 ticks", moved)
+	}
+	if len(a.QTable) < 5 {
+		t.Errorf("Q-table has %d states after 500 ticks (%d crashes), want it to grow", len(a.QTable), crashes)
+	}
+}
@@ -0,0 +1,317 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+)
+
+// Tile-coded agent hyperparameters
+const (
+	TileAlpha float64 = 0.1  // Learning rate, split across the tilings
+	TileGamma float64 = 0.99 // Discount Factor (short horizon, as for AgentLinear)
+)
+
+// Continuous steering (see AgentTileCoded.SteerLevels)
+const (
+	TileSteerLevels = 8 // Steering amounts each way, evenly spaced up to full lock
+	TileSteerTiles  = 8 // Tiles across the steering range [-1, 1] in each tiling
+)
+
+// Tile coder dimensions, in the order of TileCoder.Tiles
+const (
+	TileDimS = iota
+	TileDimD
+	TileDimSpeed
+	TileDimHeading
+	TileDims
+)
+
+// TileCoder maps the continuous Features to a sparse set of active tiles: one tile per
+// tiling, where each tiling is a grid over (s, d, speed, heading) shifted by a fraction
+// of a tile. Nearby states fall in mostly the same tiles, so what is learned at one
+// generalizes to its neighbours, while distant states share none.
+type TileCoder struct {
+	Tilings int           // Number of offset tilings (= active tiles per state)
+	Tiles   [TileDims]int // Tiles per dimension in each tiling
+}
+
+// DefaultTileCoder is fine along the track and coarse elsewhere.
+func DefaultTileCoder() TileCoder {
+	return TileCoder{Tilings: 8, Tiles: [TileDims]int{TileDimS: 64, TileDimD: 6, TileDimSpeed: 6, TileDimHeading: 8}}
+}
+
+// wraps reports whether a dimension is periodic (progress and heading wrap around).
+func wraps(dim int) bool {
+	return dim == TileDimS || dim == TileDimHeading
+}
+
+// cells is the number of distinct tile coordinates along a dimension in one tiling.
+// Offsetting a bounded dimension needs one extra tile at the top end.
+func (tc TileCoder) cells(dim int) int {
+	if wraps(dim) {
+		return tc.Tiles[dim]
+	}
+	return tc.Tiles[dim] + 1
+}
+
+// Size is the number of tiles over all tilings (the weight vector length per action).
+func (tc TileCoder) Size() int {
+	n := 1
+	for dim := 0; dim < TileDims; dim++ {
+		n *= tc.cells(dim)
+	}
+	return n * tc.Tilings
+}
+
+// normalize maps the features into [0, 1] per dimension.
+func normalize(f Features) [TileDims]float64 {
+	return [TileDims]float64{
+		TileDimS:       f.S - math.Floor(f.S),
+		TileDimD:       (clamp(f.D/LinearDClamp, -1, 1) + 1) / 2,
+		TileDimSpeed:   clamp(f.SpeedFrac(), 0, 1),
+		TileDimHeading: (math.Remainder(f.HeadingRel, 2*math.Pi) + math.Pi) / (2 * math.Pi),
+	}
+}
+
+// Active appends the index of the active tile in every tiling to buf and returns it.
+// Tiling t is displaced by t/Tilings of a tile times (1, 3, 5, 7) across the dimensions,
+// the usual asymmetric offsets that avoid tilings lining up along diagonals.
+func (tc TileCoder) Active(f Features, buf []int) []int {
+	x := normalize(f)
+	perTiling := tc.Size() / tc.Tilings
+	for t := 0; t < tc.Tilings; t++ {
+		idx := 0
+		for dim := 0; dim < TileDims; dim++ {
+			shift := float64(t*(2*dim+1)%tc.Tilings) / float64(tc.Tilings)
+			c := int(x[dim]*float64(tc.Tiles[dim]) + shift)
+			if wraps(dim) {
+				c %= tc.Tiles[dim]
+			} else {
+				c = min(c, tc.Tiles[dim])
+			}
+			idx = idx*tc.cells(dim) + c
+		}
+		buf = append(buf, t*perTiling+idx)
+	}
+	return buf
+}
+
+// AgentTileCoded is a linear agent over tile-coded features: Q(s, a) is the sum of
+// W[a] over the active tiles. It sits between the Q-table (no generalization) and
+// AgentLinear (global generalization from a handful of basis functions).
+type AgentTileCoded struct {
+	Coder   TileCoder
+	W       [ActionCount][]float64
+	Updates int
+
+	// SteerLevels, if over 1, makes the steering continuous: Left and Right steer by
+	// k/SteerLevels of full lock (k = 1..SteerLevels) instead of always by all of it, the
+	// amount picked like an action. Their values are then WSteer summed over the tiles of
+	// the state and the steering input, which are tiled across [-1, 1] like a fifth
+	// dimension, so what is learned for one amount carries over to the amounts near it.
+	SteerLevels int
+	WSteer      []float64
+
+	// Exploration is the epsilon-greedy schedule, over the learning steps (Updates).
+	Exploration Exploration
+
+	seed     uint64 // Of rng, for Reset
+	rng      *Rand
+	active   []int // Scratch buffer for Active
+	steerBuf []int // ... and for steerTiles
+
+	// picked is the steering input SelectAction last chose, kept for the Learn that
+	// follows it (see Steering)
+	picked struct {
+		ok     bool
+		state  State
+		action int
+		input  float64
+	}
+}
+
+// NewTileCodedAgent creates a tile-coded agent over tc with the exploration schedule and
+// seed of cfg (it keeps its own learning rate and discount; see TileAlpha).
+func NewTileCodedAgent(tc TileCoder, cfg AgentConfig) *AgentTileCoded {
+	seed := cfg.seed()
+	a := &AgentTileCoded{
+		Coder:       tc,
+		Exploration: cfg.Exploration,
+		seed:        seed,
+		rng:         NewRand(seed),
+	}
+	for act := range a.W {
+		a.W[act] = make([]float64, tc.Size())
+	}
+	return a
+}
+
+// NewSteeringTileCodedAgent is NewTileCodedAgent with continuous steering over the given
+// number of steering amounts each way (see SteerLevels).
+func NewSteeringTileCodedAgent(tc TileCoder, levels int, cfg AgentConfig) *AgentTileCoded {
+	a := NewTileCodedAgent(tc, cfg)
+	a.SteerLevels = levels
+	a.WSteer = make([]float64, tc.Size()*(TileSteerTiles+1))
+	return a
+}
+
+// steers reports whether the agent picks its steering amount, and the action is a steering one.
+func (a *AgentTileCoded) steers(action int) bool {
+	return a.SteerLevels > 1 && (action == ActionLeft || action == ActionRight)
+}
+
+// steerTiles appends the WSteer index of every tiling's tile for the active state tiles
+// and steering input (in [-1, 1]) to buf and returns it. Tiling t is shifted along the
+// steering as along a fifth dimension (see Active).
+func (a *AgentTileCoded) steerTiles(active []int, input float64, buf []int) []int {
+	x := (clamp(input, -1, 1) + 1) / 2
+	for t, tile := range active {
+		shift := float64(t*(2*TileDims+1)%a.Coder.Tilings) / float64(a.Coder.Tilings)
+		c := min(int(x*TileSteerTiles+shift), TileSteerTiles)
+		buf = append(buf, tile*(TileSteerTiles+1)+c)
+	}
+	return buf
+}
+
+// steerQ is the value of steering by input from the state with the given active tiles.
+func (a *AgentTileCoded) steerQ(active []int, input float64) float64 {
+	a.steerBuf = a.steerTiles(active, input, a.steerBuf[:0])
+	q := 0.0
+	for _, i := range a.steerBuf {
+		q += a.WSteer[i]
+	}
+	return q
+}
+
+// bestSteer returns the steering input for the action with the highest value from the
+// state with the given active tiles, and that value. Ties go to the gentler amount.
+func (a *AgentTileCoded) bestSteer(active []int, action int) (input, q float64) {
+	sign := 1.0
+	if action == ActionLeft {
+		sign = -1
+	}
+	q = math.Inf(-1)
+	for k := 1; k <= a.SteerLevels; k++ {
+		u := sign * float64(k) / float64(a.SteerLevels)
+		if v := a.steerQ(active, u); v > q {
+			input, q = u, v
+		}
+	}
+	return input, q
+}
+
+// Steering is the steering input for a steering action at state: the amount SelectAction
+// picked, if it was the last thing it picked and no Learn has used it up, else the best
+// one. Other actions, and an agent without SteerLevels, steer as ActionInputs does.
+func (a *AgentTileCoded) Steering(state State, action int) float64 {
+	if !a.steers(action) {
+		_, _, steering := ActionInputs(action)
+		return steering
+	}
+	if p := a.picked; p.ok && p.action == action && p.state == state {
+		return p.input
+	}
+	a.active = a.Coder.Active(state.Features, a.active[:0])
+	input, _ := a.bestSteer(a.active, action)
+	return input
+}
+
+// Reset zeroes the weights (keeping their storage) and restarts exploration.
+func (a *AgentTileCoded) Reset() {
+	for act := range a.W {
+		clear(a.W[act])
+	}
+	clear(a.WSteer)
+	a.picked.ok = false
+	a.Updates = 0
+	a.rng = NewRand(a.seed)
+}
+
+func (a *AgentTileCoded) qValues(tiles []int) [ActionCount]float64 {
+	var q [ActionCount]float64
+	for act := range q {
+		if a.steers(act) {
+			_, q[act] = a.bestSteer(tiles, act)
+			continue
+		}
+		for _, i := range tiles {
+			q[act] += a.W[act][i]
+		}
+	}
+	return q
+}
+
+func (a *AgentTileCoded) Epsilon() float64 { return a.Exploration.Rate(a.Updates) }
+
+// SelectAction chooses an action using Epsilon-Greedy policy over the tile-coded Q-values.
+// Masked actions are never chosen. With SteerLevels, a steering action also gets its
+// amount, at random when exploring and else the best one (see Steering).
+func (a *AgentTileCoded) SelectAction(state State) int {
+	explore := a.rng.Float64() < a.Epsilon()
+	var action int
+	if explore {
+		action = randomAction(a.rng, state.Masked)
+	} else {
+		action = greedyAction(a.rng, a.QValuesFor(state), state.Masked)
+	}
+	a.picked.ok = false
+	if a.steers(action) {
+		input := a.Steering(state, action)
+		if explore {
+			input = math.Copysign(float64(1+a.rng.IntN(a.SteerLevels))/float64(a.SteerLevels), input)
+		}
+		a.picked.ok, a.picked.state, a.picked.action, a.picked.input = true, state, action, input
+	}
+	return action
+}
+
+// Learn performs a TD(0) update of the chosen action's weights on the active tiles.
+func (a *AgentTileCoded) Learn(state State, action int, reward float64, nextState State) {
+	a.learn(state, action, reward, maxAllowedQ(a.QValuesFor(nextState), nextState.Masked))
+}
+
+// LearnTerminal is Learn for a transition that ended the episode: the target is the reward alone.
+func (a *AgentTileCoded) LearnTerminal(state State, action int, reward float64) {
+	a.learn(state, action, reward, 0)
+}
+
+// learn performs the update towards reward + Gamma * maxNextQ. A steering action with
+// SteerLevels updates the value of the amount it steered by (see Steering).
+func (a *AgentTileCoded) learn(state State, action int, reward, maxNextQ float64) {
+	steers := a.steers(action)
+	input := 0.0
+	if steers {
+		input = a.Steering(state, action)
+	}
+	a.picked.ok = false
+
+	a.active = a.Coder.Active(state.Features, a.active[:0])
+	w, tiles := a.W[action], a.active
+	if steers {
+		w, tiles = a.WSteer, a.steerTiles(a.active, input, a.steerBuf[:0])
+	}
+	currentQ := 0.0
+	for _, i := range tiles {
+		currentQ += w[i]
+	}
+	step := TileAlpha / float64(a.Coder.Tilings) * (reward + TileGamma*maxNextQ - currentQ)
+	for _, i := range tiles {
+		w[i] += step
+	}
+	a.Updates++
+}
+
+// QValuesFor returns the tile-coded Q-values of every action at the given state.
+func (a *AgentTileCoded) QValuesFor(state State) [ActionCount]float64 {
+	a.active = a.Coder.Active(state.Features, a.active[:0])
+	return a.qValues(a.active)
+}
+
+func (a *AgentTileCoded) DebugInfoStr() string {
+	steering := "full lock"
+	if a.SteerLevels > 1 {
+		steering = fmt.Sprintf("%d levels", a.SteerLevels)
+	}
+	return fmt.Sprintf("Type: Tile-coded\nTiles:   %d x %d\nSteer:   %s\nUpdates: %d\nAlpha:   %.8f\nGamma:   %.8f\nEpsilon: %.8f\nDecay:   %.8f",
+		a.Coder.Tilings, a.Coder.Size()/a.Coder.Tilings, steering, a.Updates, TileAlpha, TileGamma, a.Epsilon(), a.Exploration.Decay)
+}
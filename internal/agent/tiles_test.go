@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"math"
+	"testing"
+)
+
+// shared counts the tiles two feature vectors have in common.
+func shared(tc TileCoder, a, b Features) int {
+	ta, tb := tc.Active(a, nil), tc.Active(b, nil)
+	n := 0
+	for i := range ta {
+		if ta[i] == tb[i] { // Tiling i contributes exactly one tile to each
+			n++
+		}
+	}
+	return n
+}
+
+// TestTileCoderNearbyStatesShareFeatures checks that a small step in any dimension
+// keeps most active tiles, a large one keeps none, and progress wraps at the finish line.
+func TestTileCoderNearbyStatesShareFeatures(t *testing.T) {
+	tc := DefaultTileCoder()
+	base := Features{S: 0.5, D: 5, Speed: 4, HeadingRel: 0.1}
+
+	if got := len(tc.Active(base, nil)); got != tc.Tilings {
+		t.Fatalf("%d active tiles, want one per tiling (%d)", got, tc.Tilings)
+	}
+	for _, idx := range tc.Active(base, nil) {
+		if idx < 0 || idx >= tc.Size() {
+			t.Fatalf("tile index %d outside 0..%d", idx, tc.Size())
+		}
+	}
+
+	near := []Features{
+		{S: 0.501, D: 5, Speed: 4, HeadingRel: 0.1},
+		{S: 0.5, D: 6, Speed: 4, HeadingRel: 0.1},
+		{S: 0.5, D: 5, Speed: 4.2, HeadingRel: 0.1},
+		{S: 0.5, D: 5, Speed: 4, HeadingRel: 0.15},
+	}
+	for _, f := range near {
+		if n := shared(tc, base, f); n < tc.Tilings/2 {
+			t.Errorf("%+v shares %d of %d tiles with %+v, want most", f, n, tc.Tilings, base)
+		}
+	}
+
+	far := Features{S: 0.9, D: -25, Speed: 9, HeadingRel: 2}
+	if n := shared(tc, base, far); n != 0 {
+		t.Errorf("%+v shares %d tiles with %+v, want none", far, n, base)
+	}
+
+	if n := shared(tc, Features{S: 0.999}, Features{S: 0.001}); n < tc.Tilings/2 {
+		t.Errorf("states either side of the finish line share %d of %d tiles, want most", n, tc.Tilings)
+	}
+}
+
+// TestTileCodedAgentGeneralizes checks that learning at one state moves the
+// Q-value of a nearby unvisited state, but not of a distant one.
+func TestTileCodedAgentGeneralizes(t *testing.T) {
+	ag := NewTileCodedAgent(DefaultTileCoder(), DefaultAgentConfig())
+	s := State{Features: Features{S: 0.3, D: 0, Speed: 5}}
+	near := State{Features: Features{S: 0.302, D: 1, Speed: 5.1}}
+	far := State{Features: Features{S: 0.8, D: 20, Speed: 1}}
+
+	for i := 0; i < 20; i++ {
+		ag.Learn(s, ActionThrottle, 10, far)
+	}
+	if q := ag.QValuesFor(near)[ActionThrottle]; q <= 0 {
+		t.Errorf("nearby Q[Throttle] = %.3f, want raised by learning next to it", q)
+	}
+	if q := ag.QValuesFor(far)[ActionThrottle]; q != 0 {
+		t.Errorf("distant Q[Throttle] = %.3f, want untouched", q)
+	}
+}
+
+// TestSteeringTileCodedAgent trains continuous steering on a state where steering a
+// quarter of full lock right pays best: the agent comes to steer by about that, Left
+// keeps its sign, and the other actions still steer as ActionInputs does.
+func TestSteeringTileCodedAgent(t *testing.T) {
+	cfg := DefaultAgentConfig()
+	cfg.Exploration = Exploration{Start: 1, Decay: 1, Min: 1} // Explore every amount throughout
+	cfg.Seed = 1
+	ag := NewSteeringTileCodedAgent(DefaultTileCoder(), TileSteerLevels, cfg)
+	s := State{Features: Features{S: 0.3, Speed: 5}}
+
+	inputs := map[float64]bool{}
+	for i := 0; i < 4000; i++ {
+		action := ag.SelectAction(s)
+		_, _, steering := Inputs(ag, s, action)
+		if ag.steers(action) {
+			inputs[steering] = true
+		}
+		ag.LearnTerminal(s, action, -100*(steering-0.25)*(steering-0.25))
+	}
+	if len(inputs) != 2*TileSteerLevels {
+		t.Errorf("explored %d steering inputs, want all %d amounts each way", len(inputs), 2*TileSteerLevels)
+	}
+
+	if got := ag.Steering(s, ActionRight); math.Abs(got-0.25) > 1.0/TileSteerLevels {
+		t.Errorf("best steering right %.3f, want within a level of 0.25", got)
+	}
+	if got := ag.Steering(s, ActionLeft); got >= 0 {
+		t.Errorf("best steering left %.3f, want it to the left", got)
+	}
+	if q := ag.QValuesFor(s); q[ActionRight] <= q[ActionLeft] {
+		t.Errorf("Q[Right] %.2f, Q[Left] %.2f; want steering right to be worth more", q[ActionRight], q[ActionLeft])
+	}
+	if _, _, steering := Inputs(ag, s, ActionThrottle); steering != 0 {
+		t.Errorf("throttle steers by %.2f, want 0", steering)
+	}
+	if _, _, steering := Inputs(NewTileCodedAgent(DefaultTileCoder(), cfg), s, ActionLeft); steering != -1 {
+		t.Errorf("without steer levels Left steers by %.2f, want full lock", steering)
+	}
+}
@@ -0,0 +1,34 @@
+package common
+
+// CatmullRom evaluates the Catmull-Rom spline through p1 and p2 at t in [0, 1],
+// with p0 and p3 the neighbouring control points. The curve passes through every
+// control point, so it smooths a sampled path without cutting its corners.
+func CatmullRom(p0, p1, p2, p3 Vec2, t float64) Vec2 {
+	t2 := t * t
+	t3 := t2 * t
+	f := func(a, b, c, d float64) float64 {
+		return 0.5 * (2*b + (c-a)*t + (2*a-5*b+4*c-d)*t2 + (3*b-a-3*c+d)*t3)
+	}
+	return Vec2{
+		X: f(p0.X, p1.X, p2.X, p3.X),
+		Y: f(p0.Y, p1.Y, p2.Y, p3.Y),
+	}
+}
+
+// SamplePath evaluates a Catmull-Rom spline through the points at fractional index u
+// (u = 1.5 is halfway between points[1] and points[2]). The ends are clamped.
+func SamplePath(points []Vec2, u float64) Vec2 {
+	n := len(points)
+	switch {
+	case n == 0:
+		return Vec2{}
+	case n == 1 || u <= 0:
+		return points[0]
+	case u >= float64(n-1):
+		return points[n-1]
+	}
+
+	i := int(u)
+	at := func(j int) Vec2 { return points[max(0, min(n-1, j))] }
+	return CatmullRom(at(i-1), at(i), at(i+1), at(i+2), u-float64(i))
+}
@@ -0,0 +1,146 @@
+package imgproc
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+)
+
+// Contours traces the boundaries of the foreground with marching squares. Each contour
+// is a closed loop (the last point connects back to the first) through the midpoints
+// between foreground and background pixel centers, in pixel coordinates where pixel
+// (x, y) covers [x, x+1) x [y, y+1). A one-pixel staircase comes out as a diagonal line,
+// which is what makes the outline worth filling with anti-aliasing. Diagonal-only
+// neighbours are treated as separate shapes, and the image border counts as background.
+// Holes get contours of their own, so fill with the even-odd rule.
+func Contours(m *Mask) [][]common.Vec2 {
+	// Edge midpoints are keyed on a doubled grid: the horizontal edge between pixel
+	// centers (x, y) and (x+1, y) is (2x+1, 2y), the vertical one to (x, y+1) is (2x, 2y+1).
+	type key struct{ X, Y int }
+	links := make(map[key][2]key)
+	link := func(a, b key) {
+		for _, p := range [2][2]key{{a, b}, {b, a}} {
+			l, ok := links[p[0]]
+			if !ok {
+				l[0] = p[1]
+				l[1] = p[1]
+			} else {
+				l[1] = p[1]
+			}
+			links[p[0]] = l
+		}
+	}
+
+	// Cells span 2x2 pixel centers, from (-1, -1) so the border is closed off
+	for y := -1; y < m.H; y++ {
+		for x := -1; x < m.W; x++ {
+			tl, tr := m.At(x, y), m.At(x+1, y)
+			bl, br := m.At(x, y+1), m.At(x+1, y+1)
+			top, bottom := key{2*x + 1, 2 * y}, key{2*x + 1, 2*y + 2}
+			left, right := key{2 * x, 2*y + 1}, key{2*x + 2, 2*y + 1}
+
+			var edges []key
+			if tl != tr {
+				edges = append(edges, top)
+			}
+			if tr != br {
+				edges = append(edges, right)
+			}
+			if br != bl {
+				edges = append(edges, bottom)
+			}
+			if bl != tl {
+				edges = append(edges, left)
+			}
+			switch len(edges) {
+			case 2:
+				link(edges[0], edges[1])
+			case 4:
+				// Saddle: cut off the two foreground corners separately
+				if tl {
+					link(left, top)
+					link(right, bottom)
+				} else {
+					link(top, right)
+					link(bottom, left)
+				}
+			}
+		}
+	}
+
+	var contours [][]common.Vec2
+	seen := make(map[key]bool, len(links))
+	for start := range links {
+		if seen[start] {
+			continue
+		}
+		var loop []common.Vec2
+		prev, curr := start, start
+		for !seen[curr] {
+			seen[curr] = true
+			loop = append(loop, common.Vec2{X: float64(curr.X)/2 + 0.5, Y: float64(curr.Y)/2 + 0.5})
+			next := links[curr][0]
+			if next == prev {
+				next = links[curr][1]
+			}
+			prev, curr = curr, next
+		}
+		contours = append(contours, loop)
+	}
+	return contours
+}
+
+// SimplifyLoop drops points of a closed polyline that lie within tolerance of the line
+// through their neighbours (Ramer-Douglas-Peucker), keeping its shape to that accuracy.
+func SimplifyLoop(loop []common.Vec2, tolerance float64) []common.Vec2 {
+	n := len(loop)
+	if n < 4 {
+		return loop
+	}
+	// Split the loop at the point furthest from the first, then simplify both halves
+	far := 0
+	for i, p := range loop {
+		if p.Sub(loop[0]).Len() > loop[far].Sub(loop[0]).Len() {
+			far = i
+		}
+	}
+	closed := append(append([]common.Vec2{}, loop...), loop[0])
+	keep := make([]bool, n+1)
+	keep[0], keep[far], keep[n] = true, true, true
+	markKept(closed, 0, far, tolerance, keep)
+	markKept(closed, far, n, tolerance, keep)
+
+	var out []common.Vec2
+	for i, p := range loop {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// markKept runs Ramer-Douglas-Peucker on points[first..last], marking the points to keep
+// (the end points are assumed kept).
+func markKept(points []common.Vec2, first, last int, tolerance float64, keep []bool) {
+	if last-first < 2 {
+		return
+	}
+	a, b := points[first], points[last]
+	ab := b.Sub(a)
+	worst, worstDist := 0, 0.0
+	for i := first + 1; i < last; i++ {
+		ap := points[i].Sub(a)
+		dist := ap.Len()
+		if l := ab.Len(); l > 0 {
+			dist = math.Abs(ab.X*ap.Y-ab.Y*ap.X) / l
+		}
+		if dist > worstDist {
+			worst, worstDist = i, dist
+		}
+	}
+	if worstDist <= tolerance {
+		return
+	}
+	keep[worst] = true
+	markKept(points, first, worst, tolerance, keep)
+	markKept(points, worst, last, tolerance, keep)
+}
@@ -0,0 +1,84 @@
+package imgproc
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+	"testing"
+)
+
+// loopArea is the shoelace area of a closed polyline (unsigned).
+func loopArea(loop []common.Vec2) float64 {
+	sum := 0.0
+	for i, a := range loop {
+		b := loop[(i+1)%len(loop)]
+		sum += a.X*b.Y - b.X*a.Y
+	}
+	return math.Abs(sum) / 2
+}
+
+// distToLoop is the distance from p to the nearest segment of a closed polyline.
+func distToLoop(p common.Vec2, loop []common.Vec2) float64 {
+	best := math.Inf(1)
+	for i, a := range loop {
+		ab := loop[(i+1)%len(loop)].Sub(a)
+		t := 0.0
+		if l2 := ab.X*ab.X + ab.Y*ab.Y; l2 > 0 {
+			t = math.Max(0, math.Min(1, (p.Sub(a).X*ab.X+p.Sub(a).Y*ab.Y)/l2))
+		}
+		best = math.Min(best, p.Sub(a.Add(ab.Scale(t))).Len())
+	}
+	return best
+}
+
+func TestContoursOutlineBlockAndHole(t *testing.T) {
+	m := NewMask(40, 40)
+	// A 20x20 block with a 6x6 hole in the middle
+	for y := 10; y < 30; y++ {
+		for x := 10; x < 30; x++ {
+			m.Set(x, y, x < 17 || x >= 23 || y < 17 || y >= 23)
+		}
+	}
+
+	contours := Contours(m)
+	if len(contours) != 2 {
+		t.Fatalf("got %d contours, want 2 (outside and hole)", len(contours))
+	}
+	// Contours run through the pixel edges, cutting each corner by half a pixel diagonally
+	areas := []float64{loopArea(contours[0]), loopArea(contours[1])}
+	if areas[0] < areas[1] {
+		areas[0], areas[1] = areas[1], areas[0]
+	}
+	if math.Abs(areas[0]-399.5) > 1e-9 || math.Abs(areas[1]-35.5) > 1e-9 {
+		t.Errorf("contour areas = %v, want [399.5 35.5]", areas)
+	}
+
+	outer := contours[0]
+	if loopArea(contours[1]) > loopArea(outer) {
+		outer = contours[1]
+	}
+	simple := SimplifyLoop(outer, 0.5)
+	if len(simple) >= len(outer) || len(simple) > 8 {
+		t.Errorf("simplified %d points to %d, want at most 8 (the corners)", len(outer), len(simple))
+	}
+	for _, p := range outer {
+		if d := distToLoop(p, simple); d > 0.5+1e-9 {
+			t.Errorf("point %v is %.2f from the simplified loop, want within the tolerance", p, d)
+		}
+	}
+}
+
+func TestContoursSeparateDiagonalNeighbours(t *testing.T) {
+	m := NewMask(10, 10)
+	m.Set(4, 4, true)
+	m.Set(5, 5, true)
+
+	contours := Contours(m)
+	if len(contours) != 2 {
+		t.Fatalf("got %d contours, want 2 (one per pixel)", len(contours))
+	}
+	for _, c := range contours {
+		if len(c) != 4 || loopArea(c) != 0.5 {
+			t.Errorf("pixel contour %v: want a diamond of area 0.5", c)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package imgproc
+
+import "math"
+
+// DistanceTransform returns, for every pixel (row-major, W*H), the Euclidean distance
+// to the nearest background pixel: 0 on the background, and counting everything
+// outside the mask as background. It is exact, computed with the separable
+// lower-envelope algorithm of Felzenszwalb and Huttenlocher (columns, then rows).
+func DistanceTransform(m *Mask) []float64 {
+	p := m.Pad(1) // The border is background
+	w, h := p.W, p.H
+	const inf = 1e20
+
+	sq := make([]float64, w*h) // Squared distances
+	for i, fg := range p.Pix {
+		if fg {
+			sq[i] = inf
+		}
+	}
+
+	n := max(w, h)
+	f, d := make([]float64, n), make([]float64, n)
+	v, z := make([]int, n), make([]float64, n+1)
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			f[y] = sq[y*w+x]
+		}
+		lowerEnvelope(f[:h], d[:h], v, z)
+		for y := 0; y < h; y++ {
+			sq[y*w+x] = d[y]
+		}
+	}
+	for y := 0; y < h; y++ {
+		copy(f[:w], sq[y*w:(y+1)*w])
+		lowerEnvelope(f[:w], sq[y*w:(y+1)*w], v, z)
+	}
+
+	out := make([]float64, m.W*m.H)
+	for y := 0; y < m.H; y++ {
+		for x := 0; x < m.W; x++ {
+			out[y*m.W+x] = math.Sqrt(sq[(y+1)*w+x+1])
+		}
+	}
+	return out
+}
+
+// lowerEnvelope computes the 1D squared distance transform d[q] = min_p (q-p)^2 + f[p]
+// as the lower envelope of the parabolas rooted at each p. v and z are scratch space
+// of at least len(f) and len(f)+1.
+func lowerEnvelope(f, d []float64, v []int, z []float64) {
+	k := 0
+	v[0] = 0
+	z[0], z[1] = math.Inf(-1), math.Inf(1)
+	for q := 1; q < len(f); q++ {
+		s := intersect(f, q, v[k])
+		for s <= z[k] {
+			k--
+			s = intersect(f, q, v[k])
+		}
+		k++
+		v[k] = q
+		z[k], z[k+1] = s, math.Inf(1)
+	}
+
+	k = 0
+	for q := range f {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		dq := float64(q - v[k])
+		d[q] = dq*dq + f[v[k]]
+	}
+}
+
+// intersect is where the parabolas rooted at q and p (p < q) cross.
+func intersect(f []float64, q, p int) float64 {
+	fq, fp := float64(q), float64(p)
+	return ((f[q] + fq*fq) - (f[p] + fp*fp)) / (2*fq - 2*fp)
+}
@@ -0,0 +1,37 @@
+package imgproc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceTransformMatchesBruteForce(t *testing.T) {
+	m := NewMask(40, 30)
+	// A ring with a notch, touching the top edge of the image
+	for y := 0; y < 25; y++ {
+		for x := 5; x < 35; x++ {
+			r := math.Hypot(float64(x)-20, float64(y)-12)
+			m.Set(x, y, r < 12 && r > 4 && !(x > 20 && y == 12))
+		}
+	}
+
+	got := DistanceTransform(m)
+	for y := 0; y < m.H; y++ {
+		for x := 0; x < m.W; x++ {
+			want := 0.0
+			if m.At(x, y) {
+				want = math.Inf(1)
+				for by := -1; by <= m.H; by++ {
+					for bx := -1; bx <= m.W; bx++ {
+						if !m.At(bx, by) {
+							want = math.Min(want, math.Hypot(float64(bx-x), float64(by-y)))
+						}
+					}
+				}
+			}
+			if d := got[y*m.W+x]; math.Abs(d-want) > 1e-9 {
+				t.Fatalf("(%d, %d): distance %.3f, want %.3f", x, y, d, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package imgproc holds pure-Go versions of the image operations the track
+// preprocessor needs, so it can run without OpenCV.
+package imgproc
+
+import (
+	"image"
+	"image/color"
+)
+
+// Mask is a binary image; true is foreground (track).
+type Mask struct {
+	W, H int
+	Pix  []bool // Row-major, W*H
+}
+
+func NewMask(w, h int) *Mask {
+	return &Mask{W: w, H: h, Pix: make([]bool, w*h)}
+}
+
+// At returns the pixel at (x, y); out-of-bounds pixels are background.
+func (m *Mask) At(x, y int) bool {
+	if x < 0 || y < 0 || x >= m.W || y >= m.H {
+		return false
+	}
+	return m.Pix[y*m.W+x]
+}
+
+func (m *Mask) Set(x, y int, v bool) {
+	if x < 0 || y < 0 || x >= m.W || y >= m.H {
+		return
+	}
+	m.Pix[y*m.W+x] = v
+}
+
+func (m *Mask) Clone() *Mask {
+	c := NewMask(m.W, m.H)
+	copy(c.Pix, m.Pix)
+	return c
+}
+
+// Count returns the number of foreground pixels.
+func (m *Mask) Count() int {
+	n := 0
+	for _, p := range m.Pix {
+		if p {
+			n++
+		}
+	}
+	return n
+}
+
+// Or sets every pixel that is foreground in o (same size) to foreground in m.
+func (m *Mask) Or(o *Mask) {
+	for i, p := range o.Pix {
+		m.Pix[i] = m.Pix[i] || p
+	}
+}
+
+// Pad returns the mask with n pixels of background added on every side.
+func (m *Mask) Pad(n int) *Mask {
+	out := NewMask(m.W+2*n, m.H+2*n)
+	for y := 0; y < m.H; y++ {
+		copy(out.Pix[(y+n)*out.W+n:], m.Pix[y*m.W:(y+1)*m.W])
+	}
+	return out
+}
+
+// Gray renders the mask as white foreground on black.
+func (m *Mask) Gray() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, m.W, m.H))
+	for i, p := range m.Pix {
+		if p {
+			img.Pix[i] = 255
+		}
+	}
+	return img
+}
+
+// Threshold marks pixels whose luma is above t as foreground (or at/below t, if invert).
+func Threshold(img image.Image, t uint8, invert bool) *Mask {
+	b := img.Bounds()
+	m := NewMask(b.Dx(), b.Dy())
+	for y := 0; y < m.H; y++ {
+		for x := 0; x < m.W; x++ {
+			l := color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+			m.Pix[y*m.W+x] = (l > t) != invert
+		}
+	}
+	return m
+}
+
+// InRange marks pixels whose R, G and B all lie within [lo, hi] as foreground.
+func InRange(img image.Image, lo, hi color.RGBA) *Mask {
+	b := img.Bounds()
+	m := NewMask(b.Dx(), b.Dy())
+	for y := 0; y < m.H; y++ {
+		for x := 0; x < m.W; x++ {
+			c := color.RGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.RGBA)
+			m.Pix[y*m.W+x] = c.R >= lo.R && c.R <= hi.R &&
+				c.G >= lo.G && c.G <= hi.G &&
+				c.B >= lo.B && c.B <= hi.B
+		}
+	}
+	return m
+}
@@ -0,0 +1,75 @@
+package imgproc
+
+// Kernel is a structuring element: the offsets (from its anchor) it covers.
+type Kernel []struct{ DX, DY int }
+
+// EllipseKernel returns a size x size elliptical structuring element anchored
+// at its center, like OpenCV's MORPH_ELLIPSE.
+func EllipseKernel(size int) Kernel {
+	if size < 1 {
+		size = 1
+	}
+	r := float64(size) / 2
+	anchor := size / 2
+	var k Kernel
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx := (float64(x) + 0.5 - r) / r
+			dy := (float64(y) + 0.5 - r) / r
+			if dx*dx+dy*dy <= 1 {
+				k = append(k, struct{ DX, DY int }{x - anchor, y - anchor})
+			}
+		}
+	}
+	return k
+}
+
+// Erode keeps a pixel only if every pixel under the kernel is foreground.
+// Pixels outside the image count as foreground, so the border doesn't eat into shapes.
+func Erode(m *Mask, k Kernel) *Mask {
+	out := NewMask(m.W, m.H)
+	for y := 0; y < m.H; y++ {
+		for x := 0; x < m.W; x++ {
+			if !m.Pix[y*m.W+x] {
+				continue
+			}
+			keep := true
+			for _, o := range k {
+				px, py := x+o.DX, y+o.DY
+				if px >= 0 && py >= 0 && px < m.W && py < m.H && !m.Pix[py*m.W+px] {
+					keep = false
+					break
+				}
+			}
+			out.Pix[y*m.W+x] = keep
+		}
+	}
+	return out
+}
+
+// Dilate sets every pixel the kernel covers when centered on a foreground pixel.
+func Dilate(m *Mask, k Kernel) *Mask {
+	out := NewMask(m.W, m.H)
+	for y := 0; y < m.H; y++ {
+		for x := 0; x < m.W; x++ {
+			if !m.Pix[y*m.W+x] {
+				continue
+			}
+			for _, o := range k {
+				out.Set(x+o.DX, y+o.DY, true)
+			}
+		}
+	}
+	return out
+}
+
+// Open is a morphological opening (erode, then dilate) with an elliptical kernel,
+// repeated iterations times. It removes specks and spurs smaller than the kernel.
+func Open(m *Mask, kernelSize, iterations int) *Mask {
+	k := EllipseKernel(kernelSize)
+	out := m
+	for i := 0; i < iterations; i++ {
+		out = Dilate(Erode(out, k), k)
+	}
+	return out
+}
@@ -0,0 +1,30 @@
+package imgproc
+
+import "testing"
+
+func TestOpenRemovesSpecks(t *testing.T) {
+	m := NewMask(60, 40)
+	// A 20x20 block (kept) and a 2x2 speck (removed by a 5px kernel)
+	for y := 10; y < 30; y++ {
+		for x := 10; x < 30; x++ {
+			m.Set(x, y, true)
+		}
+	}
+	for y := 5; y < 7; y++ {
+		for x := 45; x < 47; x++ {
+			m.Set(x, y, true)
+		}
+	}
+
+	out := Open(m, 5, 1)
+
+	if out.At(45, 5) || out.At(46, 6) {
+		t.Error("speck survived the opening")
+	}
+	if !out.At(20, 20) || !out.At(11, 20) || !out.At(20, 28) {
+		t.Error("opening ate into the block")
+	}
+	if got := out.Count(); got > 400 || got < 380 {
+		t.Errorf("block area after opening = %d, want ~400 (only the corners rounded)", got)
+	}
+}
@@ -0,0 +1,59 @@
+package imgproc
+
+// Thin skeletonizes the mask with the Zhang-Suen algorithm: foreground shapes
+// are peeled from the boundary inwards, in two alternating sub-iterations
+// (south-east, then north-west), until nothing more can be removed without
+// breaking connectivity. The result is a 1px wide medial line.
+func Thin(m *Mask) *Mask {
+	out := m.Clone()
+	var remove []int
+	for {
+		changed := false
+		for sub := 0; sub < 2; sub++ {
+			remove = remove[:0]
+			for y := 0; y < out.H; y++ {
+				for x := 0; x < out.W; x++ {
+					if out.Pix[y*out.W+x] && zhangSuenRemovable(out, x, y, sub) {
+						remove = append(remove, y*out.W+x)
+					}
+				}
+			}
+			for _, i := range remove {
+				out.Pix[i] = false
+			}
+			changed = changed || len(remove) > 0
+		}
+		if !changed {
+			return out
+		}
+	}
+}
+
+// zhangSuenRemovable tests the deletion conditions for pixel (x, y) in the given sub-iteration.
+func zhangSuenRemovable(m *Mask, x, y, sub int) bool {
+	// Neighbours P2..P9, clockwise from north
+	p := [8]bool{
+		m.At(x, y-1), m.At(x+1, y-1), m.At(x+1, y), m.At(x+1, y+1),
+		m.At(x, y+1), m.At(x-1, y+1), m.At(x-1, y), m.At(x-1, y-1),
+	}
+
+	// B: foreground neighbours; A: 0->1 transitions around the ring
+	b, a := 0, 0
+	for i := 0; i < 8; i++ {
+		if p[i] {
+			b++
+		}
+		if !p[i] && p[(i+1)%8] {
+			a++
+		}
+	}
+	if b < 2 || b > 6 || a != 1 {
+		return false
+	}
+
+	p2, p4, p6, p8 := p[0], p[2], p[4], p[6]
+	if sub == 0 {
+		return !(p2 && p4 && p6) && !(p4 && p6 && p8)
+	}
+	return !(p2 && p4 && p8) && !(p2 && p6 && p8)
+}
@@ -0,0 +1,34 @@
+package imgproc
+
+import "testing"
+
+func TestThinRectangleToMedialLine(t *testing.T) {
+	m := NewMask(60, 30)
+	// 40x11 rectangle centered on row 15
+	for y := 10; y <= 20; y++ {
+		for x := 10; x < 50; x++ {
+			m.Set(x, y, true)
+		}
+	}
+
+	out := Thin(m)
+
+	// Away from the ends, each column keeps exactly one pixel, on the middle row
+	for x := 18; x < 42; x++ {
+		n, row := 0, -1
+		for y := 0; y < out.H; y++ {
+			if out.At(x, y) {
+				n++
+				row = y
+			}
+		}
+		if n != 1 || row != 15 {
+			t.Fatalf("column %d: %d pixels (last at row %d), want 1 at row 15", x, n, row)
+		}
+	}
+
+	// Thinning again changes nothing (converged)
+	if again := Thin(out); again.Count() != out.Count() {
+		t.Errorf("skeleton not stable: %d -> %d pixels", out.Count(), again.Count())
+	}
+}
@@ -6,26 +6,149 @@ import (
 	"racing-line-mapper/internal/track"
 )
 
+// Drift model defaults (see ModelDrift, CarConfig.GripLimit and CarConfig.CorneringStiffness)
 const (
-	MaxSpeed         = 10.0 // Pixels per tick (approx)
-	Acceleration     = 0.2
-	Braking          = 0.4
-	Friction         = 0.05 // Air resistance / Rolling resistance
-	TurnSpeed        = 0.05 // Radians per tick
-	OffTrackFriction = 0.2  // Extra drag when on gravel
+	DriftGripLimit          = 0.35 // Most the tyres can change the sideways speed per tick (pixels/tick^2) at full grip
+	DriftCorneringStiffness = 1.0  // Fraction of the sideways speed the tyres take out per tick, within the limit
 )
 
+// WallNormalRadius is how far (in cells) around the point where the car touched a wall
+// the grid is sampled to tell which way the wall faces (see wallNormal).
+const WallNormalRadius = 2
+
+// PhysicsModel selects how the car's velocity follows its heading.
+type PhysicsModel int
+
+const (
+	// ModelArcade keeps the speed as a scalar along the heading and lerps the velocity
+	// toward it by the surface grip: the car always comes back in line, however fast.
+	ModelArcade PhysicsModel = iota
+	// ModelDrift keeps the velocity as a vector of its own. The engine and brakes push
+	// along the heading and the tyres resist sideways slip with a limited force, shared
+	// with the longitudinal load, so past the limit the car slides and can oversteer.
+	ModelDrift
+)
+
+func (m PhysicsModel) String() string {
+	if m == ModelDrift {
+		return "Drift"
+	}
+	return "Arcade"
+}
+
+// SurfaceParams describes how a surface affects the car.
+// Longitudinal drag and lateral grip are separate so e.g. wet tarmac
+// (normal drag, low grip) and gravel (high drag, low grip) can both be modelled.
+type SurfaceParams struct {
+	RollingResistance float64 // Fraction of speed lost per tick on this surface (on top of CarParams.Friction)
+	LateralGrip       float64 // How fast velocity lerps towards the heading (1 = on rails, 0 = ice)
+}
+
+// TireWear describes how grip fades over a stint. The zero value disables wear.
+// Wear builds up with distance driven and with cornering load; the grip factor
+// 1-Wear (floored at MinGrip) scales acceleration, braking and lateral grip.
+type TireWear struct {
+	PerPixel   float64 // Wear per pixel driven
+	PerLateral float64 // Wear per unit of lateral acceleration (pixels/tick^2), summed per tick
+	MinGrip    float64 // Grip factor of fully worn tyres
+}
+
+// CarConfig holds the tunable parameters of the car model.
+type CarConfig struct {
+	Surfaces map[track.CellType]SurfaceParams
+	TireWear TireWear     // Off by default
+	Model    PhysicsModel // Arcade by default
+
+	// Restitution is the fraction of its speed into a wall the car keeps as it bounces
+	// off (0 = it stops dead against the wall, 1 = a perfect bounce).
+	Restitution float64
+	// CrashSpeedThreshold is the speed along the wall's normal (pixels/tick) above which
+	// touching a wall is a crash rather than a bounce. 0 makes every touch a crash.
+	CrashSpeedThreshold float64
+
+	// GripLimit is the most the tyres can change the car's sideways speed per tick
+	// (pixels/tick^2) at full surface grip under ModelDrift, shared with braking and power.
+	// Past it the car slides.
+	GripLimit float64
+	// CorneringStiffness is the fraction of the car's sideways speed the tyres take out per
+	// tick under ModelDrift while within GripLimit. Below 1 the car never quite follows
+	// its nose, so it runs wide (understeers) even when the tyres could hold it.
+	CorneringStiffness float64
+}
+
+// DefaultCarConfig returns the stock surface behaviour.
+func DefaultCarConfig() CarConfig {
+	tarmac := SurfaceParams{RollingResistance: 0.0, LateralGrip: 0.9}
+	return CarConfig{
+		Surfaces: map[track.CellType]SurfaceParams{
+			track.CellTarmac:    tarmac,
+			track.CellStart:     tarmac,
+			track.CellFinish:    tarmac,
+			track.CellDirection: tarmac, // Treat as Tarmac (Safe)
+			track.CellGravel:    {RollingResistance: 0.2, LateralGrip: 0.5},
+		},
+		Restitution:         0.3,
+		CrashSpeedThreshold: 1.5,
+		GripLimit:           DriftGripLimit,
+		CorneringStiffness:  DriftCorneringStiffness,
+	}
+}
+
+// Surface returns the parameters for a cell type, falling back to tarmac for unlisted types.
+func (cfg CarConfig) Surface(t track.CellType) SurfaceParams {
+	if p, ok := cfg.Surfaces[t]; ok {
+		return p
+	}
+	return cfg.Surfaces[track.CellTarmac]
+}
+
+// CellSurface returns the parameters for a cell: those of its type, adjusted for how its
+// Friction compares to the type's nominal friction (see track.SurfaceFriction). Grip
+// scales with the ratio and rolling resistance with its inverse, so a damp patch of
+// tarmac at 0.7 grips 70% as well and a deeper gravel trap drags harder. A drivable cell
+// with no friction set counts as nominal.
+func (cfg CarConfig) CellSurface(cell track.Cell) SurfaceParams {
+	p := cfg.Surface(cell.Type)
+	nominal := track.SurfaceFriction(cell.Type)
+	if cell.Friction <= 0 || nominal <= 0 || cell.Friction == nominal {
+		return p
+	}
+	ratio := cell.Friction / nominal
+	p.LateralGrip = math.Min(p.LateralGrip*ratio, 1)
+	p.RollingResistance = math.Min(p.RollingResistance/ratio, 1)
+	return p
+}
+
+// StepInfo reports what happened during one Update.
+type StepInfo struct {
+	Crashed      bool           // Hit a wall too hard to bounce this tick (see Car.Crash)
+	Bounced      bool           // Touched a wall this tick and bounced off it (see CarConfig.Restitution)
+	Surface      track.CellType // Surface that limited grip (worst under any corner; CellWall on a crash)
+	Distance     float64        // Pixels moved this tick
+	SpeedClamped bool           // Speed was capped at CarParams.MaxSpeed
+	Slip         float64        // Sideways speed (pixels/tick) the car moved at relative to its heading
+}
+
 type Car struct {
 	Position common.Vec2
 	Velocity common.Vec2
 	Heading  float64 // Radians
 	Speed    float64 // Scalar speed (forward/backward)
 	Crashed  bool
+	Crash    CrashInfo // Why/where we crashed (valid when Crashed)
+
+	// PrevPosition is where the car was before its last Update, so the move can be
+	// checked against lines on the track (see track.StartLine.Crossed).
+	PrevPosition common.Vec2
 
 	// Dimensions (in pixels)
 	Width  float64
 	Length float64
 
+	Params CarParams // The vehicle's performance
+	Config CarConfig
+	Wear   float64 // Accumulated tyre wear (0 = fresh, see TireWear)
+
 	// Race State
 	Checkpoint     int // Index of the last passed waypoint
 	Laps           int
@@ -33,13 +156,16 @@ type Car struct {
 	LastLapTime    int // Ticks for previous lap
 }
 
-func NewCar(x, y float64) *Car {
+// NewCar is a car with the given performance at rest at (x, y), heading east.
+func NewCar(x, y float64, params CarParams) *Car {
 	return &Car{
 		Position:       common.Vec2{X: x, Y: y},
+		Params:         params,
 		Heading:        0,
 		Width:          2.0 * common.PixelsPerMeter, // 2 meters
 		Length:         4.5 * common.PixelsPerMeter, // 4.5 meters
-		Checkpoint:     -1,                          // Not started
+		Config:         DefaultCarConfig(),
+		Checkpoint:     -1, // Not started
 		LastLapTime:    0,
 		CurrentLapTime: 0,
 	}
@@ -49,27 +175,35 @@ func NewCar(x, y float64) *Car {
 // throttle: 0.0 to 1.0
 // brake: 0.0 to 1.0
 // steering: -1.0 (left) to 1.0 (right)
-func (c *Car) Update(grid *track.Grid, throttle, brake, steering float64) {
+// Returns what happened during the step.
+func (c *Car) Update(grid *track.Grid, throttle, brake, steering float64) StepInfo {
 	if c.Crashed {
-		return
+		return StepInfo{Crashed: true, Surface: track.CellWall}
 	}
 
+	c.PrevPosition = c.Position
+	if c.Config.Model == ModelDrift {
+		return c.updateDrift(grid, throttle, brake, steering)
+	}
+	tyres := c.GripFactor()
+	heading := c.Heading
+
 	// 1. Apply Input
 	if throttle > 0 {
-		c.Speed += throttle * Acceleration
+		c.Speed += throttle * c.Params.Acceleration * tyres
 	}
 	if brake > 0 {
-		c.Speed -= brake * Braking
+		c.Speed -= brake * c.Params.Braking * tyres
 	}
 
 	// 2. Apply Drag/Friction (Natural deceleration)
 	if c.Speed > 0 {
-		c.Speed -= Friction
+		c.Speed -= c.Params.Friction
 		if c.Speed < 0 {
 			c.Speed = 0
 		}
 	} else if c.Speed < 0 {
-		c.Speed += Friction
+		c.Speed += c.Params.Friction
 		if c.Speed > 0 {
 			c.Speed = 0
 		}
@@ -77,78 +211,292 @@ func (c *Car) Update(grid *track.Grid, throttle, brake, steering float64) {
 
 	// 3. Steering
 	// Only steer if moving
+	yawRate := 0.0
 	if math.Abs(c.Speed) > 0.1 {
-		c.Heading += steering * TurnSpeed
+		yawRate = steering * c.Params.TurnSpeed
+		c.Heading += yawRate
 	}
 
 	// 4. Calculate Velocity Vector based on Heading
 	// Note: This is "Arcade" physics. Velocity is locked to heading + drift.
-	// For true drift, we'd update Velocity separately from Heading.
+	// For true drift (Velocity updated separately from Heading) see updateDrift.
 	// Let's do a simple inertia model:
 	// Target Velocity is (Cos(Heading), Sin(Heading)) * Speed
 	targetVx := math.Cos(c.Heading) * c.Speed
 	targetVy := math.Sin(c.Heading) * c.Speed
 
-	// Lerp towards target velocity (simulates grip)
+	// 4. Update Position, stopping short of the first wall on the way (see hitWall)
+	touch, tc, hit := c.sweep(grid, c.Velocity)
+	if hit >= 0 {
+		return c.hitWall(grid, touch, c.Velocity, heading, hit)
+	}
+
+	// 5. Lerp towards target velocity (simulates grip)
 	// Lower factor = more drift/ice. Higher factor = more grip.
-	grip := 0.9
+	// The car takes the worst surface under any of its corners.
+	grip, rolling, surfaceType := tc.Grip, tc.Rolling, tc.Surface
 
-	// 4. Update Position
-	newPos := common.Vec2{
-		X: c.Position.X + c.Velocity.X,
-		Y: c.Position.Y + c.Velocity.Y,
+	c.Speed *= (1.0 - rolling) // Slow down on draggy surfaces (gravel)
+	grip = c.Params.Grip(grip, c.Speed) * tyres
+
+	// Apply final movements
+	info := StepInfo{Surface: surfaceType, Distance: c.Position.Sub(c.PrevPosition).Len(), Slip: c.Slip()}
+	c.Velocity.X = c.Velocity.X*(1-grip) + targetVx*grip
+	c.Velocity.Y = c.Velocity.Y*(1-grip) + targetVy*grip
+	c.wearTyres(info.Distance, math.Abs(c.Speed*yawRate))
+
+	// Clamp speed
+	if c.Speed > c.Params.MaxSpeed {
+		c.Speed = c.Params.MaxSpeed
+		info.SpeedClamped = true
+	}
+	return info
+}
+
+// updateDrift is Update under ModelDrift. The velocity is split into its forward and
+// sideways parts relative to the heading: throttle, brakes and drag act on the forward
+// part, steering turns the body under the moving car, and the tyres then take out as much
+// of the sideways part as the grip they have left allows (a friction circle).
+func (c *Car) updateDrift(grid *track.Grid, throttle, brake, steering float64) StepInfo {
+	tyres := c.GripFactor()
+	heading := c.Heading
+	here, _ := c.contact(grid, c.Position)
+
+	forward := common.Vec2{X: math.Cos(c.Heading), Y: math.Sin(c.Heading)}
+	right := common.Vec2{X: -forward.Y, Y: forward.X}
+	long := c.Velocity.X*forward.X + c.Velocity.Y*forward.Y
+	lat := c.Velocity.X*right.X + c.Velocity.Y*right.Y
+
+	// 1. Engine, brakes and drag along the heading
+	drive := throttle * c.Params.Acceleration * tyres
+	braking := brake * c.Params.Braking * tyres
+	long += drive
+	if long > 0 {
+		long = math.Max(0, long-braking-c.Params.Friction)
+	} else {
+		long = math.Min(0, long+braking+c.Params.Friction)
+	}
+	long *= 1.0 - here.Rolling
+	vel := forward.Scale(long).Add(right.Scale(lat))
+
+	// 2. Steering turns the body; the velocity doesn't follow by itself
+	yawRate := 0.0
+	if math.Abs(long) > 0.1 {
+		yawRate = steering * c.Params.TurnSpeed
+		c.Heading += yawRate
+	}
+	forward = common.Vec2{X: math.Cos(c.Heading), Y: math.Sin(c.Heading)}
+	right = common.Vec2{X: -forward.Y, Y: forward.X}
+	long = vel.X*forward.X + vel.Y*forward.Y
+	lat = vel.X*right.X + vel.Y*right.Y
+
+	// 3. Tyre friction against the slip, limited by what the longitudinal load leaves
+	limit := c.Config.GripLimit * c.Params.Grip(here.Grip, long) * tyres
+	used := math.Min(drive+braking, limit)
+	avail := math.Sqrt(limit*limit - used*used)
+	lat -= math.Max(-avail, math.Min(avail, c.Config.CorneringStiffness*lat))
+
+	info := StepInfo{}
+	vel = forward.Scale(long).Add(right.Scale(lat))
+	if v := vel.Len(); v > c.Params.MaxSpeed {
+		vel = vel.Scale(c.Params.MaxSpeed / v)
+		long *= c.Params.MaxSpeed / v
+		info.SpeedClamped = true
 	}
 
-	// 5. Calculate Corners for Collision Detection
+	// 4. Move, stopping short of the first wall on the way
+	touch, tc, hit := c.sweep(grid, vel)
+	if hit >= 0 {
+		c.Speed = long
+		return c.hitWall(grid, touch, vel, heading, hit)
+	}
+	info.Surface = tc.Surface
+	info.Distance = vel.Len()
+	c.Velocity = vel
+	c.Speed = long
+	info.Slip = c.Slip()
+	c.wearTyres(info.Distance, math.Abs(long*yawRate))
+	return info
+}
+
+// tyreContact is what the tyres are on: the worst surface under any corner.
+type tyreContact struct {
+	Grip    float64 // Lowest LateralGrip
+	Rolling float64 // Highest RollingResistance
+	Surface track.CellType
+}
+
+// contact checks the chassis centered at pos against the grid. It returns the index of
+// the first corner in a wall (-1 if none) and otherwise the surface the car is on.
+func (c *Car) contact(grid *track.Grid, pos common.Vec2) (tyreContact, int) {
+	tc := tyreContact{Grip: 1.0, Surface: track.CellTarmac}
+	for i, corner := range c.corners(pos) {
+		cell := grid.CellAt(corner)
+		if cell.Type == track.CellWall {
+			return tc, i
+		}
+
+		surface := c.Config.CellSurface(cell)
+		if surface.LateralGrip < tc.Grip {
+			tc.Surface = cell.Type
+		}
+		tc.Grip = math.Min(tc.Grip, surface.LateralGrip)
+		tc.Rolling = math.Max(tc.Rolling, surface.RollingResistance)
+	}
+	return tc, -1
+}
+
+// sweep moves the car by vel in steps of at most a cell, checking the corners after each,
+// so no wall is thin enough to be passed through between two checks. It stops at the last
+// position clear of the walls and returns the chassis position where corner hit touched
+// one. With no wall on the way hit is -1, and tc is the contact at the end of the move.
+func (c *Car) sweep(grid *track.Grid, vel common.Vec2) (touch common.Vec2, tc tyreContact, hit int) {
+	from := c.Position
+	steps := max(1, int(math.Ceil(vel.Len())))
+	for k := 1; k <= steps; k++ {
+		pos := from.Add(vel.Scale(float64(k) / float64(steps)))
+		if tc, hit = c.contact(grid, pos); hit >= 0 {
+			return pos, tc, hit
+		}
+		c.Position = pos
+	}
+	return c.Position, tc, -1
+}
+
+// hitWall handles corner i of the chassis touching a wall at the chassis position touch,
+// moving with velocity vel, having turned from heading; sweep has stopped the car short of
+// it. Hitting the wall faster than CrashSpeedThreshold along its normal is a crash.
+// Anything gentler is a bounce: the car stays where it stopped, with the part of vel into
+// the wall reflected and scaled by Restitution, and the part along it kept.
+func (c *Car) hitWall(grid *track.Grid, touch, vel common.Vec2, heading float64, i int) StepInfo {
+	at := c.corners(touch)[i]
+	n := wallNormal(grid, at, vel)
+	impact := -(vel.X*n.X + vel.Y*n.Y)
+	if impact <= 0 {
+		// The walls around don't face the way the car came from (e.g. it clipped a wall's
+		// corner): take it as a head-on hit, so the bounce always sends the car back
+		n, impact = vel.Scale(-1).Normalize(), vel.Len()
+	}
+	if c.Config.CrashSpeedThreshold <= 0 || impact > c.Config.CrashSpeedThreshold {
+		return c.crash(at, i)
+	}
+
+	// Bouncing keeps the car where it stopped, turned if it fits that way (so it can steer
+	// away from the wall) and otherwise at its old heading. If neither fits, it was
+	// already in the wall and bouncing can't help.
+	tc, stuck := c.contact(grid, c.Position)
+	if stuck >= 0 {
+		turned := c.Heading
+		c.Heading = heading
+		if tc, stuck = c.contact(grid, c.Position); stuck >= 0 {
+			c.Heading = turned
+			return c.crash(at, i)
+		}
+	}
+
+	vel = vel.Add(n.Scale((1 + c.Config.Restitution) * impact))
+	c.Velocity = vel
+	c.Speed = vel.X*math.Cos(c.Heading) + vel.Y*math.Sin(c.Heading)
+	return StepInfo{Bounced: true, Surface: tc.Surface, Distance: c.Position.Sub(c.PrevPosition).Len(), Slip: c.Slip()}
+}
+
+// wallNormal estimates the unit normal of the wall touched at the point at, pointing out
+// of it: away from the wall cells within WallNormalRadius of it, on average. Where those
+// are too symmetric to tell (e.g. in a narrow slot) it points back against vel.
+func wallNormal(grid *track.Grid, at, vel common.Vec2) common.Vec2 {
+	var n common.Vec2
+	cx, cy := int(math.Floor(at.X)), int(math.Floor(at.Y))
+	for dx := -WallNormalRadius; dx <= WallNormalRadius; dx++ {
+		for dy := -WallNormalRadius; dy <= WallNormalRadius; dy++ {
+			if grid.Get(cx+dx, cy+dy).Type == track.CellWall {
+				n = n.Sub(common.Vec2{X: float64(dx), Y: float64(dy)})
+			}
+		}
+	}
+	if n.Len() < 1e-9 {
+		return vel.Scale(-1).Normalize()
+	}
+	return n.Normalize()
+}
+
+// crash stops the car against the wall that corner i (at world position at) touched.
+func (c *Car) crash(at common.Vec2, i int) StepInfo {
+	c.Crashed = true
+	c.Crash = CrashInfo{
+		Position: at,
+		Speed:    c.Speed,
+		Heading:  c.Heading,
+		Corner:   CornerNames[i],
+	}
+	c.Speed = 0
+	return StepInfo{Crashed: true, Surface: track.CellWall}
+}
+
+// GripFactor is the fraction of fresh-tyre grip left after wear (1 with wear disabled).
+func (c *Car) GripFactor() float64 {
+	return math.Max(1-c.Wear, c.Config.TireWear.MinGrip)
+}
+
+// Slip is the car's sideways speed relative to its heading (pixels/tick): zero when it
+// goes where it points, growing as the grip fails to turn the velocity with the heading.
+func (c *Car) Slip() float64 {
+	return math.Abs(-c.Velocity.X*math.Sin(c.Heading) + c.Velocity.Y*math.Cos(c.Heading))
+}
+
+// Corners returns the world positions of the chassis corners, in CornerNames order.
+func (c *Car) Corners() [4]common.Vec2 {
+	return c.corners(c.Position)
+}
+
+// wearTyres adds the wear of one tick: dist pixels driven under the given lateral acceleration.
+func (c *Car) wearTyres(dist, lateral float64) {
+	w := c.Config.TireWear
+	c.Wear += w.PerPixel*dist + w.PerLateral*lateral
+}
+
+// corners returns the world positions of the chassis corners (in CornerNames order)
+// with the car centered at pos at its current heading.
+func (c *Car) corners(pos common.Vec2) [4]common.Vec2 {
 	halfW := c.Width / 2
 	halfL := c.Length / 2
 	cosH := math.Cos(c.Heading)
 	sinH := math.Sin(c.Heading)
 
 	// Local corner offsets
-	offsets := []common.Vec2{
+	offsets := [4]common.Vec2{
 		{X: halfL, Y: halfW},   // Front Right
 		{X: halfL, Y: -halfW},  // Front Left
 		{X: -halfL, Y: halfW},  // Rear Right
 		{X: -halfL, Y: -halfW}, // Rear Left
 	}
 
-	grip = 0.9
-	onGravel := false
-
-	for _, off := range offsets {
+	var out [4]common.Vec2
+	for i, off := range offsets {
 		// Rotate and translate corner
-		worldX := newPos.X + off.X*cosH - off.Y*sinH
-		worldY := newPos.Y + off.X*sinH + off.Y*cosH
-
-		cellX := int(worldX)
-		cellY := int(worldY)
-		cell := grid.Get(cellX, cellY)
-
-		switch cell.Type {
-		case track.CellWall:
-			c.Crashed = true
-			c.Speed = 0
-			return
-		case track.CellGravel:
-			onGravel = true
-		case track.CellDirection:
-			// Treat as Tarmac (Safe)
-		}
+		out[i] = common.Vec2{X: pos.X + off.X*cosH - off.Y*sinH, Y: pos.Y + off.X*sinH + off.Y*cosH}
 	}
+	return out
+}
 
-	if onGravel {
-		grip = 0.5
-		c.Speed *= (1.0 - OffTrackFriction) // Slow down on gravel
+// FitsAt reports whether the car, at its current heading, would touch no wall if centered at pos.
+func (c *Car) FitsAt(grid *track.Grid, pos common.Vec2) bool {
+	for _, corner := range c.corners(pos) {
+		if grid.SurfaceAt(corner) == track.CellWall {
+			return false
+		}
 	}
+	return true
+}
 
-	// Apply final movements
-	c.Position = newPos
-	c.Velocity.X = c.Velocity.X*(1-grip) + targetVx*grip
-	c.Velocity.Y = c.Velocity.Y*(1-grip) + targetVy*grip
-
-	// Clamp speed
-	if c.Speed > MaxSpeed {
-		c.Speed = MaxSpeed
+// SteerToward is the steering input (-1 left .. 1 right, as for Update) that turns the
+// car toward target: the signed angle from its heading to the target, as a fraction of
+// the TurnSpeed (see CarParams) one tick of full lock turns, clamped to the steering range. A target
+// behind the car gets full lock (either way for one dead astern); one at the car, none.
+func SteerToward(c *Car, target common.Vec2) float64 {
+	to := target.Sub(c.Position)
+	if to.X == 0 && to.Y == 0 {
+		return 0
 	}
+	diff := math.Remainder(math.Atan2(to.Y, to.X)-c.Heading, 2*math.Pi)
+	return math.Max(-1, math.Min(1, diff/c.Params.TurnSpeed))
 }
@@ -0,0 +1,379 @@
+package physics
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+	"racing-line-mapper/internal/track"
+	"testing"
+)
+
+// openGrid is a size x size square of tarmac.
+func openGrid(size int) *track.Grid {
+	g := track.NewGrid(size, size)
+	for x := range g.Width {
+		for y := range g.Height {
+			g.Set(x, y, track.Cell{Type: track.CellTarmac, Friction: 1})
+		}
+	}
+	return g
+}
+
+// lapTimes drives the car clockwise around a circle of the given radius with a simple
+// driver (steer onto the circle, lift while the car slides) and returns the time in
+// ticks of each completed lap.
+func lapTimes(c *Car, grid *track.Grid, center common.Vec2, radius float64, laps int) []int {
+	const maxSlip = 0.01 // Radians between velocity and heading the driver tolerates
+	var times []int
+	angle := math.Atan2(c.Position.Y-center.Y, c.Position.X-center.X)
+	travelled, lapStart := 0.0, 0
+	for tick := 1; len(times) < laps && tick < 100000; tick++ {
+		r := c.Position.Sub(center)
+		// Aim along the tangent, pulled back toward the circle
+		want := math.Atan2(r.Y, r.X) + math.Pi/2 + (r.Len()-radius)/radius*2
+		diff := math.Remainder(want-c.Heading, 2*math.Pi)
+		steering := math.Max(-1, math.Min(1, diff/c.Params.TurnSpeed))
+		throttle := 1.0
+		if c.Velocity.Len() > 0 && math.Abs(math.Remainder(math.Atan2(c.Velocity.Y, c.Velocity.X)-c.Heading, 2*math.Pi)) > maxSlip {
+			throttle = 0
+		}
+		c.Update(grid, throttle, 0, steering)
+		if c.Crashed {
+			return times
+		}
+
+		next := math.Atan2(c.Position.Y-center.Y, c.Position.X-center.X)
+		travelled += math.Remainder(next-angle, 2*math.Pi)
+		angle = next
+		if travelled >= 2*math.Pi {
+			travelled -= 2 * math.Pi
+			times = append(times, tick-lapStart)
+			lapStart = tick
+		}
+	}
+	return times
+}
+
+// TestTireWearSlowsLaps checks that with wear enabled every flying lap of a stint is
+// slower than the one before, and that the default (wear off) car keeps a steady pace.
+func TestTireWearSlowsLaps(t *testing.T) {
+	grid := openGrid(1000)
+	center := common.Vec2{X: 500, Y: 500}
+	const radius, laps = 300.0, 5
+
+	newCar := func(wear TireWear) *Car {
+		c := NewCar(center.X+radius, center.Y, DefaultCarParams())
+		c.Heading = math.Pi / 2
+		c.Config.TireWear = wear
+		return c
+	}
+
+	fresh := lapTimes(newCar(TireWear{}), grid, center, radius, laps)
+	if len(fresh) != laps {
+		t.Fatalf("completed %d of %d laps without wear", len(fresh), laps)
+	}
+	for i := 2; i < laps; i++ { // Lap 1 includes the standing start; later laps differ only by tick rounding
+		if d := fresh[i] - fresh[1]; d < -1 || d > 1 {
+			t.Errorf("without wear lap %d took %d ticks, lap 2 took %d", i+1, fresh[i], fresh[1])
+		}
+	}
+
+	worn := newCar(TireWear{PerPixel: 2e-5, PerLateral: 5e-4, MinGrip: 0.3})
+	times := lapTimes(worn, grid, center, radius, laps)
+	if len(times) != laps {
+		t.Fatalf("completed %d of %d laps with wear", len(times), laps)
+	}
+	for i := 2; i < laps; i++ {
+		if times[i] <= times[i-1] {
+			t.Errorf("lap times with wear %v: lap %d not slower than lap %d", times, i+1, i)
+		}
+	}
+	if worn.GripFactor() >= 1 {
+		t.Errorf("grip factor %.3f after a stint, want below 1", worn.GripFactor())
+	}
+}
+
+func TestSlipGrowsWithCorneringAndLowGrip(t *testing.T) {
+	maxSlip := func(surface track.CellType, speed, steering float64) float64 {
+		grid := openGrid(2000)
+		for x := range grid.Width {
+			for y := range grid.Height {
+				grid.Set(x, y, track.Cell{Type: surface, Friction: track.SurfaceFriction(surface)})
+			}
+		}
+		c := NewCar(1000, 1000, DefaultCarParams())
+		c.Speed = speed
+		c.Velocity = common.Vec2{X: speed}
+		slip := 0.0
+		for i := 0; i < 100; i++ {
+			throttle := 0.0
+			if c.Speed < speed {
+				throttle = 1
+			}
+			slip = math.Max(slip, c.Update(grid, throttle, 0, steering).Slip)
+		}
+		return slip
+	}
+
+	if s := maxSlip(track.CellTarmac, 8, 0); s > 1e-9 {
+		t.Errorf("straight line slip = %v, want 0", s)
+	}
+	slow, fast := maxSlip(track.CellTarmac, 3, 1), maxSlip(track.CellTarmac, 8, 1)
+	gravel := maxSlip(track.CellGravel, 3, 1)
+	if !(slow > 0 && fast > slow && gravel > slow) {
+		t.Errorf("slip at full lock: slow %.3f, fast %.3f, slow on gravel %.3f; want 0 < slow < fast and slow < gravel", slow, fast, gravel)
+	}
+}
+
+func TestCellSurfaceScalesWithFriction(t *testing.T) {
+	cfg := DefaultCarConfig()
+	tarmac, gravel := cfg.Surface(track.CellTarmac), cfg.Surface(track.CellGravel)
+
+	nominal := []track.Cell{
+		{Type: track.CellTarmac, Friction: track.SurfaceFriction(track.CellTarmac)},
+		{Type: track.CellTarmac}, // Friction not set
+		{Type: track.CellGravel, Friction: track.SurfaceFriction(track.CellGravel)},
+	}
+	for _, cell := range nominal {
+		if got, want := cfg.CellSurface(cell), cfg.Surface(cell.Type); got != want {
+			t.Errorf("CellSurface(%+v) = %+v, want the type's %+v", cell, got, want)
+		}
+	}
+
+	damp := cfg.CellSurface(track.Cell{Type: track.CellTarmac, Friction: 0.7})
+	if math.Abs(damp.LateralGrip-0.7*tarmac.LateralGrip) > 1e-9 || damp.RollingResistance != tarmac.RollingResistance {
+		t.Errorf("damp tarmac = %+v, want 70%% of %+v's grip and the same drag", damp, tarmac)
+	}
+	deep := cfg.CellSurface(track.Cell{Type: track.CellGravel, Friction: 0.2})
+	if deep.LateralGrip >= gravel.LateralGrip || deep.RollingResistance <= gravel.RollingResistance {
+		t.Errorf("deep gravel = %+v, want less grip and more drag than %+v", deep, gravel)
+	}
+}
+
+func TestDampPatchSlipsMore(t *testing.T) {
+	slipOn := func(friction float64) float64 {
+		grid := openGrid(2000)
+		for x := range grid.Width {
+			for y := range grid.Height {
+				c := grid.Get(x, y)
+				c.Friction = friction
+				grid.Set(x, y, c)
+			}
+		}
+		c := NewCar(1000, 1000, DefaultCarParams())
+		c.Speed = 3
+		c.Velocity = common.Vec2{X: 3}
+		slip := 0.0
+		for i := 0; i < 100; i++ {
+			slip = math.Max(slip, c.Update(grid, 0, 0, 1).Slip)
+		}
+		return slip
+	}
+
+	dry, damp := slipOn(1.0), slipOn(0.7)
+	if !(damp > dry) {
+		t.Errorf("slip at full lock: dry %.3f, damp %.3f; want the damp patch to slip more", dry, damp)
+	}
+}
+
+// TestDriftModelSlidesPastTheGripLimit checks that under ModelDrift the car grips while
+// the cornering load is within what the tyres can hold and slides once it isn't, where
+// the arcade model always pulls the car back in line.
+func TestDriftModelSlidesPastTheGripLimit(t *testing.T) {
+	slipAt := func(model PhysicsModel, surface track.CellType, speed float64) (slip float64) {
+		grid := openGrid(3000)
+		for x := range grid.Width {
+			for y := range grid.Height {
+				grid.Set(x, y, track.Cell{Type: surface, Friction: track.SurfaceFriction(surface)})
+			}
+		}
+		c := NewCar(1500, 1500, DefaultCarParams())
+		c.Config.Model = model
+		c.Speed = speed
+		c.Velocity = common.Vec2{X: speed}
+		for i := 0; i < 60; i++ {
+			throttle := 0.0
+			if c.Speed < speed {
+				throttle = 1
+			}
+			step := c.Update(grid, throttle, 0, 1)
+			if step.Crashed {
+				t.Fatalf("%v model crashed on an open grid", model)
+			}
+			slip = math.Max(slip, step.Slip)
+		}
+		return slip
+	}
+
+	if slip := slipAt(ModelDrift, track.CellTarmac, 3); slip > 1e-9 {
+		t.Errorf("drift model at 3 px/tick on tarmac slipped %.3f, want the tyres to hold", slip)
+	}
+	if slip := slipAt(ModelDrift, track.CellGravel, 5); slip < 0.1 {
+		t.Errorf("drift model at 5 px/tick on gravel slipped %.3f, want a slide", slip)
+	}
+	arcade := slipAt(ModelArcade, track.CellTarmac, 8)
+	drift := slipAt(ModelDrift, track.CellTarmac, 8)
+	if drift < 5*arcade || drift < 0.5 {
+		t.Errorf("slip at 8 px/tick and full lock: arcade %.3f, drift %.3f; want the drift car to slide", arcade, drift)
+	}
+
+	// In a straight line the two models accelerate alike
+	c := NewCar(100, 1500, DefaultCarParams())
+	c.Config.Model = ModelDrift
+	a := NewCar(100, 1500, DefaultCarParams())
+	grid := openGrid(3000)
+	for i := 0; i < 100; i++ {
+		c.Update(grid, 1, 0, 0)
+		a.Update(grid, 1, 0, 0)
+	}
+	if d := math.Abs(c.Velocity.Len() - a.Velocity.Len()); d > 0.3 {
+		t.Errorf("straight-line speed after 100 ticks: drift %.2f, arcade %.2f", c.Velocity.Len(), a.Velocity.Len())
+	}
+}
+
+// TestDriftTyreParameters checks the drift model's tyre settings: softer cornering
+// stiffness lets the car run wide even within the grip limit, and a higher grip limit
+// holds a corner the stock tyres slide out of.
+func TestDriftTyreParameters(t *testing.T) {
+	slipWith := func(stiffness, limit, speed float64) (slip float64) {
+		grid := openGrid(3000)
+		c := NewCar(1500, 1500, DefaultCarParams())
+		c.Config.Model = ModelDrift
+		c.Config.CorneringStiffness, c.Config.GripLimit = stiffness, limit
+		c.Speed = speed
+		c.Velocity = common.Vec2{X: speed}
+		for i := 0; i < 60; i++ {
+			throttle := 0.0
+			if c.Speed < speed {
+				throttle = 1
+			}
+			slip = math.Max(slip, c.Update(grid, throttle, 0, 1).Slip)
+		}
+		return slip
+	}
+
+	if slip := slipWith(DriftCorneringStiffness, DriftGripLimit, 3); slip > 1e-9 {
+		t.Errorf("stock tyres at 3 px/tick slipped %.3f, want them to hold", slip)
+	}
+	if slip := slipWith(0.5, DriftGripLimit, 3); slip < 0.05 {
+		t.Errorf("half cornering stiffness at 3 px/tick slipped %.3f, want the car to run wide", slip)
+	}
+	stock, grippy := slipWith(DriftCorneringStiffness, DriftGripLimit, 8), slipWith(DriftCorneringStiffness, 2*DriftGripLimit, 8)
+	if grippy >= stock/2 {
+		t.Errorf("slip at 8 px/tick: stock limit %.3f, doubled limit %.3f; want the grippier tyres to hold far better", stock, grippy)
+	}
+}
+
+// TestWallBounce checks that a glancing touch of a wall bounces the car off it, keeping
+// its speed along the wall, while hitting it head on (or with bouncing off) crashes.
+func TestWallBounce(t *testing.T) {
+	// Open track above y = 200, wall below
+	grid := openGrid(400)
+	for x := range grid.Width {
+		for y := 200; y < 400; y++ {
+			grid.Set(x, y, track.Cell{Type: track.CellWall})
+		}
+	}
+	drive := func(c *Car, heading float64) (StepInfo, bool) {
+		c.Heading = heading
+		c.Speed = 6
+		c.Velocity = common.Vec2{X: 6 * math.Cos(heading), Y: 6 * math.Sin(heading)}
+		for i := 0; i < 200; i++ {
+			if step := c.Update(grid, 0, 0, 0); step.Crashed || step.Bounced {
+				return step, true
+			}
+		}
+		return StepInfo{}, false
+	}
+
+	for _, model := range []PhysicsModel{ModelArcade, ModelDrift} {
+		c := NewCar(100, 180, DefaultCarParams())
+		c.Config.Model = model
+		step, hit := drive(c, 0.15)
+		if !hit || !step.Bounced || c.Crashed {
+			t.Errorf("%v: glancing hit gave %+v (crashed %v), want a bounce", model, step, c.Crashed)
+			continue
+		}
+		if c.Velocity.Y >= 0 || c.Velocity.X < 4 {
+			t.Errorf("%v: velocity after the bounce %+v, want away from the wall and still along it", model, c.Velocity)
+		}
+		if _, in := c.contact(grid, c.Position); in >= 0 {
+			t.Errorf("%v: car left in the wall at %+v", model, c.Position)
+		}
+	}
+
+	c := NewCar(100, 180, DefaultCarParams())
+	if step, hit := drive(c, math.Pi/2); !hit || !step.Crashed || !c.Crashed {
+		t.Errorf("head-on hit gave %+v, want a crash", step)
+	}
+
+	c = NewCar(100, 180, DefaultCarParams())
+	c.Config.CrashSpeedThreshold = 0
+	if step, hit := drive(c, 0.15); !hit || !step.Crashed {
+		t.Errorf("glancing hit without bouncing gave %+v, want a crash", step)
+	}
+}
+
+// TestThinWallStopsFastCar drives flat out at a wall one cell thick, thinner than the car
+// moves per tick, which checking only where each move ends would jump straight over.
+func TestThinWallStopsFastCar(t *testing.T) {
+	grid := openGrid(400)
+	for y := range grid.Height {
+		grid.Set(200, y, track.Cell{Type: track.CellWall})
+	}
+
+	for _, model := range []PhysicsModel{ModelArcade, ModelDrift} {
+		c := NewCar(151, 200, DefaultCarParams())
+		c.Config.Model = model
+		c.Speed = c.Params.MaxSpeed
+		c.Velocity = common.Vec2{X: c.Params.MaxSpeed}
+		for i := 0; i < 20 && !c.Crashed; i++ {
+			c.Update(grid, 1, 0, 0)
+		}
+		front := c.Position.X + c.Length/2
+		if !c.Crashed || front >= 200 || front < 199 {
+			t.Errorf("%v: crashed %v with the front at x = %.2f, want a crash just short of the wall at 200", model, c.Crashed, front)
+		}
+	}
+}
+
+func TestSteerToward(t *testing.T) {
+	c := NewCar(100, 100, DefaultCarParams()) // Heading east; screen Y is down, so left of travel is -Y
+	for _, tc := range []struct {
+		name   string
+		target common.Vec2
+		want   float64
+	}{
+		{"ahead", common.Vec2{X: 200, Y: 100}, 0},
+		{"left", common.Vec2{X: 110, Y: 90}, -1},
+		{"right", common.Vec2{X: 110, Y: 110}, 1},
+		{"slightly right", common.Vec2{X: 200, Y: 102}, math.Atan2(2, 100) / c.Params.TurnSpeed},
+		{"behind left", common.Vec2{X: 0, Y: 99}, -1},
+		{"on the car", common.Vec2{X: 100, Y: 100}, 0},
+	} {
+		if got := SteerToward(c, tc.target); math.Abs(got-tc.want) > 1e-12 {
+			t.Errorf("%s: steer %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if got := SteerToward(c, common.Vec2{X: 0, Y: 100}); math.Abs(got) != 1 {
+		t.Errorf("dead astern: steer %v, want full lock", got)
+	}
+
+	// Across the +-Pi seam: heading just south of west, target just north of it
+	c.Heading = math.Pi - 0.01
+	if got, want := SteerToward(c, common.Vec2{X: 0, Y: 100 - 100*math.Tan(0.01)}), 0.02/c.Params.TurnSpeed; math.Abs(got-want) > 1e-9 {
+		t.Errorf("across the seam: steer %v, want %v (the short way, right)", got, want)
+	}
+
+	// Steering as told does turn the car toward the target
+	c = NewCar(100, 100, DefaultCarParams())
+	c.Speed = 2
+	target := common.Vec2{X: 300, Y: 0}
+	grid := openGrid(400)
+	for i := 0; i < 40; i++ {
+		c.Update(grid, 0.3, 0, SteerToward(c, target))
+	}
+	to := target.Sub(c.Position)
+	if miss := math.Abs(math.Remainder(math.Atan2(to.Y, to.X)-c.Heading, 2*math.Pi)); miss > c.Params.TurnSpeed {
+		t.Errorf("after steering toward the target, still %.2f rad off it", miss)
+	}
+}
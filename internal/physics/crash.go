@@ -0,0 +1,65 @@
+package physics
+
+import (
+	"fmt"
+	"math"
+	"racing-line-mapper/internal/common"
+	"racing-line-mapper/internal/track"
+)
+
+// CornerNames labels the chassis corners in the order Update checks them.
+var CornerNames = [4]string{"FR", "FL", "RR", "RL"}
+
+// CrashInfo records what the car hit and how.
+// Position/Speed/Heading/Corner are captured by Update at impact;
+// the track-relative fields are filled in by Locate.
+type CrashInfo struct {
+	Position common.Vec2 // World position of the corner that touched the wall
+	Speed    float64     // Speed at impact
+	Heading  float64     // Car heading at impact (radians)
+	Corner   string      // Which chassis corner hit (FR, FL, RR, RL)
+
+	// Track-relative (see Locate)
+	WaypointIdx int
+	D           float64 // Lateral offset of the impact point (positive = right of center)
+	RelHeading  float64 // Car heading minus track heading (radians, -Pi..Pi)
+}
+
+// Locate fills in the track-relative fields of the crash using the mesh.
+// hintIdx is the car's last known waypoint (see GetClosestWaypointNear).
+// The sign of D tells which side of the track was hit.
+func (ci *CrashInfo) Locate(mesh *track.TrackMesh, hintIdx int) {
+	wp, idx := mesh.GetClosestWaypointNear(ci.Position, hintIdx)
+	ci.WaypointIdx = idx
+	if idx < 0 {
+		return
+	}
+
+	dx := ci.Position.X - wp.Position.X
+	dy := ci.Position.Y - wp.Position.Y
+	ci.D = dx*wp.Normal.X + dy*wp.Normal.Y
+
+	// Tangent is Normal rotated -90 deg
+	trackHeading := math.Atan2(-wp.Normal.X, wp.Normal.Y)
+	rel := ci.Heading - trackHeading
+	for rel > math.Pi {
+		rel -= 2 * math.Pi
+	}
+	for rel < -math.Pi {
+		rel += 2 * math.Pi
+	}
+	ci.RelHeading = rel
+}
+
+// Side returns which track edge was hit, relative to the direction of travel.
+func (ci *CrashInfo) Side() string {
+	if ci.D < 0 {
+		return "Left"
+	}
+	return "Right"
+}
+
+func (ci *CrashInfo) String() string {
+	return fmt.Sprintf("%s wall @ wp %d (%.0f, %.0f) | %s corner | speed %.2f | rel hdg %.0f deg | d %.1f",
+		ci.Side(), ci.WaypointIdx, ci.Position.X, ci.Position.Y, ci.Corner, ci.Speed, ci.RelHeading*180/math.Pi, ci.D)
+}
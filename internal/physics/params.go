@@ -0,0 +1,98 @@
+package physics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// CarParams is the performance of a vehicle: how fast it goes, speeds up, slows down and
+// turns, and how much grip its downforce adds at speed. Each Car carries its own, so
+// e.g. a nimble kart and a heavy GT car can be driven on the same track, and tuned from
+// a file (see LoadCarParams) rather than by recompiling.
+type CarParams struct {
+	MaxSpeed     float64 `json:"max_speed"`    // Pixels per tick (approx)
+	Acceleration float64 `json:"acceleration"` // Speed gained per tick at full throttle (pixels/tick^2)
+	Braking      float64 `json:"braking"`      // Speed lost per tick at full brake (pixels/tick^2)
+	Friction     float64 `json:"friction"`     // Air resistance / Rolling resistance, speed lost per tick
+	TurnSpeed    float64 `json:"turn_speed"`   // Radians per tick at full lock
+
+	// Downforce is the grip the car gains per pixel/tick of speed, on top of the surface's
+	// (see Grip), up to DownforceCap: fast corners hold better than their speed alone
+	// suggests, so carrying speed pays. 0 makes grip the same at any speed.
+	Downforce    float64 `json:"downforce"`
+	DownforceCap float64 `json:"downforce_cap"` // Speed (pixels/tick) past which downforce stops growing
+}
+
+// DefaultCarParams returns the stock car.
+func DefaultCarParams() CarParams {
+	return CarParams{
+		MaxSpeed:     10.0,
+		Acceleration: 0.2,
+		Braking:      0.4,
+		Friction:     0.05,
+		TurnSpeed:    0.05,
+		Downforce:    0.005,
+		DownforceCap: 8.0,
+	}
+}
+
+// Deceleration is the speed the car loses per tick under full braking, drag included.
+func (p CarParams) Deceleration() float64 {
+	return p.Braking + p.Friction
+}
+
+// Grip is the grip the car has at the given speed on a surface gripping base at rest:
+// base + Downforce*min(|speed|, DownforceCap), at most 1 (on rails). The bonus is the
+// same on any surface, so gravel still grips far less than tarmac.
+func (p CarParams) Grip(base, speed float64) float64 {
+	return math.Min(1, base+p.Downforce*math.Min(math.Abs(speed), p.DownforceCap))
+}
+
+// LoadCarParams reads a vehicle from a JSON file at path, e.g.
+//
+//	{"max_speed": 7, "acceleration": 0.3, "turn_speed": 0.08}
+//
+// Anything the file leaves out keeps its default (see DefaultCarParams).
+func LoadCarParams(path string) (CarParams, error) {
+	p := DefaultCarParams()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return p, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Validate reports a vehicle that can't drive: one that can't move, speed up, stop or
+// turn, or whose drag or downforce is negative.
+func (p CarParams) Validate() error {
+	var errs []error
+	for _, v := range []struct {
+		name  string
+		value float64
+	}{
+		{"max_speed", p.MaxSpeed},
+		{"acceleration", p.Acceleration},
+		{"braking", p.Braking},
+		{"turn_speed", p.TurnSpeed},
+	} {
+		if v.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s %v is not positive", v.name, v.value))
+		}
+	}
+	if p.Friction < 0 {
+		errs = append(errs, fmt.Errorf("friction %v is negative", p.Friction))
+	}
+	if p.Downforce < 0 || p.DownforceCap < 0 {
+		errs = append(errs, fmt.Errorf("downforce %v (cap %v) is negative", p.Downforce, p.DownforceCap))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,97 @@
+package physics
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"racing-line-mapper/internal/track"
+	"testing"
+)
+
+// TestLoadCarParams checks a partial file overrides only what it sets, and that a
+// vehicle that can't drive is refused.
+func TestLoadCarParams(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	p, err := LoadCarParams(write("kart.json", `{"max_speed": 7, "turn_speed": 0.08}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultCarParams()
+	want.MaxSpeed, want.TurnSpeed = 7, 0.08
+	if p != want {
+		t.Errorf("loaded %+v\nwant   %+v", p, want)
+	}
+
+	for name, data := range map[string]string{
+		"speed.json":    `{"max_speed": 0}`,
+		"brakes.json":   `{"braking": -1}`,
+		"friction.json": `{"friction": -0.1}`,
+		"json.json":     `{"max_speed": "fast"}`,
+	} {
+		if _, err := LoadCarParams(write(name, data)); err == nil {
+			t.Errorf("%s: %s loaded without an error", name, data)
+		}
+	}
+}
+
+// TestCarParamsSetPerformance checks the car drives with its own parameters: a kart
+// with a lower top speed but more acceleration gets going sooner and tops out lower.
+func TestCarParamsSetPerformance(t *testing.T) {
+	kart := DefaultCarParams()
+	kart.MaxSpeed, kart.Acceleration = 6, 0.4
+
+	grid := openGrid(3000)
+	stock, k := NewCar(100, 1500, DefaultCarParams()), NewCar(100, 1500, kart)
+	for i := 0; i < 10; i++ {
+		stock.Update(grid, 1, 0, 0)
+		k.Update(grid, 1, 0, 0)
+	}
+	if !(k.Speed > stock.Speed) {
+		t.Errorf("after 10 ticks of throttle: kart %.2f, stock %.2f px/tick; want the kart ahead", k.Speed, stock.Speed)
+	}
+	for i := 0; i < 200; i++ {
+		stock.Update(grid, 1, 0, 0)
+		k.Update(grid, 1, 0, 0)
+	}
+	if k.Speed != kart.MaxSpeed || stock.Speed != DefaultCarParams().MaxSpeed {
+		t.Errorf("top speeds: kart %.2f, stock %.2f; want %v and %v", k.Speed, stock.Speed, kart.MaxSpeed, DefaultCarParams().MaxSpeed)
+	}
+}
+
+// TestDownforceGrip checks grip rises with speed up to the cap and no further, and that
+// gravel at top speed still grips less than tarmac at rest.
+func TestDownforceGrip(t *testing.T) {
+	p := DefaultCarParams()
+	tarmac := DefaultCarConfig().Surface(track.CellTarmac).LateralGrip
+	gravel := DefaultCarConfig().Surface(track.CellGravel).LateralGrip
+
+	if got := p.Grip(tarmac, 0); got != tarmac {
+		t.Errorf("tarmac grip at rest %v, want the surface's %v", got, tarmac)
+	}
+	fast := p.Grip(tarmac, p.MaxSpeed)
+	if want := math.Min(1, tarmac+p.Downforce*p.DownforceCap); math.Abs(fast-want) > 1e-12 {
+		t.Errorf("tarmac grip at top speed %v, want %v", fast, want)
+	}
+	if !(fast > tarmac) || fast > 1 {
+		t.Errorf("tarmac grip at top speed %v, want more than at rest (%v) and at most 1", fast, tarmac)
+	}
+	if got := p.Grip(tarmac, -p.MaxSpeed); got != fast {
+		t.Errorf("grip reversing at top speed %v, want %v as going forward", got, fast)
+	}
+	if got := p.Grip(gravel, p.MaxSpeed); !(got > gravel) || got >= tarmac {
+		t.Errorf("gravel grip at top speed %v, want above its %v at rest but below tarmac's %v", got, gravel, tarmac)
+	}
+
+	p.Downforce = 0
+	if got := p.Grip(tarmac, p.MaxSpeed); got != tarmac {
+		t.Errorf("without downforce, grip at top speed %v, want %v", got, tarmac)
+	}
+}
@@ -0,0 +1,141 @@
+package track
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+)
+
+// ReferenceBin is the length of centerline (pixels) a ReferenceLine averages its offset over.
+const ReferenceBin = 4.0
+
+// ReferenceLine is a racing line (e.g. the best lap) as its lateral offset d from the
+// centerline against centerline arc length s. Another path is compared with it at the
+// same point along the track, not at the same time or sample index, so a lap that is
+// slower in places still lines up with it.
+type ReferenceLine struct {
+	Offsets []float64 // Mean d per ReferenceBin of s; bins the line skipped are interpolated
+	Looped  bool      // s wraps around (the mesh is a loop)
+}
+
+// NewReferenceLine projects the polyline points onto the mesh's centerline. It returns
+// nil if there's nothing to compare with (fewer than two points or an empty mesh).
+func NewReferenceLine(mesh *TrackMesh, points []common.Vec2) *ReferenceLine {
+	bins := int(math.Ceil(mesh.TotalLen / ReferenceBin))
+	if len(points) < 2 || len(mesh.Waypoints) == 0 || bins == 0 {
+		return nil
+	}
+
+	sum := make([]float64, bins)
+	count := make([]int, bins)
+	hint := -1
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		steps := max(1, int(math.Ceil(b.Sub(a).Len()))) // About one sample per pixel
+		for k := 0; k < steps; k++ {
+			p := a.Add(b.Sub(a).Scale(float64(k) / float64(steps)))
+			wp, idx := mesh.GetClosestWaypointNear(p, hint)
+			hint = idx
+			s, d := mesh.frenetFrom(wp, p)
+			bin := min(max(int(s/ReferenceBin), 0), bins-1)
+			sum[bin] += d
+			count[bin]++
+		}
+	}
+
+	r := &ReferenceLine{Offsets: make([]float64, bins), Looped: mesh.Looped}
+	var filled []int
+	for i := range sum {
+		if count[i] > 0 {
+			r.Offsets[i] = sum[i] / float64(count[i])
+			filled = append(filled, i)
+		}
+	}
+	r.fillGaps(filled)
+	return r
+}
+
+// fillGaps interpolates the offsets of the bins between the filled ones, wrapping
+// around a loop; past the ends of an open line the nearest filled bin is held.
+func (r *ReferenceLine) fillGaps(filled []int) {
+	n := len(r.Offsets)
+	for k, from := range filled {
+		to, span := 0, 0
+		switch {
+		case k+1 < len(filled):
+			to = filled[k+1]
+			span = to - from
+		case r.Looped:
+			to = filled[0]
+			span = to + n - from
+		default:
+			for i := from + 1; i < n; i++ {
+				r.Offsets[i] = r.Offsets[from]
+			}
+			continue
+		}
+		for j := 1; j < span; j++ {
+			t := float64(j) / float64(span)
+			r.Offsets[wrapIndex(from+j, n, r.Looped)] = r.Offsets[from] + (r.Offsets[to]-r.Offsets[from])*t
+		}
+	}
+	if !r.Looped && len(filled) > 0 {
+		for i := 0; i < filled[0]; i++ {
+			r.Offsets[i] = r.Offsets[filled[0]]
+		}
+	}
+}
+
+// Offset is the line's lateral offset at arc length s, interpolated between bin centers.
+func (r *ReferenceLine) Offset(s float64) float64 {
+	n := len(r.Offsets)
+	x := s/ReferenceBin - 0.5 // In bins, from the first bin's center
+	i := int(math.Floor(x))
+	t := x - float64(i)
+	if r.Looped {
+		i = wrapIndex(i, n, true)
+		return r.Offsets[i] + (r.Offsets[wrapIndex(i+1, n, true)]-r.Offsets[i])*t
+	}
+	if i < 0 {
+		return r.Offsets[0]
+	}
+	if i >= n-1 {
+		return r.Offsets[n-1]
+	}
+	return r.Offsets[i] + (r.Offsets[i+1]-r.Offsets[i])*t
+}
+
+// Deviation is how far (pixels, across the track) the Frenet point (s, d) is from the line.
+func (r *ReferenceLine) Deviation(s, d float64) float64 {
+	return math.Abs(d - r.Offset(s))
+}
+
+// Adherence aggregates the deviations of a path's points from a reference line
+// (see ReferenceLine.Deviation): how consistently a lap follows it.
+type Adherence struct {
+	Count int
+	Sum   float64 // Of the deviations
+	SumSq float64 // Of their squares
+}
+
+// Add records one point's deviation.
+func (a *Adherence) Add(dev float64) {
+	a.Count++
+	a.Sum += dev
+	a.SumSq += dev * dev
+}
+
+// Mean is the mean deviation (pixels), 0 before any points.
+func (a Adherence) Mean() float64 {
+	if a.Count == 0 {
+		return 0
+	}
+	return a.Sum / float64(a.Count)
+}
+
+// RMS is the root-mean-square deviation (pixels), which weighs the big excursions more.
+func (a Adherence) RMS() float64 {
+	if a.Count == 0 {
+		return 0
+	}
+	return math.Sqrt(a.SumSq / float64(a.Count))
+}
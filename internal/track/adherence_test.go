@@ -0,0 +1,62 @@
+package track
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+	"testing"
+)
+
+// TestReferenceLineAdherence builds a weaving reference line from sparse points around a
+// loop and scores laps against it: the line itself, and the line shifted 3px across the
+// track, sampled at a different spacing (as a slower or faster lap would be).
+func TestReferenceLineAdherence(t *testing.T) {
+	m := circleMesh(300, 300)
+	weave := func(s float64) float64 { return 8 * math.Sin(4*math.Pi*s/m.TotalLen) }
+	lap := func(step, shift float64) []common.Vec2 {
+		var pts []common.Vec2
+		for s := 0.0; s <= m.TotalLen; s += step {
+			pts = append(pts, m.FrenetToWorld(s, weave(s)+shift))
+		}
+		return pts
+	}
+
+	ref := NewReferenceLine(m, lap(25, 0))
+	if ref == nil {
+		t.Fatal("no reference line")
+	}
+	for s := 0.0; s < m.TotalLen; s += 7 {
+		if got, want := ref.Offset(s), weave(s); math.Abs(got-want) > 0.5 {
+			t.Errorf("offset at s=%.0f is %.2f, want %.2f", s, got, want)
+		}
+	}
+
+	score := func(points []common.Vec2) Adherence {
+		var a Adherence
+		for _, p := range points {
+			a.Add(ref.Deviation(m.WorldToFrenet(p)))
+		}
+		return a
+	}
+	if a := score(lap(9, 0)); a.Mean() > 0.3 || a.RMS() > 0.4 {
+		t.Errorf("the line itself: mean %.2f, RMS %.2f; want about 0", a.Mean(), a.RMS())
+	}
+	if a := score(lap(13, 3)); math.Abs(a.Mean()-3) > 0.3 || math.Abs(a.RMS()-3) > 0.3 {
+		t.Errorf("shifted 3px: mean %.2f, RMS %.2f; want about 3", a.Mean(), a.RMS())
+	}
+
+	if NewReferenceLine(m, lap(25, 0)[:1]) != nil {
+		t.Error("a single point made a reference line")
+	}
+}
+
+func TestAdherenceStats(t *testing.T) {
+	var a Adherence
+	if a.Mean() != 0 || a.RMS() != 0 {
+		t.Errorf("empty: mean %v, RMS %v; want 0", a.Mean(), a.RMS())
+	}
+	a.Add(3)
+	a.Add(4)
+	if a.Mean() != 3.5 || a.RMS() != math.Sqrt(12.5) {
+		t.Errorf("mean %v, RMS %v; want 3.5, %v", a.Mean(), a.RMS(), math.Sqrt(12.5))
+	}
+}
@@ -0,0 +1,146 @@
+package track
+
+import "math"
+
+// TargetSpeeds returns, per waypoint, the fastest speed (pixels per tick) the car
+// can take it at: turning at curvature k and speed v needs a heading change of
+// v*|k| per tick, so with at most maxYawRate per tick, v = maxYawRate/|k|,
+// capped at maxSpeed. Through a corner the car needn't follow the centerline, so k
+// there is that of the widest line the corner's width allows (see LineRadius) where
+// that is gentler. Requires ComputeCurvature and ComputePhases.
+func (m *TrackMesh) TargetSpeeds(maxYawRate, maxSpeed float64) []float64 {
+	curvature := make([]float64, len(m.Waypoints))
+	for i, wp := range m.Waypoints {
+		curvature[i] = math.Abs(wp.Curvature)
+	}
+	for _, apex := range m.Apexes(ApexMinCurvature, ApexNMSWindow) {
+		lineK := 1 / m.LineRadius(apex)
+		first, last := m.cornerExtent(apex)
+		for i := first; ; i = m.Next(i) {
+			curvature[i] = math.Min(curvature[i], lineK)
+			if i == last {
+				break
+			}
+		}
+	}
+
+	speeds := make([]float64, len(m.Waypoints))
+	for i, k := range curvature {
+		speeds[i] = maxSpeed
+		if k > 0 {
+			speeds[i] = math.Min(maxSpeed, maxYawRate/k)
+		}
+	}
+	return speeds
+}
+
+// LineRadius estimates the radius of the widest line through the corner at apex: in from
+// the outside edge, touching the inside edge at the apex, and back out to the outside edge.
+// For a constant-radius corner of centerline radius R, width w and total heading change
+// theta, that is (R - w/2) + w/(1 - cos(theta/2)): a kink can be taken almost straight,
+// while a hairpin (theta = 180 deg) only allows its outside edge. R is taken at the apex,
+// theta is the turning summed over the corner's phases and w is its narrowest width. The
+// inside edge is measured at the apex (see Waypoint.Sides), so w/2 there becomes the
+// distance to it where the centerline sits off the middle of the track.
+// Requires ComputeCurvature and ComputePhases.
+func (m *TrackMesh) LineRadius(apex int) float64 {
+	k := math.Abs(m.Waypoints[apex].Curvature)
+	if k == 0 {
+		return math.Inf(1)
+	}
+	radius := 1 / k
+
+	theta, width := 0.0, math.Inf(1)
+	first, last := m.cornerExtent(apex)
+	for i := first; ; i = m.Next(i) {
+		wp := m.Waypoints[i]
+		theta += math.Abs(wp.Curvature) * m.At(m.Next(i)).Position.Sub(wp.Position).Len()
+		left, right := wp.Sides()
+		width = math.Min(width, left+right)
+		if i == last {
+			break
+		}
+	}
+	theta = math.Min(theta, 2*math.Pi)
+	if theta == 0 {
+		return math.Inf(1)
+	}
+
+	left, right := m.Waypoints[apex].Sides()
+	inside := right // Positive curvature turns towards the normal, on the right
+	if m.Waypoints[apex].Curvature < 0 {
+		inside = left
+	}
+	inner := math.Max(radius-inside, 0)
+	return math.Max(radius, inner+width/(1-math.Cos(theta/2)))
+}
+
+// cornerExtent returns the first and last waypoint of the corner around apex:
+// the turn-in run before it and the exit run after it (see ComputePhases).
+func (m *TrackMesh) cornerExtent(apex int) (first, last int) {
+	n := len(m.Waypoints)
+	first, last = apex, apex
+	for steps := 0; steps < n && m.Prev(first) != first && m.Waypoints[m.Prev(first)].Phase == PhaseTurnIn; steps++ {
+		first = m.Prev(first)
+	}
+	for steps := 0; steps < n && m.Next(last) != last && m.Waypoints[m.Next(last)].Phase == PhaseExit; steps++ {
+		last = m.Next(last)
+	}
+	return first, last
+}
+
+// BrakePoint is the latest point before a corner where full braking must begin.
+type BrakePoint struct {
+	WaypointIdx int     // Where to start braking
+	ApexIdx     int     // Corner being braked for
+	EntrySpeed  float64 // Speed at the brake point (the straight-line speed, unless the run-up is too short)
+	ApexSpeed   float64 // Target speed at the apex
+	Distance    float64 // Braking distance, pixels along the centerline
+}
+
+// BrakePoints finds the brake point for each apex: integrating backward from the apex
+// at constant deceleration decel (pixels per tick per tick), v^2 = v_apex^2 + 2*decel*dist,
+// until the allowed speed reaches straightSpeed. Apexes whose target speed is already
+// straightSpeed need no braking and are skipped. If the previous apex is reached first,
+// braking starts right after it (the corners are linked).
+func (m *TrackMesh) BrakePoints(apexes []int, targets []float64, decel, straightSpeed float64) []BrakePoint {
+	n := len(m.Waypoints)
+	if n < 2 || decel <= 0 {
+		return nil
+	}
+
+	var points []BrakePoint
+	for k, apex := range apexes {
+		vApex := targets[apex]
+		if vApex >= straightSpeed {
+			continue
+		}
+
+		// The walk back stops at the previous apex (wrapping around the loop),
+		// or at the start of an open track
+		prevApex := apexes[wrapIndex(k-1, len(apexes), m.Looped)] // Itself for an open track's first
+		limit := wrapIndex(apex-prevApex, n, m.Looped)            // Waypoints back to it
+		switch {
+		case !m.Looped && prevApex >= apex:
+			limit = apex + 1
+		case limit == 0:
+			limit = n - 1 // Single corner on the track
+		}
+
+		bp := BrakePoint{WaypointIdx: apex, ApexIdx: apex, EntrySpeed: vApex, ApexSpeed: vApex}
+		dist := 0.0
+		for step := 1; step < limit; step++ {
+			i := m.Index(apex - step)
+			dist += m.At(m.Next(i)).Position.Sub(m.Waypoints[i].Position).Len()
+
+			v := math.Sqrt(vApex*vApex + 2*decel*dist)
+			bp.WaypointIdx, bp.Distance = i, dist
+			bp.EntrySpeed = math.Min(v, straightSpeed)
+			if v >= straightSpeed {
+				break
+			}
+		}
+		points = append(points, bp)
+	}
+	return points
+}
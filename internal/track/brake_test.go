@@ -0,0 +1,112 @@
+package track
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+	"testing"
+)
+
+func TestBrakePoints(t *testing.T) {
+	// Waypoints 5px apart along x; only the target speeds matter here
+	var wps []Waypoint
+	for i := 0; i < 200; i++ {
+		wps = append(wps, Waypoint{ID: i, Position: common.Vec2{X: float64(i) * 5}, Width: 40})
+	}
+	m := &TrackMesh{Waypoints: wps, TotalLen: 1000, Looped: true}
+
+	targets := make([]float64, len(wps))
+	for i := range targets {
+		targets[i] = 10
+	}
+	targets[150] = 4 // Slow corner after a long straight
+	targets[100] = 6 // Linked pair: 110 comes too soon after 100 to reach straight speed
+	targets[110] = 2
+
+	const decel = 0.45
+	got := m.BrakePoints([]int{20, 100, 110, 150}, targets, decel, 10)
+
+	if len(got) != 3 {
+		t.Fatalf("got %d brake points, want 3 (apex 20 is flat out): %+v", len(got), got)
+	}
+
+	// 150: v^2 = 16 + 0.9*d reaches 100 after d = 93.3px, i.e. 19 steps of 5px
+	bp := got[2]
+	if bp.ApexIdx != 150 || bp.WaypointIdx != 131 || bp.Distance != 95 {
+		t.Errorf("apex 150: brake at wp %d after %.1fpx, want wp 131 after 95px", bp.WaypointIdx, bp.Distance)
+	}
+	if want := math.Min(10, math.Sqrt(16+2*decel*95)); bp.EntrySpeed != want {
+		t.Errorf("apex 150: entry speed %.3f, want %.3f", bp.EntrySpeed, want)
+	}
+
+	// 110: can't reach straight speed within 10 waypoints, so braking starts right after apex 100
+	bp = got[1]
+	if bp.ApexIdx != 110 || bp.WaypointIdx != 101 || bp.EntrySpeed >= 10 {
+		t.Errorf("apex 110: %+v, want braking from wp 101 below straight speed", bp)
+	}
+}
+
+// cornerMesh is an open track: a straight along +x, a 90 degree right-hander of
+// centerline radius r, and a straight along +y, with waypoints about 5px apart.
+func cornerMesh(r, width float64) *TrackMesh {
+	m := &TrackMesh{}
+	add := func(x, y float64) {
+		m.Waypoints = append(m.Waypoints, Waypoint{ID: len(m.Waypoints), Position: common.Vec2{X: x, Y: y}, Width: width})
+	}
+	for x := -200.0; x < 0; x += 5 {
+		add(x, 0)
+	}
+	steps := int(math.Round(math.Pi / 2 * r / 5))
+	for k := 0; k < steps; k++ {
+		a := math.Pi / 2 * float64(k) / float64(steps)
+		add(r*math.Sin(a), r-r*math.Cos(a))
+	}
+	for y := r; y < r+200; y += 5 {
+		add(r, y)
+	}
+	m.ComputeDistances()
+	m.ComputeCurvature()
+	m.ComputePhases()
+	return m
+}
+
+func TestLineRadiusUsesTheWidth(t *testing.T) {
+	const r = 50.0
+	var speeds []float64
+	for _, w := range []float64{20, 40} {
+		m := cornerMesh(r, w)
+		apexes := m.Apexes(ApexMinCurvature, ApexNMSWindow)
+		if len(apexes) != 1 {
+			t.Fatalf("width %v: %d apexes, want 1", w, len(apexes))
+		}
+		apex := apexes[0]
+
+		// The smoothed apex curvature is close to 1/r, so the line should be close to
+		// the constant-radius estimate for a 90 degree corner
+		want := r - w/2 + w/(1-math.Cos(math.Pi/4))
+		if got := m.LineRadius(apex); math.Abs(got-want) > 0.15*want {
+			t.Errorf("width %v: line radius %.1f, want about %.1f", w, got, want)
+		}
+		speeds = append(speeds, m.TargetSpeeds(0.05, 100)[apex])
+	}
+	if speeds[1] <= speeds[0] {
+		t.Errorf("apex target speed %.2f on the wide track, %.2f on the narrow one; want faster when wider", speeds[1], speeds[0])
+	}
+}
+
+// TestLineRadiusUsesTheInsideEdge moves the inside edge of the corner towards the
+// centerline: the same width then leaves a larger-radius line.
+func TestLineRadiusUsesTheInsideEdge(t *testing.T) {
+	const r, w = 50.0, 40.0
+	var radii []float64
+	for _, inside := range []float64{w / 2, 5} {
+		m := cornerMesh(r, w)
+		for i := range m.Waypoints {
+			m.Waypoints[i].WallLeft, m.Waypoints[i].WallRight = w-inside, inside // A right-hander
+		}
+		apex := m.Apexes(ApexMinCurvature, ApexNMSWindow)[0]
+		radii = append(radii, m.LineRadius(apex))
+	}
+	if got, want := radii[1]-radii[0], w/2-5; math.Abs(got-want) > 1e-9 {
+		t.Errorf("line radius grew by %.2f with the inside edge %.0fpx nearer, want by %.0f", got, want, want)
+	}
+}
@@ -0,0 +1,62 @@
+package track
+
+import (
+	"encoding/gob"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+)
+
+// MeshCacheVersion is part of every mesh cache key; bump it when mesh generation changes
+// so meshes cached by older code are regenerated instead of reused.
+const MeshCacheVersion = 9
+
+// meshCacheKey identifies a generated mesh by everything it's generated from: the grid
+// (see Grid.Hash), the seed point and heading, and the spacing.
+func meshCacheKey(grid *Grid, startX, startY int, heading float64, sp Spacing) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "v%d %s %d %d %x %#v", MeshCacheVersion, grid.Hash(), startX, startY, heading, sp)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// meshCachePath is where the mesh with the given key is stored in the cache directory dir.
+func meshCachePath(dir, key string) string {
+	return filepath.Join(dir, key+".mesh.gob")
+}
+
+// loadCachedMesh reads the mesh with the given key from the cache directory dir.
+// A missing or unreadable entry is just a miss, as is every key without a directory.
+func loadCachedMesh(dir, key string) (*TrackMesh, bool) {
+	if dir == "" {
+		return nil, false
+	}
+	f, err := os.Open(meshCachePath(dir, key))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	var mesh TrackMesh
+	if err := gob.NewDecoder(f).Decode(&mesh); err != nil || len(mesh.Waypoints) == 0 {
+		return nil, false
+	}
+	return &mesh, true
+}
+
+// storeCachedMesh writes the mesh under the given key to the cache directory dir, creating it if needed.
+func storeCachedMesh(dir, key string, mesh *TrackMesh) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(meshCachePath(dir, key))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := gob.NewEncoder(f).Encode(mesh); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,100 @@
+package track
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGridHash(t *testing.T) {
+	g := NewGrid(3, 2)
+	g.Set(1, 0, Cell{Type: CellTarmac})
+	g.Set(2, 1, Cell{Type: CellStart})
+	// Pinned: the hash must not change between runs, platforms or releases
+	if got, want := g.Hash(), "fe153aa6223db51c"; got != want {
+		t.Errorf("hash %s, want %s", got, want)
+	}
+
+	h := NewGrid(3, 2)
+	h.Set(1, 0, Cell{Type: CellTarmac})
+	h.Set(2, 1, Cell{Type: CellGravel})
+	if g.Hash() == h.Hash() {
+		t.Error("grids with different cells hash the same")
+	}
+	if NewGrid(2, 3).Hash() == NewGrid(3, 2).Hash() {
+		t.Error("all-wall grids of different shapes hash the same")
+	}
+}
+
+// TestGridHashIgnoresEncoding loads the same track from two differently compressed PNGs.
+func TestGridHashIgnoresEncoding(t *testing.T) {
+	img := Esses{Radius: 100, Amplitude: 10, Wavelength: 120, Width: 30}.Image()
+	dir := t.TempDir()
+	var hashes []string
+	for i, level := range []png.CompressionLevel{png.NoCompression, png.BestCompression} {
+		var buf bytes.Buffer
+		if err := (&png.Encoder{CompressionLevel: level}).Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, []string{"a.png", "b.png"}[i])
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		grid, _, err := LoadTrackFromImage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, grid.Hash())
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("re-encoding changed the hash: %s vs %s", hashes[0], hashes[1])
+	}
+}
+
+func TestMeshCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "esses.png")
+	writePNG(t, path, Esses{Radius: 100, Amplitude: 10, Wavelength: 120, Width: 30}.Image())
+	opts := LoadOptions{MeshCache: filepath.Join(dir, "cache")}
+
+	_, generated, err := LoadTrackFromImageWith(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := filepath.Glob(filepath.Join(opts.MeshCache, "*.mesh.gob"))
+	if len(entries) != 1 {
+		t.Fatalf("cache holds %v, want one mesh", entries)
+	}
+
+	_, cached, err := LoadTrackFromImageWith(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cached, generated) {
+		t.Error("cached mesh differs from the generated one")
+	}
+
+	// A broken entry is regenerated, not trusted
+	if err := os.WriteFile(entries[0], []byte("not a mesh"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, regenerated, err := LoadTrackFromImageWith(path, opts); err != nil || !reflect.DeepEqual(regenerated, generated) {
+		t.Errorf("after corrupting the cache: %v, mesh equal %v", err, reflect.DeepEqual(regenerated, generated))
+	}
+
+	// Another spacing is another mesh, cached alongside
+	opts.Spacing = DefaultAdaptiveSpacing
+	_, adaptive, err := LoadTrackFromImageWith(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(adaptive.Waypoints) == len(generated.Waypoints) {
+		t.Errorf("adaptive spacing gave the uniform mesh's %d waypoints", len(adaptive.Waypoints))
+	}
+	if entries, _ := filepath.Glob(filepath.Join(opts.MeshCache, "*.mesh.gob")); len(entries) != 2 {
+		t.Errorf("cache holds %v, want a mesh per spacing", entries)
+	}
+}
@@ -0,0 +1,55 @@
+package track
+
+import (
+	"fmt"
+	"racing-line-mapper/internal/common"
+)
+
+// Coords is the coordinate convention of positions and headings exchanged with other
+// tools: read from the sidecar, and written to exported lines. The simulation itself
+// always works in image coordinates: the grid is indexed like the picture, headings are
+// screen angles and mesh normals point to the right of travel as drawn. A Y-up
+// convention is converted where its coordinates are read or written, so the track is
+// never mirrored.
+type Coords int
+
+const (
+	CoordsImage Coords = iota // Origin top-left, +Y down; headings clockwise from East (90 = South)
+	CoordsYUp                 // Origin bottom-left, +Y up; headings counter-clockwise from East (90 = North)
+)
+
+func (c Coords) String() string {
+	if c == CoordsYUp {
+		return "y-up"
+	}
+	return "image"
+}
+
+// ParseCoords parses a convention name as printed by Coords.String ("y-down" is accepted for image).
+func ParseCoords(s string) (Coords, error) {
+	switch s {
+	case "image", "y-down":
+		return CoordsImage, nil
+	case "y-up":
+		return CoordsYUp, nil
+	}
+	return 0, fmt.Errorf("unknown coordinate convention %q (want image or y-up)", s)
+}
+
+// Point converts a point between c and image coordinates on an image height pixels tall.
+// Coordinates are pixel indices, so Y-up row 0 is the bottom row, height-1 in image
+// coordinates. Flipping is its own inverse, so it works in either direction.
+func (c Coords) Point(p common.Vec2, height float64) common.Vec2 {
+	if c == CoordsYUp {
+		p.Y = height - 1 - p.Y
+	}
+	return p
+}
+
+// Heading converts a heading (radians) between c and image coordinates, in either direction.
+func (c Coords) Heading(h float64) float64 {
+	if c == CoordsYUp {
+		return -h
+	}
+	return h
+}
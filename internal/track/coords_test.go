@@ -0,0 +1,95 @@
+package track
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"racing-line-mapper/internal/common"
+	"testing"
+)
+
+// TestYUpSidecar seeds the esses from a sidecar written in Y-up coordinates at the bottom
+// of the loop (as drawn) and checks the mesh starts there and runs the way it points,
+// rather than from the mirrored point at the top.
+func TestYUpSidecar(t *testing.T) {
+	e := Esses{Radius: 250, Amplitude: 30, Wavelength: 260, Width: 40}
+	path := filepath.Join(t.TempDir(), "esses.png")
+	writePNG(t, path, e.Image())
+
+	// Bottom of the loop on screen, driving towards decreasing theta (against the markers)
+	start, ahead := e.Center(math.Pi/2), e.Center(math.Pi/2-0.05)
+	heading := math.Atan2(ahead.Y-start.Y, ahead.X-start.X)
+	size := float64(e.Size())
+	sidecar := fmt.Sprintf(`{"start_x": %f, "start_y": %f, "heading_deg": %f}`,
+		start.X, size-1-start.Y, -heading*180/math.Pi)
+	if err := os.WriteFile(SidecarPath(path), []byte(sidecar), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, mesh, err := LoadTrackFromImageWith(path, LoadOptions{Coords: CoordsYUp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.Waypoints) < 10 {
+		t.Fatalf("%d waypoints", len(mesh.Waypoints))
+	}
+	if d := mesh.Waypoints[0].Position.Sub(start).Len(); d > 5 {
+		t.Errorf("mesh starts at %v, %.1f px from the sidecar's start %v", mesh.Waypoints[0].Position, d, start)
+	}
+	p := mesh.Waypoints[5].Position.Sub(e.origin())
+	if theta := math.Atan2(p.Y, p.X); theta >= math.Pi/2 {
+		t.Errorf("waypoint 5 is at theta %.2f, want below %.2f (heading away from the markers)", theta, math.Pi/2)
+	}
+}
+
+func TestCoordsRoundTrip(t *testing.T) {
+	for _, s := range []string{"image", "y-down", "y-up"} {
+		c, err := ParseCoords(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back, _ := ParseCoords(c.String()); back != c {
+			t.Errorf("%q: %v doesn't round-trip", s, c)
+		}
+	}
+	if _, err := ParseCoords("z-up"); err == nil {
+		t.Error("unknown convention: expected an error")
+	}
+
+	p := common.Vec2{X: 3, Y: 10}
+	if got := CoordsYUp.Point(CoordsYUp.Point(p, 100), 100); got != p {
+		t.Errorf("flipping twice gave %v, want %v", got, p)
+	}
+	if got := CoordsYUp.Point(p, 100); got != (common.Vec2{X: 3, Y: 89}) {
+		t.Errorf("y-up point = %v, want (3, 89)", got)
+	}
+	if got := CoordsImage.Heading(1); got != 1 {
+		t.Errorf("image heading = %v, want 1", got)
+	}
+	if got := CoordsYUp.Heading(math.Pi / 2); got != -math.Pi/2 {
+		t.Errorf("y-up North = %v, want %v (up the screen)", got, -math.Pi/2)
+	}
+}
+
+// TestCoordsKnownPixel checks a Y-up pixel index lands on the same pixel of the image:
+// the bottom and top rows swap, and nothing falls off the edge.
+func TestCoordsKnownPixel(t *testing.T) {
+	const height = 5
+	grid := NewGrid(4, height)
+	grid.Set(2, 1, Cell{Type: CellStart}) // Row 1 from the top is row 3 from the bottom
+
+	yUp := common.Vec2{X: 2, Y: 3}
+	img := CoordsYUp.Point(yUp, height)
+	if grid.Get(int(img.X), int(img.Y)).Type != CellStart {
+		t.Errorf("y-up %v converts to %v, not the marked pixel (2, 1)", yUp, img)
+	}
+	if back := CoordsYUp.Point(img, height); back != yUp {
+		t.Errorf("%v converts back to %v, want %v", img, back, yUp)
+	}
+	for _, y := range []float64{0, height - 1} {
+		if got := CoordsYUp.Point(common.Vec2{Y: y}, height).Y; got != height-1-y {
+			t.Errorf("y-up row %v is image row %v, want %v", y, got, height-1-y)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package track
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// Corner is one entry of the corner guide: where a corner starts, peaks and ends, how
+// fast it can be taken and where to brake for it. Speeds are in pixels per tick and
+// positions are waypoint indices.
+type Corner struct {
+	Number        int     `json:"corner"`         // 1-based, in driving order from the start
+	Direction     string  `json:"direction"`      // "left" or "right"
+	Entry         int     `json:"entry"`          // First waypoint of the turn-in
+	Apex          int     `json:"apex"`           //
+	Exit          int     `json:"exit"`           // Last waypoint of the exit
+	ApexDistance  float64 `json:"apex_s"`         // Arc length of the apex (pixels)
+	LineRadius    float64 `json:"line_radius"`    // Of the widest line through the corner (see LineRadius)
+	MinSpeed      float64 `json:"min_speed"`      // Target speed at the apex
+	BrakePoint    int     `json:"brake_point"`    // Where full braking starts (-1 if the corner is flat out)
+	BrakeDistance float64 `json:"brake_distance"` // From the brake point to the apex (pixels)
+	EntrySpeed    float64 `json:"entry_speed"`    // Speed at the brake point
+}
+
+// CornerGuide lists the corners (see Apexes) with their target speeds (see TargetSpeeds)
+// and brake points (see BrakePoints) for a car turning at most maxYawRate per tick,
+// topping out at maxSpeed and braking at decel. Requires ComputeCurvature and ComputePhases.
+func (m *TrackMesh) CornerGuide(maxYawRate, maxSpeed, decel float64) []Corner {
+	targets := m.TargetSpeeds(maxYawRate, maxSpeed)
+	apexes := m.Apexes(ApexMinCurvature, ApexNMSWindow)
+	brakes := make(map[int]BrakePoint)
+	for _, bp := range m.BrakePoints(apexes, targets, decel, maxSpeed) {
+		brakes[bp.ApexIdx] = bp
+	}
+
+	corners := make([]Corner, 0, len(apexes))
+	for k, apex := range apexes {
+		wp := m.Waypoints[apex]
+		c := Corner{
+			Number:       k + 1,
+			Direction:    "left",
+			Apex:         apex,
+			ApexDistance: wp.Distance,
+			LineRadius:   m.LineRadius(apex),
+			MinSpeed:     targets[apex],
+			BrakePoint:   -1,
+			EntrySpeed:   targets[apex],
+		}
+		if wp.Curvature > 0 {
+			c.Direction = "right"
+		}
+		c.Entry, c.Exit = m.cornerExtent(apex)
+		if bp, ok := brakes[apex]; ok {
+			c.BrakePoint, c.BrakeDistance, c.EntrySpeed = bp.WaypointIdx, bp.Distance, bp.EntrySpeed
+		}
+		corners = append(corners, c)
+	}
+	return corners
+}
+
+// cornerCSVHeader is the first row of WriteCornersCSV, matching the JSON field names.
+var cornerCSVHeader = []string{"corner", "direction", "entry", "apex", "exit", "apex_s", "line_radius", "min_speed", "brake_point", "brake_distance", "entry_speed"}
+
+// WriteCornersCSV writes the corner guide as CSV with a header row.
+func WriteCornersCSV(w io.Writer, corners []Corner) error {
+	cw := csv.NewWriter(w)
+	cw.Write(cornerCSVHeader)
+	ftoa := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, c := range corners {
+		cw.Write([]string{
+			strconv.Itoa(c.Number), c.Direction,
+			strconv.Itoa(c.Entry), strconv.Itoa(c.Apex), strconv.Itoa(c.Exit),
+			ftoa(c.ApexDistance), ftoa(c.LineRadius), ftoa(c.MinSpeed),
+			strconv.Itoa(c.BrakePoint), ftoa(c.BrakeDistance), ftoa(c.EntrySpeed),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteCornersJSON writes the corner guide as an indented JSON array.
+func WriteCornersJSON(w io.Writer, corners []Corner) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(corners)
+}
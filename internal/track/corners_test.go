@@ -0,0 +1,54 @@
+package track
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCornerGuide(t *testing.T) {
+	m := cornerMesh(40, 30)
+	const yawRate, maxSpeed, decel = 0.05, 10, 0.45
+	corners := m.CornerGuide(yawRate, maxSpeed, decel)
+	if len(corners) != 1 {
+		t.Fatalf("got %d corners, want the one right-hander: %+v", len(corners), corners)
+	}
+
+	c := corners[0]
+	targets := m.TargetSpeeds(yawRate, maxSpeed)
+	if c.Number != 1 || c.Direction != "right" || c.MinSpeed != targets[c.Apex] {
+		t.Errorf("corner %+v, want number 1, right, min speed %.2f", c, targets[c.Apex])
+	}
+	if !(c.BrakePoint >= 0 && c.BrakePoint < c.Entry && c.Entry <= c.Apex && c.Apex <= c.Exit) {
+		t.Errorf("brake point %d, entry %d, apex %d, exit %d; want them in driving order", c.BrakePoint, c.Entry, c.Apex, c.Exit)
+	}
+	if c.EntrySpeed <= c.MinSpeed || c.BrakeDistance <= 0 {
+		t.Errorf("entry speed %.2f over %.1fpx of braking, want faster than the apex's %.2f", c.EntrySpeed, c.BrakeDistance, c.MinSpeed)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCornersCSV(&buf, corners); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || !reflect.DeepEqual(rows[0], cornerCSVHeader) || rows[1][1] != "right" {
+		t.Errorf("CSV rows %q, want the header and the corner", rows)
+	}
+
+	buf.Reset()
+	if err := WriteCornersJSON(&buf, corners); err != nil {
+		t.Fatal(err)
+	}
+	var back []Corner
+	if err := json.Unmarshal(buf.Bytes(), &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, corners) {
+		t.Errorf("JSON round trip: got %+v, want %+v", back, corners)
+	}
+}
@@ -0,0 +1,103 @@
+package track
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"racing-line-mapper/internal/common"
+)
+
+// Esses describes a synthetic test track: a closed loop whose centerline is a circle
+// with a sinusoid added to its radius, r(theta) = Radius + Amplitude*sin(n*theta), where
+// n is the number of whole waves of the given wavelength that fit around the circle.
+// With enough amplitude the corners alternate left and right. The walls are a constant
+// Width apart, and the centerline is known exactly, so generated meshes can be checked.
+type Esses struct {
+	Radius     float64 // Mean centerline radius (pixels)
+	Amplitude  float64 // Radial amplitude of the waves (pixels)
+	Wavelength float64 // Length of one wave along the mean circle (pixels)
+	Width      float64 // Track width (pixels)
+}
+
+// Waves is the number of whole waves around the loop (at least 1).
+func (e Esses) Waves() int {
+	return max(1, int(math.Round(2*math.Pi*e.Radius/e.Wavelength)))
+}
+
+// Size is the side of the square image that holds the track with a margin.
+func (e Esses) Size() int {
+	return int(math.Ceil(2 * (e.Radius + e.Amplitude + e.Width)))
+}
+
+// origin is the center of the loop in image coordinates.
+func (e Esses) origin() common.Vec2 {
+	c := float64(e.Size()) / 2
+	return common.Vec2{X: c, Y: c}
+}
+
+// RadiusAt is the centerline's distance from the loop center at angle theta.
+func (e Esses) RadiusAt(theta float64) float64 {
+	return e.Radius + e.Amplitude*math.Sin(float64(e.Waves())*theta)
+}
+
+// Center is the centerline point at angle theta (radians, clockwise on screen from +x).
+func (e Esses) Center(theta float64) common.Vec2 {
+	r := e.RadiusAt(theta)
+	o := e.origin()
+	return common.Vec2{X: o.X + r*math.Cos(theta), Y: o.Y + r*math.Sin(theta)}
+}
+
+// CenterlineError is how far p is from the centerline, measured radially from the loop center.
+func (e Esses) CenterlineError(p common.Vec2) float64 {
+	d := p.Sub(e.origin())
+	return math.Abs(d.Len() - e.RadiusAt(math.Atan2(d.Y, d.X)))
+}
+
+// Image renders the track in the loader's colors: white tarmac on black, a red start
+// line across the track at theta = 0 and a yellow marker just after it, so the car
+// drives with increasing theta.
+func (e Esses) Image() *image.RGBA {
+	size := e.Size()
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	black := color.RGBA{0, 0, 0, 255}
+	draw.Draw(img, img.Bounds(), image.NewUniform(black), image.Point{}, draw.Src)
+
+	fill := func(c common.Vec2, r float64, col color.RGBA, onTarmac bool) {
+		for x := int(c.X - r); x <= int(c.X+r)+1; x++ {
+			for y := int(c.Y - r); y <= int(c.Y+r)+1; y++ {
+				if math.Hypot(float64(x)-c.X, float64(y)-c.Y) > r {
+					continue
+				}
+				if onTarmac && img.RGBAAt(x, y) == black {
+					continue
+				}
+				img.SetRGBA(x, y, col)
+			}
+		}
+	}
+
+	// The track is swept as discs along the centerline, which keeps its width
+	// constant through the corners.
+	white := color.RGBA{255, 255, 255, 255}
+	step := 0.5 / (e.Radius + e.Amplitude) // Half a pixel along the outer edge
+	for theta := 0.0; theta < 2*math.Pi; theta += step {
+		fill(e.Center(theta), e.Width/2, white, false)
+	}
+
+	// Start line: a strip a few pixels deep, across the whole width
+	c := e.Center(0)
+	tangent := e.Center(step).Sub(e.Center(-step)).Normalize()
+	for x := int(c.X - e.Width); x <= int(c.X+e.Width); x++ {
+		for y := int(c.Y - e.Width); y <= int(c.Y+e.Width); y++ {
+			d := common.Vec2{X: float64(x), Y: float64(y)}.Sub(c)
+			along := d.X*tangent.X + d.Y*tangent.Y
+			across := d.X*tangent.Y - d.Y*tangent.X
+			if math.Abs(along) <= 3 && math.Abs(across) <= e.Width/2 && img.RGBAAt(x, y) != black {
+				img.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+			}
+		}
+	}
+	fill(e.Center(20/e.RadiusAt(0)), 3, color.RGBA{255, 255, 0, 255}, true)
+	return img
+}
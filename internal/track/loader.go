@@ -3,15 +3,75 @@ package track
 import (
 	"fmt"
 	"image"
+	"image/color"
 	_ "image/jpeg"
 	_ "image/png"
 	"math"
 	"os"
 	"racing-line-mapper/internal/common"
+	"runtime"
 )
 
+// LoadOptions controls how a track image is turned into a grid.
+type LoadOptions struct {
+	// Downsample merges each Downsample x Downsample block of pixels into one cell
+	// (0 or 1 keeps full resolution). See downsample for how blocks are classified.
+	Downsample int
+	// MaxDim, if set, picks the smallest downsample factor that brings the larger
+	// image dimension down to at most MaxDim cells (overrides Downsample when larger).
+	MaxDim int
+	// GrayThreshold is the brightness (1-255) splitting wall from tarmac in grayscale
+	// images (see GrayToCellType); 0 means DefaultGrayThreshold. Color images ignore it.
+	GrayThreshold uint8
+	// Spacing, if enabled, resamples the mesh with curvature-adaptive waypoint spacing
+	// (see Spacing); by default the waypoints keep the walker's uniform step.
+	Spacing Spacing
+	// Coords is the convention the sidecar's start point and heading are given in
+	// (see Coords); the zero value is image coordinates.
+	Coords Coords
+	// MeshCache, if set, is a directory of generated meshes keyed on the grid (see
+	// Grid.Hash), the start and the spacing: loading a track that classifies to the same
+	// grid reuses its mesh instead of generating it again.
+	MeshCache string
+}
+
+// factor is the block size to downsample an image of the given size by.
+func (o LoadOptions) factor(width, height int) int {
+	k := max(o.Downsample, 1)
+	if o.MaxDim > 0 {
+		k = max(k, (max(width, height)+o.MaxDim-1)/o.MaxDim)
+	}
+	return k
+}
+
+// classifier returns how the pixels of img map to cell types: by color, or by
+// brightness alone if img is grayscale.
+func (o LoadOptions) classifier(img image.Image) func(color.Color) CellType {
+	if !IsGrayscale(img) {
+		return ColorToCellType
+	}
+	threshold := o.GrayThreshold
+	if threshold == 0 {
+		threshold = DefaultGrayThreshold
+	}
+	return func(c color.Color) CellType { return GrayToCellType(c, threshold) }
+}
+
 // LoadTrackFromImage loads an image and converts it to a Grid.
+// If the image has a sidecar file (see Sidecar), its start and heading seed the mesh.
 func LoadTrackFromImage(path string) (*Grid, *TrackMesh, error) {
+	return LoadTrackFromImageWith(path, LoadOptions{})
+}
+
+// LoadTrackFromImageWith is LoadTrackFromImage with options, e.g. to downsample huge scans.
+// Downsampling multiplies Grid.Scale (meters per cell) by the factor, and sidecar
+// coordinates (image pixels, converted from opts.Coords) are scaled down to match.
+func LoadTrackFromImageWith(path string, opts LoadOptions) (*Grid, *TrackMesh, error) {
+	sidecar, err := LoadSidecar(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, nil, err
@@ -24,31 +84,83 @@ func LoadTrackFromImage(path string) (*Grid, *TrackMesh, error) {
 	}
 
 	bounds := img.Bounds()
-	width, height := bounds.Max.X, bounds.Max.Y
-	grid := NewGrid(width, height)
+	k := opts.factor(bounds.Max.X, bounds.Max.Y)
+	grid := downsample(img, k, opts.classifier(img))
+
+	startX, startY := findStart(grid)
+	var heading float64
+	if sidecar != nil {
+		fmt.Printf("Using sidecar %s: Start(%.1f, %.1f) Heading %.1f deg (%s coordinates)\n",
+			SidecarPath(path), sidecar.StartX, sidecar.StartY, sidecar.HeadingDeg, opts.Coords)
+		if sidecar.Scale > 0 {
+			grid.Scale = sidecar.Scale * float64(k)
+		}
+		start := opts.Coords.Point(common.Vec2{X: sidecar.StartX, Y: sidecar.StartY}, float64(bounds.Max.Y))
+		startX, startY = int(start.X)/k, int(start.Y)/k
+		heading = opts.Coords.Heading(sidecar.HeadingDeg * math.Pi / 180)
+	} else {
+		heading = DetectStartHeading(grid, startX, startY)
+	}
 
-	// Keep track of start pixels to find centroid
-	var startXSum, startYSum, startCount int
+	key := meshCacheKey(grid, startX, startY, heading, opts.Spacing)
+	mesh, cached := loadCachedMesh(opts.MeshCache, key)
+	if cached {
+		fmt.Printf("Using cached mesh %s (%d waypoints)\n", meshCachePath(opts.MeshCache, key), len(mesh.Waypoints))
+	} else {
+		mesh = meshWithFallback(grid, startX, startY, heading)
+		mesh.Resample(opts.Spacing)
+		if opts.MeshCache != "" {
+			if err := storeCachedMesh(opts.MeshCache, key, mesh); err != nil {
+				fmt.Printf("WARNING: caching the mesh: %v\n", err)
+			}
+		}
+	}
+	reportCentering(grid, mesh)
+	return grid, mesh, nil
+}
 
-	for x := 0; x < width; x++ {
-		for y := 0; y < height; y++ {
-			c := img.At(x, y)
-			cellType := ColorToCellType(c)
+// meshWithFallback generates the mesh with the walker (see GenerateMeshFrom) and, if that
+// doesn't close the loop or comes out poorly centered (see CenteringWarnMean and
+// CenteringWarnMax), also from the medial axis (see GenerateMeshMedialAxis), keeping
+// whichever is the better centered loop.
+func meshWithFallback(grid *Grid, startX, startY int, heading float64) *TrackMesh {
+	mesh := GenerateMeshFrom(grid, startX, startY, heading)
+	switch {
+	case mesh.DeadEnd:
+		fmt.Printf("Mesh walk reached a dead end after %d waypoints; treating the track as point to point\n", len(mesh.Waypoints))
+	case !mesh.Looped:
+		fmt.Printf("WARNING: mesh walk did not get back to the start after %d waypoints\n", len(mesh.Waypoints))
+	}
+	mean, worst := mesh.CenteringError(grid)
+	if mesh.Looped && mean <= CenteringWarnMean && worst <= CenteringWarnMax {
+		return mesh
+	}
 
-			friction := 1.0
-			switch cellType {
-			case CellGravel:
-				friction = 0.4
-			case CellWall:
-				friction = 0.0
-			}
+	fmt.Printf("Walker mesh is poor (looped %v, centering error mean %.2f, max %.1f); trying the medial axis\n", mesh.Looped, mean, worst)
+	alt := medialAxisMesh(grid, startX, startY, heading)
+	if !alt.Looped {
+		fmt.Println("The medial axis has no loop through the start; keeping the walker's mesh")
+		return mesh
+	}
+	if altMean, _ := alt.CenteringError(grid); mesh.Looped && altMean >= mean {
+		fmt.Printf("The medial-axis mesh is no better centered (mean %.2f); keeping the walker's mesh\n", altMean)
+		return mesh
+	}
+	fmt.Printf("Using the medial-axis mesh (%d waypoints)\n", len(alt.Waypoints))
+	return alt
+}
 
-			grid.Cells[x][y] = Cell{
-				Type:     cellType,
-				Friction: friction,
-			}
+// findStart returns the cell the mesh is seeded from: the centroid of the start/finish
+// cells, or failing that the first tarmac cell.
+func findStart(grid *Grid) (startX, startY int) {
+	width, height := grid.Width, grid.Height
 
-			if cellType == CellStart {
+	// Keep track of start pixels to find centroid
+	var startXSum, startYSum, startCount int
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if grid.at(x, y).Type == CellStart {
 				startXSum += x
 				startYSum += y
 				startCount++
@@ -56,50 +168,108 @@ func LoadTrackFromImage(path string) (*Grid, *TrackMesh, error) {
 		}
 	}
 
-	var startX, startY int
-	foundStart := false
 	if startCount > 0 {
-		startX = startXSum / startCount
-		startY = startYSum / startCount
-		foundStart = true
+		return startXSum / startCount, startYSum / startCount
 	}
 
 	// If no explicit start, find first tarmac
-	if !foundStart {
-		// Simple search
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if grid.Get(x, y).Type == CellTarmac {
+				return x, y
+			}
+		}
+	}
+	return 0, 0
+}
+
+// Centering error (see TrackMesh.CenteringError) above which a loaded mesh is reported as poorly centered
+const (
+	CenteringWarnMean = 2.0  // Grid cells, averaged over the waypoints
+	CenteringWarnMax  = 12.0 // Grid cells, at the worst waypoint
+)
+
+// reportCentering prints the mesh's centering error, with a warning if it's poor.
+func reportCentering(grid *Grid, mesh *TrackMesh) {
+	mean, worst := mesh.CenteringError(grid)
+	fmt.Printf("Mesh centering error: mean %.2f, max %.1f cells over %d waypoints\n", mean, worst, len(mesh.Waypoints))
+	if mean > CenteringWarnMean || worst > CenteringWarnMax {
+		fmt.Printf("WARNING: mesh is poorly centered (limits: mean %.1f, max %.1f); the walker may have cut a corner\n",
+			CenteringWarnMean, CenteringWarnMax)
+	}
+}
+
+// SurfaceFriction is the nominal friction of a cell type, as the loader stores it in
+// each Cell. Physics scales a surface's grip by how far a cell's Friction is from it.
+func SurfaceFriction(t CellType) float64 {
+	switch t {
+	case CellGravel:
+		return 0.4
+	case CellWall:
+		return 0.0
+	}
+	return 1.0
+}
+
+// downsample classifies the image into a grid of k x k pixel blocks, each pixel by
+// classify (see LoadOptions.classifier). A block is a wall if any of its pixels is, so
+// walls thinner than a block still separate the cells on either side; otherwise it takes
+// the most common of its other surfaces (ties go to the lower CellType, i.e. tarmac).
+// With k = 1 every pixel is its own cell.
+func downsample(img image.Image, k int, classify func(color.Color) CellType) *Grid {
+	bounds := img.Bounds()
+	width, height := (bounds.Max.X+k-1)/k, (bounds.Max.Y+k-1)/k
+	grid := NewGrid(width, height)
+	grid.Scale *= float64(k)
+
+	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			for y := 0; y < height; y++ {
-				if grid.Cells[x][y].Type == CellTarmac {
-					startX, startY = x, y
-					foundStart = true
-					break
+			var votes [CellDirection + 1]int
+			for py := y * k; py < min((y+1)*k, bounds.Max.Y); py++ {
+				for px := x * k; px < min((x+1)*k, bounds.Max.X); px++ {
+					votes[classify(img.At(px, py))]++
 				}
 			}
-			if foundStart {
-				break
+
+			cellType := CellWall
+			if votes[CellWall] == 0 {
+				cellType = CellTarmac
+				for t := CellTarmac; t <= CellDirection; t++ {
+					if votes[t] > votes[cellType] {
+						cellType = t
+					}
+				}
 			}
+			*grid.at(x, y) = Cell{Type: cellType, Friction: SurfaceFriction(cellType)}
 		}
 	}
-
-	mesh := GenerateMesh(grid, startX, startY)
-
-	return grid, mesh, nil
+	return grid
 }
 
-// GenerateMesh creates a centerline mesh from the grid.
+// GenerateMesh creates a centerline mesh from the grid, walking in the
+// direction given by the track's direction hint (see DetectStartHeading).
 func GenerateMesh(grid *Grid, startX, startY int) *TrackMesh {
-	rawWaypoints := []Waypoint{}
-
-	// 1. Determine Start Direction
-	// Priority: Use Yellow Marker (CellDirection) if present.
+	return GenerateMeshFrom(grid, startX, startY, DetectStartHeading(grid, startX, startY))
+}
 
-	var dirX, dirY float64
+// GenerateMeshWith is GenerateMesh followed by a resampling of the waypoints with the
+// given spacing (see TrackMesh.Resample); a zero Spacing gives GenerateMesh's mesh.
+func GenerateMeshWith(grid *Grid, startX, startY int, sp Spacing) *TrackMesh {
+	mesh := GenerateMesh(grid, startX, startY)
+	mesh.Resample(sp)
+	return mesh
+}
 
+// DetectStartHeading returns the initial walk direction (radians) for a mesh seeded at (startX, startY).
+// Priority: Use Yellow Marker (CellDirection) if present, otherwise default to East.
+// The marker counts by its centroid rather than its nearest cell: on a JPEG scan the cells
+// nearest the start are the marker's ragged edge, and skew the heading by ten degrees or so.
+func DetectStartHeading(grid *Grid, startX, startY int) float64 {
 	// Find Yellow Centroid
 	var yellowXSum, yellowYSum, yellowCount int
-	for x := 0; x < grid.Width; x++ {
-		for y := 0; y < grid.Height; y++ {
-			if grid.Cells[x][y].Type == CellDirection {
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			if grid.at(x, y).Type == CellDirection {
 				yellowXSum += x
 				yellowYSum += y
 				yellowCount++
@@ -113,20 +283,75 @@ func GenerateMesh(grid *Grid, startX, startY int) *TrackMesh {
 
 		dx := yellowX - float64(startX)
 		dy := yellowY - float64(startY)
-		l := math.Sqrt(dx*dx + dy*dy)
-		if l > 0 {
-			dirX, dirY = dx/l, dy/l
-		} else {
-			dirX, dirY = 1.0, 0.0 // Start and Direction are same point? Default East
+		heading := 0.0 // Start and Direction are same point? Default East
+		if dx != 0 || dy != 0 {
+			heading = math.Atan2(dy, dx)
 		}
 		fmt.Printf("Use Yellow Heading: Start(%.1f, %.1f) -> Yellow(%.1f, %.1f) | Dir(%.2f, %.2f)\n",
-			float64(startX), float64(startY), yellowX, yellowY, dirX, dirY)
-	} else {
-		// Fallback: Default to East (1,0) as requested to remove 360 scan
-		dirX, dirY = 1.0, 0.0
-		fmt.Printf("No Yellow Marker found. Defaulting to East (1.0, 0.0). Start(%.1f, %.1f)\n", float64(startX), float64(startY))
+			float64(startX), float64(startY), yellowX, yellowY, math.Cos(heading), math.Sin(heading))
+		return heading
 	}
 
+	// Fallback: Default to East (1,0) as requested to remove 360 scan
+	fmt.Printf("No Yellow Marker found. Defaulting to East (1.0, 0.0). Start(%.1f, %.1f)\n", float64(startX), float64(startY))
+	return 0
+}
+
+// Mesh seeding
+const (
+	StartBandClearSteps = 3           // Walker steps past the far edge of the start band before loop closure can trigger
+	ClosureArmWidths    = 3           // Loop closure also needs the walker to get this many track widths from the start
+	DeadEndArc          = math.Pi / 3 // The walk ends (an open track) once a wall is within half a track width everywhere this far either side of ahead
+)
+
+// startBand is the extent of the start/finish cells around the start point.
+type startBand struct {
+	Across    float64 // Band length across the track, through the start point
+	Ahead     float64 // Distance from the start point to the band's far edge, along the walk direction
+	FullWidth bool    // The band reaches the walls on both sides
+}
+
+// measureStartBand scans the CellStart run through (x, y) along the normal and ahead along (dirX, dirY).
+func measureStartBand(grid *Grid, x, y int, dirX, dirY float64) startBand {
+	var band startBand
+	if grid.Get(x, y).Type != CellStart {
+		return band
+	}
+	normX, normY := -dirY, dirX
+
+	// Walk out from the start until the band ends; report whether it ended at a wall
+	run := func(dx, dy float64) (float64, bool) {
+		for k := 1.0; k < 200; k++ {
+			switch grid.Get(int(float64(x)+dx*k), int(float64(y)+dy*k)).Type {
+			case CellStart:
+				continue
+			case CellWall:
+				return k, true
+			default:
+				return k, false
+			}
+		}
+		return 200, false
+	}
+	left, leftWall := run(normX, normY)
+	right, rightWall := run(-normX, -normY)
+	band.Across = left + right
+	band.FullWidth = leftWall && rightWall
+	band.Ahead, _ = run(dirX, dirY)
+	return band
+}
+
+// GenerateMeshFrom creates a centerline mesh from the grid, starting at (startX, startY)
+// and initially walking along heading (radians). Used directly to re-seed the mesh
+// from an arbitrary point when the automatic start detection is poor. If the walk
+// doesn't get back to the start the mesh is open, and DeadEnd says whether that's
+// because it reached the end of a point-to-point track; reporting it is up to the caller.
+func GenerateMeshFrom(grid *Grid, startX, startY int, heading float64) *TrackMesh {
+	rawWaypoints := []Waypoint{}
+
+	// 1. Start Direction
+	dirX, dirY := math.Cos(heading), math.Sin(heading)
+
 	// 2. Find True Center & Width relative to Direction
 	// Scan perpendicular to direction (Normal)
 	normX, normY := -dirY, dirX
@@ -147,6 +372,13 @@ func GenerateMesh(grid *Grid, startX, startY int) *TrackMesh {
 	}
 
 	trackWidth := leftDist + rightDist
+
+	// A painted start/finish band spanning the whole track measures the width directly,
+	// even on tracks too wide for the wall scan above
+	band := measureStartBand(grid, startX, startY, dirX, dirY)
+	if band.FullWidth {
+		trackWidth = band.Across
+	}
 	if trackWidth < 2 {
 		trackWidth = 20
 	}
@@ -159,15 +391,22 @@ func GenerateMesh(grid *Grid, startX, startY int) *TrackMesh {
 	centerY := float64(startY) + normY*centerOffset
 
 	currX, currY := centerX, centerY
+	startDirX, startDirY, startNormX, startNormY := dirX, dirY, normX, normY
 	totalDist := 0.0
 
 	stepSize := 6.0 // "Sweet spot" attempt (not 4, not 8)
 	visited := make(map[int]bool)
 
+	// Loop closure is armed only once the walker has cleared the start band and got
+	// well away from the start; otherwise a deep band can close the loop on the first steps.
+	armDist := math.Max(band.Ahead+StartBandClearSteps*stepSize, ClosureArmWidths*trackWidth)
+	closureArmed, looped, deadEnd := false, false, false
+
 	for i := 0; i < 6000; i++ {
 		// Scan an arc to find the "deepest" path
 		bestAngle := 0.0
 		maxDepth := -999.0
+		aheadDepth := 0.0 // Deepest clear run within DeadEndArc of the heading
 		baseAngle := math.Atan2(dirY, dirX)
 
 		// Search in a 120-degree arc with high resolution
@@ -190,6 +429,10 @@ func GenerateMesh(grid *Grid, startX, startY int) *TrackMesh {
 				depth = d
 			}
 
+			if math.Abs(angle) <= DeadEndArc {
+				aheadDepth = math.Max(aheadDepth, depth)
+			}
+
 			// Turning penalty
 			score := depth * (1.1 - math.Abs(angle)/math.Pi)
 			if foundVisited {
@@ -202,6 +445,13 @@ func GenerateMesh(grid *Grid, startX, startY int) *TrackMesh {
 			}
 		}
 
+		// Dead end: the end of a point-to-point track (turning round would walk it back).
+		// Even in a hairpin the track ahead runs on further than this
+		if aheadDepth < math.Max(stepSize, trackWidth/2) {
+			deadEnd = true
+			break
+		}
+
 		newDirX := math.Cos(bestAngle)
 		newDirY := math.Sin(bestAngle)
 
@@ -241,85 +491,41 @@ func GenerateMesh(grid *Grid, startX, startY int) *TrackMesh {
 		}
 		rawWaypoints = append(rawWaypoints, wp)
 
-		// Loop Closure Check (After traveling enough)
-		if i > 150 {
-			distToStart := math.Sqrt((currX-centerX)*(currX-centerX) + (currY-centerY)*(currY-centerY))
-			if distToStart < stepSize*2.0 {
-				break
-			}
+		// Loop Closure Check (After traveling enough): back across the start line,
+		// anywhere within the track width (the walker needn't pass through the exact start center)
+		toStartX, toStartY := currX-centerX, currY-centerY
+		if !closureArmed {
+			closureArmed = math.Hypot(toStartX, toStartY) > armDist
+		} else if along, across := toStartX*startDirX+toStartY*startDirY, toStartX*startNormX+toStartY*startNormY; math.Abs(along) < stepSize && math.Abs(across) < trackWidth/2 {
+			looped = true
+			break
 		}
 	}
-
 	// 2. Refinement Pass ("Elastic Band" / Iterative Centering)
 	// The initial walker might be biased or cut corners.
 	// We iterate to pull every point towards the true geometric center.
-	refinedWaypoints := make([]Waypoint, len(rawWaypoints))
-	copy(refinedWaypoints, rawWaypoints)
-
-	// Number of relaxation iterations
-	for iter := 0; iter < 10; iter++ {
-		for i := 0; i < len(refinedWaypoints); i++ {
-			wp := refinedWaypoints[i]
-
-			// Calculate approximate tangent from neighbors
-			prev := refinedWaypoints[(i-1+len(refinedWaypoints))%len(refinedWaypoints)]
-			next := refinedWaypoints[(i+1)%len(refinedWaypoints)]
-
-			tx := next.Position.X - prev.Position.X
-			ty := next.Position.Y - prev.Position.Y
-
-			// Normal = (-ty, tx)
-			nx, ny := -ty, tx
-			l := math.Sqrt(nx*nx + ny*ny)
-			if l == 0 {
-				continue
-			}
-			nx /= l
-			ny /= l
-
-			// Raycast Left/Right to find walls
-			dLeft := 0.0
-			foundLeft := false
-			for d := 1.0; d < 80.0; d += 1.0 {
-				cx := int(wp.Position.X + nx*d)
-				cy := int(wp.Position.Y + ny*d)
-				if grid.Get(cx, cy).Type == CellWall {
-					dLeft = d
-					foundLeft = true
-					break
-				}
-			}
+	refinedWaypoints := RefineWaypoints(grid, rawWaypoints, looped, RefineIterations, runtime.NumCPU())
 
-			dRight := 0.0
-			foundRight := false
-			for d := 1.0; d < 80.0; d += 1.0 {
-				cx := int(wp.Position.X - nx*d)
-				cy := int(wp.Position.Y - ny*d)
-				if grid.Get(cx, cy).Type == CellWall {
-					dRight = d
-					foundRight = true
-					break
-				}
-			}
+	// 3. Final smoothing of positions and normals
+	mesh := newMesh(smoothWaypoints(refinedWaypoints, looped), looped)
 
-			// Move point towards center
-			if foundLeft && foundRight {
-				// We want dLeft == dRight.
-				// Error = dLeft - dRight.
-				// Correction = Error / 2
-				correction := (dLeft - dRight) / 2.0
+	// 4. Refinement and smoothing moved the waypoints unevenly; space them out again
+	mesh.ResampleUniform(stepSize)
 
-				// Alpha blend for stability (0.5)
-				refinedWaypoints[i].Position.X += nx * correction * 0.5
-				refinedWaypoints[i].Position.Y += ny * correction * 0.5
+	// 5. Measure the track edges from where the waypoints ended up
+	mesh.measureSides(grid)
+	mesh.StartPosition = common.Vec2{X: float64(startX), Y: float64(startY)}
+	mesh.StartHeading = heading
+	mesh.DeadEnd = deadEnd
+	return mesh
+}
 
-				// Update Width estimate
-				refinedWaypoints[i].Width = dLeft + dRight
-			}
-		}
-	}
+// smoothWaypoints smooths the positions of a centered but jittery centerline, then
+// recomputes its normals from them and smooths those too (see GenerateMeshFrom).
+func smoothWaypoints(refinedWaypoints []Waypoint, looped bool) []Waypoint {
+	n := len(refinedWaypoints)
 
-	// 3. Final Smoothing Pass (Moving Average)
+	// Final Smoothing Pass (Moving Average)
 	smoothedWaypoints := make([]Waypoint, len(refinedWaypoints))
 	copy(smoothedWaypoints, refinedWaypoints)
 
@@ -332,7 +538,7 @@ func GenerateMesh(grid *Grid, startX, startY int) *TrackMesh {
 			sumX, sumY := 0.0, 0.0
 			window := 3 // Reduced from 15 to 3 to preserve curve geometry
 			for j := -window / 2; j <= window/2; j++ {
-				idx := (i + j + len(smoothedWaypoints)) % len(smoothedWaypoints)
+				idx := wrapIndex(i+j, n, looped)
 				sumX += temp[idx].Position.X
 				sumY += temp[idx].Position.Y
 			}
@@ -344,8 +550,8 @@ func GenerateMesh(grid *Grid, startX, startY int) *TrackMesh {
 	// Recompute Final Normals with explicit normal smoothing
 	for i := 0; i < len(smoothedWaypoints); i++ {
 		// Calculate Raw Normal from smoothed positions
-		prev := smoothedWaypoints[(i-1+len(smoothedWaypoints))%len(smoothedWaypoints)]
-		next := smoothedWaypoints[(i+1)%len(smoothedWaypoints)]
+		prev := smoothedWaypoints[wrapIndex(i-1, n, looped)]
+		next := smoothedWaypoints[wrapIndex(i+1, n, looped)]
 
 		dx := next.Position.X - prev.Position.X
 		dy := next.Position.Y - prev.Position.Y
@@ -372,7 +578,7 @@ func GenerateMesh(grid *Grid, startX, startY int) *TrackMesh {
 			sumNx, sumNy := 0.0, 0.0
 			window := 5
 			for j := -window / 2; j <= window/2; j++ {
-				idx := (i + j + len(finalMeshPoints)) % len(finalMeshPoints)
+				idx := wrapIndex(i+j, n, looped)
 				sumNx += temp[idx].Normal.X
 				sumNy += temp[idx].Normal.Y
 			}
@@ -385,10 +591,18 @@ func GenerateMesh(grid *Grid, startX, startY int) *TrackMesh {
 		}
 	}
 
-	smoothedWaypoints = finalMeshPoints
+	return finalMeshPoints
+}
 
-	return &TrackMesh{
-		Waypoints: smoothedWaypoints,
-		TotalLen:  float64(len(smoothedWaypoints)) * stepSize,
-	}
+// newMesh builds the mesh over a finished centerline and derives its arc lengths,
+// widths, edges, curvature and corner phases.
+func newMesh(waypoints []Waypoint, looped bool) *TrackMesh {
+	mesh := &TrackMesh{Waypoints: waypoints, Looped: looped}
+	mesh.ComputeDistances() // Also sets TotalLen
+	mesh.FillDegenerateWidths()
+	mesh.ComputeBoundaries()
+	mesh.ComputeCurvature()
+	mesh.ComputePhases()
+
+	return mesh
 }
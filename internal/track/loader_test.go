@@ -0,0 +1,354 @@
+package track
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"racing-line-mapper/internal/common"
+	"testing"
+)
+
+// ringGrid is an annulus of tarmac (inner radius r-w/2, outer r+w/2) around (cx, cy),
+// with a start band of the given depth painted across the full width at the top.
+func ringGrid(cx, cy, r, w, bandDepth float64) *Grid {
+	size := int(2 * (cx + r))
+	g := NewGrid(size, size)
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			dx, dy := float64(x)-cx, float64(y)-cy
+			dist := math.Hypot(dx, dy)
+			switch {
+			case math.Abs(dist-r) > w/2:
+				g.Set(x, y, Cell{Type: CellWall})
+			case dy < 0 && math.Abs(dx) <= bandDepth/2:
+				g.Set(x, y, Cell{Type: CellStart, Friction: 1})
+			default:
+				g.Set(x, y, Cell{Type: CellTarmac, Friction: 1})
+			}
+		}
+	}
+	return g
+}
+
+// TestGenerateMeshWideStartBand seeds the mesh on a full-width, deep start band on a
+// short loop, and checks the walker goes exactly once around and takes the band's width.
+func TestGenerateMeshWideStartBand(t *testing.T) {
+	const cx, cy, r, w = 200.0, 200.0, 110.0, 40.0
+	grid := ringGrid(cx, cy, r, w, 30)
+
+	band := measureStartBand(grid, int(cx), int(cy-r), 1, 0)
+	if !band.FullWidth || math.Abs(band.Across-w) > 3 {
+		t.Errorf("start band %+v, want full width of about %.0f", band, w)
+	}
+	if math.Abs(band.Ahead-15) > 1 {
+		t.Errorf("start band reaches %.1f ahead, want about 15", band.Ahead)
+	}
+
+	mesh := GenerateMeshFrom(grid, int(cx), int(cy-r), 0)
+	mesh.ComputeDistances()
+	circumference := 2 * math.Pi * r
+	if math.Abs(mesh.TotalLen-circumference) > 0.1*circumference {
+		t.Fatalf("mesh is %.0f px around (%d waypoints), want one lap of about %.0f",
+			mesh.TotalLen, len(mesh.Waypoints), circumference)
+	}
+	for i, wp := range mesh.Waypoints {
+		if d := math.Hypot(wp.Position.X-cx, wp.Position.Y-cy); math.Abs(d-r) > 5 {
+			t.Errorf("waypoint %d is %.1f from the center, want about %.0f", i, d, r)
+			break
+		}
+	}
+}
+
+// TestMeshStartsAtTheMarkers paints a direction marker west of the start band at the
+// top of a ring, and checks the mesh records the band's centroid and a westward heading,
+// and is walked that way (counter-clockwise on screen) rather than East.
+func TestMeshStartsAtTheMarkers(t *testing.T) {
+	const cx, cy, r, w = 200.0, 200.0, 110.0, 40.0
+	grid := ringGrid(cx, cy, r, w, 10)
+	for x := int(cx) - 30; x < int(cx)-25; x++ {
+		for y := int(cy - r - 2); y <= int(cy-r+2); y++ {
+			grid.Set(x, y, Cell{Type: CellDirection, Friction: 1})
+		}
+	}
+
+	startX, startY := findStart(grid)
+	mesh := GenerateMesh(grid, startX, startY)
+	if d := mesh.StartPosition.Sub(common.Vec2{X: cx, Y: cy - r}).Len(); d > 2 {
+		t.Errorf("start position %v, want the band's centroid about (%.0f, %.0f)", mesh.StartPosition, cx, cy-r)
+	}
+	if math.Abs(math.Abs(mesh.StartHeading)-math.Pi) > 0.1 {
+		t.Errorf("start heading %.2f rad, want West (Pi)", mesh.StartHeading)
+	}
+	if ahead := mesh.At(5).Position; ahead.X >= cx {
+		t.Errorf("waypoint 5 at %v, want it West of the start", ahead)
+	}
+}
+
+// stripGrid is a straight horizontal strip of tarmac, closed at both ends, with a start
+// band painted across it near the left end: a point-to-point track.
+func stripGrid(length, width int) *Grid {
+	g := NewGrid(length+40, width+40)
+	for x := 20; x < length+20; x++ {
+		for y := 20; y < width+20; y++ {
+			cell := Cell{Type: CellTarmac, Friction: 1}
+			if x >= 40 && x < 50 {
+				cell.Type = CellStart
+			}
+			g.Set(x, y, cell)
+		}
+	}
+	return g
+}
+
+// TestGenerateMeshPointToPoint walks a straight strip: the walk has to stop at the far
+// end, as an open track running the strip's length, rather than turn back to the start.
+func TestGenerateMeshPointToPoint(t *testing.T) {
+	const length, width = 600, 40
+	grid := stripGrid(length, width)
+	startX, startY := findStart(grid)
+	mesh := GenerateMesh(grid, startX, startY)
+
+	if mesh.Looped || !mesh.DeadEnd {
+		t.Fatalf("a straight strip came out looped %v, dead end %v (%d waypoints); want an open track ending in a dead end",
+			mesh.Looped, mesh.DeadEnd, len(mesh.Waypoints))
+	}
+	first, last := mesh.Waypoints[0].Position, mesh.Waypoints[len(mesh.Waypoints)-1].Position
+	if first.X > 60 || last.X < length+20-width {
+		t.Errorf("mesh runs from x=%.0f to x=%.0f, want from the start band (45) to the far end (%d)", first.X, last.X, length+20)
+	}
+	for i := 1; i < len(mesh.Waypoints); i++ {
+		a, b := mesh.Waypoints[i-1].Position, mesh.Waypoints[i].Position
+		if b.X <= a.X || math.Abs(b.Y-(20+width/2)) > 2 {
+			t.Fatalf("waypoint %d at %v after %v: want straight down the middle, left to right", i, b, a)
+		}
+	}
+}
+
+// reachable flood-fills (4-connected) the non-wall cells reachable from (x, y).
+func reachable(g *Grid, x, y int) map[[2]int]bool {
+	seen := map[[2]int]bool{}
+	stack := [][2]int{{x, y}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[p] || g.Get(p[0], p[1]).Type == CellWall {
+			continue
+		}
+		seen[p] = true
+		stack = append(stack, [2]int{p[0] + 1, p[1]}, [2]int{p[0] - 1, p[1]}, [2]int{p[0], p[1] + 1}, [2]int{p[0], p[1] - 1})
+	}
+	return seen
+}
+
+// TestDownsampleKeepsThinWalls draws 1px walls (straight and diagonal) through tarmac and
+// checks that after downsampling they still split the track into separate regions.
+func TestDownsampleKeepsThinWalls(t *testing.T) {
+	const size = 101
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			img.Set(x, y, color.White) // Tarmac
+			if x == 50 || x == y {
+				img.Set(x, y, color.Black) // Wall
+			}
+		}
+	}
+
+	for _, k := range []int{1, 3, 4, 7} {
+		grid := downsample(img, k, ColorToCellType)
+		if want := (size + k - 1) / k; grid.Width != want || grid.Height != want {
+			t.Fatalf("k=%d: grid %dx%d, want %dx%d", k, grid.Width, grid.Height, want, want)
+		}
+		if grid.Scale != float64(k) {
+			t.Errorf("k=%d: scale %v, want %d", k, grid.Scale, k)
+		}
+
+		// Regions: below the diagonal left of x=50, below it right of x=50, and above it
+		cell := func(x, y int) (int, int) { return x / k, y / k }
+		lx, ly := cell(10, 40)
+		rx, ry := cell(90, 95)
+		ux, uy := cell(90, 10)
+		left := reachable(grid, lx, ly)
+		if len(left) == 0 {
+			t.Fatalf("k=%d: no tarmac left at (%d, %d)", k, lx, ly)
+		}
+		for _, p := range [][2]int{{rx, ry}, {ux, uy}} {
+			if left[p] {
+				t.Errorf("k=%d: cell %v reachable from (%d, %d) across a thin wall", k, p, lx, ly)
+			}
+		}
+		if !reachable(grid, rx, ry)[[2]int{rx, ry}] || !reachable(grid, ux, uy)[[2]int{ux, uy}] {
+			t.Errorf("k=%d: regions beside the walls were swallowed by them", k)
+		}
+	}
+}
+
+// TestGrayscaleGradientSplitsAtThreshold feeds a left-to-right gray ramp, stored both
+// as a single-channel image and as RGB, and checks it splits cleanly into wall and tarmac
+// at the threshold instead of going through the color rules.
+func TestGrayscaleGradientSplitsAtThreshold(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 256, 4))
+	rgb := image.NewRGBA(gray.Bounds())
+	for x := 0; x < 256; x++ {
+		for y := 0; y < 4; y++ {
+			gray.SetGray(x, y, color.Gray{Y: uint8(x)})
+			rgb.Set(x, y, color.Gray{Y: uint8(x)})
+		}
+	}
+
+	for _, threshold := range []uint8{0, 40, 200} {
+		want := threshold
+		if want == 0 {
+			want = DefaultGrayThreshold
+		}
+		for name, img := range map[string]image.Image{"gray": gray, "rgb": rgb} {
+			if !IsGrayscale(img) {
+				t.Fatalf("%s: not detected as grayscale", name)
+			}
+			opts := LoadOptions{GrayThreshold: threshold}
+			grid := downsample(img, 1, opts.classifier(img))
+			for x := 0; x < 256; x++ {
+				wantType := CellWall
+				if x >= int(want) {
+					wantType = CellTarmac
+				}
+				if got := grid.Get(x, 0).Type; got != wantType {
+					t.Errorf("%s, threshold %d: brightness %d is %v, want %v", name, want, x, got, wantType)
+					break
+				}
+			}
+		}
+	}
+
+	// Markers make an image color, so it keeps the color rules
+	rgb.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	if IsGrayscale(rgb) {
+		t.Error("image with a red marker detected as grayscale")
+	}
+}
+
+// writePNG encodes img as a PNG file at path.
+func writePNG(t testing.TB, path string, img image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkLoadTrackFromImage loads a large synthetic track, about 3000 pixels square:
+// classifying its pixels into the grid and generating the mesh from it.
+func BenchmarkLoadTrackFromImage(b *testing.B) {
+	e := Esses{Radius: 1400, Amplitude: 30, Wavelength: 260, Width: 40}
+	path := filepath.Join(b.TempDir(), "esses.png")
+	writePNG(b, path, e.Image())
+	b.ResetTimer()
+
+	for b.Loop() {
+		if _, _, err := LoadTrackFromImage(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestGenerateMeshEsses builds the mesh of a synthetic esses track from its rendered
+// image and checks it against the known centerline.
+func TestGenerateMeshEsses(t *testing.T) {
+	e := Esses{Radius: 250, Amplitude: 30, Wavelength: 260, Width: 40}
+	path := filepath.Join(t.TempDir(), "esses.png")
+	writePNG(t, path, e.Image())
+
+	_, mesh, err := LoadTrackFromImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh.ComputeDistances()
+	mesh.ComputeCurvature()
+
+	// Mean circumference of the loop (sum of chords of the true centerline)
+	want := 0.0
+	for i := 0; i < 3600; i++ {
+		a, b := 2*math.Pi*float64(i)/3600, 2*math.Pi*float64(i+1)/3600
+		want += e.Center(b).Sub(e.Center(a)).Len()
+	}
+	if math.Abs(mesh.TotalLen-want) > 0.05*want {
+		t.Fatalf("mesh is %.0f px around (%d waypoints), want one lap of about %.0f", mesh.TotalLen, len(mesh.Waypoints), want)
+	}
+
+	sum, worst := 0.0, 0.0
+	left, right := 0, 0
+	for _, wp := range mesh.Waypoints {
+		err := e.CenterlineError(wp.Position)
+		sum += err
+		worst = math.Max(worst, err)
+		if wp.Curvature > 0 {
+			right++
+		} else if wp.Curvature < 0 {
+			left++
+		}
+	}
+	if mean := sum / float64(len(mesh.Waypoints)); mean > 1 || worst > 3 {
+		t.Errorf("centerline error mean %.2f px, max %.2f px; want under 1 and 3", mean, worst)
+	}
+	if left == 0 || right == 0 {
+		t.Errorf("%d left-hand and %d right-hand waypoints; want corners both ways", left, right)
+	}
+}
+
+// TestMeshBoundariesFollowTheEdges checks the boundaries of a generated mesh lie on the
+// track's edges, half the width out from the true centerline on either side.
+// (CenterlineError measures radially, which overstates the distance across the wiggles.)
+func TestMeshBoundariesFollowTheEdges(t *testing.T) {
+	e := Esses{Radius: 250, Amplitude: 30, Wavelength: 260, Width: 40}
+	path := filepath.Join(t.TempDir(), "esses.png")
+	writePNG(t, path, e.Image())
+
+	_, mesh, err := LoadTrackFromImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left, right := mesh.GetBoundaries()
+	if len(left) != len(mesh.Waypoints) || len(right) != len(mesh.Waypoints) {
+		t.Fatalf("%d left and %d right boundary points for %d waypoints", len(left), len(right), len(mesh.Waypoints))
+	}
+
+	measured, sum, worst := 0, 0.0, 0.0
+	for i, wp := range mesh.Waypoints {
+		if wp.WallLeft > 0 && wp.WallRight > 0 {
+			measured++
+		}
+		for side, p := range map[string]common.Vec2{"left": left[i], "right": right[i]} {
+			off := p.Sub(wp.Position)
+			if across := off.X*wp.Normal.X + off.Y*wp.Normal.Y; (side == "left") != (across < 0) {
+				t.Fatalf("waypoint %d: %s boundary point %+v is on the wrong side", i, side, p)
+			}
+			err := math.Abs(centerlineDistance(e, p) - e.Width/2)
+			sum += err
+			worst = math.Max(worst, err)
+		}
+	}
+	if measured < len(mesh.Waypoints)*9/10 {
+		t.Errorf("only %d of %d waypoints have both edges measured", measured, len(mesh.Waypoints))
+	}
+	if mean := sum / float64(2*len(mesh.Waypoints)); mean > 1.5 || worst > 4 {
+		t.Errorf("boundary distance from the true edge: mean %.2f px, max %.2f px; want under 1.5 and 4", mean, worst)
+	}
+}
+
+// centerlineDistance is the shortest distance from p to the esses' true centerline.
+func centerlineDistance(e Esses, p common.Vec2) float64 {
+	best := math.Inf(1)
+	for i := 0; i < 7200; i++ {
+		best = math.Min(best, e.Center(2*math.Pi*float64(i)/7200).Sub(p).Len())
+	}
+	return best
+}
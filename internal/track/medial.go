@@ -0,0 +1,156 @@
+package track
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+	"racing-line-mapper/internal/imgproc"
+)
+
+// MedialStep is the spacing (grid cells) of the waypoints taken along the medial axis,
+// the same as the walker's step.
+const MedialStep = 6.0
+
+// GenerateMeshMedialAxis builds the centerline from the medial axis of the drivable
+// region instead of walking it: the region is thinned to its skeleton (see
+// imgproc.Thin), stubs are pruned until only loops remain, and the loop through the
+// start is traced into ordered waypoints whose widths come from the distance to the
+// nearest wall (see imgproc.DistanceTransform). Being centered by construction, it copes
+// with layouts that make the walker cut corners. The start and direction are found as by
+// the loader. The mesh is empty, or open, if no loop runs near the start.
+func GenerateMeshMedialAxis(grid *Grid) *TrackMesh {
+	startX, startY := findStart(grid)
+	return medialAxisMesh(grid, startX, startY, DetectStartHeading(grid, startX, startY))
+}
+
+// medialAxisMesh is GenerateMeshMedialAxis from a given start cell and heading (radians).
+func medialAxisMesh(grid *Grid, startX, startY int, heading float64) *TrackMesh {
+	drivable := imgproc.NewMask(grid.Width, grid.Height)
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			drivable.Set(x, y, grid.at(x, y).Type != CellWall)
+		}
+	}
+	dist := imgproc.DistanceTransform(drivable)
+	skel := imgproc.Thin(drivable)
+	pruneStubs(skel)
+
+	path, looped := traceSkeleton(skel, startX, startY, common.Vec2{X: math.Cos(heading), Y: math.Sin(heading)})
+
+	// A waypoint every MedialStep along the traced pixels
+	var wps []Waypoint
+	along := MedialStep // Distance since the last waypoint; take the first pixel
+	for i, p := range path {
+		if i > 0 {
+			along += math.Hypot(float64(p[0]-path[i-1][0]), float64(p[1]-path[i-1][1]))
+		}
+		if along < MedialStep {
+			continue
+		}
+		along = 0
+		wps = append(wps, Waypoint{
+			ID:       len(wps),
+			Position: common.Vec2{X: float64(p[0]) + 0.5, Y: float64(p[1]) + 0.5},
+			Width:    2 * dist[p[1]*grid.Width+p[0]],
+		})
+	}
+	if len(wps) < 3 {
+		return &TrackMesh{}
+	}
+	mesh := newMesh(smoothWaypoints(wps, looped), looped)
+	mesh.ResampleUniform(MedialStep) // Diagonal pixel steps left the spacing uneven
+	mesh.StartPosition = common.Vec2{X: float64(startX), Y: float64(startY)}
+	mesh.StartHeading = heading
+	return mesh
+}
+
+// neighbours8 are the offsets of the 8-connected neighbours of a pixel.
+var neighbours8 = [8][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+
+// pruneStubs repeatedly removes skeleton pixels with at most one neighbour, so the
+// branches that end in dead ends go and only the loops (and what links them) remain.
+func pruneStubs(skel *imgproc.Mask) {
+	degree := func(x, y int) int {
+		n := 0
+		for _, d := range neighbours8 {
+			if skel.At(x+d[0], y+d[1]) {
+				n++
+			}
+		}
+		return n
+	}
+
+	var queue [][2]int
+	for y := 0; y < skel.H; y++ {
+		for x := 0; x < skel.W; x++ {
+			if skel.At(x, y) && degree(x, y) <= 1 {
+				queue = append(queue, [2]int{x, y})
+			}
+		}
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if !skel.At(p[0], p[1]) || degree(p[0], p[1]) > 1 {
+			continue
+		}
+		skel.Set(p[0], p[1], false)
+		for _, d := range neighbours8 {
+			if q := [2]int{p[0] + d[0], p[1] + d[1]}; skel.At(q[0], q[1]) && degree(q[0], q[1]) <= 1 {
+				queue = append(queue, q)
+			}
+		}
+	}
+}
+
+// traceSkeleton follows the skeleton from its pixel nearest (startX, startY), setting off
+// along dir and at every fork keeping as straight on as it can, until it gets back to the
+// start (looped) or runs out of unvisited pixels.
+func traceSkeleton(skel *imgproc.Mask, startX, startY int, dir common.Vec2) (path [][2]int, looped bool) {
+	start, best := [2]int{-1, -1}, math.Inf(1)
+	for y := 0; y < skel.H; y++ {
+		for x := 0; x < skel.W; x++ {
+			if d := math.Hypot(float64(x-startX), float64(y-startY)); skel.At(x, y) && d < best {
+				start, best = [2]int{x, y}, d
+			}
+		}
+	}
+	if start[0] < 0 {
+		return nil, false
+	}
+
+	const (
+		lookBack    = 5  // Pixels the travel direction is measured over, smoothing the pixel staircase
+		closeRadius = 3  // Back within this many pixels of the start closes the loop
+		minLoop     = 30 // Pixels travelled before the loop may close
+	)
+	visited := map[[2]int]bool{start: true}
+	path = [][2]int{start}
+	cur := start
+	for {
+		next, score := [2]int{-1, -1}, math.Inf(-1)
+		for _, d := range neighbours8 {
+			q := [2]int{cur[0] + d[0], cur[1] + d[1]}
+			if !skel.At(q[0], q[1]) || visited[q] {
+				continue
+			}
+			step := common.Vec2{X: float64(d[0]), Y: float64(d[1])}.Normalize()
+			if s := step.X*dir.X + step.Y*dir.Y; s > score {
+				next, score = q, s
+			}
+		}
+		if next[0] < 0 {
+			return path, false
+		}
+
+		visited[next] = true
+		path = append(path, next)
+		cur = next
+		from := path[max(0, len(path)-1-lookBack)]
+		if v := (common.Vec2{X: float64(cur[0] - from[0]), Y: float64(cur[1] - from[1])}); v.Len() > 0 {
+			dir = v.Normalize()
+		}
+		if len(path) > minLoop && math.Hypot(float64(cur[0]-start[0]), float64(cur[1]-start[1])) <= closeRadius {
+			return path, true
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package track
+
+import (
+	"math"
+	"testing"
+)
+
+// TestGenerateMeshMedialAxisEsses traces the synthetic esses track's medial axis and
+// checks it against the known centerline and the walker's direction of travel.
+func TestGenerateMeshMedialAxisEsses(t *testing.T) {
+	e := Esses{Radius: 250, Amplitude: 30, Wavelength: 260, Width: 40}
+	img := e.Image()
+	grid := downsample(img, 1, ColorToCellType)
+	mesh := GenerateMeshMedialAxis(grid)
+	if !mesh.Looped {
+		t.Fatalf("medial-axis mesh of %d waypoints is open, want a loop", len(mesh.Waypoints))
+	}
+
+	want := 0.0
+	for i := 0; i < 3600; i++ {
+		a, b := 2*math.Pi*float64(i)/3600, 2*math.Pi*float64(i+1)/3600
+		want += e.Center(b).Sub(e.Center(a)).Len()
+	}
+	if math.Abs(mesh.TotalLen-want) > 0.05*want {
+		t.Errorf("mesh is %.0f px around (%d waypoints), want about %.0f", mesh.TotalLen, len(mesh.Waypoints), want)
+	}
+
+	sum, worst := 0.0, 0.0
+	for _, wp := range mesh.Waypoints {
+		err := e.CenterlineError(wp.Position)
+		sum += err
+		worst = math.Max(worst, err)
+		if math.Abs(wp.Width-e.Width) > 4 {
+			t.Errorf("waypoint %d width %.1f, want about %.0f", wp.ID, wp.Width, e.Width)
+		}
+	}
+	if mean := sum / float64(len(mesh.Waypoints)); mean > 1 || worst > 3 {
+		t.Errorf("centerline error mean %.2f px, max %.2f px; want under 1 and 3", mean, worst)
+	}
+
+	// Same start and direction as the walker
+	x, y := findStart(grid)
+	walker := GenerateMesh(grid, x, y)
+	a, b := mesh.Waypoints[0], walker.Waypoints[0]
+	if d := a.Position.Sub(b.Position).Len(); d > 2*MedialStep {
+		t.Errorf("first waypoint %+v, %.1f px from the walker's %+v", a.Position, d, b.Position)
+	}
+	if dot := a.Normal.X*b.Normal.X + a.Normal.Y*b.Normal.Y; dot < 0.9 {
+		t.Errorf("first normal %+v, walker's %+v: want the same direction of travel", a.Normal, b.Normal)
+	}
+}
@@ -3,21 +3,107 @@ package track
 import (
 	"math"
 	"racing-line-mapper/internal/common"
+	"sort"
+)
+
+// Phase labels where a waypoint sits relative to the nearest corner.
+type Phase int
+
+const (
+	PhaseStraight Phase = iota
+	PhaseBraking        // Approach to a corner, before turn-in
+	PhaseTurnIn         // Curvature rising towards the apex
+	PhaseApex           // Curvature peak
+	PhaseExit           // Curvature falling after the apex
+)
+
+// PhaseNames are display names indexed by Phase.
+var PhaseNames = [...]string{"Straight", "Braking", "Turn-in", "Apex", "Exit"}
+
+// Corner detection thresholds.
+const (
+	ApexMinCurvature     = 0.005 // |curvature| (rad/px) a corner must exceed to get an apex, i.e. radius < 200px
+	ApexNMSWindow        = 10    // Non-max suppression window (waypoints either side)
+	StraightCurvature    = 0.002 // Below this |curvature| the track counts as straight (radius > 500px)
+	BrakingZoneWaypoints = 8     // Length of the braking zone before turn-in
 )
 
 // Waypoint represents a point on the track centerline.
 type Waypoint struct {
-	ID       int
-	Position common.Vec2 // World coordinates (x, y)
-	Normal   common.Vec2 // Unit vector perpendicular to the track direction (pointing Right)
-	Width    float64     // Width of the track at this point
-	Distance float64     // Distance from start (s-coordinate)
+	ID        int
+	Position  common.Vec2 // World coordinates (x, y)
+	Normal    common.Vec2 // Unit vector perpendicular to the track direction (pointing Right)
+	Width     float64     // Width of the track at this point
+	WallLeft  float64     // Distance to the left edge (against Normal) as measured from the finished centerline; 0 if not measured (see Sides)
+	WallRight float64     // Distance to the right edge (along Normal); 0 if not measured
+	Distance  float64     // Distance from start (s-coordinate)
+	Curvature float64     // Signed curvature (radians per pixel). Positive = turning towards Normal (right)
+	Phase     Phase       // Corner phase, derived from the curvature profile
 }
 
 // TrackMesh represents the curvilinear coordinate system of the track.
 type TrackMesh struct {
 	Waypoints []Waypoint
 	TotalLen  float64
+	Looped    bool // The last waypoint connects back to the first (a circuit); false for an open track
+
+	// DeadEnd is set on an open mesh whose walk ran into the end of the road: a
+	// point-to-point track, rather than a circuit the walk failed to get round.
+	DeadEnd bool
+
+	// Where the mesh was seeded from: the start cell (the centroid of the start/finish
+	// cells unless a sidecar says otherwise) and the heading (radians, 0 = East) it set
+	// off in, from the direction marker if there is one (see DetectStartHeading)
+	StartPosition common.Vec2
+	StartHeading  float64
+
+	// The track edges, one point per waypoint (see ComputeBoundaries)
+	LeftBoundary  []common.Vec2
+	RightBoundary []common.Vec2
+}
+
+// Index maps a waypoint index that may have stepped past either end (e.g. i+k) back
+// onto the mesh: wrapping around a looped track, clamped to the first or last waypoint
+// of an open one. It returns -1 for an empty mesh.
+func (m *TrackMesh) Index(i int) int {
+	return wrapIndex(i, len(m.Waypoints), m.Looped)
+}
+
+// Next is the index of the waypoint after i (i itself at the end of an open track).
+func (m *TrackMesh) Next(i int) int { return m.Index(i + 1) }
+
+// Prev is the index of the waypoint before i (i itself at the start of an open track).
+func (m *TrackMesh) Prev(i int) int { return m.Index(i - 1) }
+
+// At returns waypoint Index(i), or the zero Waypoint for an empty mesh.
+func (m *TrackMesh) At(i int) Waypoint {
+	if len(m.Waypoints) == 0 {
+		return Waypoint{}
+	}
+	return m.Waypoints[m.Index(i)]
+}
+
+// StartPose is where a car starts the track: StartPosition facing StartHeading, or on a
+// mesh that wasn't seeded from an image (one built in code), the first waypoint facing
+// the second.
+func (m *TrackMesh) StartPose() (common.Vec2, float64) {
+	if m.StartPosition != (common.Vec2{}) || len(m.Waypoints) < 2 {
+		return m.StartPosition, m.StartHeading
+	}
+	wp, next := m.Waypoints[0].Position, m.Waypoints[1].Position
+	return wp, math.Atan2(next.Y-wp.Y, next.X-wp.X)
+}
+
+// wrapIndex is TrackMesh.Index for a bare slice of n waypoints.
+func wrapIndex(i, n int, looped bool) int {
+	switch {
+	case n == 0:
+		return -1
+	case looped:
+		return (i%n + n) % n
+	default:
+		return min(max(i, 0), n-1)
+	}
 }
 
 // GetClosestWaypoint finds the waypoint closest to the given world position.
@@ -43,12 +129,297 @@ func (m *TrackMesh) GetClosestWaypoint(pos common.Vec2) (Waypoint, int) {
 	return m.Waypoints[closestIdx], closestIdx
 }
 
+// NearSearchWindow is how many waypoints either side of the hint GetClosestWaypointNear searches.
+const NearSearchWindow = 20
+
+// GetClosestWaypointNear finds the closest waypoint within NearSearchWindow of hintIdx
+// (e.g. the car's last known waypoint), wrapping around the loop.
+// This keeps the lookup on the right section where the track runs close to itself
+// (a back straight next to the pit straight). It falls back to the global search
+// when hintIdx is unknown (< 0) or the local minimum is implausibly far (beyond the track width).
+func (m *TrackMesh) GetClosestWaypointNear(pos common.Vec2, hintIdx int) (Waypoint, int) {
+	n := len(m.Waypoints)
+	if hintIdx < 0 || hintIdx >= n || n <= 2*NearSearchWindow+1 {
+		return m.GetClosestWaypoint(pos)
+	}
+
+	minDistSq := math.MaxFloat64
+	closestIdx := -1
+
+	for k := -NearSearchWindow; k <= NearSearchWindow; k++ {
+		i := m.Index(hintIdx + k)
+		wp := m.Waypoints[i]
+		dx := pos.X - wp.Position.X
+		dy := pos.Y - wp.Position.Y
+		distSq := dx*dx + dy*dy
+		if distSq < minDistSq {
+			minDistSq = distSq
+			closestIdx = i
+		}
+	}
+
+	// Lost track of the car (teleport, respawn, or a huge jump): search everywhere
+	if minDistSq > m.Waypoints[closestIdx].Width*m.Waypoints[closestIdx].Width {
+		return m.GetClosestWaypoint(pos)
+	}
+
+	return m.Waypoints[closestIdx], closestIdx
+}
+
+// Waypoint width sanity limits.
+const (
+	MinWaypointWidth  = 4.0  // Narrowest width (pixels) treated as real; below this the wall raycasts failed
+	NominalTrackWidth = 50.0 // Width assumed where a waypoint's own width is unknown
+)
+
+// Degenerate reports whether the waypoint's width is unusable (both raycasts failed or the track pinched).
+func (wp Waypoint) Degenerate() bool {
+	return !(wp.Width >= MinWaypointWidth) // Also catches NaN
+}
+
+// Sides returns the distances from the waypoint to the track edges on its left and right:
+// the measured ones while they still add up to Width, and otherwise (never measured, or
+// the width has been filled in since) half the width each way.
+func (wp Waypoint) Sides() (left, right float64) {
+	if wp.WallLeft > 0 && wp.WallRight > 0 && math.Abs(wp.WallLeft+wp.WallRight-wp.Width) < 1e-6 {
+		return wp.WallLeft, wp.WallRight
+	}
+	return wp.Width / 2, wp.Width / 2
+}
+
+// ComputeBoundaries offsets every waypoint along its normal to the track edges either
+// side (see Waypoint.Sides), giving the left and right boundaries as polylines.
+func (m *TrackMesh) ComputeBoundaries() {
+	m.LeftBoundary = make([]common.Vec2, len(m.Waypoints))
+	m.RightBoundary = make([]common.Vec2, len(m.Waypoints))
+	for i, wp := range m.Waypoints {
+		left, right := wp.Sides()
+		m.LeftBoundary[i] = wp.Position.Sub(wp.Normal.Scale(left))
+		m.RightBoundary[i] = wp.Position.Add(wp.Normal.Scale(right))
+	}
+}
+
+// GetBoundaries returns the left and right track edges, a point per waypoint (on a looped
+// track each edge closes from its last point back to its first).
+func (m *TrackMesh) GetBoundaries() (left, right []common.Vec2) {
+	return m.LeftBoundary, m.RightBoundary
+}
+
+// FillDegenerateWidths replaces degenerate widths by linear interpolation between the
+// nearest valid waypoints on either side, wrapping around a looped track (the ends of an
+// open one take the nearest valid width). If no waypoint has a valid width, they all get
+// NominalTrackWidth.
+func (m *TrackMesh) FillDegenerateWidths() {
+	n := len(m.Waypoints)
+	first := -1
+	for i, wp := range m.Waypoints {
+		if !wp.Degenerate() {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		for i := range m.Waypoints {
+			m.Waypoints[i].Width = NominalTrackWidth
+		}
+		return
+	}
+
+	// Walk the loop once from the first valid waypoint, filling each run of
+	// degenerate waypoints between two valid ones.
+	prev := first
+	for k := 1; k <= n; k++ {
+		if !m.Looped && first+k >= n {
+			// Open track: no wrapping, both ends are held at their nearest valid width
+			for i := prev + 1; i < n; i++ {
+				m.Waypoints[i].Width = m.Waypoints[prev].Width
+			}
+			for i := 0; i < first; i++ {
+				m.Waypoints[i].Width = m.Waypoints[first].Width
+			}
+			break
+		}
+		i := m.Index(first + k)
+		if m.Waypoints[i].Degenerate() {
+			continue
+		}
+		gap := wrapIndex(i-prev, n, m.Looped)
+		if gap == 0 {
+			gap = n // Only one valid waypoint: the run wraps all the way around
+		}
+		w0, w1 := m.Waypoints[prev].Width, m.Waypoints[i].Width
+		for j := 1; j < gap; j++ {
+			t := float64(j) / float64(gap)
+			m.Waypoints[m.Index(prev+j)].Width = w0 + (w1-w0)*t
+		}
+		prev = i
+	}
+}
+
+// CurvatureSmoothWindow is the moving-average window applied to the raw curvature profile.
+// The raw three-point estimate is noisy at this waypoint spacing.
+const CurvatureSmoothWindow = 5
+
+// ComputeCurvature fills in Waypoint.Curvature from the waypoint positions:
+// the turn angle between consecutive segments divided by the local arc length,
+// then smoothed with a moving average.
+func (m *TrackMesh) ComputeCurvature() {
+	n := len(m.Waypoints)
+	if n < 3 {
+		return
+	}
+
+	raw := make([]float64, n)
+	for i := 0; i < n; i++ {
+		if m.Prev(i) == i || m.Next(i) == i {
+			continue // End of an open track: no turn to measure
+		}
+		prev := m.At(m.Prev(i)).Position
+		curr := m.Waypoints[i].Position
+		next := m.At(m.Next(i)).Position
+
+		a1 := math.Atan2(curr.Y-prev.Y, curr.X-prev.X)
+		a2 := math.Atan2(next.Y-curr.Y, next.X-curr.X)
+		da := a2 - a1
+		for da > math.Pi {
+			da -= 2 * math.Pi
+		}
+		for da < -math.Pi {
+			da += 2 * math.Pi
+		}
+
+		arc := (curr.Sub(prev).Len() + next.Sub(curr).Len()) / 2
+		if arc > 0 {
+			raw[i] = da / arc
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		sum := 0.0
+		for j := -CurvatureSmoothWindow / 2; j <= CurvatureSmoothWindow/2; j++ {
+			sum += raw[m.Index(i+j)]
+		}
+		m.Waypoints[i].Curvature = sum / float64(CurvatureSmoothWindow)
+	}
+}
+
+// Apexes returns the indices of the theoretical apexes: local maxima of |Curvature|
+// above minCurvature, with non-max suppression so only the strongest point within
+// +/- window waypoints is kept.
+func (m *TrackMesh) Apexes(minCurvature float64, window int) []int {
+	n := len(m.Waypoints)
+	var apexes []int
+	for i := 0; i < n; i++ {
+		k := math.Abs(m.Waypoints[i].Curvature)
+		if k < minCurvature {
+			continue
+		}
+
+		isMax := true
+		for j := -window; j <= window && isMax; j++ {
+			if j == 0 {
+				continue
+			}
+			idx := m.Index(i + j)
+			if idx == i {
+				continue // Clamped at the end of an open track
+			}
+			other := math.Abs(m.Waypoints[idx].Curvature)
+			// Strictly greater neighbours win; ties go to the earlier index
+			if other > k || (other == k && j < 0) {
+				isMax = false
+			}
+		}
+		if isMax {
+			apexes = append(apexes, i)
+		}
+	}
+	return apexes
+}
+
+// SegmentTypeAt is the corner Phase of waypoint Index(idx) (see ComputePhases), so a
+// reward or overlay can look ahead or behind without wrapping the index itself.
+// An empty mesh is all straight.
+func (m *TrackMesh) SegmentTypeAt(idx int) Phase {
+	return m.At(idx).Phase
+}
+
+// ComputePhases labels every waypoint with its corner Phase from the curvature profile:
+// each apex (see Apexes) gets the rising-curvature run before it as turn-in, the falling run
+// after it as exit, and BrakingZoneWaypoints of straight before the turn-in as the braking zone.
+// Everything else is straight. Requires ComputeCurvature.
+func (m *TrackMesh) ComputePhases() {
+	n := len(m.Waypoints)
+	for i := range m.Waypoints {
+		m.Waypoints[i].Phase = PhaseStraight
+	}
+
+	apexes := m.Apexes(ApexMinCurvature, ApexNMSWindow)
+	for _, a := range apexes {
+		m.Waypoints[a].Phase = PhaseApex
+	}
+
+	// inCorner: still curving the same way as the apex
+	inCorner := func(i int, sign float64) bool {
+		k := m.Waypoints[i].Curvature * sign
+		return k >= StraightCurvature && m.Waypoints[i].Phase == PhaseStraight
+	}
+
+	turnInStart := make([]int, len(apexes))
+	for c, a := range apexes {
+		sign := math.Copysign(1, m.Waypoints[a].Curvature)
+
+		i := a
+		for steps := 0; steps < n; steps++ {
+			prev := m.Prev(i)
+			if !inCorner(prev, sign) {
+				break
+			}
+			m.Waypoints[prev].Phase = PhaseTurnIn
+			i = prev
+		}
+		turnInStart[c] = i
+
+		i = a
+		for steps := 0; steps < n; steps++ {
+			next := m.Next(i)
+			if !inCorner(next, sign) {
+				break
+			}
+			m.Waypoints[next].Phase = PhaseExit
+			i = next
+		}
+	}
+
+	// Braking zones last, so they only claim what no corner did
+	for _, start := range turnInStart {
+		for k := 1; k <= BrakingZoneWaypoints; k++ {
+			i := m.Index(start - k)
+			if m.Waypoints[i].Phase != PhaseStraight {
+				break
+			}
+			m.Waypoints[i].Phase = PhaseBraking
+		}
+	}
+}
+
 // WorldToFrenet converts World (x,y) to Frenet (s,d).
 // s: Progress along track
 // d: Lateral offset (positive = right of center, negative = left)
 func (m *TrackMesh) WorldToFrenet(pos common.Vec2) (float64, float64) {
 	wp, _ := m.GetClosestWaypoint(pos)
+	return m.frenetFrom(wp, pos)
+}
 
+// WorldToFrenetNear is WorldToFrenet with the waypoint search kept near hintIdx
+// (see GetClosestWaypointNear).
+func (m *TrackMesh) WorldToFrenetNear(pos common.Vec2, hintIdx int) (float64, float64) {
+	wp, _ := m.GetClosestWaypointNear(pos, hintIdx)
+	return m.frenetFrom(wp, pos)
+}
+
+// frenetFrom is the Frenet (s,d) of pos measured from waypoint wp's frame.
+func (m *TrackMesh) frenetFrom(wp Waypoint, pos common.Vec2) (float64, float64) {
 	// Vector from Waypoint to Pos
 	dx := pos.X - wp.Position.X
 	dy := pos.Y - wp.Position.Y
@@ -57,10 +428,144 @@ func (m *TrackMesh) WorldToFrenet(pos common.Vec2) (float64, float64) {
 	// Normal is unit vector. Dot product gives scalar projection.
 	d := dx*wp.Normal.X + dy*wp.Normal.Y
 
-	// 's' is roughly the waypoint's distance.
-	// For more precision, we'd project onto the tangent and add that small delta.
-	// But for discrete RL, waypoint distance is sufficient.
-	s := wp.Distance
+	// 's' is the waypoint's distance plus the projection onto the tangent
+	// (Normal rotated -90 deg), so it varies continuously between waypoints.
+	s := wp.Distance + dx*wp.Normal.Y - dy*wp.Normal.X
+	if m.Looped && m.TotalLen > 0 {
+		s = math.Mod(math.Mod(s, m.TotalLen)+m.TotalLen, m.TotalLen)
+	}
 
 	return s, d
 }
+
+// ComputeDistances sets each waypoint's Distance to the arc length along the
+// centerline polyline from the first waypoint, and TotalLen to the length of
+// the closed loop (or of the polyline, for an open track), so Frenet s is in true pixels.
+func (m *TrackMesh) ComputeDistances() {
+	n := len(m.Waypoints)
+	if n == 0 {
+		m.TotalLen = 0
+		return
+	}
+	dist := 0.0
+	for i := range m.Waypoints {
+		if i > 0 {
+			dist += m.Waypoints[i].Position.Sub(m.Waypoints[i-1].Position).Len()
+		}
+		m.Waypoints[i].Distance = dist
+	}
+	m.TotalLen = dist
+	if m.Looped {
+		m.TotalLen += m.Waypoints[0].Position.Sub(m.Waypoints[n-1].Position).Len()
+	}
+}
+
+// frameAt interpolates the centerline frame (position, unit normal, width) at arc length s,
+// between the two waypoints bracketing it. s wraps around a looped track and is
+// clamped to the ends of an open one.
+func (m *TrackMesh) frameAt(s float64) (common.Vec2, common.Vec2, float64) {
+	if len(m.Waypoints) == 0 {
+		return common.Vec2{}, common.Vec2{}, 0
+	}
+	a, b, t := m.segmentAt(s)
+	pos := a.Position.Add(b.Position.Sub(a.Position).Scale(t))
+	normal := a.Normal.Add(b.Normal.Sub(a.Normal).Scale(t)).Normalize()
+	width := a.Width + (b.Width-a.Width)*t
+	return pos, normal, width
+}
+
+// sidesAt interpolates the distances to the track edges (see Waypoint.Sides) at arc length s.
+func (m *TrackMesh) sidesAt(s float64) (left, right float64) {
+	if len(m.Waypoints) == 0 {
+		return 0, 0
+	}
+	a, b, t := m.segmentAt(s)
+	al, ar := a.Sides()
+	bl, br := b.Sides()
+	return al + (bl-al)*t, ar + (br-ar)*t
+}
+
+// segmentAt finds the two waypoints bracketing arc length s and how far (0-1) s is from
+// the first to the second (see frameAt). The mesh must not be empty.
+func (m *TrackMesh) segmentAt(s float64) (a, b Waypoint, t float64) {
+	wps := m.Waypoints
+	n := len(wps)
+	if n == 1 {
+		return wps[0], wps[0], 0
+	}
+
+	base := wps[0].Distance
+	if !m.Looped {
+		s = math.Max(base, math.Min(s, wps[n-1].Distance))
+	} else if m.TotalLen > 0 {
+		s = base + math.Mod(math.Mod(s-base, m.TotalLen)+m.TotalLen, m.TotalLen)
+	}
+
+	// Last waypoint at or before s (the closing segment runs from the last waypoint back to the first)
+	i := sort.Search(n, func(k int) bool { return wps[k].Distance > s }) - 1
+	if i < 0 {
+		i = n - 1
+	}
+	j := m.Next(i)
+	d0, d1 := wps[i].Distance, wps[j].Distance
+	if j < i {
+		d1 += m.TotalLen
+	}
+	if d1 > d0 {
+		t = math.Max(0, math.Min(1, (s-d0)/(d1-d0)))
+	}
+	return wps[i], wps[j], t
+}
+
+// FrenetToWorld converts Frenet (s,d) back to World (x,y): the centerline point
+// at arc length s (interpolated between the bracketing waypoints), offset by d along the normal.
+func (m *TrackMesh) FrenetToWorld(s, d float64) common.Vec2 {
+	pos, normal, _ := m.frameAt(s)
+	return pos.Add(normal.Scale(d))
+}
+
+// ClampToTrack returns a copy of path with every point that lies outside the track
+// pulled back onto its nearest edge (same s, d clamped to the edge distances on that
+// side, see Waypoint.Sides). Points already on track are kept as is. Each point is
+// located near the one before it (see GetClosestWaypointNear), so a path along a
+// section that runs close to another stays on its own section.
+func (m *TrackMesh) ClampToTrack(path []common.Vec2) []common.Vec2 {
+	out := make([]common.Vec2, len(path))
+	hint := -1
+	for i, p := range path {
+		out[i], hint = m.clampNear(p, 0, hint)
+	}
+	return out
+}
+
+// NearestOnTrack returns the point at p's arc length s that is nearest to p while at
+// least margin inside the track edges on either side (see Waypoint.Sides), or midway
+// between them if the track is narrower than that. Points already that far inside are
+// returned as is. p is located near hintIdx, e.g. the car's checkpoint (see
+// GetClosestWaypointNear; -1 searches everywhere).
+func (m *TrackMesh) NearestOnTrack(p common.Vec2, margin float64, hintIdx int) common.Vec2 {
+	q, _ := m.clampNear(p, margin, hintIdx)
+	return q
+}
+
+// clampNear is NearestOnTrack, also returning the index of the waypoint p was located
+// from, to hint the next lookup.
+func (m *TrackMesh) clampNear(p common.Vec2, margin float64, hintIdx int) (common.Vec2, int) {
+	wp, idx := m.GetClosestWaypointNear(p, hintIdx)
+	if idx < 0 {
+		return p, idx
+	}
+	s, d := m.frenetFrom(wp, p)
+	left, right := m.sidesAt(s)
+	if left+right <= 0 {
+		return p, idx // Unknown width: nothing to clamp to
+	}
+	lo, hi := margin-left, right-margin
+	if lo > hi {
+		return m.FrenetToWorld(s, (lo+hi)/2), idx
+	}
+	if d >= lo && d <= hi {
+		return p, idx
+	}
+	return m.FrenetToWorld(s, math.Max(lo, math.Min(hi, d))), idx
+}
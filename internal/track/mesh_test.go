@@ -0,0 +1,367 @@
+package track
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+	"slices"
+	"testing"
+)
+
+// parallelMesh builds a long thin loop: an outbound straight along y=0
+// and a return straight along y=gap, joined by short end sections.
+// Waypoint i on the outbound straight sits right next to the return straight.
+func parallelMesh(gap float64) *TrackMesh {
+	var wps []Waypoint
+	add := func(x, y, nx, ny float64) {
+		wps = append(wps, Waypoint{
+			ID:       len(wps),
+			Position: common.Vec2{X: x, Y: y},
+			Normal:   common.Vec2{X: nx, Y: ny},
+			Width:    40,
+			Distance: float64(len(wps)) * 5,
+		})
+	}
+	for x := 0.0; x < 500; x += 5 { // Outbound, heading +X
+		add(x, 0, 0, 1)
+	}
+	for y := 0.0; y < gap; y += 5 { // Turn
+		add(500, y, -1, 0)
+	}
+	for x := 500.0; x > 0; x -= 5 { // Return, heading -X
+		add(x, gap, 0, -1)
+	}
+	for y := gap; y > 0; y -= 5 { // Turn back
+		add(0, y, 1, 0)
+	}
+	return &TrackMesh{Waypoints: wps, TotalLen: float64(len(wps)) * 5, Looped: true}
+}
+
+func TestIndexHelpersAtBoundaries(t *testing.T) {
+	wps := make([]Waypoint, 5)
+	for i := range wps {
+		wps[i].ID = i
+	}
+	looped := &TrackMesh{Waypoints: wps, Looped: true}
+	open := &TrackMesh{Waypoints: wps}
+
+	for _, tc := range []struct {
+		name      string
+		got, want int
+	}{
+		{"looped Next(last)", looped.Next(4), 0},
+		{"looped Prev(0)", looped.Prev(0), 4},
+		{"looped Index(-7)", looped.Index(-7), 3},
+		{"looped Index(12)", looped.Index(12), 2},
+		{"open Next(last)", open.Next(4), 4},
+		{"open Prev(0)", open.Prev(0), 0},
+		{"open Index(-7)", open.Index(-7), 0},
+		{"open Index(12)", open.Index(12), 4},
+		{"open Next(2)", open.Next(2), 3},
+		{"looped At(5).ID", looped.At(5).ID, 0},
+		{"open At(5).ID", open.At(5).ID, 4},
+		{"empty Index(0)", (&TrackMesh{Looped: true}).Index(0), -1},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %d, want %d", tc.name, tc.got, tc.want)
+		}
+	}
+	if wp := (&TrackMesh{}).At(3); wp != (Waypoint{}) {
+		t.Errorf("empty At(3) = %+v, want the zero Waypoint", wp)
+	}
+}
+
+func TestOpenTrackDoesNotWrap(t *testing.T) {
+	var wps []Waypoint
+	for i := 0; i < 10; i++ {
+		wps = append(wps, Waypoint{ID: i, Position: common.Vec2{X: float64(i) * 10}, Normal: common.Vec2{Y: 1}, Width: 20})
+	}
+	wps[0].Width, wps[9].Width = 0, 0 // Degenerate ends
+	m := &TrackMesh{Waypoints: wps}
+	m.ComputeDistances()
+	m.FillDegenerateWidths()
+
+	if m.TotalLen != 90 {
+		t.Errorf("TotalLen = %v, want 90 (no closing segment)", m.TotalLen)
+	}
+	if m.Waypoints[0].Width != 20 || m.Waypoints[9].Width != 20 {
+		t.Errorf("end widths = %v, %v; want the nearest valid width 20", m.Waypoints[0].Width, m.Waypoints[9].Width)
+	}
+	if p := m.FrenetToWorld(200, 0); p != (common.Vec2{X: 90}) {
+		t.Errorf("FrenetToWorld past the end = %+v, want the last waypoint", p)
+	}
+}
+
+// TestOpenMeshNeverWraps runs the per-waypoint passes over an open U: its ends sit 100px
+// apart, so anything reading across them would see a sharp turn at each end and a
+// segment cutting across the U's mouth.
+func TestOpenMeshNeverWraps(t *testing.T) {
+	u := func() *TrackMesh {
+		m := parallelMesh(100)
+		m.Waypoints = m.Waypoints[:len(m.Waypoints)-20] // Drop the turn back
+		m.Looped = false
+		m.ComputeDistances()
+		m.ComputeCurvature()
+		m.ComputePhases()
+		return m
+	}
+
+	m := u()
+	n := len(m.Waypoints)
+	speeds := m.TargetSpeeds(0.02, 10) // A 90 degree turn across the mouth would cap the ends at about 4.5
+	for _, i := range []int{0, 1, 2, n - 3, n - 2, n - 1} {
+		if speeds[i] != 10 {
+			t.Errorf("TargetSpeeds[%d] = %.2f, want the straight-line speed 10", i, speeds[i])
+		}
+	}
+
+	line := OptimizeRacingLine(m)
+	for _, i := range []int{1, 2, 3} { // The ends are pinned; a wrapped line is pulled across the mouth next to them
+		if d := math.Abs(line[i].Y); d > 1 {
+			t.Errorf("line[%d] is %.1fpx off the outbound straight, want the end of the line straight", i, d)
+		}
+		if d := math.Abs(line[n-1-i].Y - 100); d > 1 {
+			t.Errorf("line[%d] is %.1fpx off the return straight, want the end of the line straight", n-1-i, d)
+		}
+	}
+
+	length := m.TotalLen
+	m.ResampleUniform(4)
+	if math.Abs(m.TotalLen-length) > 0.01*length {
+		t.Errorf("resampled length %.1f, want about %.1f (no segment across the mouth)", m.TotalLen, length)
+	}
+	for i, wp := range m.Waypoints {
+		if p := wp.Position; p.Y > 1e-6 && p.Y < 100-1e-6 && p.X < 500-1e-6 {
+			t.Fatalf("resampled waypoint %d at %+v, want it on the U", i, p)
+		}
+	}
+}
+
+func TestGetClosestWaypointNearParallelSections(t *testing.T) {
+	m := parallelMesh(30)
+
+	// Car on the outbound straight (x=250), but drifted 16px towards the return straight,
+	// which is now 14px away: the global search picks the wrong section.
+	pos := common.Vec2{X: 250, Y: 16}
+	outboundIdx := 50
+
+	global, _ := m.GetClosestWaypoint(pos)
+	if global.Position.Y != 30 {
+		t.Fatalf("expected global search to be fooled onto the return straight, got %+v", global.Position)
+	}
+
+	near, idx := m.GetClosestWaypointNear(pos, outboundIdx-2)
+	if near.Position.Y != 0 || idx != outboundIdx {
+		t.Errorf("GetClosestWaypointNear = idx %d at %+v, want idx %d on the outbound straight", idx, near.Position, outboundIdx)
+	}
+}
+
+func TestGetClosestWaypointNearFallsBackWhenFar(t *testing.T) {
+	m := parallelMesh(30)
+
+	// Hint is on the far side of the loop: the local minimum is implausibly far,
+	// so it must fall back to the global answer.
+	pos := common.Vec2{X: 100, Y: 1}
+	_, want := m.GetClosestWaypoint(pos)
+	_, got := m.GetClosestWaypointNear(pos, len(m.Waypoints)/2+40)
+	if got != want {
+		t.Errorf("fallback idx = %d, want global idx %d", got, want)
+	}
+
+	// Unknown hint behaves like the global search
+	_, got = m.GetClosestWaypointNear(pos, -1)
+	if got != want {
+		t.Errorf("no-hint idx = %d, want global idx %d", got, want)
+	}
+}
+
+func TestGetClosestWaypointNearWrapsAround(t *testing.T) {
+	m := parallelMesh(30)
+
+	// Near the start of the loop with a hint at the very end: the window must wrap.
+	pos := common.Vec2{X: 5, Y: 0}
+	_, idx := m.GetClosestWaypointNear(pos, len(m.Waypoints)-1)
+	if idx != 1 {
+		t.Errorf("wrapped idx = %d, want 1", idx)
+	}
+}
+
+func TestFillDegenerateWidths(t *testing.T) {
+	m := parallelMesh(30)
+	n := len(m.Waypoints)
+	m.Waypoints[10].Width = 20
+	m.Waypoints[11].Width = 0
+	m.Waypoints[12].Width = 0
+	m.Waypoints[13].Width = 50
+	m.Waypoints[n-1].Width = 0 // Run that wraps past the end of the loop
+
+	m.FillDegenerateWidths()
+
+	if got := m.Waypoints[11].Width; got != 30 {
+		t.Errorf("width[11] = %.2f, want 30 (interpolated)", got)
+	}
+	if got := m.Waypoints[12].Width; got != 40 {
+		t.Errorf("width[12] = %.2f, want 40 (interpolated)", got)
+	}
+	if got := m.Waypoints[n-1].Width; got != 40 {
+		t.Errorf("width[n-1] = %.2f, want 40 (neighbours' width)", got)
+	}
+	for i, wp := range m.Waypoints {
+		if wp.Degenerate() {
+			t.Errorf("waypoint %d still degenerate (width %.2f)", i, wp.Width)
+		}
+	}
+}
+
+func TestWaypointSides(t *testing.T) {
+	tests := []struct {
+		wp          Waypoint
+		left, right float64
+	}{
+		{Waypoint{Width: 40, WallLeft: 15, WallRight: 25}, 15, 25}, // Measured off center
+		{Waypoint{Width: 40}, 20, 20},                              // Not measured
+		{Waypoint{Width: 30, WallLeft: 15, WallRight: 25}, 15, 15}, // Width filled in since
+	}
+	for _, tt := range tests {
+		if left, right := tt.wp.Sides(); left != tt.left || right != tt.right {
+			t.Errorf("%+v: sides %v, %v; want %v, %v", tt.wp, left, right, tt.left, tt.right)
+		}
+	}
+}
+
+func TestClampToTrack(t *testing.T) {
+	m := parallelMesh(100) // Width 40: edges at d = +-20
+
+	path := []common.Vec2{
+		{X: 250, Y: 5},   // On track
+		{X: 250, Y: -27}, // 7px off the left edge of the outbound straight
+		{X: 300, Y: 24},  // 4px off the right edge
+	}
+	got := m.ClampToTrack(path)
+
+	if got[0] != path[0] {
+		t.Errorf("on-track point moved: %+v -> %+v", path[0], got[0])
+	}
+	want := []common.Vec2{{X: 250, Y: -20}, {X: 300, Y: 20}}
+	for i, w := range want {
+		if g := got[i+1]; g.Sub(w).Len() > 1e-9 {
+			t.Errorf("point %d clamped to %+v, want %+v", i+1, g, w)
+		}
+	}
+}
+
+// TestClampToTrackPerSide clamps to each side's own edge where the centerline is off-center.
+func TestClampToTrackPerSide(t *testing.T) {
+	m := parallelMesh(100)
+	for i := range m.Waypoints {
+		m.Waypoints[i].WallLeft, m.Waypoints[i].WallRight = 30, 10 // Width 40, edges at d = -30 and +10
+	}
+
+	got := m.ClampToTrack([]common.Vec2{{X: 250, Y: -25}, {X: 250, Y: -35}, {X: 300, Y: 15}})
+	for i, w := range []common.Vec2{{X: 250, Y: -25}, {X: 250, Y: -30}, {X: 300, Y: 10}} {
+		if got[i].Sub(w).Len() > 1e-9 {
+			t.Errorf("point %d clamped to %+v, want %+v", i, got[i], w)
+		}
+	}
+}
+
+// TestClampToTrackFollowsThePath clamps a path along the outbound straight that strays
+// closer to the return straight than to its own centerline: each point is located near
+// the one before, so it's clamped back to the outbound straight's edge.
+func TestClampToTrackFollowsThePath(t *testing.T) {
+	m := parallelMesh(30) // The outbound straight reaches y = 20, the return one y = 10
+
+	var path []common.Vec2
+	for x := 100.0; x <= 150; x += 5 {
+		path = append(path, common.Vec2{X: x, Y: 0})
+	}
+	path = append(path, common.Vec2{X: 155, Y: 24}) // Nearer the return straight's waypoints
+	got := m.ClampToTrack(path)
+	if w := (common.Vec2{X: 155, Y: 20}); got[len(got)-1].Sub(w).Len() > 1e-9 {
+		t.Errorf("stray point clamped to %+v, want the outbound straight's edge %+v", got[len(got)-1], w)
+	}
+}
+
+func TestNearestOnTrackKeepsMargin(t *testing.T) {
+	m := parallelMesh(100) // Width 40: edges at d = +-20
+
+	if p := (common.Vec2{X: 250, Y: 10}); m.NearestOnTrack(p, 6, -1) != p {
+		t.Errorf("point well inside the margin moved: %+v", m.NearestOnTrack(p, 6, -1))
+	}
+	if g, w := m.NearestOnTrack(common.Vec2{X: 250, Y: -19}, 6, -1), (common.Vec2{X: 250, Y: -14}); g.Sub(w).Len() > 1e-9 {
+		t.Errorf("point near the edge pulled to %+v, want %+v", g, w)
+	}
+	if g, w := m.NearestOnTrack(common.Vec2{X: 300, Y: 30}, 25, -1), (common.Vec2{X: 300, Y: 0}); g.Sub(w).Len() > 1e-9 {
+		t.Errorf("margin wider than the track: got %+v, want the centerline %+v", g, w)
+	}
+}
+
+// TestNearestOnTrackUsesTheHint nudges a point that has strayed nearer the return
+// straight's waypoints back inside the outbound straight it was on.
+func TestNearestOnTrackUsesTheHint(t *testing.T) {
+	m := parallelMesh(30) // The outbound straight reaches y = 20, the return one y = 10
+	_, hint := m.GetClosestWaypoint(common.Vec2{X: 150, Y: 0})
+
+	if g, w := m.NearestOnTrack(common.Vec2{X: 155, Y: 24}, 6, hint), (common.Vec2{X: 155, Y: 14}); g.Sub(w).Len() > 1e-9 {
+		t.Errorf("nudged to %+v, want %+v inside the outbound straight", g, w)
+	}
+}
+
+// circleMesh is a clockwise (on screen) circular loop of radius r with n waypoints,
+// normals pointing right of travel, i.e. towards the center.
+func circleMesh(r float64, n int) *TrackMesh {
+	m := &TrackMesh{Looped: true}
+	for i := 0; i < n; i++ {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		m.Waypoints = append(m.Waypoints, Waypoint{
+			ID:       i,
+			Position: common.Vec2{X: r * math.Cos(a), Y: r * math.Sin(a)},
+			Normal:   common.Vec2{X: -math.Cos(a), Y: -math.Sin(a)},
+			Width:    40,
+		})
+	}
+	m.ComputeDistances()
+	return m
+}
+
+func TestFrenetRoundTrip(t *testing.T) {
+	for name, m := range map[string]*TrackMesh{
+		"tight": circleMesh(100, 100),
+		"wide":  circleMesh(500, 400),
+	} {
+		for s := 0.0; s < m.TotalLen; s += m.TotalLen / 97 {
+			for _, d := range []float64{-15, -4, 0, 3, 15} {
+				p := m.FrenetToWorld(s, d)
+				gotS, gotD := m.WorldToFrenet(p)
+				back := m.FrenetToWorld(gotS, gotD)
+				// Not exact: normals are interpolated linearly between waypoints,
+				// so the error grows with |d| and curvature.
+				if err := back.Sub(p).Len(); err > 1 {
+					t.Errorf("%s: (s=%.1f, d=%.1f) -> %+v -> (%.2f, %.2f) -> %+v: off by %.2fpx",
+						name, s, d, p, gotS, gotD, back, err)
+				}
+			}
+		}
+	}
+}
+
+// TestSegmentTypeAt checks a single corner reads straight, braking, turn-in, apex, exit,
+// straight in order, and that the lookup clamps past the ends of the open track.
+func TestSegmentTypeAt(t *testing.T) {
+	m := cornerMesh(40, 20)
+	var order []Phase
+	for i := range m.Waypoints {
+		if p := m.SegmentTypeAt(i); len(order) == 0 || order[len(order)-1] != p {
+			order = append(order, p)
+		}
+	}
+	want := []Phase{PhaseStraight, PhaseBraking, PhaseTurnIn, PhaseApex, PhaseExit, PhaseStraight}
+	if !slices.Equal(order, want) {
+		t.Errorf("phases in order %v, want %v", order, want)
+	}
+	if got := m.SegmentTypeAt(-5); got != PhaseStraight {
+		t.Errorf("SegmentTypeAt(-5) = %v, want the first waypoint's %v", got, PhaseStraight)
+	}
+	if got := (&TrackMesh{}).SegmentTypeAt(3); got != PhaseStraight {
+		t.Errorf("empty mesh: SegmentTypeAt(3) = %v, want %v", got, PhaseStraight)
+	}
+}
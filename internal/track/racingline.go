@@ -0,0 +1,158 @@
+package track
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+)
+
+// Racing line optimizer settings (see OptimizeRacingLine)
+const (
+	RacingLineMargin    = 3.0  // Clearance (pixels) kept from each track edge: about half the car's width, plus a pixel
+	RacingLineCoarsest  = 32   // The coarsest level keeps at least this many waypoints
+	RacingLineSweeps    = 500  // Most relaxation sweeps per level
+	RacingLineTolerance = 1e-3 // A level is done once no offset moves more than this (pixels) in a sweep
+)
+
+// OptimizeRacingLine returns a minimum-curvature line around the track, a point per
+// waypoint: each waypoint moved along its normal by the offset, within the track edges
+// less RacingLineMargin (see Waypoint.Sides), that minimizes the sum of the line's squared
+// second differences across the track (along each waypoint's normal). For evenly spaced
+// waypoints that is its total squared curvature. The part along the track is left out:
+// it only measures how unevenly the line's points are spaced, which cutting across a
+// corner always makes them, and counting it held the line back from the apexes.
+// The ends of an open track stay on the centerline.
+//
+// The offsets are a bounded quadratic program, solved by projected Gauss-Seidel: each
+// offset in turn is set to the value minimizing the terms it appears in, then clamped to
+// its bounds. Relaxation only straightens bends a few waypoints long quickly, so it runs
+// coarse to fine: first over every 2^k-th waypoint, each level's offsets interpolated as
+// the start of the next, down to every waypoint.
+func OptimizeRacingLine(mesh *TrackMesh) []common.Vec2 {
+	wps := mesh.Waypoints
+	n := len(wps)
+	lo, hi := make([]float64, n), make([]float64, n)
+	for i, wp := range wps {
+		left, right := wp.Sides()
+		lo[i], hi[i] = RacingLineMargin-left, right-RacingLineMargin
+		if lo[i] > hi[i] { // Narrower than the margins: hold the middle
+			lo[i] = (lo[i] + hi[i]) / 2
+			hi[i] = lo[i]
+		}
+	}
+	d := make([]float64, n)
+	for i := range d {
+		d[i] = math.Max(lo[i], math.Min(hi[i], 0))
+	}
+
+	if n >= 3 {
+		stride := 1
+		for n/(2*stride) >= RacingLineCoarsest {
+			stride *= 2
+		}
+		for ; stride >= 1; stride /= 2 {
+			lattice := lineLattice(n, stride, mesh.Looped)
+			relaxOffsets(wps, d, lo, hi, lattice, mesh.Looped)
+			interpolateOffsets(d, lo, hi, lattice, mesh.Looped)
+		}
+	}
+
+	line := make([]common.Vec2, n)
+	for i, wp := range wps {
+		line[i] = wp.Position.Add(wp.Normal.Scale(d[i]))
+	}
+	return line
+}
+
+// lineLattice is the waypoints a level of the optimizer works on: every stride-th one,
+// plus the last on an open track so its end stays put.
+func lineLattice(n, stride int, looped bool) []int {
+	var lattice []int
+	for i := 0; i < n; i += stride {
+		lattice = append(lattice, i)
+	}
+	if !looped && lattice[len(lattice)-1] != n-1 {
+		lattice = append(lattice, n-1)
+	}
+	return lattice
+}
+
+// relaxOffsets runs projected Gauss-Seidel sweeps over the offsets d of the lattice
+// waypoints (see OptimizeRacingLine) until they settle or RacingLineSweeps runs out.
+func relaxOffsets(wps []Waypoint, d, lo, hi []float64, lattice []int, looped bool) {
+	m := len(lattice)
+	if m < 3 {
+		return
+	}
+	point := func(q int) common.Vec2 {
+		i := lattice[wrapIndex(q, m, looped)]
+		return wps[i].Position.Add(wps[i].Normal.Scale(d[i]))
+	}
+	normal := func(q int) common.Vec2 { return wps[lattice[wrapIndex(q, m, looped)]].Normal }
+	// Second difference at lattice position q, across the track; ok is false where an
+	// open line has none
+	bend := func(q int) (b float64, ok bool) {
+		if !looped && (q < 1 || q > m-2) {
+			return 0, false
+		}
+		e := point(q - 1).Sub(point(q).Scale(2)).Add(point(q + 1))
+		n := normal(q)
+		return n.X*e.X + n.Y*e.Y, true
+	}
+
+	first, last := 0, m-1
+	if !looped {
+		first, last = 1, m-2 // The ends stay fixed
+	}
+	for sweep := 0; sweep < RacingLineSweeps; sweep++ {
+		moved := 0.0
+		for q := first; q <= last; q++ {
+			i := lattice[q]
+			// The offset moves the point along N(q), entering e(q) with weight -2 and e(q±1)
+			// with weight 1, so bend(p) changes at c = w * N(p).N(q) per pixel: along it the
+			// summed squares have gradient 2*sum(c * bend) and curvature 2*sum(c^2)
+			grad, curv := 0.0, 0.0
+			for k, w := range [3]float64{1, -2, 1} {
+				if b, ok := bend(q - 1 + k); ok {
+					np, nq := normal(q-1+k), normal(q)
+					c := w * (np.X*nq.X + np.Y*nq.Y)
+					grad += c * b
+					curv += c * c
+				}
+			}
+			if curv == 0 {
+				continue
+			}
+			next := math.Max(lo[i], math.Min(hi[i], d[i]-grad/curv))
+			moved = math.Max(moved, math.Abs(next-d[i]))
+			d[i] = next
+		}
+		if moved < RacingLineTolerance {
+			return
+		}
+	}
+}
+
+// interpolateOffsets fills in the offsets between the lattice waypoints linearly (the
+// gap after the last wrapping back to the first on a looped track), within their bounds.
+func interpolateOffsets(d, lo, hi []float64, lattice []int, looped bool) {
+	n, m := len(d), len(lattice)
+	for q := 0; q < m; q++ {
+		a := lattice[q]
+		b, gap := 0, 0
+		switch {
+		case q+1 < m:
+			b = lattice[q+1]
+			gap = b - a
+		case looped:
+			b = lattice[0]
+			gap = n - a + b
+		default:
+			continue
+		}
+		for j := 1; j < gap; j++ {
+			t := float64(j) / float64(gap)
+			i := wrapIndex(a+j, n, looped)
+			d[i] = math.Max(lo[i], math.Min(hi[i], d[a]+(d[b]-d[a])*t))
+		}
+	}
+}
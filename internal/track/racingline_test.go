@@ -0,0 +1,82 @@
+package track
+
+import (
+	"math"
+	"path/filepath"
+	"racing-line-mapper/internal/common"
+	"testing"
+)
+
+// squaredCurvature sums the squared curvature along a closed polyline: the turn at each
+// point over the mean length of the segments either side, squared, times that length.
+func squaredCurvature(line []common.Vec2) float64 {
+	n := len(line)
+	sum := 0.0
+	for i := range line {
+		a, b, c := line[(i+n-1)%n], line[i], line[(i+1)%n]
+		in, out := b.Sub(a), c.Sub(b)
+		turn := math.Atan2(in.X*out.Y-in.Y*out.X, in.X*out.X+in.Y*out.Y)
+		ds := (in.Len() + out.Len()) / 2
+		sum += turn * turn / ds
+	}
+	return sum
+}
+
+// TestOptimizeRacingLineStraightensEsses checks the optimized line through the esses cuts
+// across the wiggles, curving much less than the centerline, while staying on the track.
+func TestOptimizeRacingLineStraightensEsses(t *testing.T) {
+	e := Esses{Radius: 250, Amplitude: 30, Wavelength: 260, Width: 40}
+	path := filepath.Join(t.TempDir(), "esses.png")
+	writePNG(t, path, e.Image())
+	grid, mesh, err := LoadTrackFromImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := OptimizeRacingLine(mesh)
+	if len(line) != len(mesh.Waypoints) {
+		t.Fatalf("%d line points for %d waypoints", len(line), len(mesh.Waypoints))
+	}
+	center := make([]common.Vec2, len(mesh.Waypoints))
+	for i, wp := range mesh.Waypoints {
+		center[i] = wp.Position
+
+		left, right := wp.Sides()
+		off := line[i].Sub(wp.Position)
+		d := off.X*wp.Normal.X + off.Y*wp.Normal.Y
+		if d < RacingLineMargin-left-1e-9 || d > right-RacingLineMargin+1e-9 {
+			t.Fatalf("waypoint %d: offset %.2f outside [%.2f, %.2f]", i, d, RacingLineMargin-left, right-RacingLineMargin)
+		}
+		if grid.SurfaceAt(line[i]) == CellWall {
+			t.Fatalf("waypoint %d: line point %+v is in a wall", i, line[i])
+		}
+	}
+
+	if got, was := squaredCurvature(line), squaredCurvature(center); got > was/3 {
+		t.Errorf("squared curvature %.4f, centerline %.4f; want under a third of it", got, was)
+	}
+}
+
+// TestOptimizeRacingLineOpenTrack checks an open track's line keeps its ends on the
+// centerline while it cuts the corners in between.
+func TestOptimizeRacingLineOpenTrack(t *testing.T) {
+	m := parallelMesh(100)
+	m.Looped = false
+	line := OptimizeRacingLine(m)
+
+	n := len(line)
+	for _, i := range []int{0, n - 1} {
+		if line[i] != m.Waypoints[i].Position {
+			t.Errorf("end %d: line at %+v, want the centerline %+v", i, line[i], m.Waypoints[i].Position)
+		}
+	}
+	moved := 0
+	for i, p := range line {
+		if p.Sub(m.Waypoints[i].Position).Len() > 1 {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Error("the line follows the centerline everywhere, want it to cut the turns")
+	}
+}
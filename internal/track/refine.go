@@ -0,0 +1,180 @@
+package track
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+	"sync"
+)
+
+// RefineIterations is the number of elastic-band relaxation iterations GenerateMesh runs.
+const RefineIterations = 10
+
+// RefineWaypoints runs the "Elastic Band" centering: every iteration raycasts
+// left/right along each waypoint's normal and pulls it halfway towards the midpoint
+// between the walls. Waypoints are updated in place in red-black order: the even ones
+// first, from their odd neighbours, then the odd ones from the evens just moved (on a
+// loop with an odd count, the last waypoint neighbours the first and goes on its own,
+// last). No waypoint reads another of its own color, so each color's raycasts are
+// independent and are spread over `workers` goroutines, and the result is the same,
+// bit for bit, for any number of workers. looped says whether the last waypoint
+// neighbours the first (see TrackMesh.Looped).
+func RefineWaypoints(grid *Grid, waypoints []Waypoint, looped bool, iterations, workers int) []Waypoint {
+	n := len(waypoints)
+	refined := make([]Waypoint, n)
+	copy(refined, waypoints)
+
+	colors := refineColors(n, looped)
+	for iter := 0; iter < iterations; iter++ {
+		for _, color := range colors {
+			refineEach(grid, refined, looped, color, workers)
+		}
+	}
+
+	return refined
+}
+
+// refineColors splits the indices of n waypoints into the red-black groups RefineWaypoints
+// updates in turn, none holding two neighbours.
+func refineColors(n int, looped bool) [][]int {
+	colors := make([][]int, 2, 3)
+	for i := 0; i < n; i++ {
+		colors[i%2] = append(colors[i%2], i)
+	}
+	if looped && n%2 == 1 && n > 1 { // The last waypoint is even and neighbours the first
+		colors[0] = colors[0][:len(colors[0])-1]
+		colors = append(colors, []int{n - 1})
+	}
+	return colors
+}
+
+// refineEach refines the waypoints at the given indices in place, over up to `workers`
+// goroutines. None of them may neighbour another (see refineColors).
+func refineEach(grid *Grid, wps []Waypoint, looped bool, indices []int, workers int) {
+	workers = max(1, min(workers, len(indices)))
+	if workers == 1 {
+		for _, i := range indices {
+			wps[i] = refineWaypoint(grid, wps, looped, i)
+		}
+		return
+	}
+
+	chunk := (len(indices) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for lo := 0; lo < len(indices); lo += chunk {
+		hi := min(lo+chunk, len(indices))
+		wg.Add(1)
+		go func(indices []int) {
+			defer wg.Done()
+			for _, i := range indices {
+				wps[i] = refineWaypoint(grid, wps, looped, i)
+			}
+		}(indices[lo:hi])
+	}
+	wg.Wait()
+}
+
+// refineWaypoint returns waypoint i moved towards the track center, using its
+// neighbours in wps for the tangent. It only reads wps.
+func refineWaypoint(grid *Grid, wps []Waypoint, looped bool, i int) Waypoint {
+	n := len(wps)
+	wp := wps[i]
+
+	// Calculate approximate tangent from neighbors
+	prev := wps[wrapIndex(i-1, n, looped)]
+	next := wps[wrapIndex(i+1, n, looped)]
+
+	tx := next.Position.X - prev.Position.X
+	ty := next.Position.Y - prev.Position.Y
+
+	// Normal = (-ty, tx)
+	nx, ny := -ty, tx
+	l := math.Sqrt(nx*nx + ny*ny)
+	if l == 0 {
+		return wp
+	}
+	nx /= l
+	ny /= l
+
+	// Raycast Left/Right to find walls
+	dLeft, dRight, found := wallDistances(grid, wp.Position, common.Vec2{X: nx, Y: ny})
+
+	// Move point towards center
+	if found {
+		// We want dLeft == dRight.
+		// Error = dLeft - dRight.
+		// Correction = Error / 2
+		correction := (dLeft - dRight) / 2.0
+
+		// Alpha blend for stability (0.5)
+		wp.Position.X += nx * correction * 0.5
+		wp.Position.Y += ny * correction * 0.5
+
+		// Update Width estimate, keeping each side as it is from the moved point
+		// (dLeft is the one along the normal, i.e. on the right as the track is driven)
+		wp.Width = dLeft + dRight
+		wp.WallLeft = dRight + correction*0.5
+		wp.WallRight = dLeft - correction*0.5
+	}
+
+	return wp
+}
+
+// CenteringError measures how well the centerline sits between the walls: at every
+// waypoint it raycasts to both walls along the normal and takes |dLeft - dRight|, in
+// grid cells. A well-centered mesh has near-zero mean and max; a large max usually
+// means the walker cut a corner there and refinement didn't pull it back out. Waypoints
+// whose raycasts miss a wall are skipped.
+func (m *TrackMesh) CenteringError(grid *Grid) (mean, max float64) {
+	n := 0
+	for _, wp := range m.Waypoints {
+		dLeft, dRight, found := wallDistances(grid, wp.Position, wp.Normal)
+		if !found {
+			continue
+		}
+		e := math.Abs(dLeft - dRight)
+		mean += e
+		max = math.Max(max, e)
+		n++
+	}
+	if n > 0 {
+		mean /= float64(n)
+	}
+	return mean, max
+}
+
+// measureSides raycasts from every waypoint along its normal to the walls either side
+// and records the distances as its WallLeft and WallRight, and their sum as its Width,
+// then recomputes the boundaries. Refinement measures them where it leaves each
+// waypoint, but smoothing and resampling move the waypoints and turn their normals
+// after that, so on the finished centerline those are stale. Waypoints whose raycasts
+// miss a wall keep what they had.
+func (m *TrackMesh) measureSides(grid *Grid) {
+	for i := range m.Waypoints {
+		wp := &m.Waypoints[i]
+		dLeft, dRight, found := wallDistances(grid, wp.Position, wp.Normal)
+		if !found {
+			continue
+		}
+		// dLeft is the one along the normal, i.e. on the right as the track is driven
+		wp.WallLeft, wp.WallRight, wp.Width = dRight, dLeft, dLeft+dRight
+	}
+	m.ComputeBoundaries()
+}
+
+// wallDistances raycasts from pos along +normal and -normal and returns the distance to
+// the first wall cell each way. found is false if either ray runs out before a wall.
+func wallDistances(grid *Grid, pos, normal common.Vec2) (dLeft, dRight float64, found bool) {
+	cast := func(sign float64) (float64, bool) {
+		for d := 1.0; d < 80.0; d += 1.0 {
+			cx := int(pos.X + sign*normal.X*d)
+			cy := int(pos.Y + sign*normal.Y*d)
+			if grid.Get(cx, cy).Type == CellWall {
+				return d, true
+			}
+		}
+		return 0, false
+	}
+	dLeft, foundLeft := cast(1)
+	dRight, foundRight := cast(-1)
+	return dLeft, dRight, foundLeft && foundRight
+}
@@ -0,0 +1,163 @@
+package track
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+const benchTrack = "../../processed_tracks/monza_10m.jpg"
+
+// benchWaypoints loads the bench track and returns its grid plus a realistic
+// set of waypoints to refine (the generated mesh).
+func benchWaypoints(tb testing.TB) (*Grid, []Waypoint) {
+	tb.Helper()
+	grid, mesh, err := LoadTrackFromImage(benchTrack)
+	if err != nil {
+		tb.Skipf("bench track not available: %v", err)
+	}
+	return grid, mesh.Waypoints
+}
+
+func TestRefineWaypointsParallelMatchesSequential(t *testing.T) {
+	grid, wps := offCenterWaypoints(t)
+
+	for _, tc := range []struct {
+		name   string
+		wps    []Waypoint
+		looped bool
+	}{
+		{"loop", wps, true}, // An odd count: the last waypoint gets a color of its own
+		{"even loop", wps[:len(wps)-1], true},
+		{"open", wps, false},
+	} {
+		seq := RefineWaypoints(grid, tc.wps, tc.looped, RefineIterations, 1)
+		for _, workers := range []int{2, 3, 8, 64} {
+			par := RefineWaypoints(grid, tc.wps, tc.looped, RefineIterations, workers)
+			if !reflect.DeepEqual(seq, par) {
+				t.Errorf("%s (%d waypoints): RefineWaypoints with %d workers differs from one worker", tc.name, len(tc.wps), workers)
+			}
+		}
+	}
+}
+
+func TestRefineColors(t *testing.T) {
+	for _, n := range []int{1, 2, 5, 6} {
+		for _, looped := range []bool{false, true} {
+			seen := make([]int, n)
+			for _, color := range refineColors(n, looped) {
+				in := make(map[int]bool)
+				for _, i := range color {
+					seen[i]++
+					in[i] = true
+				}
+				for _, i := range color {
+					if j := wrapIndex(i+1, n, looped); j != i && in[j] {
+						t.Errorf("n %d, looped %v: waypoints %d and %d share a color", n, looped, i, j)
+					}
+				}
+			}
+			for i, c := range seen {
+				if c != 1 {
+					t.Errorf("n %d, looped %v: waypoint %d is in %d colors, want 1", n, looped, i, c)
+				}
+			}
+		}
+	}
+}
+
+// refineInPlace is the refinement GenerateMesh ran before RefineWaypoints: one pass over
+// the waypoints per iteration, in index order, updating them in place, so each
+// waypoint's tangent already sees its predecessor's move from the same pass
+// (Gauss-Seidel). That chain is what kept it sequential.
+func refineInPlace(grid *Grid, waypoints []Waypoint, looped bool, iterations int) []Waypoint {
+	wps := make([]Waypoint, len(waypoints))
+	copy(wps, waypoints)
+	for iter := 0; iter < iterations; iter++ {
+		for i := range wps {
+			prev, next := wps[wrapIndex(i-1, len(wps), looped)], wps[wrapIndex(i+1, len(wps), looped)]
+			nx, ny := -(next.Position.Y - prev.Position.Y), next.Position.X-prev.Position.X
+			l := math.Sqrt(nx*nx + ny*ny)
+			if l == 0 {
+				continue
+			}
+			nx /= l
+			ny /= l
+			if dLeft, dRight, found := wallDistances(grid, wps[i].Position, common.Vec2{X: nx, Y: ny}); found {
+				correction := (dLeft - dRight) / 2
+				wps[i].Position.X += nx * correction * 0.5
+				wps[i].Position.Y += ny * correction * 0.5
+			}
+		}
+	}
+	return wps
+}
+
+// offCenterWaypoints is the bench track's generated centerline knocked off-center, so
+// refinement has work to do.
+func offCenterWaypoints(tb testing.TB) (*Grid, []Waypoint) {
+	grid, wps := benchWaypoints(tb)
+	for i := range wps {
+		wps[i].Position = wps[i].Position.Add(wps[i].Normal.Scale(4 * math.Sin(float64(i)/15)))
+	}
+	return grid, wps
+}
+
+// TestRefineWaypointsNearInPlace compares RefineWaypoints' red-black order with the
+// in-place pass in index order it replaced. The two aren't bit-identical (a waypoint's
+// tangent sees a different mix of moved and unmoved neighbours), but the centerline must
+// come out in the same place to within the limits below.
+func TestRefineWaypointsNearInPlace(t *testing.T) {
+	const maxMeanShift, maxShift = 0.5, 1.5 // Cells
+	grid, wps := offCenterWaypoints(t)
+
+	want := refineInPlace(grid, wps, true, RefineIterations)
+	got := RefineWaypoints(grid, wps, true, RefineIterations, runtime.NumCPU())
+	mean, worst := 0.0, 0.0
+	for i := range got {
+		d := got[i].Position.Sub(want[i].Position).Len()
+		mean += d
+		worst = math.Max(worst, d)
+	}
+	mean /= float64(len(got))
+	t.Logf("%d waypoints moved by %.3f cells on average, %.2f at most", len(got), mean, worst)
+	if mean > maxMeanShift || worst > maxShift {
+		t.Errorf("centerline moved by %.3f cells on average, %.2f at most, from the in-place refinement; want at most %.2f and %.2f",
+			mean, worst, maxMeanShift, maxShift)
+	}
+}
+
+func TestCenteringError(t *testing.T) {
+	grid := ringGrid(100, 100, 80, 30, 0)
+	mesh := circleMesh(80, 120)
+	for i := range mesh.Waypoints {
+		mesh.Waypoints[i].Position = mesh.Waypoints[i].Position.Add(common.Vec2{X: 100, Y: 100})
+	}
+	if mean, max := mesh.CenteringError(grid); mean > 1.5 || max > 3 {
+		t.Errorf("centered mesh: error mean %.2f, max %.1f; want only pixel rounding", mean, max)
+	}
+
+	// Shift one waypoint 6 cells towards the outer wall: 12 cells of asymmetry there
+	wp := &mesh.Waypoints[30]
+	wp.Position = wp.Position.Sub(wp.Normal.Scale(6))
+	if _, max := mesh.CenteringError(grid); math.Abs(max-12) > 3 {
+		t.Errorf("off-center waypoint: max error %.1f, want about 12", max)
+	}
+}
+
+func BenchmarkRefineWaypoints(b *testing.B) {
+	grid, wps := benchWaypoints(b)
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			RefineWaypoints(grid, wps, true, RefineIterations, 1)
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			RefineWaypoints(grid, wps, true, RefineIterations, runtime.NumCPU())
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package track
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sidecar is the optional track metadata file stored next to a track image as
+// <trackname>.json. When present, its start point and heading seed the mesh
+// instead of the red start / yellow direction cells. Its coordinates are image pixels
+// and screen angles unless the track is loaded with another LoadOptions.Coords.
+//
+//	{"start_x": 412, "start_y": 108, "heading_deg": 0, "scale": 0.5}
+type Sidecar struct {
+	StartX     float64 `json:"start_x"`         // Start position, image pixels
+	StartY     float64 `json:"start_y"`         //
+	HeadingDeg float64 `json:"heading_deg"`     // Initial direction of travel: 0 = East (+x), 90 = South (+y, image down)
+	Scale      float64 `json:"scale,omitempty"` // Meters per pixel (optional; 0 keeps the grid default)
+}
+
+// SidecarPath returns the sidecar file path for a track image: same directory and name, .json extension.
+func SidecarPath(imagePath string) string {
+	return strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".json"
+}
+
+// LoadSidecar reads the sidecar for the given track image.
+// It returns nil without an error if the image has no sidecar.
+func LoadSidecar(imagePath string) (*Sidecar, error) {
+	data, err := os.ReadFile(SidecarPath(imagePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sc Sidecar
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", SidecarPath(imagePath), err)
+	}
+	if sc.Scale < 0 {
+		return nil, fmt.Errorf("%s: scale must be positive, got %v", SidecarPath(imagePath), sc.Scale)
+	}
+	return &sc, nil
+}
@@ -0,0 +1,38 @@
+package track
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSidecar(t *testing.T) {
+	dir := t.TempDir()
+	img := filepath.Join(dir, "monza.png")
+
+	// No sidecar: not an error
+	sc, err := LoadSidecar(img)
+	if err != nil || sc != nil {
+		t.Fatalf("missing sidecar: got %+v, %v; want nil, nil", sc, err)
+	}
+
+	json := `{"start_x": 412, "start_y": 108.5, "heading_deg": 90, "scale": 0.5}`
+	if err := os.WriteFile(filepath.Join(dir, "monza.json"), []byte(json), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sc, err = LoadSidecar(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Sidecar{StartX: 412, StartY: 108.5, HeadingDeg: 90, Scale: 0.5}
+	if *sc != want {
+		t.Errorf("LoadSidecar = %+v, want %+v", *sc, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "monza.json"), []byte(`{"start_x": `), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSidecar(img); err == nil {
+		t.Error("malformed sidecar: expected an error")
+	}
+}
@@ -0,0 +1,190 @@
+package track
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+	"sort"
+)
+
+// Spacing places waypoints by curvature instead of at the walker's uniform step: dense
+// through tight corners, where the racing line and the state discretization need the
+// precision, and sparse along the straights. The zero value keeps the uniform spacing.
+type Spacing struct {
+	TurnPerWaypoint float64 // Heading change (radians) between consecutive waypoints; 0 = off
+	Min, Max        float64 // Clamp on the spacing (pixels)
+}
+
+// DefaultAdaptiveSpacing spans the walker's 6px step: 2px through hairpins, 10px on straights.
+var DefaultAdaptiveSpacing = Spacing{TurnPerWaypoint: 0.05, Min: 2, Max: 10}
+
+// Enabled reports whether the spacing adapts to curvature.
+func (sp Spacing) Enabled() bool { return sp.TurnPerWaypoint > 0 }
+
+// at is the spacing for a centerline with |curvature| k: inversely proportional to
+// the curvature, so every waypoint turns by about TurnPerWaypoint, within [Min, Max].
+func (sp Spacing) at(k float64) float64 {
+	if k <= 0 {
+		return sp.Max
+	}
+	return math.Max(sp.Min, math.Min(sp.Max, sp.TurnPerWaypoint/k))
+}
+
+// Resample replaces the waypoints with ones spaced by sp along the current centerline
+// (see Spacing), interpolating position, normal, width and edges between the old waypoints.
+// Distances, curvature and phases are recomputed, so s stays the arc length along the
+// new polyline. It needs Curvature to be computed and does nothing if sp is disabled.
+func (m *TrackMesh) Resample(sp Spacing) {
+	n := len(m.Waypoints)
+	if !sp.Enabled() || n < 3 {
+		return
+	}
+
+	start := m.Waypoints[0].Distance
+	end := m.Waypoints[n-1].Distance
+	if m.Looped {
+		end = start + m.TotalLen
+	}
+
+	var stations []float64
+	for s := start; s < end-sp.Min/2; {
+		stations = append(stations, s)
+		// Look a whole long step ahead, so a straight's spacing doesn't carry into a corner
+		s += sp.at(m.maxCurvature(s, s+sp.Max))
+	}
+	if !m.Looped {
+		stations = append(stations, end) // Keep the end of an open track where it was
+	}
+	m.resampleAt(stations)
+}
+
+// Uniform resampling settings (see ResampleUniform)
+const UniformSpacingIterations = 50 // Bisection steps on the spacing that makes the last one come out even
+
+// ResampleUniform replaces the waypoints with ones equally spaced along the current
+// centerline, as close to step apart as divides its length evenly, interpolating them as
+// Resample does. Distances, curvature and phases are recomputed, and come out even: the
+// new waypoints are placed the same straight-line distance apart (not merely at equal
+// arc lengths of the old centerline, whose chords would be shorter where it bends), with
+// that distance chosen so the last gap, back to the start of a loop or to the end of an
+// open track, is the same as the others.
+func (m *TrackMesh) ResampleUniform(step float64) {
+	n := len(m.Waypoints)
+	if step <= 0 || n < 3 {
+		return
+	}
+
+	// The centerline as a polyline with the arc length at each point, closed if looped
+	pts := make([]common.Vec2, 0, n+1)
+	cum := make([]float64, 0, n+1)
+	for _, wp := range m.Waypoints {
+		pts = append(pts, wp.Position)
+		cum = append(cum, wp.Distance)
+	}
+	if m.Looped {
+		pts = append(pts, pts[0])
+		cum = append(cum, cum[0]+m.TotalLen)
+	}
+	count := max(2, int(math.Round((cum[len(cum)-1]-cum[0])/step)))
+
+	// walk steps along the polyline from its start a chord of h at a time, giving the
+	// arc length of each of the count points and the gap left from the last to the end
+	walk := func(h float64) (stations []float64, gap float64, ok bool) {
+		stations = append(make([]float64, 0, count+1), cum[0])
+		p, seg := pts[0], 0
+		for len(stations) < count {
+			for ; seg < len(pts)-1; seg++ {
+				if t, ok := chordExit(pts[seg], pts[seg+1], p, h); ok {
+					p = pts[seg].Add(pts[seg+1].Sub(pts[seg]).Scale(t))
+					stations = append(stations, cum[seg]+t*(cum[seg+1]-cum[seg]))
+					break
+				}
+			}
+			if seg == len(pts)-1 {
+				return nil, 0, false // Ran off the end
+			}
+		}
+		return stations, pts[len(pts)-1].Sub(p).Len(), true
+	}
+
+	// Too long a chord runs off the end or leaves less than itself, too short leaves more
+	h := (cum[len(cum)-1] - cum[0]) / float64(count)
+	lo, hi := h/2, 2*h
+	for range UniformSpacingIterations {
+		h = (lo + hi) / 2
+		if _, gap, ok := walk(h); !ok || gap < h {
+			hi = h
+		} else {
+			lo = h
+		}
+	}
+	stations, _, ok := walk(lo)
+	if !ok {
+		return
+	}
+	if !m.Looped {
+		stations = append(stations, cum[len(cum)-1]) // The end of an open track
+	}
+	m.resampleAt(stations)
+}
+
+// chordExit finds where the segment from a to b leaves the circle of radius h around p:
+// the t in [0, 1] of the point a + t*(b-a) at distance h from p, past any point inside
+// the circle. ok is false if b is still inside it.
+func chordExit(a, b, p common.Vec2, h float64) (t float64, ok bool) {
+	if b.Sub(p).Len() < h {
+		return 0, false
+	}
+	d, ap := b.Sub(a), a.Sub(p)
+	qa := d.X*d.X + d.Y*d.Y
+	qb := 2 * (ap.X*d.X + ap.Y*d.Y)
+	qc := ap.X*ap.X + ap.Y*ap.Y - h*h
+	disc := qb*qb - 4*qa*qc
+	if qa == 0 || disc < 0 {
+		return 0, false
+	}
+	t = (-qb + math.Sqrt(disc)) / (2 * qa)
+	return t, t >= 0 && t <= 1
+}
+
+// resampleAt replaces the waypoints with ones at the given arc lengths along the current
+// centerline and recomputes everything derived from them.
+func (m *TrackMesh) resampleAt(stations []float64) {
+	wps := make([]Waypoint, len(stations))
+	for k, s := range stations {
+		pos, normal, width := m.frameAt(s)
+		left, right := m.sidesAt(s)
+		wps[k] = Waypoint{ID: k, Position: pos, Normal: normal, Width: width, WallLeft: left, WallRight: right}
+	}
+
+	m.Waypoints = wps
+	m.ComputeDistances()
+	m.ComputeCurvature()
+	m.ComputePhases()
+	m.ComputeBoundaries()
+}
+
+// maxCurvature is the largest |Curvature| over the waypoints between arc lengths
+// from and to (from < to), including the one just before from.
+func (m *TrackMesh) maxCurvature(from, to float64) float64 {
+	wps := m.Waypoints
+	n := len(wps)
+	i := max(0, sort.Search(n, func(k int) bool { return wps[k].Distance > from })-1)
+
+	k := 0.0
+	for step := 0; step < n; step++ {
+		j := i + step
+		if !m.Looped && j >= n {
+			break
+		}
+		wp := m.At(j)
+		d := wp.Distance
+		if j >= n {
+			d += m.TotalLen
+		}
+		if step > 0 && d > to {
+			break
+		}
+		k = math.Max(k, math.Abs(wp.Curvature))
+	}
+	return k
+}
@@ -0,0 +1,89 @@
+package track
+
+import (
+	"math"
+	"racing-line-mapper/internal/common"
+	"testing"
+)
+
+// TestResampleDensifiesCorners checks that curvature-adaptive spacing puts more waypoints
+// through a tight corner than along a straight of the same length, and that s is still
+// the arc length along the resampled centerline.
+func TestResampleDensifiesCorners(t *testing.T) {
+	const r = 40.0
+	m := cornerMesh(r, 20)
+	length := m.Waypoints[len(m.Waypoints)-1].Distance
+	m.Resample(DefaultAdaptiveSpacing)
+
+	arc := math.Pi / 2 * r
+	corner, straight := 0, 0
+	for _, wp := range m.Waypoints {
+		p := wp.Position
+		switch {
+		case p.X >= 0 && p.X <= r && p.Y >= 0 && p.Y < r:
+			corner++
+		case p.Y == 0 && p.X >= -150 && p.X < -150+arc:
+			straight++
+		}
+	}
+	if corner <= 2*straight {
+		t.Errorf("%d waypoints through the corner, %d along a straight as long; want the corner at least twice as dense", corner, straight)
+	}
+
+	last := m.Waypoints[len(m.Waypoints)-1]
+	if math.Abs(last.Distance-length) > 0.01*length {
+		t.Errorf("resampled length %.1f, want %.1f", last.Distance, length)
+	}
+	for i, wp := range m.Waypoints {
+		if i > 0 && wp.Distance <= m.Waypoints[i-1].Distance {
+			t.Fatalf("waypoint %d at s=%.2f, not past waypoint %d at s=%.2f", i, wp.Distance, i-1, m.Waypoints[i-1].Distance)
+		}
+		if s, _ := m.WorldToFrenet(wp.Position); math.Abs(s-wp.Distance) > 1e-6 {
+			t.Errorf("waypoint %d: Frenet s=%.3f, Distance %.3f", i, s, wp.Distance)
+		}
+	}
+
+	uniform := cornerMesh(r, 20)
+	n := len(uniform.Waypoints)
+	uniform.Resample(Spacing{})
+	if len(uniform.Waypoints) != n {
+		t.Errorf("zero Spacing changed the waypoint count from %d to %d", n, len(uniform.Waypoints))
+	}
+}
+
+// TestResampleUniform checks that uniform resampling spaces the waypoints evenly, the gap
+// closing a loop included, and keeps s the arc length along the new centerline.
+func TestResampleUniform(t *testing.T) {
+	open := cornerMesh(40, 20)
+	looped := parallelMesh(60)
+	looped.ComputeDistances()
+	for name, m := range map[string]*TrackMesh{"open": open, "looped": looped} {
+		length := m.TotalLen
+		m.ResampleUniform(6)
+
+		n := len(m.Waypoints)
+		gaps := make([]float64, 0, n)
+		for i := 1; i < n; i++ {
+			gaps = append(gaps, m.Waypoints[i].Distance-m.Waypoints[i-1].Distance)
+		}
+		if m.Looped {
+			gaps = append(gaps, m.TotalLen-m.Waypoints[n-1].Distance)
+		}
+		for i, gap := range gaps {
+			if math.Abs(gap-gaps[0]) > 1e-6 || math.Abs(gap-6) > 0.5 {
+				t.Fatalf("%s: gap %d is %.6f, gap 0 is %.6f; want them equal and about 6", name, i, gap, gaps[0])
+			}
+		}
+		if math.Abs(m.TotalLen-length) > 0.01*length {
+			t.Errorf("%s: resampled length %.1f, want about %.1f", name, m.TotalLen, length)
+		}
+		for i, wp := range m.Waypoints {
+			if wp.ID != i {
+				t.Fatalf("%s: waypoint %d has ID %d", name, i, wp.ID)
+			}
+		}
+	}
+	if first, last := open.Waypoints[0].Position, open.Waypoints[len(open.Waypoints)-1].Position; first != (common.Vec2{X: -200}) || last.Sub(common.Vec2{X: 40, Y: 235}).Len() > 1e-9 {
+		t.Errorf("open track runs from %+v to %+v, want its ends kept", first, last)
+	}
+}
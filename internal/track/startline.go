@@ -0,0 +1,46 @@
+package track
+
+import "racing-line-mapper/internal/common"
+
+// StartLine is the start/finish line: straight across the track at the first waypoint.
+type StartLine struct {
+	A, B common.Vec2 // Ends, from the left edge of the track to the right
+}
+
+// StartLine returns the start/finish line, or false for an empty mesh.
+func (m *TrackMesh) StartLine() (StartLine, bool) {
+	if len(m.Waypoints) == 0 {
+		return StartLine{}, false
+	}
+	wp := m.Waypoints[0]
+	half := wp.Width / 2
+	if wp.Degenerate() {
+		half = NominalTrackWidth / 2
+	}
+	return StartLine{A: wp.Position.Sub(wp.Normal.Scale(half)), B: wp.Position.Add(wp.Normal.Scale(half))}, true
+}
+
+// cross is the z component of a x b: twice the signed area of the triangle they span.
+func cross(a, b common.Vec2) float64 {
+	return a.X*b.Y - a.Y*b.X
+}
+
+// ahead is the signed area of p against the line: positive past it in the direction of
+// travel, negative before it. With A on the left and B on the right (Normal points
+// right of travel), travel runs from B-A towards p in the cross product's sense.
+func (l StartLine) ahead(p common.Vec2) float64 {
+	return cross(p.Sub(l.A), l.B.Sub(l.A))
+}
+
+// Crossed reports whether moving from prev to curr crossed the line forwards. The move
+// must start strictly before the line and end on or past it, so a car sitting on the
+// line doesn't cross it again every tick, and it must pass between the ends rather than
+// around them. However long the move, a crossing isn't missed.
+func (l StartLine) Crossed(prev, curr common.Vec2) bool {
+	if !(l.ahead(prev) < 0 && l.ahead(curr) >= 0) {
+		return false
+	}
+	move := curr.Sub(prev)
+	sa, sb := cross(move, l.A.Sub(prev)), cross(move, l.B.Sub(prev))
+	return (sa <= 0 && sb >= 0) || (sa >= 0 && sb <= 0)
+}
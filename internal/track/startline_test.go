@@ -0,0 +1,41 @@
+package track
+
+import (
+	"racing-line-mapper/internal/common"
+	"testing"
+)
+
+func TestStartLineCrossing(t *testing.T) {
+	// Track heading +X through the origin (normal +Y), 20 wide: the line runs from (0,-10) to (0,10)
+	mesh := &TrackMesh{Waypoints: []Waypoint{
+		{Position: common.Vec2{}, Normal: common.Vec2{Y: 1}, Width: 20},
+		{Position: common.Vec2{X: 5}, Normal: common.Vec2{Y: 1}, Width: 20},
+	}}
+	line, ok := mesh.StartLine()
+	if !ok {
+		t.Fatal("no start line")
+	}
+
+	v := func(x, y float64) common.Vec2 { return common.Vec2{X: x, Y: y} }
+	for _, tc := range []struct {
+		name       string
+		prev, curr common.Vec2
+		want       bool
+	}{
+		{"forward", v(-1, 0), v(1, 0), true},
+		{"forward at an angle", v(-3, -6), v(2, 4), true},
+		{"forward in one long step", v(-40, 2), v(40, -2), true},
+		{"forward onto the line", v(-1, 5), v(0, 5), true},
+		{"forward off the line", v(0, 5), v(1, 5), false},
+		{"backward", v(1, 0), v(-1, 0), false},
+		{"near miss past the end", v(-1, 11), v(1, 11), false},
+		{"near miss, angled past the end", v(-2, 8), v(2, 14), false},
+		{"idling before the line", v(-0.5, 0), v(-0.2, 0), false},
+		{"idling past the line", v(0.2, 0), v(0.5, 0), false},
+		{"along the line", v(0, -5), v(0, 5), false},
+	} {
+		if got := line.Crossed(tc.prev, tc.curr); got != tc.want {
+			t.Errorf("%s: %v -> %v crossed = %v, want %v", tc.name, tc.prev, tc.curr, got, tc.want)
+		}
+	}
+}
@@ -1,6 +1,14 @@
 package track
 
-import "image/color"
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"math"
+	"racing-line-mapper/internal/common"
+)
 
 // CellType represents the type of surface in a grid cell.
 type CellType int
@@ -20,33 +28,116 @@ type Cell struct {
 	Friction float64 // 1.0 for Tarmac, 0.5 for Gravel, etc.
 }
 
-// Grid represents the discretized track.
+// Grid represents the discretized track. Its cells are read and written through Get
+// and Set.
 type Grid struct {
 	Width, Height int
-	Cells         [][]Cell
 	Scale         float64 // Meters per pixel/cell
+
+	cells []Cell // Row by row: cell (x, y) is cells[y*Width+x]
+	hash  string // See Hash
 }
 
 // NewGrid creates a new grid of the specified size.
 func NewGrid(width, height int) *Grid {
-	cells := make([][]Cell, width)
-	for i := range cells {
-		cells[i] = make([]Cell, height)
-	}
 	return &Grid{
 		Width:  width,
 		Height: height,
-		Cells:  cells,
 		Scale:  1.0, // Default 1 meter per cell
+		cells:  make([]Cell, width*height),
 	}
 }
 
+// at is the cell at (x, y), which must be in bounds: the one place that knows the
+// grid's layout in memory.
+func (g *Grid) at(x, y int) *Cell {
+	return &g.cells[y*g.Width+x]
+}
+
 // Get returns the cell at (x, y). Returns Wall if out of bounds.
 func (g *Grid) Get(x, y int) Cell {
 	if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
 		return Cell{Type: CellWall, Friction: 0.0}
 	}
-	return g.Cells[x][y]
+	return *g.at(x, y)
+}
+
+// Set replaces the cell at (x, y); out of bounds it does nothing. Like any change to
+// the grid, it is only meant for building one, before its Hash is taken.
+func (g *Grid) Set(x, y int, c Cell) {
+	if x < 0 || x >= g.Width || y < 0 || y >= g.Height {
+		return
+	}
+	*g.at(x, y) = c
+}
+
+// CellAt returns the cell containing the world point pos. Cell (x, y) covers
+// [x, x+1) x [y, y+1), so the coordinates are floored (truncating would put points just
+// above or left of the grid into its first row or column). Wall if out of bounds.
+func (g *Grid) CellAt(pos common.Vec2) Cell {
+	return g.Get(int(math.Floor(pos.X)), int(math.Floor(pos.Y)))
+}
+
+// SurfaceAt is the surface at the world point pos (see CellAt).
+func (g *Grid) SurfaceAt(pos common.Vec2) CellType {
+	return g.CellAt(pos).Type
+}
+
+// FrictionAt is the friction at the world point pos (see CellAt).
+func (g *Grid) FrictionAt(pos common.Vec2) float64 {
+	return g.CellAt(pos).Friction
+}
+
+// SurfaceInRadius is the worst surface (the one with the least grip: wall, then gravel,
+// then the rest) of any cell within r of the world point pos, e.g. under a car's
+// footprint. With r <= 0 it is SurfaceAt.
+func (g *Grid) SurfaceInRadius(pos common.Vec2, r float64) CellType {
+	worst := g.SurfaceAt(pos)
+	if r <= 0 {
+		return worst
+	}
+	for x := int(math.Floor(pos.X - r)); x <= int(math.Floor(pos.X+r)); x++ {
+		for y := int(math.Floor(pos.Y - r)); y <= int(math.Floor(pos.Y+r)); y++ {
+			// Closest point of the cell to pos
+			dx := pos.X - math.Max(float64(x), math.Min(pos.X, float64(x+1)))
+			dy := pos.Y - math.Max(float64(y), math.Min(pos.Y, float64(y+1)))
+			if dx*dx+dy*dy > r*r {
+				continue
+			}
+			if t := g.Get(x, y).Type; SurfaceFriction(t) < SurfaceFriction(worst) {
+				if t == CellWall {
+					return t
+				}
+				worst = t
+			}
+		}
+	}
+	return worst
+}
+
+// Hash identifies the track by its classified cells: a hex FNV-1a hash of the grid's size
+// and every cell's type, the same on every run and platform. It doesn't depend on how the
+// image was encoded, only on what it classifies to. It is computed on the first call,
+// so the grid must not change afterwards.
+func (g *Grid) Hash() string {
+	if g.hash != "" {
+		return g.hash
+	}
+	h := fnv.New64a()
+	var size [8]byte
+	binary.LittleEndian.PutUint32(size[:4], uint32(g.Width))
+	binary.LittleEndian.PutUint32(size[4:], uint32(g.Height))
+	h.Write(size[:])
+	// Column by column, as when the grid was stored that way, so hashes stay the same
+	column := make([]byte, g.Height)
+	for x := 0; x < g.Width; x++ {
+		for y := range column {
+			column[y] = byte(g.at(x, y).Type)
+		}
+		h.Write(column)
+	}
+	g.hash = fmt.Sprintf("%016x", h.Sum64())
+	return g.hash
 }
 
 // ColorToCellType maps a pixel color to a cell type.
@@ -82,3 +173,40 @@ func ColorToCellType(c color.Color) CellType {
 
 	return CellTarmac
 }
+
+// Grayscale classification (see GrayToCellType)
+const (
+	DefaultGrayThreshold = 128 // Brightness at and above which a grayscale pixel is tarmac
+	GrayTolerance        = 8   // Channel spread (0-255) still counted as gray, e.g. JPEG chroma noise
+)
+
+// GrayToCellType classifies a pixel of a grayscale image: at or above threshold
+// brightness it's tarmac, below it's wall. Grayscale images carry no markers, so
+// this never yields the color-coded cell types.
+func GrayToCellType(c color.Color, threshold uint8) CellType {
+	if color.GrayModel.Convert(c).(color.Gray).Y >= threshold {
+		return CellTarmac
+	}
+	return CellWall
+}
+
+// IsGrayscale reports whether img is a grayscale image: either stored as one
+// (e.g. the single-channel output of the OpenCV pipeline) or with every pixel's
+// channels within GrayTolerance of each other.
+func IsGrayscale(img image.Image) bool {
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			r8, g8, b8 := r>>8, g>>8, b>>8
+			if max(r8, g8, b8)-min(r8, g8, b8) > GrayTolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
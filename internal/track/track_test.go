@@ -0,0 +1,76 @@
+package track
+
+import (
+	"racing-line-mapper/internal/common"
+	"testing"
+)
+
+// TestSurfaceAt checks the world-point accessors map a point to the cell containing it,
+// flooring rather than truncating, with everything outside the grid a wall.
+func TestSurfaceAt(t *testing.T) {
+	g := NewGrid(4, 4)
+	for x := range g.Width {
+		for y := range g.Height {
+			g.Set(x, y, Cell{Type: CellTarmac, Friction: SurfaceFriction(CellTarmac)})
+		}
+	}
+	g.Set(2, 1, Cell{Type: CellGravel, Friction: SurfaceFriction(CellGravel)})
+
+	for _, tc := range []struct {
+		pos      common.Vec2
+		want     CellType
+		friction float64
+	}{
+		{common.Vec2{X: 0.5, Y: 0.5}, CellTarmac, 1},
+		{common.Vec2{X: 2, Y: 1}, CellGravel, 0.4},
+		{common.Vec2{X: 2.99, Y: 1.99}, CellGravel, 0.4},
+		{common.Vec2{X: 3, Y: 1.5}, CellTarmac, 1},
+		{common.Vec2{X: -0.5, Y: 0.5}, CellWall, 0}, // Truncating would land in column 0
+		{common.Vec2{X: 1, Y: 4}, CellWall, 0},
+	} {
+		if got := g.SurfaceAt(tc.pos); got != tc.want {
+			t.Errorf("SurfaceAt(%v) = %v, want %v", tc.pos, got, tc.want)
+		}
+		if got := g.FrictionAt(tc.pos); got != tc.friction {
+			t.Errorf("FrictionAt(%v) = %v, want %v", tc.pos, got, tc.friction)
+		}
+	}
+}
+
+// TestSurfaceInRadius checks the worst surface under a footprint: gravel outranks
+// tarmac and a wall outranks both, but only for cells that reach within the radius.
+func TestSurfaceInRadius(t *testing.T) {
+	g := NewGrid(10, 10)
+	for x := 1; x < 9; x++ { // Walls around the edge
+		for y := 1; y < 9; y++ {
+			g.Set(x, y, Cell{Type: CellTarmac, Friction: SurfaceFriction(CellTarmac)})
+		}
+	}
+	g.Set(6, 5, Cell{Type: CellGravel, Friction: SurfaceFriction(CellGravel)})
+
+	center := common.Vec2{X: 4.5, Y: 5.5}
+	for _, tc := range []struct {
+		r    float64
+		want CellType
+	}{
+		{0, CellTarmac},
+		{1.4, CellTarmac}, // Gravel cell starts 1.5 to the right
+		{1.6, CellGravel}, // Reaches it
+		{3.4, CellGravel}, // Edge walls are 3.5 away (left) and beyond
+		{3.6, CellWall},   // Reaches the left wall column
+		{-1, CellTarmac},  // Just the point
+	} {
+		if got := g.SurfaceInRadius(center, tc.r); got != tc.want {
+			t.Errorf("SurfaceInRadius(%v, %v) = %v, want %v", center, tc.r, got, tc.want)
+		}
+	}
+
+	// Diagonally: the gravel cell's nearest corner, (6, 5), is about 0.71 from (5.5, 4.5)
+	p := common.Vec2{X: 5.5, Y: 4.5}
+	if got := g.SurfaceInRadius(p, 0.6); got != CellTarmac {
+		t.Errorf("corner 0.71 away counted within 0.6: %v", got)
+	}
+	if got := g.SurfaceInRadius(p, 0.8); got != CellGravel {
+		t.Errorf("corner 0.71 away not counted within 0.8: %v", got)
+	}
+}